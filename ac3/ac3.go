@@ -0,0 +1,178 @@
+// Package ac3 implements reading of metadata from AC-3 (Dolby Digital) and
+// E-AC-3 (Dolby Digital Plus) elementary streams.
+//
+// An elementary stream is a bare sequence of sync frames with nothing to say
+// how many there are, so the duration is estimated from the size of the
+// stream and the bitrate of the first frame.
+package ac3
+
+import (
+	"bufio"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+)
+
+const Magic = "\x0B\x77"
+
+func init() {
+	sound.RegisterFormat("AC-3", Magic, nil, nil, DecodeMeta)
+}
+
+var (
+	ErrUnsynced = errors.New("ac3: missing sync word")
+	ErrReserved = errors.New("ac3: sync frame header has reserved value")
+)
+
+var sampleRates = [3]int{48000, 44100, 32000}
+
+// bitrates are the AC-3 bitrates in kbps, by half the frame size code.
+var bitrates = [19]int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+
+// fullChannels are the number of full bandwidth channels, by audio coding
+// mode.
+var fullChannels = [8]int{2, 1, 2, 3, 3, 4, 4, 5}
+
+// Metadata is the information in the header of the first sync frame.
+type Metadata struct {
+	// Enhanced is whether the stream is E-AC-3 rather than AC-3.
+	Enhanced bool
+	// LFE is whether there is a low frequency effects channel, which is
+	// counted by NumChannels.
+	LFE bool
+	// AudioCodingMode is acmod, the arrangement of the full bandwidth
+	// channels, from 1 for mono to 7 for 3/2 surround. 0 is two
+	// independent mono channels.
+	AudioCodingMode int
+
+	sampleRate int
+	bitRate    int
+	duration   time.Duration
+}
+
+func (m *Metadata) Duration() time.Duration { return m.duration }
+func (m *Metadata) SampleRate() int         { return m.sampleRate }
+func (m *Metadata) BitRate() int            { return m.bitRate }
+func (m *Metadata) DurationExact() bool     { return false }
+
+func (m *Metadata) String() string { return sound.Summary(nil, m) }
+
+func (m *Metadata) NumChannels() int {
+	n := fullChannels[m.AudioCodingMode]
+	if m.LFE {
+		n++
+	}
+	return n
+}
+
+// DecodeMeta decodes the header of the first sync frame, and estimates the
+// duration from fsize, if it is known, and the bitrate. The underlying type
+// of the sound.Metadata returned will be (*Metadata).
+func DecodeMeta(r io.Reader, fsize int64) (sound.Metadata, error) {
+	br := bufio.NewReader(r)
+	// enough for the longest header before lfeon
+	b, err := br.Peek(8)
+	if err != nil {
+		return nil, errors.Wrap(err, "read sync frame header")
+	}
+	if string(b[:2]) != Magic {
+		return nil, ErrUnsynced
+	}
+
+	// bsid is at the same place in both kinds of frame, and tells them apart
+	var m *Metadata
+	if bsid := b[5] >> 3; bsid > 10 {
+		m, err = decodeEnhanced(b)
+	} else {
+		m, err = decodeFrame(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fsize > 0 && m.bitRate > 0 {
+		m.duration = time.Duration(float64(fsize*8) / float64(m.bitRate) * float64(time.Second))
+	}
+	return m, nil
+}
+
+// decodeFrame decodes an AC-3 sync frame header: the sync word, a CRC, the
+// sample rate and frame size codes, and then the bit stream information.
+func decodeFrame(b []byte) (*Metadata, error) {
+	fscod := int(b[4] >> 6)
+	frmsizecod := int(b[4] & 0x3F)
+	if fscod == 3 || frmsizecod/2 >= len(bitrates) {
+		return nil, ErrReserved
+	}
+
+	r := bitReader{b: b[5:]}
+	r.read(5) // bsid
+	r.read(3) // bsmod
+	m := &Metadata{
+		AudioCodingMode: r.read(3),
+		sampleRate:      sampleRates[fscod],
+		bitRate:         bitrates[frmsizecod/2] * 1000,
+	}
+	if m.AudioCodingMode&1 != 0 && m.AudioCodingMode != 1 {
+		r.read(2) // cmixlev
+	}
+	if m.AudioCodingMode&4 != 0 {
+		r.read(2) // surmixlev
+	}
+	if m.AudioCodingMode == 2 {
+		r.read(2) // dsurmod
+	}
+	m.LFE = r.read(1) == 1
+	return m, nil
+}
+
+// decodeEnhanced decodes an E-AC-3 sync frame header, which gives the frame
+// size directly, so the bitrate follows from it and the number of samples in
+// the frame.
+func decodeEnhanced(b []byte) (*Metadata, error) {
+	r := bitReader{b: b[2:]}
+	r.read(2) // strmtyp
+	r.read(3) // substreamid
+	frameSize := (r.read(11) + 1) * 2
+
+	var (
+		fscod  = r.read(2)
+		blocks = 6
+		m      = &Metadata{Enhanced: true}
+	)
+	if fscod == 3 {
+		fscod2 := r.read(2)
+		if fscod2 == 3 {
+			return nil, ErrReserved
+		}
+		m.sampleRate = sampleRates[fscod2] / 2
+	} else {
+		m.sampleRate = sampleRates[fscod]
+		blocks = [4]int{1, 2, 3, 6}[r.read(2)]
+	}
+	m.AudioCodingMode = r.read(3)
+	m.LFE = r.read(1) == 1
+
+	// each audio block is 256 samples
+	m.bitRate = frameSize * 8 * m.sampleRate / (blocks * 256)
+	return m, nil
+}
+
+// bitReader reads big endian bit fields out of a header.
+type bitReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *bitReader) read(n int) int {
+	var v int
+	for i := 0; i < n; i++ {
+		bit := r.b[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | int(bit)
+		r.pos++
+	}
+	return v
+}
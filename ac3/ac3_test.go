@@ -0,0 +1,39 @@
+package ac3
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDecodeMeta(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		channels int
+		rate     int
+		bitrate  int
+	}{
+		// 48 kHz, 448 kbps, bsid 8, 3/2 with LFE
+		{"AC-3", "\x0b\x77\x00\x00\x1e\x40\xe1\x00", 6, 48000, 448000},
+		// 44.1 kHz, 192 kbps, stereo without LFE
+		{"AC-3 stereo", "\x0b\x77\x00\x00\x54\x40\x40\x00", 2, 44100, 192000},
+		// 48 kHz, 6 blocks, frame size 1536 bytes, 3/2 with LFE, bsid 16
+		{"E-AC-3", "\x0b\x77\x02\xff\x3f\x80\x00\x00", 6, 48000, 384000},
+	}
+
+	for _, test := range tests {
+		fsize := int64(test.bitrate / 8 * 2)
+		m, err := DecodeMeta(bytes.NewReader([]byte(test.header)), fsize)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if m.NumChannels() != test.channels || m.SampleRate() != test.rate || m.BitRate() != test.bitrate {
+			t.Errorf("%s: got %d channels, %d Hz, %d bps", test.name, m.NumChannels(), m.SampleRate(), m.BitRate())
+		}
+		if m.Duration() != 2*time.Second {
+			t.Errorf("%s: got %v", test.name, m.Duration())
+		}
+	}
+}
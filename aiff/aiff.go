@@ -0,0 +1,295 @@
+// Package aiff implements reading of metadata from AIFF and AIFF-C files.
+//
+// An AIFF file is an IFF container: a "FORM" header with the form type "AIFF"
+// or "AIFC", followed by a sequence of chunks, each with a 4-byte ID, a 32-bit
+// big endian size, and the data, padded to an even number of bytes. The
+// "COMM" chunk describes the audio and the "SSND" chunk holds it.
+//
+// AIFF-C adds a compression type to the COMM chunk. Despite the name, some of
+// the types are plain PCM, most commonly "sowt", which is little endian PCM
+// in an otherwise big endian file.
+package aiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+)
+
+const (
+	Magic  = "FORM????AIFF"
+	MagicC = "FORM????AIFC"
+)
+
+func init() {
+	sound.RegisterFormat("AIFF", Magic, nil, nil, DecodeMeta)
+	sound.RegisterFormat("AIFF-C", MagicC, nil, nil, DecodeMeta)
+}
+
+var (
+	ErrBadHeader = errors.New("aiff: malformed FORM header")
+	ErrNoCommon  = errors.New("aiff: missing COMM chunk")
+	ErrBadChunk  = errors.New("aiff: chunk extends past the end of the FORM")
+)
+
+type chunkHeader struct {
+	ID   [4]byte
+	Size uint32
+}
+
+type formHeader struct {
+	Magic [4]byte
+	Size  uint32
+	Form  [4]byte
+}
+
+// Common is the contents of the "COMM" chunk.
+type Common struct {
+	NumChannels     int16
+	NumSampleFrames uint32
+	SampleSize      int16
+	// SampleRate is an 80-bit IEEE 754 extended precision number.
+	SampleRate [10]byte
+}
+
+// Compression types of AIFF-C. Plain AIFF files are reported as
+// CompressionNone.
+const (
+	CompressionNone = "NONE"
+	// CompressionSowt is PCM in little endian byte order.
+	CompressionSowt = "sowt"
+	// CompressionTwos is PCM in big endian byte order, as in AIFF.
+	CompressionTwos = "twos"
+	CompressionALaw = "alaw"
+	CompressionULaw = "ulaw"
+)
+
+// losslessTypes are the compression types that hold PCM or floating point
+// samples.
+var losslessTypes = map[string]bool{
+	CompressionNone: true,
+	CompressionSowt: true,
+	CompressionTwos: true,
+	"raw ":          true,
+	"in24":          true,
+	"in32":          true,
+	"fl32":          true,
+	"FL32":          true,
+	"fl64":          true,
+	"FL64":          true,
+}
+
+// Metadata is the information gathered from the chunks of an AIFF file.
+type Metadata struct {
+	Common
+	DataSize int64
+
+	compression     string
+	compressionName string
+}
+
+func (m *Metadata) Duration() time.Duration {
+	rate := m.sampleRate()
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(m.NumSampleFrames) / rate * float64(time.Second))
+}
+
+func (m *Metadata) NumChannels() int    { return int(m.Common.NumChannels) }
+func (m *Metadata) SampleRate() int     { return int(m.sampleRate()) }
+func (m *Metadata) TotalSamples() int64 { return int64(m.NumSampleFrames) }
+func (m *Metadata) DurationExact() bool { return true }
+
+func (m *Metadata) String() string { return sound.Summary(nil, m) }
+
+// BitRate is exact for PCM, and averaged over the sound data otherwise.
+func (m *Metadata) BitRate() int {
+	if m.Lossless() && m.compression != "raw " {
+		return m.SampleRate() * m.NumChannels() * int(m.SampleSize)
+	}
+	if d := m.Duration(); d > 0 {
+		return int(float64(m.DataSize*8) / d.Seconds())
+	}
+	return 0
+}
+
+// Compression returns the compression type of an AIFF-C file, such as "sowt"
+// or "ulaw", or "NONE" for plain AIFF.
+func (m *Metadata) Compression() string { return m.compression }
+
+// CompressionName returns the description of the compression type that
+// AIFF-C files carry, such as "Signed integer (little-endian) linear PCM", or
+// "" if there is none.
+func (m *Metadata) CompressionName() string { return m.compressionName }
+
+// Lossless reports whether the audio is PCM or floating point rather than
+// compressed.
+func (m *Metadata) Lossless() bool { return losslessTypes[m.compression] }
+
+// LittleEndian reports whether the samples are little endian, which is the
+// case for "sowt" even though the rest of the file is big endian.
+func (m *Metadata) LittleEndian() bool { return m.compression == CompressionSowt }
+
+// sampleRate decodes the 80-bit extended precision sample rate: a sign bit and
+// 15-bit exponent biased by 16383, followed by a 64-bit mantissa with an
+// explicit integer bit.
+func (m *Metadata) sampleRate() float64 {
+	b := m.Common.SampleRate
+	exp := int(binary.BigEndian.Uint16(b[:2]) & 0x7fff)
+	mant := binary.BigEndian.Uint64(b[2:])
+	if exp == 0 && mant == 0 {
+		return 0
+	}
+	return math.Ldexp(float64(mant), exp-16383-63)
+}
+
+// DecodeMeta decodes the COMM chunk and finds the size of the sound data.
+// The underlying type of the sound.Metadata returned will be (*Metadata).
+func DecodeMeta(r io.Reader, fsize int64) (sound.Metadata, error) {
+	m, err := decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func decode(rr io.Reader) (*Metadata, error) {
+	r := ensureBufioReader(rr)
+
+	// If rr can seek, the sound data is seeked past rather than read.
+	var (
+		seeker io.Seeker
+		start  int64
+	)
+	if s, ok := rr.(io.Seeker); ok && rr != io.Reader(r) {
+		pos, err := s.Seek(0, os.SEEK_CUR)
+		if err == nil {
+			seeker, start = s, pos
+		}
+	}
+
+	var h formHeader
+	err := binary.Read(r, binary.BigEndian, &h)
+	if err != nil {
+		return nil, errors.Wrap(err, "read FORM header")
+	}
+	form := string(h.Form[:])
+	if string(h.Magic[:]) != "FORM" || (form != "AIFF" && form != "AIFC") {
+		return nil, ErrBadHeader
+	}
+
+	var (
+		m          = Metadata{compression: CompressionNone}
+		haveCommon bool
+		// offsets of the next chunk and the end of the form
+		pos = int64(binary.Size(h))
+		end = 8 + int64(h.Size)
+	)
+	for pos < end {
+		var ch chunkHeader
+		err = binary.Read(r, binary.BigEndian, &ch)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "read chunk header")
+		}
+		next := pos + int64(binary.Size(ch)) + int64(ch.Size) + int64(ch.Size%2)
+		if next > end+int64(ch.Size%2) {
+			return nil, ErrBadChunk
+		}
+		pos = next
+
+		body := &io.LimitedReader{R: r, N: int64(ch.Size)}
+
+		switch string(ch.ID[:]) {
+		case "COMM":
+			err = readCommon(body, &m, form == "AIFC")
+			haveCommon = true
+
+		case "SSND":
+			// the sound data is preceded by its offset and block size
+			m.DataSize = int64(ch.Size) - 8
+			if m.DataSize < 0 {
+				m.DataSize = 0
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// skip whatever wasn't read, plus the pad byte for odd sizes
+		if ch.Size%2 != 0 {
+			body.N++
+		}
+		if seeker != nil && body.N > int64(r.Buffered()) {
+			_, err = seeker.Seek(start+pos, os.SEEK_SET)
+			if err != nil {
+				return nil, err
+			}
+			r.Reset(rr)
+			continue
+		}
+		_, err = io.Copy(ioutil.Discard, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !haveCommon {
+		return nil, ErrNoCommon
+	}
+	return &m, nil
+}
+
+// readCommon reads the COMM chunk, which in AIFF-C goes on with the
+// compression type and a Pascal string naming it.
+func readCommon(r io.Reader, m *Metadata, aifc bool) error {
+	err := binary.Read(r, binary.BigEndian, &m.Common)
+	if err != nil {
+		return err
+	}
+	if !aifc {
+		return nil
+	}
+
+	var compression [4]byte
+	_, err = io.ReadFull(r, compression[:])
+	if err != nil {
+		return err
+	}
+	m.compression = string(compression[:])
+
+	var n [1]byte
+	_, err = io.ReadFull(r, n[:])
+	if err == io.EOF {
+		// some writers leave the name out
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	name := make([]byte, n[0])
+	_, err = io.ReadFull(r, name)
+	if err != nil {
+		return err
+	}
+	m.compressionName = string(name)
+	return nil
+}
+
+func ensureBufioReader(r io.Reader) *bufio.Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
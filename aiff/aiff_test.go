@@ -0,0 +1,80 @@
+package aiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/fixture"
+)
+
+func TestCompression(t *testing.T) {
+	// 2 channels of 16 bits at 44.1 kHz, one second long
+	common := "\x00\x02\x00\x00\xac\x44\x00\x10" + "\x40\x0e\xac\x44\x00\x00\x00\x00\x00\x00"
+	sound4 := fixture.AIFFChunk("SSND", "\x00\x00\x00\x00\x00\x00\x00\x00\x01\x02\x03\x04")
+
+	tests := []struct {
+		file        []byte
+		compression string
+		lossless    bool
+		le          bool
+	}{
+		{fixture.AIFFForm("AIFF", fixture.AIFFChunk("COMM", common), sound4), "NONE", true, false},
+		{fixture.AIFFForm("AIFC", fixture.AIFFChunk("FVER", "\xa2\x80\x51\x40"), fixture.AIFFChunk("COMM", common+"sowt\x03abc"), sound4), "sowt", true, true},
+		{fixture.AIFFForm("AIFC", fixture.AIFFChunk("COMM", common+"ulaw\x00"), sound4), "ulaw", false, false},
+	}
+	for _, test := range tests {
+		sm, _, err := sound.DecodeMeta(bytes.NewReader(test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := sm.(*Metadata)
+		if m.Compression() != test.compression || m.Lossless() != test.lossless || m.LittleEndian() != test.le {
+			t.Errorf("got %q, lossless %t, little endian %t; expected %q", m.Compression(), m.Lossless(), m.LittleEndian(), test.compression)
+		}
+		if m.SampleRate() != 44100 || m.NumChannels() != 2 || m.Duration() != time.Second || m.DataSize != 4 {
+			t.Errorf("%s: got %d Hz, %d channels, %v, %d bytes", test.compression, m.SampleRate(), m.NumChannels(), m.Duration(), m.DataSize)
+		}
+	}
+}
+
+func TestSkipSoundData(t *testing.T) {
+	common := "\x00\x02\x00\x00\xac\x44\x00\x10" + "\x40\x0e\xac\x44\x00\x00\x00\x00\x00\x00"
+	data := string(make([]byte, 8+1<<20))
+	file := fixture.AIFFForm("AIFF", fixture.AIFFChunk("SSND", data), fixture.AIFFChunk("COMM", common))
+
+	r := fixture.NewCountingReadSeeker(file)
+	sm, _, err := sound.DecodeMeta(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := sm.(*Metadata); m.DataSize != 1<<20 || m.Duration() != time.Second {
+		t.Errorf("got %d bytes, %v", m.DataSize, m.Duration())
+	}
+	if r.N > 64<<10 {
+		t.Errorf("read %d bytes of %d", r.N, len(file))
+	}
+}
+
+func TestChunkPastForm(t *testing.T) {
+	common := "\x00\x02\x00\x00\xac\x44\x00\x10" + "\x40\x0e\xac\x44\x00\x00\x00\x00\x00\x00"
+	file := fixture.AIFFForm("AIFF", fixture.AIFFChunk("COMM", common), fixture.AIFFChunk("SSND", "\x00\x00\x00\x00\x00\x00\x00\x00\x01\x02"))
+	// cut the form short in the middle of the SSND chunk
+	binary.BigEndian.PutUint32(file[4:], uint32(len(file)-8-4))
+
+	_, err := DecodeMeta(bytes.NewReader(file), 0)
+	if err != ErrBadChunk {
+		t.Errorf("got %v, expected ErrBadChunk", err)
+	}
+}
+
+func TestTruncatedHeader(t *testing.T) {
+	_, err := DecodeMeta(bytes.NewReader([]byte("FORM\x00\x00")), 0)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, expected io.ErrUnexpectedEOF", err)
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"ktkr.us/pkg/sound"
 	_ "ktkr.us/pkg/sound/mp3"
 	_ "ktkr.us/pkg/sound/ogg"
-	// _ "ktkr.us/pkg/sound/wave"
+	_ "ktkr.us/pkg/sound/wave"
 )
 
 func main() {
@@ -0,0 +1,185 @@
+package sound
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoCuesheet is returned by Cuesheeters that don't hold a cue sheet.
+	ErrNoCuesheet  = errors.New("sound: no cue sheet present")
+	ErrBadCuesheet = errors.New("sound: malformed cue sheet")
+)
+
+// Cuesheet is the table of contents of a recording of a whole disc, such as
+// a CD image ripped to a single file, which lays out where each track starts.
+type Cuesheet struct {
+	// Catalog is the media catalog number (the UPC/EAN of the disc).
+	Catalog   string
+	Performer string
+	Title     string
+	Tracks    []CueTrack
+}
+
+// CueTrack is one track of a Cuesheet.
+type CueTrack struct {
+	Number    int
+	Performer string
+	Title     string
+	ISRC      string
+	// Indexes are the index points of the track in order. Index 1 is the
+	// start of the track, and index 0, if there is one, is the start of the
+	// pregap before it.
+	Indexes []CueIndex
+}
+
+// CueIndex is an index point within a CueTrack.
+type CueIndex struct {
+	Number int
+	// Offset is the time of the index point from the start of the file.
+	Offset time.Duration
+}
+
+// Start returns the offset of index 1, where the track itself starts, or of
+// the first index if there is no index 1.
+func (t *CueTrack) Start() time.Duration {
+	for _, x := range t.Indexes {
+		if x.Number == 1 {
+			return x.Offset
+		}
+	}
+	if len(t.Indexes) > 0 {
+		return t.Indexes[0].Offset
+	}
+	return 0
+}
+
+// Cuesheeter is implemented by values that can hold a cue sheet. Cuesheet
+// returns ErrNoCuesheet if there isn't one.
+type Cuesheeter interface {
+	Cuesheet() (*Cuesheet, error)
+}
+
+// cueFramesPerSecond is the number of CD frames in a second, which the
+// mm:ss:ff times of a cue sheet count in.
+const cueFramesPerSecond = 75
+
+// ParseCuesheet parses a cue sheet in the usual text format, as written by CD
+// rippers. Commands that don't bear on the layout of the tracks, such as FILE,
+// REM and FLAGS, are skipped.
+func ParseCuesheet(r io.Reader) (*Cuesheet, error) {
+	var (
+		c     = new(Cuesheet)
+		track *CueTrack
+		s     = bufio.NewScanner(r)
+	)
+	for s.Scan() {
+		args := cueFields(s.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		switch cmd := strings.ToUpper(args[0]); cmd {
+		case "CATALOG", "PERFORMER", "TITLE", "ISRC":
+			if len(args) < 2 {
+				return nil, ErrBadCuesheet
+			}
+			// PERFORMER and TITLE belong to the disc until the first TRACK
+			switch {
+			case cmd == "CATALOG":
+				c.Catalog = args[1]
+			case track == nil && cmd == "PERFORMER":
+				c.Performer = args[1]
+			case track == nil && cmd == "TITLE":
+				c.Title = args[1]
+			case cmd == "PERFORMER":
+				track.Performer = args[1]
+			case cmd == "TITLE":
+				track.Title = args[1]
+			case cmd == "ISRC" && track != nil:
+				track.ISRC = args[1]
+			}
+
+		case "TRACK":
+			if len(args) < 2 {
+				return nil, ErrBadCuesheet
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return nil, ErrBadCuesheet
+			}
+			c.Tracks = append(c.Tracks, CueTrack{Number: n})
+			track = &c.Tracks[len(c.Tracks)-1]
+
+		case "INDEX":
+			if len(args) < 3 || track == nil {
+				return nil, ErrBadCuesheet
+			}
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return nil, ErrBadCuesheet
+			}
+			offset, err := parseCueTime(args[2])
+			if err != nil {
+				return nil, err
+			}
+			track.Indexes = append(track.Indexes, CueIndex{n, offset})
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.Tracks) == 0 {
+		return nil, ErrBadCuesheet
+	}
+	return c, nil
+}
+
+// cueFields splits a line of a cue sheet into words, keeping quoted strings
+// together without their quotes.
+func cueFields(line string) []string {
+	var fields []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		var field string
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				field, line = line[1:], ""
+			} else {
+				field, line = line[1:end+1], line[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			field, line = line[:end], line[end:]
+		}
+		fields = append(fields, field)
+		line = strings.TrimLeft(line, " \t")
+	}
+	return fields
+}
+
+// parseCueTime parses a time in minutes, seconds and frames, as in "03:25:62".
+func parseCueTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, ErrBadCuesheet
+	}
+	var n [3]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return 0, ErrBadCuesheet
+		}
+		n[i] = v
+	}
+	frames := (n[0]*60+n[1])*cueFramesPerSecond + n[2]
+	return time.Duration(frames) * time.Second / cueFramesPerSecond, nil
+}
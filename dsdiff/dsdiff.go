@@ -0,0 +1,500 @@
+// Package dsdiff implements reading of metadata from DSDIFF (.dff) files.
+//
+// A DSDIFF file is an IFF container much like AIFF, except that sizes are 64
+// bits: a "FRM8" header with the form type "DSD ", followed by a sequence of
+// chunks, each with a 4-byte ID, a 64-bit big endian size, and the data,
+// padded to an even number of bytes. The "PROP" chunk, of property type
+// "SND ", holds subchunks describing the audio, and the "DSD " chunk holds it,
+// or the "DST " chunk if it is DST compressed.
+//
+// Tags are carried by the "DIIN" chunk, which holds the artist and title of
+// the edited master, and the "COMT" chunk, which holds comments.
+package dsdiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+)
+
+const Magic = "FRM8????????DSD "
+
+func init() {
+	sound.RegisterFormat("DSDIFF", Magic, nil, DecodeTags, DecodeMeta)
+}
+
+var (
+	ErrBadHeader = errors.New("dsdiff: malformed FRM8 header")
+	ErrNoProp    = errors.New("dsdiff: missing PROP chunk")
+	ErrBadChunk  = errors.New("dsdiff: chunk extends past the end of the FRM8")
+)
+
+// Compression types, as in the "CMPR" property.
+const (
+	CompressionDSD = "DSD "
+	CompressionDST = "DST "
+)
+
+type chunkHeader struct {
+	ID   [4]byte
+	Size uint64
+}
+
+type formHeader struct {
+	Magic [4]byte
+	Size  uint64
+	Form  [4]byte
+}
+
+// Metadata is the information gathered from the chunks of a DSDIFF file.
+type Metadata struct {
+	// ChannelIDs are the IDs of the channels in the order they are stored,
+	// such as "SLFT" and "SRGT".
+	ChannelIDs []string
+	// DataSize is the size of the sound data in bytes, compressed or not.
+	DataSize int64
+	// NumFrames and FrameRate are the number of DST frames, and how many
+	// of them make a second, or 0 if the audio isn't DST compressed.
+	NumFrames int64
+	FrameRate int
+
+	*Tags
+
+	sampleRate  int
+	compression string
+}
+
+func (m *Metadata) NumChannels() int    { return len(m.ChannelIDs) }
+func (m *Metadata) SampleRate() int     { return m.sampleRate }
+func (m *Metadata) DurationExact() bool { return true }
+
+func (m *Metadata) String() string {
+	if m.Tags == nil {
+		return sound.Summary(nil, m)
+	}
+	return sound.Summary(m.Tags, m)
+}
+
+// Compression returns the compression type, "DSD " for plain DSD or "DST "
+// for DST.
+func (m *Metadata) Compression() string { return m.compression }
+
+// Lossless is always true: DST compression is lossless.
+func (m *Metadata) Lossless() bool { return true }
+
+// TotalSamples returns the number of 1-bit samples in each channel.
+func (m *Metadata) TotalSamples() int64 {
+	if m.compression == CompressionDST {
+		if m.FrameRate == 0 {
+			return 0
+		}
+		return m.NumFrames * int64(m.sampleRate) / int64(m.FrameRate)
+	}
+	if len(m.ChannelIDs) == 0 {
+		return 0
+	}
+	return m.DataSize * 8 / int64(len(m.ChannelIDs))
+}
+
+func (m *Metadata) Duration() time.Duration {
+	if m.compression == CompressionDST {
+		if m.FrameRate == 0 {
+			return 0
+		}
+		return time.Duration(float64(m.NumFrames) / float64(m.FrameRate) * float64(time.Second))
+	}
+	if m.sampleRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(m.TotalSamples()) / float64(m.sampleRate) * float64(time.Second))
+}
+
+// BitRate is exact for plain DSD, and averaged over the sound data for DST.
+func (m *Metadata) BitRate() int {
+	if m.compression != CompressionDST {
+		return m.sampleRate * len(m.ChannelIDs)
+	}
+	if d := m.Duration(); d > 0 {
+		return int(float64(m.DataSize*8) / d.Seconds())
+	}
+	return 0
+}
+
+// DecodeMeta decodes the properties and finds the size of the sound data.
+// The underlying type of the sound.Metadata returned will be (*Metadata).
+func DecodeMeta(r io.Reader, fsize int64) (sound.Metadata, error) {
+	m, err := decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DecodeTags decodes the DIIN and COMT chunks. If there are neither, it
+// returns sound.ErrNoTags. The underlying type of the sound.Tags returned
+// will be (*Tags).
+func DecodeTags(r io.Reader) (sound.Tags, error) {
+	m, err := decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if m.Tags == nil {
+		return nil, sound.ErrNoTags
+	}
+	return m.Tags, nil
+}
+
+func decode(rr io.Reader) (*Metadata, error) {
+	r := ensureBufioReader(rr)
+
+	// If rr can seek, the sound data is seeked past rather than read.
+	var (
+		seeker io.Seeker
+		start  int64
+	)
+	if s, ok := rr.(io.Seeker); ok && rr != io.Reader(r) {
+		pos, err := s.Seek(0, os.SEEK_CUR)
+		if err == nil {
+			seeker, start = s, pos
+		}
+	}
+
+	var h formHeader
+	err := binary.Read(r, binary.BigEndian, &h)
+	if err != nil {
+		return nil, errors.Wrap(err, "read FRM8 header")
+	}
+	if string(h.Magic[:]) != "FRM8" || string(h.Form[:]) != "DSD " || h.Size > math.MaxInt64-12 {
+		return nil, ErrBadHeader
+	}
+
+	var (
+		m        = Metadata{compression: CompressionDSD}
+		haveProp bool
+		// offsets of the next chunk and the end of the form
+		pos = int64(binary.Size(h))
+		end = 12 + int64(h.Size)
+	)
+	for pos < end {
+		var ch chunkHeader
+		err = binary.Read(r, binary.BigEndian, &ch)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "read chunk header")
+		}
+		// compared before converting, as the size can be anything up to
+		// 1<<64-1
+		pos += int64(binary.Size(ch))
+		if pos > end || ch.Size > uint64(end-pos) {
+			return nil, ErrBadChunk
+		}
+		pos += int64(ch.Size) + int64(ch.Size%2)
+
+		body := &io.LimitedReader{R: r, N: int64(ch.Size)}
+
+		switch string(ch.ID[:]) {
+		case "PROP":
+			var ok bool
+			ok, err = readProp(body, &m)
+			haveProp = haveProp || ok
+
+		case "DSD ":
+			m.DataSize = int64(ch.Size)
+
+		case "DST ":
+			m.DataSize = int64(ch.Size)
+			err = readDST(body, &m)
+
+		case "DIIN":
+			err = readDIIN(body, m.tags())
+
+		case "COMT":
+			err = readComments(body, m.tags())
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// skip whatever wasn't read, plus the pad byte for odd sizes
+		if ch.Size%2 != 0 {
+			body.N++
+		}
+		if seeker != nil && body.N > int64(r.Buffered()) {
+			_, err = seeker.Seek(start+pos, os.SEEK_SET)
+			if err != nil {
+				return nil, err
+			}
+			r.Reset(rr)
+			continue
+		}
+		_, err = io.Copy(ioutil.Discard, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !haveProp {
+		return nil, ErrNoProp
+	}
+	return &m, nil
+}
+
+// tags returns m's tags, creating them if there aren't any yet.
+func (m *Metadata) tags() *Tags {
+	if m.Tags == nil {
+		m.Tags = new(Tags)
+	}
+	return m.Tags
+}
+
+// readProp reads the subchunks of a PROP chunk. It reports false if the
+// property type isn't "SND ", which is the only one defined.
+func readProp(r io.Reader, m *Metadata) (bool, error) {
+	var propType [4]byte
+	_, err := io.ReadFull(r, propType[:])
+	if err != nil {
+		return false, err
+	}
+	if string(propType[:]) != "SND " {
+		return false, nil
+	}
+
+	err = readSubchunks(r, func(id string, body io.Reader) error {
+		switch id {
+		case "FS  ":
+			var rate uint32
+			err := binary.Read(body, binary.BigEndian, &rate)
+			m.sampleRate = int(rate)
+			return err
+
+		case "CHNL":
+			var n uint16
+			err := binary.Read(body, binary.BigEndian, &n)
+			if err != nil {
+				return err
+			}
+			m.ChannelIDs = make([]string, n)
+			for i := range m.ChannelIDs {
+				var id [4]byte
+				_, err = io.ReadFull(body, id[:])
+				if err != nil {
+					return err
+				}
+				m.ChannelIDs[i] = string(id[:])
+			}
+
+		case "CMPR":
+			var compression [4]byte
+			_, err := io.ReadFull(body, compression[:])
+			m.compression = string(compression[:])
+			return err
+		}
+		return nil
+	})
+	return true, err
+}
+
+// readDST reads the FRTE subchunk of a DST chunk, which comes before the
+// frames.
+func readDST(r io.Reader, m *Metadata) error {
+	return readSubchunks(r, func(id string, body io.Reader) error {
+		if id != "FRTE" {
+			return nil
+		}
+		var frte struct {
+			NumFrames uint32
+			FrameRate uint16
+		}
+		err := binary.Read(body, binary.BigEndian, &frte)
+		if err != nil {
+			return err
+		}
+		m.NumFrames = int64(frte.NumFrames)
+		m.FrameRate = int(frte.FrameRate)
+		return io.EOF
+	})
+}
+
+// readDIIN reads the edited master information: the artist and title, each a
+// 32-bit length and the text.
+func readDIIN(r io.Reader, t *Tags) error {
+	return readSubchunks(r, func(id string, body io.Reader) error {
+		switch id {
+		case "DIAR":
+			s, err := readText(body)
+			t.artist = s
+			return err
+
+		case "DITI":
+			s, err := readText(body)
+			t.title = s
+			return err
+		}
+		return nil
+	})
+}
+
+// readSubchunks calls fn with the ID and body of each chunk in r, skipping
+// what fn doesn't read. It stops early without error if fn returns io.EOF.
+func readSubchunks(r io.Reader, fn func(id string, body io.Reader) error) error {
+	for {
+		var ch chunkHeader
+		err := binary.Read(r, binary.BigEndian, &ch)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		body := &io.LimitedReader{R: r, N: int64(ch.Size)}
+		err = fn(string(ch.ID[:]), body)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if ch.Size%2 != 0 {
+			body.N++
+		}
+		_, err = io.Copy(ioutil.Discard, body)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readText reads a 32-bit length and that much text.
+func readText(r io.Reader) (string, error) {
+	var n uint32
+	err := binary.Read(r, binary.BigEndian, &n)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	_, err = io.CopyN(&b, r, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return strings.TrimRight(b.String(), "\x00"), err
+}
+
+// Comment types, as in the "COMT" chunk.
+const (
+	CommentGeneral = iota
+	CommentChannel
+	CommentSoundSource
+	CommentFileHistory
+)
+
+// Comment is one comment from the COMT chunk.
+type Comment struct {
+	// Time is when the comment was made, to the minute, or the zero time if
+	// it isn't set.
+	Time time.Time
+	// Type is one of the Comment constants, and Ref further qualifies it:
+	// for a channel comment it is the channel number, and for the others
+	// it is a type of source or history entry defined by the spec.
+	Type int
+	Ref  int
+	Text string
+}
+
+type commentHeader struct {
+	Year   uint16
+	Month  uint8
+	Day    uint8
+	Hour   uint8
+	Minute uint8
+	Type   uint16
+	Ref    uint16
+	Count  uint32
+}
+
+// readComments reads the comments of a COMT chunk, each of which is padded
+// to an even number of bytes.
+func readComments(r io.Reader, t *Tags) error {
+	var n uint16
+	err := binary.Read(r, binary.BigEndian, &n)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < int(n); i++ {
+		var h commentHeader
+		err = binary.Read(r, binary.BigEndian, &h)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		_, err = io.CopyN(&b, r, int64(h.Count)+int64(h.Count%2))
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		c := Comment{
+			Type: int(h.Type),
+			Ref:  int(h.Ref),
+			Text: strings.TrimRight(b.String()[:h.Count], "\x00"),
+		}
+		if h.Year != 0 {
+			c.Time = time.Date(int(h.Year), time.Month(h.Month), int(h.Day), int(h.Hour), int(h.Minute), 0, 0, time.UTC)
+		}
+		t.Comments = append(t.Comments, c)
+	}
+	return nil
+}
+
+// Tags holds the edited master information and comments of a DSDIFF file.
+// There are no fields for most of sound.Tags, whose methods return "" or 0.
+type Tags struct {
+	Comments []Comment
+
+	artist string
+	title  string
+}
+
+func (t *Tags) String() string      { return sound.Summary(t, nil) }
+func (t *Tags) TagFormat() string   { return "DSDIFF" }
+func (t *Tags) Title() string       { return t.title }
+func (t *Tags) AlbumArtist() string { return t.artist }
+func (t *Tags) Artist() string      { return t.artist }
+func (t *Tags) Album() string       { return "" }
+func (t *Tags) Genre() string       { return "" }
+func (t *Tags) Disc() int           { return 0 }
+func (t *Tags) Track() int          { return 0 }
+func (t *Tags) Date() time.Time     { return time.Time{} }
+func (t *Tags) Composer() string    { return "" }
+
+// Notes returns the text of the general comments, one per line.
+func (t *Tags) Notes() string {
+	var notes []string
+	for _, c := range t.Comments {
+		if c.Type == CommentGeneral {
+			notes = append(notes, c.Text)
+		}
+	}
+	return strings.Join(notes, "\n")
+}
+
+func ensureBufioReader(r io.Reader) *bufio.Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
@@ -0,0 +1,120 @@
+package dsdiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/fixture"
+)
+
+func TestDecode(t *testing.T) {
+	// DSD64 stereo, a quarter of a second long
+	prop := fixture.DSDIFFChunk("PROP", "SND ",
+		fixture.DSDIFFChunk("FS  ", "\x00\x2b\x11\x00"),
+		fixture.DSDIFFChunk("CHNL", "\x00\x02SLFTSRGT"),
+		fixture.DSDIFFChunk("CMPR", "DSD \x0enot compressed\x00"))
+	diin := fixture.DSDIFFChunk("DIIN",
+		fixture.DSDIFFChunk("DIAR", "\x00\x00\x00\x06artist"),
+		fixture.DSDIFFChunk("DITI", "\x00\x00\x00\x05title"))
+	comt := fixture.DSDIFFChunk("COMT", "\x00\x02"+
+		"\x07\xe4\x05\x11\x0c\x22\x00\x00\x00\x00\x00\x00\x00\x05hello\x00"+
+		"\x00\x00\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00\x00\x02ok")
+	data := bytes.Repeat([]byte{0x69}, 2822400/8/4*2)
+
+	file := fixture.DSDIFFForm(fixture.DSDIFFChunk("FVER", "\x01\x05\x00\x00"), prop, diin, fixture.DSDIFFChunk("DSD ", string(data)), comt)
+
+	sm, name, err := sound.DecodeMeta(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "DSDIFF" {
+		t.Errorf("got format %q", name)
+	}
+	m := sm.(*Metadata)
+	if m.SampleRate() != 2822400 || m.NumChannels() != 2 || m.Duration() != 250*time.Millisecond || m.BitRate() != 5644800 {
+		t.Errorf("got %d Hz, %d channels, %v, %d bps", m.SampleRate(), m.NumChannels(), m.Duration(), m.BitRate())
+	}
+	if m.Compression() != CompressionDSD || m.ChannelIDs[1] != "SRGT" {
+		t.Errorf("got compression %q, channels %q", m.Compression(), m.ChannelIDs)
+	}
+
+	tags, _, err := sound.DecodeTags(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Artist() != "artist" || tags.Title() != "title" || tags.Notes() != "hello" {
+		t.Errorf("got artist %q, title %q, notes %q", tags.Artist(), tags.Title(), tags.Notes())
+	}
+	comments := tags.(*Tags).Comments
+	if len(comments) != 2 {
+		t.Fatalf("got %d comments, expected 2", len(comments))
+	}
+	if want := time.Date(2020, 5, 17, 12, 34, 0, 0, time.UTC); !comments[0].Time.Equal(want) {
+		t.Errorf("got time %v, expected %v", comments[0].Time, want)
+	}
+	if c := comments[1]; c.Type != CommentFileHistory || c.Text != "ok" || !c.Time.IsZero() {
+		t.Errorf("got %+v", c)
+	}
+}
+
+func TestDST(t *testing.T) {
+	prop := fixture.DSDIFFChunk("PROP", "SND ",
+		fixture.DSDIFFChunk("FS  ", "\x00\x2b\x11\x00"),
+		fixture.DSDIFFChunk("CHNL", "\x00\x01C   "),
+		fixture.DSDIFFChunk("CMPR", "DST \x0eDST Encoded  \x00"))
+	// 150 frames at 75 per second
+	dst := fixture.DSDIFFChunk("DST ", fixture.DSDIFFChunk("FRTE", "\x00\x00\x00\x96\x00\x4b"), fixture.DSDIFFChunk("DSTF", "\x01\x02\x03"))
+
+	sm, err := DecodeMeta(bytes.NewReader(fixture.DSDIFFForm(prop, dst)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := sm.(*Metadata)
+	if m.Compression() != CompressionDST || m.Duration() != 2*time.Second || m.TotalSamples() != 2*2822400 {
+		t.Errorf("got %q, %v, %d samples", m.Compression(), m.Duration(), m.TotalSamples())
+	}
+
+	_, err = DecodeTags(bytes.NewReader(fixture.DSDIFFForm(prop, dst)))
+	if err != sound.ErrNoTags {
+		t.Errorf("got %v, expected sound.ErrNoTags", err)
+	}
+}
+
+func TestSkipSoundData(t *testing.T) {
+	prop := fixture.DSDIFFChunk("PROP", "SND ",
+		fixture.DSDIFFChunk("FS  ", "\x00\x2b\x11\x00"),
+		fixture.DSDIFFChunk("CHNL", "\x00\x02SLFTSRGT"))
+	data := string(make([]byte, 1<<20))
+	file := fixture.DSDIFFForm(prop, fixture.DSDIFFChunk("DSD ", data),
+		fixture.DSDIFFChunk("DIIN", fixture.DSDIFFChunk("DITI", "\x00\x00\x00\x05title")))
+
+	r := fixture.NewCountingReadSeeker(file)
+	tags, _, err := sound.DecodeTags(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title() != "title" {
+		t.Errorf("got title %q", tags.Title())
+	}
+	if r.N > 64<<10 {
+		t.Errorf("read %d bytes of %d", r.N, len(file))
+	}
+}
+
+func TestChunkPastForm(t *testing.T) {
+	prop := fixture.DSDIFFChunk("PROP", "SND ",
+		fixture.DSDIFFChunk("FS  ", "\x00\x2b\x11\x00"),
+		fixture.DSDIFFChunk("CHNL", "\x00\x02SLFTSRGT"))
+	file := fixture.DSDIFFForm(prop, fixture.DSDIFFChunk("DSD ", "\x00\x00"))
+
+	for _, size := range []uint64{3, 1<<63 + 2, 1<<64 - 1} {
+		binary.BigEndian.PutUint64(file[len(file)-2-8:], size)
+		_, err := DecodeMeta(bytes.NewReader(file), 0)
+		if err != ErrBadChunk {
+			t.Errorf("size %#x: got %v, expected ErrBadChunk", size, err)
+		}
+	}
+}
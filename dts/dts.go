@@ -0,0 +1,204 @@
+// Package dts implements reading of metadata from DTS Coherent Acoustics
+// elementary streams.
+//
+// The core frame header may be stored in four ways: as 16-bit words, big or
+// little endian, or packed 14 bits to a 16-bit word for CD audio, big or
+// little endian. An elementary stream is a bare sequence of frames with
+// nothing to say how many there are, so the duration is estimated from the
+// size of the stream and the bitrate of the first frame.
+package dts
+
+import (
+	"bufio"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+)
+
+// The sync words of the four ways a stream may be stored.
+const (
+	Magic        = "\x7F\xFE\x80\x01"
+	MagicLE      = "\xFE\x7F\x01\x80"
+	Magic14Bit   = "\x1F\xFF\xE8\x00"
+	Magic14BitLE = "\xFF\x1F\x00\xE8"
+)
+
+func init() {
+	for _, magic := range []string{Magic, MagicLE, Magic14Bit, Magic14BitLE} {
+		sound.RegisterFormat("DTS", magic, nil, nil, DecodeMeta)
+	}
+}
+
+var (
+	ErrUnsynced = errors.New("dts: missing sync word")
+	ErrReserved = errors.New("dts: frame header has invalid value")
+)
+
+// sampleRates are the core sample rates by SFREQ, or 0 where invalid.
+var sampleRates = [16]int{0, 8000, 16000, 32000, 0, 0, 11025, 22050, 44100, 0, 0, 12000, 24000, 48000, 0, 0}
+
+// bitrates are the transmission bitrates in bps by RATE, up to the values
+// for open, variable and lossless rates, which don't say.
+var bitrates = [29]int{
+	32000, 56000, 64000, 96000, 112000, 128000, 192000, 224000,
+	256000, 320000, 384000, 448000, 512000, 576000, 640000, 768000,
+	960000, 1024000, 1152000, 1280000, 1344000, 1408000, 1411200, 1472000,
+	1536000, 1920000, 2048000, 3072000, 3840000,
+}
+
+// channels are the number of channels by AMODE, not counting LFE. The modes
+// after these are user defined.
+var channels = [16]int{1, 2, 2, 2, 2, 3, 3, 4, 4, 5, 6, 6, 6, 7, 8, 8}
+
+// Metadata is the information in the core header of the first frame.
+type Metadata struct {
+	// LFE is whether there is a low frequency effects channel, which is
+	// counted by NumChannels.
+	LFE bool
+	// AudioMode is AMODE, the arrangement of the channels.
+	AudioMode int
+	// FrameSize is the size of the core frame in bytes, as it would be
+	// stored in 16-bit words.
+	FrameSize int
+	// FrameSamples is the number of samples in each frame.
+	FrameSamples int
+
+	sampleRate int
+	bitRate    int
+	duration   time.Duration
+}
+
+func (m *Metadata) Duration() time.Duration { return m.duration }
+func (m *Metadata) SampleRate() int         { return m.sampleRate }
+func (m *Metadata) BitRate() int            { return m.bitRate }
+func (m *Metadata) DurationExact() bool     { return false }
+
+func (m *Metadata) String() string { return sound.Summary(nil, m) }
+
+// NumChannels returns 0 for user defined channel arrangements.
+func (m *Metadata) NumChannels() int {
+	if m.AudioMode >= len(channels) {
+		return 0
+	}
+	n := channels[m.AudioMode]
+	if m.LFE {
+		n++
+	}
+	return n
+}
+
+// DecodeMeta decodes the core header of the first frame, and estimates the
+// duration from fsize, if it is known, and the bitrate. The underlying type
+// of the sound.Metadata returned will be (*Metadata).
+func DecodeMeta(r io.Reader, fsize int64) (sound.Metadata, error) {
+	br := bufio.NewReader(r)
+	// enough for the header in any of the forms
+	b, err := br.Peek(16)
+	if err != nil {
+		return nil, errors.Wrap(err, "read frame header")
+	}
+
+	var packed bool
+	switch string(b[:4]) {
+	case Magic:
+	case MagicLE:
+		b = swapBytes(b)
+	case Magic14Bit:
+		b, packed = unpack14(b), true
+	case Magic14BitLE:
+		b, packed = unpack14(swapBytes(b)), true
+	default:
+		return nil, ErrUnsynced
+	}
+
+	m, err := decodeHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if fsize > 0 && m.bitRate > 0 {
+		bits := fsize * 8
+		if packed {
+			// only 14 of every 16 bits are the stream
+			bits = bits / 16 * 14
+		}
+		m.duration = time.Duration(float64(bits) / float64(m.bitRate) * float64(time.Second))
+	}
+	return m, nil
+}
+
+// decodeHeader decodes a core frame header in 16-bit big endian words.
+func decodeHeader(b []byte) (*Metadata, error) {
+	r := bitReader{b: b[4:]}
+	r.read(1) // FTYPE
+	r.read(5) // SHORT
+	r.read(1) // CPF
+	blocks := r.read(7) + 1
+	m := &Metadata{
+		FrameSize:    r.read(14) + 1,
+		FrameSamples: blocks * 32,
+		AudioMode:    r.read(6),
+	}
+	m.sampleRate = sampleRates[r.read(4)]
+	rate := r.read(5)
+	r.read(10) // fixed bit and flags up to the extension audio
+	lff := r.read(2)
+
+	if m.sampleRate == 0 || m.FrameSize < 96 {
+		return nil, ErrReserved
+	}
+	m.LFE = lff == 1 || lff == 2
+
+	if rate < len(bitrates) {
+		m.bitRate = bitrates[rate]
+	} else {
+		// the bitrate isn't given, so go by the size of the core frame
+		m.bitRate = m.FrameSize * 8 * m.sampleRate / m.FrameSamples
+	}
+	return m, nil
+}
+
+// swapBytes swaps the bytes of each 16-bit word of b.
+func swapBytes(b []byte) []byte {
+	s := make([]byte, len(b))
+	for i := 0; i+1 < len(b); i += 2 {
+		s[i], s[i+1] = b[i+1], b[i]
+	}
+	return s
+}
+
+// unpack14 joins up the low 14 bits of each big endian 16-bit word of b.
+func unpack14(b []byte) []byte {
+	var (
+		out  []byte
+		acc  uint32
+		bits uint
+	)
+	for i := 0; i+1 < len(b); i += 2 {
+		acc = acc<<14 | (uint32(b[i])<<8|uint32(b[i+1]))&0x3FFF
+		bits += 14
+		for bits >= 8 {
+			bits -= 8
+			out = append(out, byte(acc>>bits))
+		}
+	}
+	return out
+}
+
+// bitReader reads big endian bit fields out of a header.
+type bitReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *bitReader) read(n int) int {
+	var v int
+	for i := 0; i < n; i++ {
+		bit := r.b[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | int(bit)
+		r.pos++
+	}
+	return v
+}
@@ -0,0 +1,94 @@
+package dts
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// header makes a core frame header in 16-bit big endian words: a normal
+// frame of 16 blocks of 32 samples, 5 channels with LFE at 48 kHz, 768 kbps.
+func header() []byte {
+	var (
+		b    []byte
+		acc  uint64
+		bits uint
+	)
+	put := func(n uint, v uint64) {
+		acc = acc<<n | v
+		bits += n
+		for bits >= 8 {
+			bits -= 8
+			b = append(b, byte(acc>>bits))
+		}
+	}
+	put(32, 0x7FFE8001)
+	put(1, 1)     // FTYPE
+	put(5, 31)    // SHORT
+	put(1, 0)     // CPF
+	put(7, 15)    // NBLKS
+	put(14, 2047) // FSIZE
+	put(6, 9)     // AMODE
+	put(4, 13)    // SFREQ
+	put(5, 15)    // RATE
+	put(10, 1)    // flags, with ASPF set
+	put(2, 2)     // LFF
+	for len(b) < 16 || bits != 0 {
+		put(1, 0)
+	}
+	return b
+}
+
+// pack14 packs b into the low 14 bits of each 16-bit word, sign extended.
+func pack14(b []byte) []byte {
+	var (
+		out  []byte
+		acc  uint64
+		bits uint
+	)
+	for _, c := range b {
+		acc = acc<<8 | uint64(c)
+		bits += 8
+		for bits >= 14 {
+			bits -= 14
+			w := uint16(acc>>bits) & 0x3FFF
+			if w&0x2000 != 0 {
+				w |= 0xC000
+			}
+			out = append(out, byte(w>>8), byte(w))
+		}
+	}
+	return out
+}
+
+func TestDecodeMeta(t *testing.T) {
+	h := header()
+	tests := []struct {
+		name   string
+		header []byte
+		fsize  int64
+	}{
+		// each is 7 seconds long
+		{"16-bit", h, 768000 / 8 * 7},
+		{"16-bit LE", swapBytes(h), 768000 / 8 * 7},
+		{"14-bit", pack14(h), 768000 / 8 * 7 / 14 * 16},
+		{"14-bit LE", swapBytes(pack14(h)), 768000 / 8 * 7 / 14 * 16},
+	}
+
+	for _, test := range tests {
+		m, err := DecodeMeta(bytes.NewReader(test.header), test.fsize)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if m.NumChannels() != 6 || m.SampleRate() != 48000 || m.BitRate() != 768000 {
+			t.Errorf("%s: got %d channels, %d Hz, %d bps", test.name, m.NumChannels(), m.SampleRate(), m.BitRate())
+		}
+		if m.Duration() != 7*time.Second {
+			t.Errorf("%s: got %v", test.name, m.Duration())
+		}
+		if mm := m.(*Metadata); mm.FrameSize != 2048 || mm.FrameSamples != 512 {
+			t.Errorf("%s: got frame size %d, %d samples", test.name, mm.FrameSize, mm.FrameSamples)
+		}
+	}
+}
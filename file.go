@@ -0,0 +1,104 @@
+package sound
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+)
+
+var ErrClosed = errors.New("sound: file already closed")
+
+// File is an open sound file along with its decoded metadata and tags.
+type File struct {
+	// Format is the name of the format the file was sniffed as.
+	Format   string
+	Metadata Metadata
+	// Tags is nil if the file has no tags.
+	Tags Tags
+
+	f *os.File
+}
+
+// OpenFile opens the named file and decodes its metadata and tags in one go.
+// The file stays open until Close is called, which also releases anything
+// the Metadata and Tags are holding on to.
+func OpenFile(name string) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := openFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func openFile(f *os.File) (*File, error) {
+	br := bufio.NewReader(f)
+	fm := sniff(br)
+
+	if fm.decodeAll != nil {
+		// the format can do both in one pass
+		n, err := fileSize(f, br)
+		if err != nil {
+			return nil, err
+		}
+		m, t, err := fm.decodeAll(br, n)
+		if err != nil {
+			return nil, err
+		}
+		return &File{Format: fm.name, Metadata: m, Tags: t, f: f}, nil
+	}
+
+	m, _, err := decodeMeta(f, br, fm, fm.decodeMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Format: fm.name, Metadata: m, f: f}
+	if fm.decodeTags == nil {
+		return file, nil
+	}
+
+	_, err = f.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return nil, err
+	}
+	br.Reset(f)
+	file.Tags, err = fm.decodeTags(br)
+	if err == ErrNoTags {
+		file.Tags, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Close releases the Metadata and Tags, if they implement io.Closer, and
+// closes the underlying file. Neither may be used after Close.
+func (f *File) Close() error {
+	if f.f == nil {
+		return ErrClosed
+	}
+
+	var firstErr error
+	for _, v := range []interface{}{f.Metadata, f.Tags} {
+		if c, ok := v.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if err := f.f.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	f.Metadata, f.Tags, f.f = nil, nil, nil
+	return firstErr
+}
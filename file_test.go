@@ -0,0 +1,59 @@
+package sound
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testMeta struct{}
+
+func (testMeta) Duration() time.Duration { return time.Second }
+func (testMeta) NumChannels() int        { return 2 }
+func (testMeta) BitRate() int            { return 0 }
+func (testMeta) SampleRate() int         { return 0 }
+
+type closingTags struct {
+	testTags
+	closed bool
+}
+
+func (t *closingTags) Close() error {
+	t.closed = true
+	return nil
+}
+
+func init() {
+	RegisterFormat("test file", "TFILE", nil,
+		func(io.Reader) (Tags, error) { return &closingTags{}, nil },
+		func(io.Reader, int64) (Metadata, error) { return testMeta{}, nil })
+}
+
+func TestOpenFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test")
+	err := os.WriteFile(name, []byte("TFILE data"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Format != "test file" || f.Metadata.Duration() != time.Second {
+		t.Errorf("got %+v", f)
+	}
+	tags := f.Tags.(*closingTags)
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !tags.closed {
+		t.Error("tags weren't closed")
+	}
+	if err := f.Close(); err != ErrClosed {
+		t.Errorf("second Close: expected ErrClosed, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package flac
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"io"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 
 	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/id3/id3v2"
 	"ktkr.us/pkg/sound/vorbis"
 )
 
@@ -16,10 +18,40 @@ const Magic = "fLaC"
 
 func init() {
 	sound.RegisterFormat("FLAC", "fLaC", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterAudioStream("FLAC", SkipMetadata)
+	sound.RegisterMetaAndTags("FLAC", DecodeAll)
+	sound.RegisterCapabilities("FLAC", sound.Capabilities{
+		SupportsPictures:   true,
+		SupportsMultiValue: true,
+	})
 }
 
+var (
+	ErrNoMarker     = errors.New("flac: missing fLaC stream marker")
+	ErrNoStreaminfo = errors.New("flac: no STREAMINFO metadata block")
+	ErrBadBlock     = errors.New("flac: malformed metadata block")
+	// ErrReservedBlock is returned in strict mode for a metadata block of a
+	// reserved type, or of the invalid type 127.
+	ErrReservedBlock = errors.New("flac: reserved metadata block type")
+)
+
+// Logger is called with diagnostics about malformed metadata blocks that are
+// skipped instead of failing the whole stream. It does nothing by default;
+// set it to log.Printf or similar to see them.
+var Logger = func(format string, v ...interface{}) {}
+
 type reader struct {
-	r *bufio.Reader
+	r      *bufio.Reader
+	strict bool
+}
+
+// DecodeOptions changes how DecodeTagsWithOptions and DecodeMetaWithOptions
+// read a stream.
+type DecodeOptions struct {
+	// Strict makes a metadata block of a reserved type, or of the invalid
+	// type 127, an error. Otherwise such blocks are skipped over, since
+	// every block carries its own length.
+	Strict bool
 }
 
 func newReader(rr io.Reader) *reader {
@@ -77,6 +109,8 @@ type Metadata struct {
 	BitsPerSample int
 	NumSamples    uint64
 	MD5           [16]byte
+
+	applications map[string][]byte
 }
 
 func (m Metadata) Duration() time.Duration {
@@ -97,6 +131,30 @@ func (m Metadata) SampleRate() int {
 	return m.sampleRate
 }
 
+func (m Metadata) String() string {
+	return sound.Summary(nil, m)
+}
+
+// DurationExact reports whether STREAMINFO recorded the number of samples,
+// which it is allowed to leave as 0 if unknown.
+func (m Metadata) DurationExact() bool {
+	return m.NumSamples != 0
+}
+
+func (m Metadata) Lossless() bool {
+	return true
+}
+
+func (m Metadata) TotalSamples() int64 {
+	return int64(m.NumSamples)
+}
+
+// Applications returns the data of the APPLICATION blocks, keyed by their
+// 4-character registered application IDs. It is nil if there are none.
+func (m Metadata) Applications() map[string][]byte {
+	return m.applications
+}
+
 type uint24 [3]byte
 
 func (n uint24) Uint32() uint32 {
@@ -107,53 +165,88 @@ func Decode(rr io.Reader) (sound.Sound, error) {
 	panic("x")
 }
 
-func DecodeTags(rr io.Reader) (sound.Tags, error) {
-	var (
-		lastMeta = false
-		h        metadataBlockHeader
-		comment  vorbis.Comment
-	)
+// Tags is the contents of the VORBIS_COMMENT block, along with the
+// STREAMINFO block that comes before it.
+type Tags struct {
+	vorbis.Comment
+	// StreamInfo is the zero Metadata if the file had no STREAMINFO block
+	// before the comments.
+	StreamInfo Metadata
 
-	r := newReader(rr)
+	vendor   string
+	pictures []sound.Picture
+}
 
-	for !lastMeta {
-		err := binary.Read(r.r, binary.BigEndian, &h)
-		if err != nil {
-			return nil, err
-		}
+func (t *Tags) SampleRate() int  { return t.StreamInfo.SampleRate() }
+func (t *Tags) NumChannels() int { return t.StreamInfo.NumChannels() }
 
-		lastMeta = (h.Header>>7)&1 == 1
-		blockType := h.Header & 0x7F
-		blockSize := int(h.Length.Uint32())
+// Vendor returns the vendor string of the VORBIS_COMMENT block, which names
+// the library that wrote it, such as "reference libFLAC 1.4.3 20230623".
+func (t *Tags) Vendor() string { return t.vendor }
 
-		switch blockType {
-		case blockTypeStreaminfo, blockTypePadding, blockTypeApplication, blockTypeSeektable, blockTypeCuesheet, blockTypePicture:
-			// fmt.Printf("metadata block: %d (%d bytes)\n", blockType, blockSize)
-			r.r.Discard(blockSize)
+// Pictures returns the pictures in PICTURE blocks, followed by any in
+// METADATA_BLOCK_PICTURE comments, where some tools put them instead.
+func (t *Tags) Pictures() []sound.Picture {
+	return append(t.pictures[:len(t.pictures):len(t.pictures)], t.Comment.Pictures()...)
+}
 
-		case blockTypeVorbisComment:
-			_, comment, err = vorbis.ReadComment(r.r)
-			return comment, err
+// DecodeTags decodes the VORBIS_COMMENT metadata block, along with any
+// PICTURE blocks. If there isn't a VORBIS_COMMENT block, but some
+// non-conformant tool has stored an ID3v2 tag in an APPLICATION block, it
+// decodes that instead. Otherwise, it returns sound.ErrNoTags.
+//
+// The underlying type of the sound.Tags returned will be (*Tags), unless it
+// came from an ID3v2 tag.
+func DecodeTags(rr io.Reader) (sound.Tags, error) {
+	return DecodeTagsWithOptions(rr, DecodeOptions{})
+}
 
-		case blockTypeInvalid:
-			return nil, errors.New("invalid metadata block type")
+// DecodeTagsWithOptions is like DecodeTags, with the given options.
+func DecodeTagsWithOptions(rr io.Reader, opts DecodeOptions) (sound.Tags, error) {
+	r := newReader(rr)
+	r.strict = opts.Strict
+	return r.decodeTags()
+}
 
-		default:
-			return nil, errors.Errorf("reserved metadata block type: %q", blockType)
-		}
+func (r *reader) decodeTags() (sound.Tags, error) {
+	b, err := r.readBlocks(true)
+	if err != nil {
+		return nil, err
 	}
+	return b.tags()
+}
 
-	return vorbis.Comment{}, nil
+// blocks is what readBlocks finds in the metadata blocks.
+type blocks struct {
+	meta           Metadata
+	haveStreaminfo bool
+	// t, haveComment and id3 are only filled in when reading tags
+	t           Tags
+	haveComment bool
+	id3         []byte
 }
 
-func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
+// tags returns the tags found in the blocks, the same way as DecodeTags.
+func (b *blocks) tags() (sound.Tags, error) {
+	if b.haveComment {
+		return &b.t, nil
+	}
+	if b.id3 != nil {
+		return id3v2.Decode(bytes.NewReader(b.id3))
+	}
+	return nil, sound.ErrNoTags
+}
+
+// readBlocks reads all of the metadata blocks in one pass, keeping STREAMINFO
+// and any APPLICATION blocks, and the tags too if withTags is set.
+func (r *reader) readBlocks(withTags bool) (*blocks, error) {
 	var (
 		lastMeta = false
 		h        metadataBlockHeader
+		b        blocks
+		apps     map[string][]byte
 	)
 
-	r := newReader(rr)
-
 	for !lastMeta {
 		err := binary.Read(r.r, binary.BigEndian, &h)
 		if err != nil {
@@ -165,42 +258,228 @@ func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
 		blockSize := int(h.Length.Uint32())
 
 		switch blockType {
-		case blockTypeVorbisComment, blockTypePadding, blockTypeApplication, blockTypeSeektable, blockTypeCuesheet, blockTypePicture:
+		case blockTypePadding, blockTypeSeektable, blockTypeCuesheet:
 			// fmt.Printf("metadata block: %d (%d bytes)\n", blockType, blockSize)
 			r.r.Discard(blockSize)
 
+		case blockTypePicture:
+			if !withTags {
+				r.r.Discard(blockSize)
+				break
+			}
+			buf := make([]byte, blockSize)
+			_, err = io.ReadFull(r.r, buf)
+			if err != nil {
+				return nil, err
+			}
+			pic, err := vorbis.DecodePicture(buf)
+			if err == nil {
+				b.t.pictures = append(b.t.pictures, *pic)
+			}
+
 		case blockTypeStreaminfo:
-			var b streaminfo
-			err = binary.Read(r.r, binary.BigEndian, &b)
+			b.meta, err = r.readStreaminfo()
 			if err != nil {
 				return nil, err
 			}
+			b.haveStreaminfo = true
 
-			sampleRate := int((b.SampleRate >> 44) & 0x3FFFF)
-			numChannels := int((b.SampleRate>>41)&0x7) + 1
-			bitsPerSample := int((b.SampleRate>>36)&0x1F) + 1
-			numSamples := b.SampleRate & 0xFFFFFFFFF
-
-			m := Metadata{
-				MinBlockSize:  b.MinBlockSize,
-				MaxBlockSize:  b.MaxBlockSize,
-				MinFrameSize:  b.MinFrameSize.Uint32(),
-				MaxFrameSize:  b.MaxFrameSize.Uint32(),
-				sampleRate:    sampleRate,
-				numChannels:   numChannels,
-				BitsPerSample: bitsPerSample,
-				NumSamples:    numSamples,
-				MD5:           b.MD5,
+		case blockTypeApplication:
+			buf := make([]byte, blockSize)
+			_, err = io.ReadFull(r.r, buf)
+			if err != nil {
+				return nil, err
+			}
+			if len(buf) < 4 {
+				Logger("flac: skipping APPLICATION block of %d bytes, too short for its ID", len(buf))
+				break
+			}
+			if apps == nil {
+				apps = make(map[string][]byte)
+			}
+			apps[string(buf[:4])] = buf[4:]
+			// there's no registered application ID for an ID3v2 tag, so go
+			// by the content after the ID
+			if withTags && b.id3 == nil && bytes.HasPrefix(buf[4:], []byte("ID3")) {
+				b.id3 = buf[4:]
 			}
-			return m, nil
 
-		case blockTypeInvalid:
-			return nil, errors.New("invalid metadata block type")
+		case blockTypeVorbisComment:
+			if !withTags {
+				r.r.Discard(blockSize)
+				break
+			}
+			// bound the vector by the block, so that its counts and
+			// lengths can be checked against it
+			lr := &io.LimitedReader{R: r.r, N: int64(blockSize)}
+			b.t.vendor, b.t.Comment, err = vorbis.ReadComment(lr)
+			if err != nil {
+				return nil, err
+			}
+			r.r.Discard(int(lr.N))
+			b.haveComment = true
 
 		default:
-			return nil, errors.Errorf("reserved metadata block type: %q", blockType)
+			err = r.skipUnknown(blockType, blockSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	b.meta.applications = apps
+	b.t.StreamInfo = b.meta
+	return &b, nil
+}
+
+func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
+	return DecodeMetaWithOptions(rr, fsize, DecodeOptions{})
+}
+
+// DecodeMetaWithOptions is like DecodeMeta, with the given options.
+func DecodeMetaWithOptions(rr io.Reader, fsize int64, opts DecodeOptions) (sound.Metadata, error) {
+	r := newReader(rr)
+	r.strict = opts.Strict
+	m, err := r.decodeStreaminfo()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DecodeAll decodes the metadata and the tags together, reading the metadata
+// blocks only once, where DecodeMeta and DecodeTags would each read them. The
+// sound.Tags is nil if there are none. Their underlying types are the same as
+// for DecodeMeta and DecodeTags.
+func DecodeAll(rr io.Reader, fsize int64) (sound.Metadata, sound.Tags, error) {
+	r := newReader(rr)
+	b, err := r.readBlocks(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !b.haveStreaminfo {
+		return nil, nil, ErrNoStreaminfo
+	}
+	t, err := b.tags()
+	if err == sound.ErrNoTags {
+		return b.meta, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.meta, t, nil
+}
+
+// SkipMetadata discards the stream marker and all of the metadata blocks from
+// r, leaving it at the first audio frame.
+func SkipMetadata(r *bufio.Reader) error {
+	magic := make([]byte, len(Magic))
+	_, err := io.ReadFull(r, magic)
+	if err != nil {
+		return err
+	}
+	if string(magic) != Magic {
+		return ErrNoMarker
+	}
+
+	var h metadataBlockHeader
+	for h.Header>>7 == 0 {
+		err = binary.Read(r, binary.BigEndian, &h)
+		if err != nil {
+			return err
+		}
+		_, err = r.Discard(int(h.Length.Uint32()))
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return nil, errors.New("no STREAMINFO metadata block found")
+// skipUnknown skips a metadata block of a reserved or invalid type, such as
+// one defined after this package was written, or returns an error in strict
+// mode.
+func (r *reader) skipUnknown(blockType byte, blockSize int) error {
+	if r.strict {
+		if blockType == blockTypeInvalid {
+			return errors.Wrap(ErrReservedBlock, "invalid type 127")
+		}
+		return errors.Wrapf(ErrReservedBlock, "type %d", blockType)
+	}
+	_, err := r.r.Discard(blockSize)
+	return err
+}
+
+// ReadStreamInfo reads the stream marker and the STREAMINFO block, which must
+// come first, and stops there, reading no more of r than that. It is the
+// quickest way to check that a stream is FLAC and find out its format. The
+// Metadata has no APPLICATION blocks, since they come after.
+func ReadStreamInfo(r io.Reader) (Metadata, error) {
+	var head struct {
+		Magic [len(Magic)]byte
+		Block metadataBlockHeader
+	}
+	err := binary.Read(r, binary.BigEndian, &head)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if string(head.Magic[:]) != Magic {
+		return Metadata{}, ErrNoMarker
+	}
+	if head.Block.Header&0x7F != blockTypeStreaminfo {
+		return Metadata{}, ErrNoStreaminfo
+	}
+	if size := head.Block.Length.Uint32(); size != uint32(binary.Size(streaminfo{})) {
+		return Metadata{}, errors.Wrapf(ErrBadBlock, "STREAMINFO block of %d bytes", size)
+	}
+
+	var b streaminfo
+	err = binary.Read(r, binary.BigEndian, &b)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return b.metadata(), nil
+}
+
+// readStreaminfo reads the body of a STREAMINFO block.
+func (r *reader) readStreaminfo() (Metadata, error) {
+	var b streaminfo
+	err := binary.Read(r.r, binary.BigEndian, &b)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return b.metadata(), nil
+}
+
+// metadata unpacks the fields of a STREAMINFO block.
+func (b streaminfo) metadata() Metadata {
+	sampleRate := int((b.SampleRate >> 44) & 0x3FFFF)
+	numChannels := int((b.SampleRate>>41)&0x7) + 1
+	bitsPerSample := int((b.SampleRate>>36)&0x1F) + 1
+	numSamples := b.SampleRate & 0xFFFFFFFFF
+
+	return Metadata{
+		MinBlockSize:  b.MinBlockSize,
+		MaxBlockSize:  b.MaxBlockSize,
+		MinFrameSize:  b.MinFrameSize.Uint32(),
+		MaxFrameSize:  b.MaxFrameSize.Uint32(),
+		sampleRate:    sampleRate,
+		numChannels:   numChannels,
+		BitsPerSample: bitsPerSample,
+		NumSamples:    numSamples,
+		MD5:           b.MD5,
+	}
+}
+
+// decodeStreaminfo reads the metadata blocks, keeping STREAMINFO and any
+// APPLICATION blocks.
+func (r *reader) decodeStreaminfo() (Metadata, error) {
+	b, err := r.readBlocks(false)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if !b.haveStreaminfo {
+		return Metadata{}, ErrNoStreaminfo
+	}
+	return b.meta, nil
 }
@@ -0,0 +1,300 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/fixture"
+	"ktkr.us/pkg/sound/vorbis"
+)
+
+// block makes a metadata block.
+func block(last bool, blockType byte, data string) string {
+	if last {
+		blockType |= 0x80
+	}
+	n := len(data)
+	return string([]byte{blockType, byte(n >> 16), byte(n >> 8), byte(n)}) + data
+}
+
+// streaminfoBody makes the body of a STREAMINFO block for 44.1 kHz, 16-bit
+// stereo.
+func streaminfoBody() string {
+	si := make([]byte, 34)
+	binary.BigEndian.PutUint64(si[10:], 44100<<44|1<<41|15<<36)
+	return string(si)
+}
+
+func TestApplications(t *testing.T) {
+	file := "fLaC" +
+		block(false, blockTypeStreaminfo, streaminfoBody()) +
+		block(false, blockTypeApplication, "riffRIFF data") +
+		block(false, blockTypePadding, "\x00\x00\x00\x00") +
+		block(true, blockTypeApplication, "ID3 \x00")
+
+	m, err := DecodeMeta(bytes.NewReader([]byte(file)), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apps := m.(Metadata).Applications()
+	if len(apps) != 2 || string(apps["riff"]) != "RIFF data" || string(apps["ID3 "]) != "\x00" {
+		t.Errorf("got %q", apps)
+	}
+	if m.SampleRate() != 44100 {
+		t.Errorf("got sample rate %d", m.SampleRate())
+	}
+}
+
+func TestShortApplication(t *testing.T) {
+	defer func(l func(string, ...interface{})) { Logger = l }(Logger)
+	var logged int
+	Logger = func(format string, v ...interface{}) { logged++ }
+
+	file := "fLaC" +
+		block(false, blockTypeStreaminfo, streaminfoBody()) +
+		block(false, blockTypeApplication, "ab") +
+		block(true, blockTypeVorbisComment, string(fixture.VorbisComment("TITLE=title")))
+
+	tags, err := DecodeTags(bytes.NewReader([]byte(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title() != "title" {
+		t.Errorf("got title %q", tags.Title())
+	}
+	if logged != 1 {
+		t.Errorf("logged %d times", logged)
+	}
+}
+
+func TestCommentPastBlock(t *testing.T) {
+	// the count is checked against the block, not the blocks after it
+	comment := fixture.VorbisComment("TITLE=title")
+	binary.LittleEndian.PutUint32(comment[len(comment)-4-11-4:], 1000)
+	file := "fLaC" +
+		block(false, blockTypeStreaminfo, streaminfoBody()) +
+		block(false, blockTypeVorbisComment, string(comment)) +
+		block(true, blockTypePadding, strings.Repeat("\x00", 8000))
+
+	_, err := DecodeTags(bytes.NewReader([]byte(file)))
+	if err != vorbis.ErrBadComment {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestID3Application(t *testing.T) {
+	id3 := "ID3\x03\x00\x00\x00\x00\x00\x10" + "TIT2\x00\x00\x00\x06\x00\x00\x00title"
+	tests := []struct {
+		file  string
+		title string
+	}{
+		// no VORBIS_COMMENT, so the ID3v2 tag is used
+		{"fLaC" +
+			block(false, blockTypeStreaminfo, streaminfoBody()) +
+			block(true, blockTypeApplication, "xxxx"+id3), "title"},
+		// but the VORBIS_COMMENT block is preferred
+		{"fLaC" +
+			block(false, blockTypeStreaminfo, streaminfoBody()) +
+			block(false, blockTypeApplication, "xxxx"+id3) +
+			block(true, blockTypeVorbisComment, string(fixture.VorbisComment("TITLE=comment"))), "comment"},
+	}
+	for _, test := range tests {
+		tags, err := DecodeTags(bytes.NewReader([]byte(test.file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags.Title() != test.title {
+			t.Errorf("got title %q, expected %q", tags.Title(), test.title)
+		}
+	}
+
+	file := "fLaC" + block(true, blockTypeStreaminfo, streaminfoBody())
+	if _, err := DecodeTags(bytes.NewReader([]byte(file))); err != sound.ErrNoTags {
+		t.Errorf("got %v, expected sound.ErrNoTags", err)
+	}
+}
+
+func TestStreaminfo(t *testing.T) {
+	b := fixture.MakeFLAC(96000*90, 96000, 6, 24)
+	mm, err := DecodeMeta(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mm.(Metadata)
+	if m.SampleRate() != 96000 || m.NumChannels() != 6 || m.BitsPerSample != 24 || m.Duration() != 90*time.Second {
+		t.Errorf("got %d Hz, %d channels, %d bits, %v", m.SampleRate(), m.NumChannels(), m.BitsPerSample, m.Duration())
+	}
+}
+
+func TestReadStreamInfo(t *testing.T) {
+	b := fixture.MakeFLAC(96000*90, 96000, 6, 24, "TITLE=Probe")
+	r := bytes.NewReader(b)
+	m, err := ReadStreamInfo(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SampleRate() != 96000 || m.NumChannels() != 6 || m.BitsPerSample != 24 || m.Duration() != 90*time.Second {
+		t.Errorf("got %d Hz, %d channels, %d bits, %v", m.SampleRate(), m.NumChannels(), m.BitsPerSample, m.Duration())
+	}
+	// the marker, block header and STREAMINFO, and nothing more
+	if read := len(b) - r.Len(); read != 4+4+34 {
+		t.Errorf("read %d bytes", read)
+	}
+
+	if _, err := ReadStreamInfo(bytes.NewReader([]byte("OggS\x00\x00\x00\x00"))); err != ErrNoMarker {
+		t.Errorf("got %v, expected ErrNoMarker", err)
+	}
+}
+
+func TestReservedBlock(t *testing.T) {
+	b := fixture.MakeFLAC(44100, 44100, 2, 16, "TITLE=Reserved")
+	// a block of reserved type 10 and of the invalid type after STREAMINFO
+	file := append(b[:4+4+34:4+4+34], "\x0a\x00\x00\x03abc\x7f\x00\x00\x01x"...)
+	file = append(file, b[4+4+34:]...)
+
+	m, err := DecodeMeta(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Duration() != time.Second {
+		t.Errorf("got %v", m.Duration())
+	}
+	tags, err := DecodeTags(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title() != "Reserved" {
+		t.Errorf("got title %q", tags.Title())
+	}
+
+	strict := DecodeOptions{Strict: true}
+	if _, err := DecodeMetaWithOptions(bytes.NewReader(file), int64(len(file)), strict); !errors.Is(err, ErrReservedBlock) {
+		t.Errorf("strict: decoding metadata got %v", err)
+	}
+	if _, err := DecodeTagsWithOptions(bytes.NewReader(file), strict); !errors.Is(err, ErrReservedBlock) {
+		t.Errorf("strict: decoding tags got %v", err)
+	}
+}
+
+func TestPictures(t *testing.T) {
+	var block bytes.Buffer
+	binary.Write(&block, binary.BigEndian, uint32(3))
+	binary.Write(&block, binary.BigEndian, uint32(len("image/png")))
+	block.WriteString("image/png")
+	binary.Write(&block, binary.BigEndian, uint32(len("cover")))
+	block.WriteString("cover")
+	// 600x400, 24 bits per pixel, not indexed
+	binary.Write(&block, binary.BigEndian, []uint32{600, 400, 24, 0, 4})
+	block.WriteString("\x89PNG")
+
+	b := fixture.MakeFLAC(44100, 44100, 2, 16, "TITLE=Pictures")
+	// the picture comes after the comments, as the last block
+	b[4+4+34] &^= 0x80
+	n := block.Len()
+	file := append(b, 0x80|blockTypePicture, byte(n>>16), byte(n>>8), byte(n))
+	file = append(file, block.Bytes()...)
+
+	tags, err := DecodeTags(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title() != "Pictures" {
+		t.Errorf("got title %q", tags.Title())
+	}
+	pics := tags.(*Tags).Pictures()
+	if len(pics) != 1 {
+		t.Fatalf("got %d pictures", len(pics))
+	}
+	p := pics[0]
+	if p.Type != 3 || p.MIMEType != "image/png" || p.Description != "cover" || string(p.Data) != "\x89PNG" {
+		t.Errorf("got %+v", p)
+	}
+	if p.Width != 600 || p.Height != 400 || p.ColorDepth != 24 {
+		t.Errorf("got %dx%d, %d bits", p.Width, p.Height, p.ColorDepth)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	b := fixture.MakeFLAC(44100, 44100, 2, 16, "ENCODER=Lavf60.3.100")
+	tags, err := DecodeTags(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := tags.(sound.EncodingTags).EncoderSettings(); s != "Lavf60.3.100" {
+		t.Errorf("EncoderSettings: got %q", s)
+	}
+	if s := tags.(*Tags).Vendor(); s != "ktkr.us/pkg/sound fixture" {
+		t.Errorf("Vendor: got %q", s)
+	}
+}
+
+func TestFrameReader(t *testing.T) {
+	header := func(number byte) []byte {
+		// fixed 4096 sample blocks at 44.1 kHz, 16-bit stereo
+		b := []byte{0xFF, 0xF8, 0xC9, 0x18, number}
+		return append(b, crc8(b))
+	}
+	var stream []byte
+	for i := byte(0); i < 3; i++ {
+		stream = append(stream, header(i)...)
+		// audio data with a sync code and a whole valid header that is out
+		// of sequence, neither of which is a frame
+		stream = append(stream, 0xFF, 0xF8, 0x00, 0x12)
+		stream = append(stream, header(0)...)
+	}
+
+	fr := NewFrameReader(bytes.NewReader(stream))
+	var frames []*FrameHeader
+	for {
+		h, err := fr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, h)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames", len(frames))
+	}
+	for i, h := range frames {
+		if h.Number != uint64(i) || h.Offset != int64(i*16) || h.FirstSample() != uint64(i*4096) {
+			t.Errorf("frame %d: got number %d at %d", i, h.Number, h.Offset)
+		}
+		if h.BlockSize != 4096 || h.SampleRate != 44100 || h.NumChannels() != 2 || h.BitsPerSample != 16 {
+			t.Errorf("frame %d: got %+v", i, h)
+		}
+	}
+
+	_, err := NewFrameReader(bytes.NewReader(stream[1:])).Next()
+	if err != ErrBadFrameHeader {
+		t.Errorf("got %v, expected ErrBadFrameHeader", err)
+	}
+}
+
+func TestReadCodedNumber(t *testing.T) {
+	tests := []struct {
+		b []byte
+		v uint64
+		n int
+	}{
+		{[]byte{0x7F}, 0x7F, 1},
+		{[]byte{0xC3, 0x88}, 200, 2},
+		{[]byte{0xFE, 0xA0, 0x80, 0x80, 0x80, 0x80, 0x81}, 1<<35 | 1, 7},
+		// a continuation byte can't come first
+		{[]byte{0x88}, 0, 0},
+		{[]byte{0xC3, 0x08}, 0, 0},
+	}
+	for _, test := range tests {
+		if v, n := readCodedNumber(test.b); v != test.v || n != test.n {
+			t.Errorf("% x: got %d, %d bytes", test.b, v, n)
+		}
+	}
+}
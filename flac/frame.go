@@ -0,0 +1,248 @@
+package flac
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// ErrBadFrameHeader is returned by FrameReader.Next when the stream doesn't
+// start with a valid frame header.
+var ErrBadFrameHeader = errors.New("flac: malformed frame header")
+
+// maxFrameHeaderSize is the size of the longest possible frame header: the
+// sync code and fixed fields, a 7 byte coded number, 16 bit block size and
+// sample rate, and the CRC-8.
+const maxFrameHeaderSize = 4 + 7 + 2 + 2 + 1
+
+// FrameHeader is the header of an audio frame.
+type FrameHeader struct {
+	// VariableBlockSize is whether the stream's frames vary in size. It
+	// decides what Number counts.
+	VariableBlockSize bool
+	// BlockSize is the number of samples in the frame, for each channel.
+	BlockSize int
+	// SampleRate and BitsPerSample are 0 if they are to be taken from
+	// STREAMINFO.
+	SampleRate    int
+	BitsPerSample int
+	// ChannelAssignment is the raw code for how the channels are stored:
+	// 0 to 7 for that many independent channels less one, or 8, 9 and 10
+	// for stereo stored as left/side, side/right and mid/side.
+	ChannelAssignment int
+	// Number is the number of the first sample of the frame if the block
+	// size is variable, or else the number of the frame.
+	Number uint64
+	// Offset is the position of the frame from where the FrameReader
+	// started.
+	Offset int64
+}
+
+// NumChannels returns the number of channels in the frame.
+func (h *FrameHeader) NumChannels() int {
+	if h.ChannelAssignment < 8 {
+		return h.ChannelAssignment + 1
+	}
+	return 2
+}
+
+// FirstSample returns the number of the first sample of the frame. For a
+// stream with a fixed block size, every frame is taken to have the block
+// size of this one, which holds for all but the last.
+func (h *FrameHeader) FirstSample() uint64 {
+	if h.VariableBlockSize {
+		return h.Number
+	}
+	return h.Number * uint64(h.BlockSize)
+}
+
+// FrameReader reads the headers of the audio frames of a stream without
+// decoding the audio in them. Since the frames don't record their size, it
+// finds each one after the first by looking for the next header with a
+// valid sync code, CRC-8 and number.
+type FrameReader struct {
+	r    *bufio.Reader
+	pos  int64
+	last *FrameHeader
+}
+
+// NewFrameReader returns a FrameReader that reads frames from r, which must
+// be at the first audio frame, such as after SkipMetadata.
+func NewFrameReader(r io.Reader) *FrameReader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return &FrameReader{r: br}
+	}
+	return &FrameReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the header of the next frame. The first frame must be right
+// at the start of the stream, or else it returns ErrBadFrameHeader. At the
+// end of the stream, including one with no frames at all, it returns io.EOF.
+func (fr *FrameReader) Next() (*FrameHeader, error) {
+	for {
+		// near the end there may be less than a whole header to peek at
+		b, err := fr.r.Peek(maxFrameHeaderSize)
+		if len(b) < 2 {
+			return nil, err
+		}
+
+		h, n := parseFrameHeader(b)
+		if h != nil && fr.follows(h) {
+			h.Offset = fr.pos
+			fr.r.Discard(n)
+			fr.pos += int64(n)
+			fr.last = h
+			return h, nil
+		}
+		if fr.last == nil {
+			return nil, ErrBadFrameHeader
+		}
+		fr.r.Discard(1)
+		fr.pos++
+	}
+}
+
+// follows reports whether h could be the frame after the last one, so that
+// a sync code that happens to turn up in the audio data, even with a valid
+// CRC-8, isn't taken for a frame.
+func (fr *FrameReader) follows(h *FrameHeader) bool {
+	last := fr.last
+	if last == nil {
+		return true
+	}
+	if h.VariableBlockSize != last.VariableBlockSize {
+		return false
+	}
+	if h.VariableBlockSize {
+		return h.Number == last.Number+uint64(last.BlockSize)
+	}
+	return h.Number == last.Number+1
+}
+
+// parseFrameHeader parses the frame header at the start of b, returning it
+// and its size, or nil if there isn't a valid one.
+func parseFrameHeader(b []byte) (*FrameHeader, int) {
+	if len(b) < 5 || b[0] != 0xFF || b[1]&0xFE != 0xF8 || b[3]&1 != 0 {
+		return nil, 0
+	}
+	h := &FrameHeader{
+		VariableBlockSize: b[1]&1 == 1,
+		ChannelAssignment: int(b[3] >> 4),
+	}
+	var (
+		blockSizeCode  = b[2] >> 4
+		sampleRateCode = b[2] & 0xF
+		sampleSizeCode = (b[3] >> 1) & 7
+	)
+	if blockSizeCode == 0 || sampleRateCode == 15 || h.ChannelAssignment > 10 || sampleSizeCode == 3 {
+		return nil, 0
+	}
+	h.BitsPerSample = [8]int{0, 8, 12, 0, 16, 20, 24, 32}[sampleSizeCode]
+
+	number, i := readCodedNumber(b[4:])
+	if i == 0 {
+		return nil, 0
+	}
+	h.Number = number
+	i += 4
+
+	// readExtra reads the end of the header that some codes call for
+	readExtra := func(n int) (int, bool) {
+		if i+n > len(b) {
+			return 0, false
+		}
+		v := 0
+		for _, c := range b[i : i+n] {
+			v = v<<8 | int(c)
+		}
+		i += n
+		return v, true
+	}
+
+	ok := true
+	switch {
+	case blockSizeCode == 1:
+		h.BlockSize = 192
+	case blockSizeCode <= 5:
+		h.BlockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6:
+		h.BlockSize, ok = readExtra(1)
+		h.BlockSize++
+	case blockSizeCode == 7:
+		h.BlockSize, ok = readExtra(2)
+		h.BlockSize++
+	default:
+		h.BlockSize = 256 << (blockSizeCode - 8)
+	}
+	if !ok {
+		return nil, 0
+	}
+
+	switch sampleRateCode {
+	case 12:
+		h.SampleRate, ok = readExtra(1)
+		h.SampleRate *= 1000
+	case 13:
+		h.SampleRate, ok = readExtra(2)
+	case 14:
+		h.SampleRate, ok = readExtra(2)
+		h.SampleRate *= 10
+	default:
+		h.SampleRate = sampleRates[sampleRateCode]
+	}
+	if !ok || i >= len(b) || crc8(b[:i]) != b[i] {
+		return nil, 0
+	}
+	return h, i + 1
+}
+
+// sampleRates are the sample rates by code, up to those that are given at
+// the end of the header. 0 means the rate is in STREAMINFO.
+var sampleRates = [12]int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000}
+
+// readCodedNumber reads a frame or sample number, which is coded the same
+// way as a UTF-8 character, extended to 7 bytes for up to 36 bits. It
+// returns the number of bytes read, or 0 if the coding is invalid.
+func readCodedNumber(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	c := b[0]
+	if c&0x80 == 0 {
+		return uint64(c), 1
+	}
+
+	// the number of leading ones is the number of bytes
+	n := 0
+	for c&(0x80>>uint(n)) != 0 && n < 8 {
+		n++
+	}
+	if n == 1 || n > 7 || len(b) < n {
+		return 0, 0
+	}
+	v := uint64(c & (0x7F >> uint(n)))
+	for _, c := range b[1:n] {
+		if c&0xC0 != 0x80 {
+			return 0, 0
+		}
+		v = v<<6 | uint64(c&0x3F)
+	}
+	return v, n
+}
+
+// crc8 computes the CRC-8 of a frame header, with the polynomial
+// x^8 + x^2 + x + 1.
+func crc8(b []byte) byte {
+	var crc byte
+	for _, c := range b {
+		crc ^= c
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,95 @@
+package flac
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/ogg"
+)
+
+// OggMagic identifies FLAC in an Ogg container: the first page's packet
+// starts with 0x7F "FLAC".
+const OggMagic = "OggS????????????????????????\x7FFLAC"
+
+func init() {
+	sound.RegisterFormat("Ogg FLAC", OggMagic, nil, DecodeOggTags, DecodeOggMeta)
+	sound.RegisterCapabilities("Ogg FLAC", sound.Capabilities{
+		SupportsPictures:   true,
+		SupportsMultiValue: true,
+	})
+}
+
+var ErrBadOggMapping = errors.New("flac: malformed Ogg FLAC mapping header")
+
+// oggMapping is the start of the first packet of an Ogg FLAC stream. It is
+// followed by the native "fLaC" signature and STREAMINFO block, and the
+// packets after it each hold one more metadata block, so from the signature
+// on, the packet data reads the same as the header of a native FLAC file.
+type oggMapping struct {
+	Magic      [5]byte
+	Major      uint8
+	Minor      uint8
+	NumHeaders uint16
+}
+
+func newOggReader(rr io.Reader) (*ogg.Reader, *reader, error) {
+	o := ogg.NewReader(rr)
+
+	var mh oggMapping
+	err := binary.Read(o, binary.BigEndian, &mh)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(mh.Magic[:]) != "\x7FFLAC" || mh.Major != 1 {
+		return nil, nil, ErrBadOggMapping
+	}
+
+	return o, newReader(o), nil
+}
+
+// DecodeOggTags decodes the VORBIS_COMMENT metadata block of an Ogg FLAC
+// stream, the same way as DecodeTags.
+func DecodeOggTags(rr io.Reader) (sound.Tags, error) {
+	_, r, err := newOggReader(rr)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeTags()
+}
+
+// DecodeOggMeta decodes the STREAMINFO block of an Ogg FLAC stream. The
+// number of samples is taken from the granule position of the last page,
+// since encoders streaming into Ogg often can't fill it in STREAMINFO. The
+// underlying type of the sound.Metadata returned will be Metadata.
+func DecodeOggMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
+	o, r, err := newOggReader(rr)
+	if err != nil {
+		return nil, err
+	}
+	m, err := r.decodeStreaminfo()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		page, err := o.NextPage()
+		if err == ogg.ErrTruncatedPage {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if page == nil {
+			break
+		}
+	}
+
+	// some or all of the pages may have been read through the buffer in r
+	if page := o.Page(); page != nil && page.GranulePos > 0 {
+		m.NumSamples = uint64(page.GranulePos)
+	}
+	return m, nil
+}
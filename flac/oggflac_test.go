@@ -0,0 +1,42 @@
+package flac
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/fixture"
+)
+
+func TestOggFLAC(t *testing.T) {
+	// 44100 Hz, 2 channels, 16 bits per sample, samples unknown
+	si := make([]byte, 34)
+	binary.BigEndian.PutUint64(si[10:], 44100<<44|1<<41|15<<36)
+
+	comment := "\x00\x00\x00\x00\x01\x00\x00\x00\x0b\x00\x00\x00TITLE=title"
+
+	file := fixture.OggPage(0, "\x7FFLAC\x01\x00\x00\x01fLaC\x00\x00\x00\x22"+string(si)) +
+		fixture.OggPage(0, "\x84\x00\x00"+string(rune(len(comment)))+comment) +
+		fixture.OggPage(44100, "audio") +
+		fixture.OggPage(88200, "audio")
+
+	meta, _, err := sound.DecodeMetaBytes([]byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := meta.(Metadata)
+	if m.SampleRate() != 44100 || m.NumChannels() != 2 || m.BitsPerSample != 16 || m.NumSamples != 88200 {
+		t.Errorf("got %+v", m)
+	}
+
+	tags, name, err := sound.DecodeTagsBytes([]byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Ogg FLAC" || tags.Title() != "title" {
+		t.Errorf("got %q, %q", name, tags.Title())
+	}
+	if si, ok := tags.(sound.StreamInfoTags); !ok || si.SampleRate() != 44100 {
+		t.Errorf("expected stream info with the tags, got %v", tags)
+	}
+}
@@ -0,0 +1,249 @@
+package sound_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	_ "ktkr.us/pkg/sound/aiff"
+	_ "ktkr.us/pkg/sound/flac"
+	"ktkr.us/pkg/sound/internal/fixture"
+	_ "ktkr.us/pkg/sound/mp3"
+	_ "ktkr.us/pkg/sound/mp4"
+	_ "ktkr.us/pkg/sound/opus"
+	_ "ktkr.us/pkg/sound/vorbis"
+	_ "ktkr.us/pkg/sound/wave"
+)
+
+// goldenTags are the expected values of a file's tags. A nil *goldenTags
+// means the file has none.
+type goldenTags struct {
+	title, artist, album string
+	track                int
+	year                 int
+}
+
+// The fixtures in testdata are made by testdata/gen.go.
+var goldenFiles = []struct {
+	name       string
+	format     string
+	duration   time.Duration
+	channels   int
+	sampleRate int
+	bitRate    int
+	tags       *goldenTags
+}{
+	// MP3 durations are rounded to the second
+	{"id3v22.mp3", "MP3 ID3v2.2", time.Second, 2, 44100, 128000, &goldenTags{"Title 2.2", "Artist", "Album", 2, 0}},
+	// the ID3v2 tag takes precedence over ID3v1
+	{"id3v23.mp3", "MP3 ID3v2.3", time.Second, 2, 44100, 128000, &goldenTags{"Title 2.3", "Artist", "Album", 3, 2003}},
+	{"id3v24.mp3", "MP3 ID3v2.4", time.Second, 2, 44100, 128000, &goldenTags{"Titre 2.4 ☆", "Artiste", "Album", 4, 2004}},
+	{"id3v1.mp3", "MPEG-1 Layer III", time.Second, 2, 44100, 128000, &goldenTags{"Title 1.1", "Artist", "Album", 5, 2001}},
+	{"vorbis.ogg", "Ogg Vorbis", 3 * time.Second, 2, 44100, 128000, &goldenTags{"Vorbis Title", "Artist", "Album", 5, 2005}},
+	{"opus.opus", "Ogg Opus", 2 * time.Second, 2, 48000, 1012, &goldenTags{"Opus Title", "Artist", "Album", 6, 0}},
+	{"flac.flac", "FLAC", 2 * time.Second, 2, 44100, 705600, &goldenTags{"FLAC Title", "Artist", "Album", 7, 2007}},
+	{"wave.wav", "WAVE", time.Second, 1, 8000, 64000, &goldenTags{"WAVE Title", "Artist", "Album", 8, 0}},
+	{"aiff.aiff", "AIFF", 500 * time.Millisecond, 1, 8000, 128000, nil},
+	{"m4a.m4a", "MPEG-4", 2 * time.Second, 2, 44100, 0, &goldenTags{"M4A Title", "Artist", "Album", 9, 2009}},
+}
+
+func TestGolden(t *testing.T) {
+	for _, g := range goldenFiles {
+		f, err := os.Open(filepath.Join("testdata", g.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, format, err := sound.DecodeMeta(f)
+		if err != nil {
+			t.Errorf("%s: %v", g.name, err)
+			f.Close()
+			continue
+		}
+		if format != g.format {
+			t.Errorf("%s: sniffed as %q, expected %q", g.name, format, g.format)
+		}
+		if m.Duration() != g.duration || m.NumChannels() != g.channels || m.SampleRate() != g.sampleRate || m.BitRate() != g.bitRate {
+			t.Errorf("%s: got %v, %d channels, %d Hz, %d bps", g.name, m.Duration(), m.NumChannels(), m.SampleRate(), m.BitRate())
+		}
+
+		_, err = f.Seek(0, os.SEEK_SET)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, _, err := sound.DecodeTags(f)
+		f.Close()
+		if g.tags == nil {
+			if err == nil {
+				t.Errorf("%s: got tags, expected none", g.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", g.name, err)
+			continue
+		}
+		got := goldenTags{tags.Title(), tags.Artist(), tags.Album(), tags.Track(), 0}
+		if d := tags.Date(); !d.IsZero() {
+			got.year = d.Year()
+		}
+		if got != *g.tags {
+			t.Errorf("%s: got tags %+v, expected %+v", g.name, got, *g.tags)
+		}
+	}
+}
+
+// TestGoldenOpenFile checks that OpenFile agrees with DecodeMeta and
+// DecodeTags, including for the formats that decode both in one pass.
+func TestGoldenOpenFile(t *testing.T) {
+	for _, g := range goldenFiles {
+		f, err := sound.OpenFile(filepath.Join("testdata", g.name))
+		if err != nil {
+			t.Errorf("%s: %v", g.name, err)
+			continue
+		}
+		m := f.Metadata
+		if m.Duration() != g.duration || m.NumChannels() != g.channels || m.SampleRate() != g.sampleRate || m.BitRate() != g.bitRate {
+			t.Errorf("%s: got %v, %d channels, %d Hz, %d bps", g.name, m.Duration(), m.NumChannels(), m.SampleRate(), m.BitRate())
+		}
+		if g.tags == nil {
+			if f.Tags != nil {
+				t.Errorf("%s: got tags, expected none", g.name)
+			}
+		} else if f.Tags == nil || f.Tags.Title() != g.tags.title || f.Tags.Track() != g.tags.track {
+			t.Errorf("%s: got tags %v, expected %+v", g.name, f.Tags, *g.tags)
+		}
+		f.Close()
+	}
+}
+
+func TestGoldenDecodeMetaReaderAt(t *testing.T) {
+	for _, g := range goldenFiles {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", g.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, format, err := sound.DecodeMetaReaderAt(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Errorf("%s: %v", g.name, err)
+			continue
+		}
+		if format != g.format {
+			t.Errorf("%s: sniffed as %q, expected %q", g.name, format, g.format)
+		}
+		if m.Duration() != g.duration || m.NumChannels() != g.channels || m.SampleRate() != g.sampleRate || m.BitRate() != g.bitRate {
+			t.Errorf("%s: got %v, %d channels, %d Hz, %d bps", g.name, m.Duration(), m.NumChannels(), m.SampleRate(), m.BitRate())
+		}
+	}
+}
+
+func TestDecodeMetaQuick(t *testing.T) {
+	// an hour long, with a page for every second
+	b := fixture.MakeOggVorbis(44100*3600, 44100, 2, 128000, "TITLE=long")
+
+	r := &fixture.CountingReader{R: bytes.NewReader(b)}
+	m, _, err := sound.DecodeMetaQuick(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.N > 64<<10 {
+		t.Errorf("read %d bytes of %d", r.N, len(b))
+	}
+	if exact, ok := m.(sound.ExactDurationMetadata); !ok || exact.DurationExact() {
+		t.Error("expected an estimated duration")
+	}
+
+	// whereas the full decode reads to the last page
+	r = &fixture.CountingReader{R: bytes.NewReader(b)}
+	if _, _, err = sound.DecodeMeta(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.N != int64(len(b)) {
+		t.Errorf("DecodeMeta read %d bytes of %d", r.N, len(b))
+	}
+}
+
+func TestDecodeTagsSeek(t *testing.T) {
+	b := fixture.MakeMP3(5000, 128000, 44100)
+	v1 := make([]byte, 128)
+	copy(v1, "TAGtitle")
+	copy(v1[93:], "2001")
+	b = append(b, v1...)
+
+	r := fixture.NewCountingReadSeeker(b)
+	tags, _, err := sound.DecodeTags(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title() != "title" {
+		t.Errorf("got title %q", tags.Title())
+	}
+	if r.N > 64<<10 {
+		t.Errorf("read %d bytes of %d", r.N, len(b))
+	}
+}
+
+func TestAudioStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		size   int
+	}{
+		// the size is the whole file less the headers, or -1 if unchecked
+		{"id3v24.mp3", "\xff\xfb", -1},
+		{"id3v1.mp3", "\xff\xfb", 16808},
+		// the fixture has no audio frames
+		{"flac.flac", "", 0},
+		// pages of audio with the header type and granule position
+		{"vorbis.ogg", "OggS\x00\x00\x44\xac\x00\x00", -1},
+		{"opus.opus", "OggS\x00\x04", -1},
+	}
+	for _, test := range tests {
+		f, err := os.Open(filepath.Join("testdata", test.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _, err := sound.AudioStream(f)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			f.Close()
+			continue
+		}
+		b, err := ioutil.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(b), test.prefix) || test.size >= 0 && len(b) != test.size {
+			t.Errorf("%s: got %d bytes, expected %d starting %q", test.name, len(b), test.size, test.prefix)
+		}
+	}
+
+	_, _, err := sound.AudioStream(strings.NewReader("not audio"))
+	if err != sound.ErrFormat {
+		t.Errorf("got %v, expected ErrFormat", err)
+	}
+}
+
+func TestFormatCapabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		c    sound.Capabilities
+	}{
+		{"MP3 ID3v2.3", sound.Capabilities{SupportsTags: true, SupportsPictures: true, SupportsReplayGain: true, SupportsCuesheet: true, SupportsMultiValue: true, SupportsWriting: true}},
+		{"MPEG-1 Layer III", sound.Capabilities{SupportsTags: true, SupportsPictures: true, SupportsReplayGain: true, SupportsCuesheet: true, SupportsMultiValue: true}},
+		{"MPEG-4", sound.Capabilities{SupportsTags: true, SupportsPictures: true, SupportsChapters: true}},
+		{"AIFF", sound.Capabilities{}},
+		{"no such format", sound.Capabilities{}},
+	}
+	for _, test := range tests {
+		if c := sound.FormatCapabilities(test.name); c != test.c {
+			t.Errorf("%s: got %+v, expected %+v", test.name, c, test.c)
+		}
+	}
+}
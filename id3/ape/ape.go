@@ -0,0 +1,225 @@
+// Package ape provides facilities for reading APEv2 tags, which some MP3s
+// carry at the end of the file, before the ID3v1 tag if there is one.
+//
+// An APEv2 tag is a sequence of items followed by a 32-byte footer starting
+// with "APETAGEX". The footer holds the size of the items plus the footer
+// itself. Each item is a 32-bit little endian value size, 32-bit flags, a
+// null-terminated key, and the value, which is UTF-8 text unless the flags
+// say otherwise.
+package ape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/id3/id3v1"
+)
+
+const (
+	Magic      = "APETAGEX"
+	footerSize = 32
+)
+
+var (
+	ErrBadSize = errors.New("ape: malformed tag size")
+	ErrBadItem = errors.New("ape: malformed item")
+)
+
+type footer struct {
+	Magic     [8]byte
+	Version   uint32
+	Size      uint32
+	ItemCount uint32
+	Flags     uint32
+	Reserved  [8]byte
+}
+
+// item types in bits 1-2 of the item flags
+const (
+	itemText   = 0
+	itemBinary = 1
+	itemLink   = 2
+)
+
+// Tag is an APEv2 tag. Items maps keys, as written, to the values of the text
+// items. Binary items, such as cover art, are left out.
+type Tag struct {
+	Items map[string]string
+
+	// version from the footer: 1000 for APEv1 or 2000 for APEv2
+	version uint32
+}
+
+// TagFormat returns "APEv2", or "APEv1" for the older version of the format.
+func (t *Tag) TagFormat() string {
+	if t.version == 1000 {
+		return "APEv1"
+	}
+	return "APEv2"
+}
+
+// Get returns the value of an item. Keys are matched case-insensitively.
+func (t *Tag) Get(key string) string {
+	if v, ok := t.Items[key]; ok {
+		return v
+	}
+	for k, v := range t.Items {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (t *Tag) String() string      { return sound.Summary(t, nil) }
+func (t *Tag) Title() string       { return t.Get("Title") }
+func (t *Tag) AlbumArtist() string { return t.Get("Album Artist") }
+func (t *Tag) Artist() string      { return t.Get("Artist") }
+func (t *Tag) Album() string       { return t.Get("Album") }
+func (t *Tag) Genre() string       { return t.Get("Genre") }
+func (t *Tag) Composer() string    { return t.Get("Composer") }
+func (t *Tag) Notes() string       { return t.Get("Comment") }
+
+// Disc and Track take the number before a slash, as in "3/12".
+func (t *Tag) Disc() int  { return leadingNumber(t.Get("Disc")) }
+func (t *Tag) Track() int { return leadingNumber(t.Get("Track")) }
+
+func (t *Tag) Date() time.Time {
+	s := t.Get("Year")
+	for _, layout := range []string{"2006-01-02", "2006"} {
+		tm, err := time.Parse(layout, s)
+		if err == nil {
+			return tm
+		}
+	}
+	return time.Time{}
+}
+
+// Keys returns the keys of the text items in the tag.
+func (t *Tag) Keys() []string {
+	keys := make([]string, 0, len(t.Items))
+	for k := range t.Items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func leadingNumber(s string) int {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+// Decode decodes an APEv2 tag, locating it from the end of the stream. The
+// tag is expected to be immediately before the ID3v1 tag, or at the very end
+// if there is no ID3v1 tag. If no APEv2 tag is found, it returns
+// sound.ErrNoTags.
+//
+// If r is not an io.Seeker, the whole stream will be read into memory.
+func Decode(r io.Reader) (sound.Tags, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		rs = bytes.NewReader(b)
+	}
+
+	end, err := rs.Seek(0, os.SEEK_END)
+	if err != nil {
+		return nil, err
+	}
+
+	// step over the ID3v1 tag if there is one
+	if end >= id3v1.Size {
+		magic, err := readAt(rs, end-id3v1.Size, 3)
+		if err != nil {
+			return nil, err
+		}
+		if string(magic) == "TAG" {
+			end -= id3v1.Size
+		}
+	}
+
+	if end < footerSize {
+		return nil, sound.ErrNoTags
+	}
+	b, err := readAt(rs, end-footerSize, footerSize)
+	if err != nil {
+		return nil, err
+	}
+	var f footer
+	binary.Read(bytes.NewReader(b), binary.LittleEndian, &f)
+	if string(f.Magic[:]) != Magic {
+		return nil, sound.ErrNoTags
+	}
+
+	if f.Size < footerSize || int64(f.Size) > end {
+		return nil, ErrBadSize
+	}
+	items, err := readAt(rs, end-int64(f.Size), int(f.Size)-footerSize)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tag{Items: make(map[string]string), version: f.Version}
+	err = decodeItems(t, items, int(f.ItemCount))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func decodeItems(t *Tag, b []byte, n int) error {
+	for i := 0; i < n && len(b) > 0; i++ {
+		if len(b) < 8 {
+			return ErrBadItem
+		}
+		size := binary.LittleEndian.Uint32(b)
+		flags := binary.LittleEndian.Uint32(b[4:])
+		b = b[8:]
+
+		j := bytes.IndexByte(b, 0)
+		if j < 0 {
+			return ErrBadItem
+		}
+		key := string(b[:j])
+		b = b[j+1:]
+
+		if uint64(size) > uint64(len(b)) {
+			return ErrBadItem
+		}
+		if (flags>>1)&3 != itemBinary {
+			// multiple values are separated by null bytes
+			t.Items[key] = strings.Replace(string(b[:size]), "\x00", ", ", -1)
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+func readAt(rs io.ReadSeeker, pos int64, n int) ([]byte, error) {
+	_, err := rs.Seek(pos, os.SEEK_SET)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(rs, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
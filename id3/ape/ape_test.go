@@ -0,0 +1,38 @@
+package ape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeTag(items ...string) []byte {
+	var body bytes.Buffer
+	for i := 0; i < len(items); i += 2 {
+		binary.Write(&body, binary.LittleEndian, uint32(len(items[i+1])))
+		binary.Write(&body, binary.LittleEndian, uint32(0))
+		body.WriteString(items[i] + "\x00" + items[i+1])
+	}
+
+	var b bytes.Buffer
+	b.Write(body.Bytes())
+	b.WriteString(Magic)
+	binary.Write(&b, binary.LittleEndian, []uint32{2000, uint32(body.Len() + footerSize), uint32(len(items) / 2), 0, 0, 0})
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	data := append([]byte("audio data"), makeTag("TITLE", "title", "Artist", "a\x00b", "Track", "3/12")...)
+	id3v1 := make([]byte, 128)
+	copy(id3v1, "TAG")
+
+	for _, b := range [][]byte{data, append(data, id3v1...)} {
+		tags, err := Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags.Title() != "title" || tags.Artist() != "a, b" || tags.Track() != 3 {
+			t.Errorf("got %q", tags.(*Tag).Items)
+		}
+	}
+}
@@ -37,6 +37,15 @@ var genres = []string{
 	"Drum & Bass",
 }
 
+// GenreName returns the name of the genre with the given index, or "" if the
+// index is out of range.
+func GenreName(i int) string {
+	if i < 0 || i >= len(genres) {
+		return ""
+	}
+	return genres[i]
+}
+
 type Tag struct {
 	title   string
 	artist  string
@@ -47,6 +56,7 @@ type Tag struct {
 	genre   string
 }
 
+func (t *Tag) String() string      { return sound.Summary(t, nil) }
 func (t *Tag) Title() string       { return t.title }
 func (t *Tag) AlbumArtist() string { return t.artist }
 func (t *Tag) Artist() string      { return t.artist }
@@ -55,13 +65,42 @@ func (t *Tag) Genre() string       { return t.genre }
 func (t *Tag) Disc() int           { return 1 }
 func (t *Tag) Track() int          { return t.track }
 func (t *Tag) Date() time.Time {
-	var tm time.Time
-	tm.AddDate(t.Year, 0, 0)
-	return tm
+	if t.Year == 0 {
+		return time.Time{}
+	}
+	return time.Date(t.Year, time.January, 1, 0, 0, 0, 0, time.UTC)
 }
+
+// TagFormat returns "ID3v1.1" if the tag has a track number, which ID3v1.1
+// added, or "ID3v1" otherwise.
+func (t *Tag) TagFormat() string {
+	if t.track != 0 {
+		return "ID3v1.1"
+	}
+	return "ID3v1"
+}
+
 func (t *Tag) Composer() string { return "" }
 func (t *Tag) Notes() string    { return t.comment }
 
+// Keys returns the names of the fields that were filled in.
+func (t *Tag) Keys() []string {
+	var keys []string
+	add := func(key string, ok bool) {
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	add("Album", t.album != "")
+	add("Artist", t.artist != "")
+	add("Comment", t.comment != "")
+	add("Genre", t.genre != "")
+	add("Title", t.title != "")
+	add("Track", t.track != 0)
+	add("Year", t.Year != 0)
+	return keys
+}
+
 type tag struct {
 	Title      [30]byte
 	Artist     [30]byte
@@ -72,6 +111,8 @@ type tag struct {
 	Genre      byte
 }
 
+// Decode decodes the ID3v1 tag at the end of the stream. If there isn't one,
+// it returns sound.ErrNoTags.
 func Decode(r io.Reader) (sound.Tags, error) {
 	var (
 		t   tag
@@ -85,7 +126,7 @@ func Decode(r io.Reader) (sound.Tags, error) {
 		}
 	} else {
 		// use some other means to find it
-		r, err = seekEnd(r, Size)
+		r, err = SeekEnd(r, Size)
 		if err != nil {
 			return nil, err
 		}
@@ -93,13 +134,10 @@ func Decode(r io.Reader) (sound.Tags, error) {
 	buf := make([]byte, 3)
 	io.ReadFull(r, buf)
 	if string(buf) != "TAG" {
-		return nil, nil
+		return nil, sound.ErrNoTags
 	}
 	binary.Read(r, binary.LittleEndian, &t)
-	var genre string
-	if int(t.Genre) < len(genres) {
-		genre = genres[t.Genre]
-	}
+	genre := GenreName(int(t.Genre))
 	year, err := strconv.Atoi(string(t.Year[:]))
 	if err != nil {
 		return nil, err
@@ -116,35 +154,35 @@ func Decode(r io.Reader) (sound.Tags, error) {
 	}, nil
 }
 
-func seekEnd(r io.Reader, pos int) (io.Reader, error) {
+// SeekEnd reads r through to the end and returns a reader over the last pos
+// bytes, or all of them if there were fewer. It is for finding tags at the
+// end of streams that can't seek.
+func SeekEnd(r io.Reader, pos int) (*bytes.Reader, error) {
+	// Read in chunks, keeping at least the last pos bytes. Reads may come up
+	// short, so the chunk boundaries can't be relied on.
 	var (
-		buf  []byte
-		buf1 = make([]byte, 1<<15)
-		buf2 = make([]byte, 1<<15)
-		n    int
-		err  error
+		buf = make([]byte, pos+1<<15)
+		n   int
 	)
 
 	for {
-		n, err = r.Read(buf1)
+		if n == len(buf) {
+			n = copy(buf, buf[n-pos:n])
+		}
+		m, err := r.Read(buf[n:])
+		n += m
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
 			return nil, err
 		}
-		buf1, buf2 = buf2, buf1
 	}
 
-	if n < Size {
-		buf = make([]byte, pos)
-		m := copy(buf, buf2[len(buf2)-(pos-n):])
-		copy(buf[m:], buf1[:n])
-	} else {
-		buf = buf1[n-pos : n]
+	if n < pos {
+		return bytes.NewReader(buf[:n]), nil
 	}
-
-	return bytes.NewReader(buf), nil
+	return bytes.NewReader(buf[n-pos : n]), nil
 }
 
 func trimString(s []byte) string {
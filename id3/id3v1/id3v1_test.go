@@ -0,0 +1,27 @@
+package id3v1
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func field(s string, n int) string {
+	return s + strings.Repeat("\x00", n-len(s))
+}
+
+func TestDate(t *testing.T) {
+	b := "TAG" + field("title", 30) + field("artist", 30) + field("album", 30) +
+		"1987" + field("comment", 29) + "\x03\x11"
+	tags, err := Decode(bytes.NewReader([]byte(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := tags.Date(); !d.Equal(time.Date(1987, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v, expected 1987", d)
+	}
+	if d := (&Tag{}).Date(); !d.IsZero() {
+		t.Errorf("got %v for no year, expected the zero time", d)
+	}
+}
@@ -0,0 +1,78 @@
+package id3v2
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrBadTOC = errors.New("id3v2: malformed CD table of contents")
+
+// leadOut is the track number of the lead-out in a CD table of contents.
+const leadOut = 0xAA
+
+// CDTOC returns the body of the MCDI (music CD identifier) frame, which is
+// the table of contents of the CD the file was ripped from, in the binary
+// format returned by the CD-ROM READ TOC command. It is kept as it was, since
+// it isn't text. It reports false if there isn't one.
+func (t *Tags) CDTOC() ([]byte, bool) {
+	for _, f := range t.raw {
+		if f.id == "MCDI" || f.id == "MCI" {
+			return f.data, true
+		}
+	}
+	return nil, false
+}
+
+// MusicBrainzDiscID computes the MusicBrainz disc ID of the CD with the given
+// table of contents, such as that returned by CDTOC, for looking up the
+// release. The track addresses must be logical block addresses, as most
+// rippers write them.
+func MusicBrainzDiscID(toc []byte) (string, error) {
+	if len(toc) < 4 {
+		return "", ErrBadTOC
+	}
+	// the length doesn't count its own 2 bytes
+	n := int(binary.BigEndian.Uint16(toc)) + 2
+	if n > len(toc) {
+		n = len(toc)
+	}
+	first, last := int(toc[2]), int(toc[3])
+	if first < 1 || last < first || last > 99 {
+		return "", ErrBadTOC
+	}
+
+	// offsets[0] is the lead-out; the rest are the tracks by number
+	var offsets [100]uint32
+	found := 0
+	for b := toc[4:n]; len(b) >= 8; b = b[8:] {
+		track := int(b[2])
+		// MusicBrainz counts from the start of the pregap of the first
+		// track, 2 seconds before the first block
+		offset := binary.BigEndian.Uint32(b[4:]) + 150
+		switch {
+		case track == leadOut:
+			offsets[0] = offset
+			found++
+		case track >= first && track <= last:
+			offsets[track] = offset
+			found++
+		}
+	}
+	if found != last-first+2 {
+		return "", errors.Wrapf(ErrBadTOC, "found %d of %d tracks and the lead-out", found, last-first+1)
+	}
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "%02X%02X", first, last)
+	for _, offset := range offsets {
+		fmt.Fprintf(&s, "%08X", offset)
+	}
+	sum := sha1.Sum([]byte(s.String()))
+	id := base64.StdEncoding.EncodeToString(sum[:])
+	return strings.NewReplacer("+", ".", "/", "_", "=", "-").Replace(id), nil
+}
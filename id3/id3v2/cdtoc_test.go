@@ -0,0 +1,55 @@
+package id3v2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// makeTOC makes a table of contents for tracks starting at the given blocks,
+// with the lead-out last.
+func makeTOC(blocks ...uint32) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint16(2+8*len(blocks)))
+	b.Write([]byte{1, byte(len(blocks) - 1)})
+	for i, block := range blocks {
+		track := byte(i + 1)
+		if i == len(blocks)-1 {
+			track = leadOut
+		}
+		b.Write([]byte{0, 0x10, track, 0})
+		binary.Write(&b, binary.BigEndian, block)
+	}
+	return b.Bytes()
+}
+
+func TestMusicBrainzDiscID(t *testing.T) {
+	toc := makeTOC(0, 15213, 32164, 46442, 63264, 80339, 95312)
+
+	frame := append([]byte("MCDI"), 0, 0, 0, byte(len(toc)), 0, 0)
+	frame = append(frame, toc...)
+	tag := "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frame))}) + string(frame)
+	tags, err := Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, ok := tags.(*Tags).CDTOC()
+	if !ok || !bytes.Equal(b, toc) {
+		t.Fatalf("got %x, %t", b, ok)
+	}
+
+	id, err := MusicBrainzDiscID(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "49HHV7Eb8UKF3aQiNmu1GR8vKTY-" {
+		t.Errorf("got %q", id)
+	}
+
+	// no lead-out
+	if _, err := MusicBrainzDiscID(toc[:len(toc)-8]); !errors.Is(err, ErrBadTOC) {
+		t.Errorf("got %v, expected ErrBadTOC", err)
+	}
+}
@@ -0,0 +1,178 @@
+package id3v2
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNoOwnership   = errors.New("id3v2: no OWNE frame")
+	ErrBadOwnership  = errors.New("id3v2: malformed OWNE frame")
+	ErrNoCommercial  = errors.New("id3v2: no COMR frame")
+	ErrBadCommercial = errors.New("id3v2: malformed COMR frame")
+)
+
+// Values of Commercial.ReceivedAs.
+const (
+	ReceivedOther          = 0x00
+	ReceivedStandardAlbum  = 0x01
+	ReceivedCompressedCD   = 0x02
+	ReceivedFileInternet   = 0x03
+	ReceivedStreamInternet = 0x04
+	ReceivedNoteSheets     = 0x05
+	ReceivedNoteSheetsBook = 0x06
+	ReceivedOtherMedia     = 0x07
+	ReceivedNonMusical     = 0x08
+)
+
+// Ownership is the content of an OWNE (ownership) frame, recording the
+// purchase of the file.
+type Ownership struct {
+	// Price is the price paid, as a currency code and an amount, such as
+	// "USD0.99".
+	Price string
+	// Purchased is the date of purchase, or the zero time if it isn't a
+	// valid date.
+	Purchased time.Time
+	Seller    string
+}
+
+// Commercial is the content of a COMR (commercial) frame, describing an
+// offer to sell the file.
+type Commercial struct {
+	// Prices are the prices the file is offered at, each a currency code and
+	// an amount, such as "USD0.99".
+	Prices []string
+	// ValidUntil is the date the prices are valid until, or the zero time
+	// if it isn't a valid date.
+	ValidUntil  time.Time
+	ContactURL  string
+	ReceivedAs  byte
+	Seller      string
+	Description string
+	// LogoMIMEType and Logo are the seller's logo, if there is one.
+	LogoMIMEType string
+	Logo         []byte
+}
+
+// Ownership decodes the tag's OWNE frame.
+func (t *Tags) Ownership() (*Ownership, error) {
+	s, ok := t.Frames["OWNE"]
+	if !ok {
+		return nil, ErrNoOwnership
+	}
+	return decodeOWNE([]byte(s))
+}
+
+// Commercial decodes the tag's COMR frame.
+func (t *Tags) Commercial() (*Commercial, error) {
+	s, ok := t.Frames["COMR"]
+	if !ok {
+		return nil, ErrNoCommercial
+	}
+	return decodeCOMR([]byte(s))
+}
+
+func decodeOWNE(buf []byte) (*Ownership, error) {
+	if len(buf) < 1 {
+		return nil, ErrBadOwnership
+	}
+
+	var (
+		o   Ownership
+		enc = buf[0]
+		b   = bytes.NewBuffer(buf[1:])
+		err error
+	)
+
+	o.Price, err = readTerminatedString(encISO8859_1, b)
+	if err != nil {
+		return nil, ErrBadOwnership
+	}
+	date := b.Next(8)
+	if len(date) != 8 {
+		return nil, ErrBadOwnership
+	}
+	o.Purchased = parseFrameDate(date)
+
+	o.Seller, err = readLastString(enc, b)
+	if err != nil {
+		return nil, ErrBadOwnership
+	}
+	return &o, nil
+}
+
+func decodeCOMR(buf []byte) (*Commercial, error) {
+	if len(buf) < 1 {
+		return nil, ErrBadCommercial
+	}
+
+	var (
+		c   Commercial
+		enc = buf[0]
+		b   = bytes.NewBuffer(buf[1:])
+	)
+
+	prices, err := readTerminatedString(encISO8859_1, b)
+	if err != nil {
+		return nil, ErrBadCommercial
+	}
+	if prices != "" {
+		c.Prices = strings.Split(prices, "/")
+	}
+	date := b.Next(8)
+	if len(date) != 8 {
+		return nil, ErrBadCommercial
+	}
+	c.ValidUntil = parseFrameDate(date)
+
+	c.ContactURL, err = readTerminatedString(encISO8859_1, b)
+	if err != nil {
+		return nil, ErrBadCommercial
+	}
+	c.ReceivedAs, err = b.ReadByte()
+	if err != nil {
+		return nil, ErrBadCommercial
+	}
+	c.Seller, err = readTerminatedString(enc, b)
+	if err != nil {
+		return nil, ErrBadCommercial
+	}
+	c.Description, err = readLastString(enc, b)
+	if err != nil {
+		return nil, ErrBadCommercial
+	}
+
+	if b.Len() > 0 {
+		c.LogoMIMEType, err = readTerminatedString(encISO8859_1, b)
+		if err != nil {
+			return nil, ErrBadCommercial
+		}
+		c.Logo = b.Bytes()
+	}
+	return &c, nil
+}
+
+// readLastString reads a null-terminated string like readTerminatedString,
+// but also accepts a string that runs to the end of r without a terminator,
+// as writers often leave it off the last field of a frame.
+func readLastString(enc byte, r *bytes.Buffer) (string, error) {
+	rest := r.Bytes()
+	s, err := readTerminatedString(enc, r)
+	if err != nil {
+		return decodeTextFrame(enc, rest, false)
+	}
+	return s, nil
+}
+
+// parseFrameDate parses a date in the YYYYMMDD form of OWNE and COMR frames.
+func parseFrameDate(b []byte) time.Time {
+	t, err := time.Parse("20060102", string(b))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
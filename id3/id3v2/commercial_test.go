@@ -0,0 +1,45 @@
+package id3v2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommercialFrames(t *testing.T) {
+	tags := &Tags{Frames: map[string]string{
+		// UTF-16 seller, without a terminator
+		"OWNE": "\x01USD0.99\x0020190305\xff\xfeS\x00t\x00o\x00r\x00e\x00",
+		"COMR": "\x00USD0.99/EUR0.89\x0020201231http://example.com/\x00\x03" +
+			"Store\x00Album download\x00image/png\x00\x89PNG",
+	}}
+
+	o, err := tags.Ownership()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedO := Ownership{"USD0.99", time.Date(2019, 3, 5, 0, 0, 0, 0, time.UTC), "Store"}
+	if *o != expectedO {
+		t.Errorf("got %+v, expected %+v", *o, expectedO)
+	}
+
+	c, err := tags.Commercial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Prices) != 2 || c.Prices[0] != "USD0.99" || c.Prices[1] != "EUR0.89" {
+		t.Errorf("got prices %q", c.Prices)
+	}
+	if !c.ValidUntil.Equal(time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)) || c.ContactURL != "http://example.com/" || c.ReceivedAs != ReceivedFileInternet {
+		t.Errorf("got %v, %q, received as %d", c.ValidUntil, c.ContactURL, c.ReceivedAs)
+	}
+	if c.Seller != "Store" || c.Description != "Album download" {
+		t.Errorf("got seller %q, description %q", c.Seller, c.Description)
+	}
+	if c.LogoMIMEType != "image/png" || string(c.Logo) != "\x89PNG" {
+		t.Errorf("got logo %q, %q", c.LogoMIMEType, c.Logo)
+	}
+
+	if _, err := (&Tags{Frames: map[string]string{"COMR": "\x00USD1"}}).Commercial(); err != ErrBadCommercial {
+		t.Errorf("got %v, expected ErrBadCommercial", err)
+	}
+}
@@ -0,0 +1,370 @@
+package id3v2
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+)
+
+// ErrUnsupportedVersion is returned by Convert for a target version other
+// than ID3v2.3 or ID3v2.4, which are the only ones WriteTo can write.
+var ErrUnsupportedVersion = errors.New("id3v2: can only convert to ID3v2.3 or ID3v2.4")
+
+// v22DateEquiv are the ID3v2.2 date frames that v22Equiv leaves alone, as
+// they only have ID3v2.3 equivalents.
+var v22DateEquiv = map[string]string{
+	"TDA": "TDAT",
+	"TIM": "TIME",
+}
+
+// v23Only are the ID3v2.3 frames with no ID3v2.4 equivalent, beyond the date
+// frames and IPLS, which are converted.
+var v23Only = []string{"EQUA", "RVAD", "TRDA", "TSIZ"}
+
+// v24Only are the ID3v2.4 frames with no ID3v2.3 equivalent. Those that are
+// text frames with a TXXX equivalent in txxxEquiv are kept as TXXX frames.
+// The sort order frames are left as they are, since ID3v2.3 taggers write
+// them too.
+var v24Only = []string{
+	"ASPI", "EQU2", "RVA2", "SEEK", "SIGN",
+	"TDEN", "TDRL", "TDTG", "TMOO", "TPRO", "TSST",
+}
+
+// Convert makes a tag out of src with its frames mapped to those of ID3v2.3
+// or ID3v2.4, as given by targetMajor, ready to be written with WriteTo. If
+// src isn't an ID3v2 tag, the frames are made from the methods of sound.Tags
+// and any of the optional interfaces it implements, and its pictures.
+//
+// For ID3v2.4, the TYER, TDAT and TIME frames are merged into TDRC, TORY
+// becomes TDOR and IPLS becomes TIPL. For ID3v2.3, TDRC is split back into
+// TYER, TDAT and TIME, TDOR becomes TORY, TIPL and TMCL become IPLS, and
+// text frames that only ID3v2.4 has are kept as the TXXX frames that
+// DecodeWithOptions would read them back from. ID3v2.2 frames are renamed
+// as they are when decoding, and PIC frames become APIC. Frames with no
+// equivalent in the target version, and PIC frames with an image format that
+// has no MIME type, are dropped, and their IDs are returned in sorted order.
+// AllFrames of the result is empty.
+func Convert(src sound.Tags, targetMajor uint8) (*Tags, []string, error) {
+	if targetMajor != 3 && targetMajor != 4 {
+		return nil, nil, ErrUnsupportedVersion
+	}
+
+	var c *Tags
+	if t, ok := src.(*Tags); ok {
+		c = copyTags(t)
+	} else {
+		c = tagsFrom(src, targetMajor)
+	}
+
+	dropped := make(map[string]bool)
+	drop := func(id string) {
+		if _, ok := c.Frames[id]; ok {
+			c.rename(id, "")
+			dropped[id] = true
+		}
+	}
+
+	for id := range c.Frames {
+		if len(id) != 3 {
+			continue
+		}
+		newID, ok := v22Equiv[id]
+		if !ok {
+			newID, ok = v22DateEquiv[id]
+		}
+		if !ok {
+			drop(id)
+			continue
+		}
+		if _, exists := c.Frames[newID]; exists {
+			c.rename(id, "")
+		} else {
+			c.rename(id, newID)
+		}
+	}
+
+	upgradeFrames(c)
+	if targetMajor == 4 {
+		for _, id := range v23Only {
+			drop(id)
+		}
+	} else {
+		downgradeFrames(c)
+		for _, id := range v24Only {
+			if desc, ok := txxxDesc(id); ok {
+				if _, exists := c.txxx[desc]; !exists {
+					c.txxx[desc] = c.Frames[id]
+				}
+				c.rename(id, "")
+				continue
+			}
+			drop(id)
+		}
+	}
+
+	raw := c.raw[:0]
+	for _, f := range c.raw {
+		if f.id == "PIC" {
+			b, ok := picToAPIC(f.data)
+			if !ok {
+				dropped["PIC"] = true
+				continue
+			}
+			f = rawFrame{"APIC", b}
+		}
+		if !dropped[f.id] {
+			raw = append(raw, f)
+		}
+	}
+	c.raw = raw
+
+	h := Header{Major: targetMajor}
+	copy(h.Magic[:], Magic)
+	t, err := makeTags(&h, c.Frames)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.TotalTracks = c.TotalTracks
+	t.TotalDiscs = c.TotalDiscs
+	t.values = c.values
+	t.txxx = c.txxx
+	t.commLang, t.commDesc = c.commLang, c.commDesc
+	t.raw = c.raw
+
+	var ids []string
+	for id := range dropped {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return t, ids, nil
+}
+
+// copyTags copies the frames of t, so that converting them leaves t alone.
+func copyTags(t *Tags) *Tags {
+	c := &Tags{
+		Frames:      make(map[string]string, len(t.Frames)),
+		values:      make(map[string][]string, len(t.values)),
+		txxx:        make(map[string]string, len(t.txxx)),
+		raw:         append([]rawFrame(nil), t.raw...),
+		TotalTracks: t.TotalTracks,
+		TotalDiscs:  t.TotalDiscs,
+		commLang:    t.commLang,
+		commDesc:    t.commDesc,
+	}
+	for id, s := range t.Frames {
+		c.Frames[id] = s
+	}
+	for id, vals := range t.values {
+		c.values[id] = vals
+	}
+	for desc, s := range t.txxx {
+		c.txxx[desc] = s
+	}
+	return c
+}
+
+// tagsFrom makes the frames of a tag out of tags of another format.
+func tagsFrom(src sound.Tags, major uint8) *Tags {
+	c := &Tags{
+		Frames: make(map[string]string),
+		values: make(map[string][]string),
+		txxx:   make(map[string]string),
+	}
+	set := func(id, s string) {
+		if s != "" {
+			c.Frames[id] = s
+		}
+	}
+
+	set("TIT2", src.Title())
+	set("TPE1", src.Artist())
+	set("TPE2", src.AlbumArtist())
+	set("TALB", src.Album())
+	set("TCON", src.Genre())
+	set("TCOM", src.Composer())
+	set("COMM", src.Notes())
+	if n := src.Track(); n > 0 {
+		set("TRCK", strconv.Itoa(n))
+	}
+	if n := src.Disc(); n > 0 {
+		set("TPOS", strconv.Itoa(n))
+	}
+	if d := src.Date(); !d.IsZero() {
+		set("TDRC", formatDate(d))
+	}
+
+	if st, ok := src.(sound.SubtitleTags); ok {
+		set("TIT3", st.Subtitle())
+		set("TSST", st.SetSubtitle())
+	}
+	if st, ok := src.(sound.SortTags); ok {
+		set("TSOT", st.SortTitle())
+		set("TSOP", st.SortArtist())
+		set("TSO2", st.SortAlbumArtist())
+		set("TSOA", st.SortAlbum())
+		set("TSOC", st.SortComposer())
+	}
+	if mt, ok := src.(sound.MultiValueTags); ok {
+		for id, vals := range map[string][]string{
+			"TPE1": mt.Artists(),
+			"TCON": mt.Genres(),
+			"TCOM": mt.Composers(),
+		} {
+			if len(vals) > 1 {
+				set(id, vals[0])
+				c.values[id] = vals
+			}
+		}
+	}
+	if p, ok := src.(sound.Picturer); ok {
+		for _, pic := range p.Pictures() {
+			c.raw = append(c.raw, rawFrame{"APIC", encodePicture(pic, major)})
+		}
+	}
+	return c
+}
+
+// formatDate formats d for TDRC as precisely as it seems to be known: to the
+// second if it has a time of day, and otherwise to the day, or the year if it
+// falls on the first of January.
+func formatDate(d time.Time) string {
+	switch {
+	case d.Hour() != 0 || d.Minute() != 0 || d.Second() != 0:
+		return d.Format("2006-01-02T15:04:05")
+	case d.Month() != time.January || d.Day() != 1:
+		return d.Format("2006-01-02")
+	}
+	return d.Format("2006")
+}
+
+// encodePicture encodes the body of an APIC frame.
+func encodePicture(pic sound.Picture, major uint8) []byte {
+	enc := textEncoding(pic.Description, major)
+	b := append([]byte{enc}, pic.MIMEType...)
+	b = append(b, 0, byte(pic.Type))
+	b = append(b, encodeString(pic.Description, enc, true)...)
+	return append(b, pic.Data...)
+}
+
+// rename moves the frame id, and any other values it has, to newID, or
+// removes it if newID is "".
+func (t *Tags) rename(id, newID string) {
+	s, ok := t.Frames[id]
+	if !ok {
+		return
+	}
+	vals, multi := t.values[id]
+	delete(t.Frames, id)
+	delete(t.values, id)
+	if newID == "" {
+		return
+	}
+	t.Frames[newID] = s
+	if multi {
+		t.values[newID] = vals
+	}
+}
+
+// upgradeFrames converts the ID3v2.3 frames that have ID3v2.4 equivalents.
+// TYER, TDAT (DDMM) and TIME (HHMM) are merged into TDRC, unless it is
+// already more precise than the year.
+func upgradeFrames(t *Tags) {
+	year := t.Frames["TYER"]
+	if tdrc := t.Frames["TDRC"]; year == "" && len(tdrc) == 4 {
+		year = tdrc
+	}
+	if tdrc := t.Frames["TDRC"]; year != "" && (tdrc == "" || tdrc == year) {
+		date := year
+		if dm := t.Frames["TDAT"]; len(dm) == 4 {
+			date += "-" + dm[2:] + "-" + dm[:2]
+			if hm := t.Frames["TIME"]; len(hm) == 4 {
+				date += "T" + hm[:2] + ":" + hm[2:]
+			}
+		}
+		t.Frames["TDRC"] = date
+	}
+	for _, id := range []string{"TYER", "TDAT", "TIME"} {
+		t.rename(id, "")
+	}
+
+	if _, ok := t.Frames["TDOR"]; ok {
+		t.rename("TORY", "")
+	} else {
+		t.rename("TORY", "TDOR")
+	}
+
+	if s, ok := t.Frames["IPLS"]; ok {
+		t.rename("IPLS", "")
+		if _, exists := t.Frames["TIPL"]; !exists && len(s) > 0 {
+			people, err := decodeTextFrame(s[0], []byte(s[1:]), false)
+			if err != nil {
+				Logger("id3v2: decode IPLS: %v", err)
+				return
+			}
+			vals := strings.Split(strings.TrimRight(people, "\x00"), "\x00")
+			for i := range vals {
+				vals[i] = strings.TrimPrefix(vals[i], "\ufeff")
+			}
+			t.Frames["TIPL"] = vals[0]
+			if len(vals) > 1 {
+				t.values["TIPL"] = vals
+			}
+		}
+	}
+}
+
+// downgradeFrames converts the ID3v2.4 frames that have ID3v2.3 equivalents,
+// the reverse of upgradeFrames.
+func downgradeFrames(t *Tags) {
+	if tdrc, ok := t.Frames["TDRC"]; ok {
+		t.rename("TDRC", "")
+		// yyyy-MM-ddTHH:mm:ss, any part of which after the year may be left
+		// off
+		if len(tdrc) >= 4 {
+			t.Frames["TYER"] = tdrc[:4]
+		}
+		if len(tdrc) >= 10 {
+			t.Frames["TDAT"] = tdrc[8:10] + tdrc[5:7]
+		}
+		if len(tdrc) >= 16 {
+			t.Frames["TIME"] = tdrc[11:13] + tdrc[14:16]
+		}
+	}
+
+	if tdor, ok := t.Frames["TDOR"]; ok {
+		t.rename("TDOR", "")
+		if len(tdor) >= 4 {
+			t.Frames["TORY"] = tdor[:4]
+		}
+	}
+
+	var people []string
+	for _, id := range []string{"TIPL", "TMCL"} {
+		people = append(people, t.allValues(id)...)
+		t.rename(id, "")
+	}
+	if len(people) > 0 {
+		// each string is terminated, and in UTF-16 has its own BOM
+		enc := textEncoding(strings.Join(people, ""), 3)
+		b := []byte{enc}
+		for _, s := range people {
+			b = append(b, encodeString(s, enc, true)...)
+		}
+		t.Frames["IPLS"] = string(b)
+	}
+}
+
+// txxxDesc returns the TXXX description that stands for the frame id.
+func txxxDesc(id string) (string, bool) {
+	for desc, frameID := range txxxEquiv {
+		if frameID == id {
+			return desc, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,157 @@
+package id3v2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+)
+
+func TestConvert(t *testing.T) {
+	v23 := &Tags{
+		Header: &Header{Major: 3},
+		Frames: map[string]string{
+			"TIT2": "title",
+			"TYER": "2001",
+			"TDAT": "0203",
+			"TIME": "1405",
+			"TORY": "1999",
+			"IPLS": "\x00producer\x00someone\x00mix\x00another\x00",
+			"RVAD": "\x03\x10\x00\x00\x00\x00",
+		},
+	}
+	v24, dropped, err := Convert(v23, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"TIT2": "title",
+		"TDRC": "2001-03-02T14:05",
+		"TDOR": "1999",
+		"TIPL": "producer",
+	}
+	if !reflect.DeepEqual(v24.Frames, want) {
+		t.Errorf("got %q, expected %q", v24.Frames, want)
+	}
+	if people := v24.allValues("TIPL"); len(people) != 4 || people[3] != "another" {
+		t.Errorf("got people %q", people)
+	}
+	if !reflect.DeepEqual(dropped, []string{"RVAD"}) {
+		t.Errorf("got dropped frames %q, expected RVAD", dropped)
+	}
+	if v23.Frames["TYER"] != "2001" {
+		t.Error("source tag was changed")
+	}
+
+	// and back again, through a written tag
+	v24.Frames["TMOO"] = "mellow"
+	back, dropped, err := Convert(v24, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != nil {
+		t.Errorf("got dropped frames %q", dropped)
+	}
+	var buf bytes.Buffer
+	if _, err = back.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	st, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := st.(*Tags)
+	if tags.Major != 3 {
+		t.Errorf("wrote ID3v2.%d", tags.Major)
+	}
+	for id, s := range map[string]string{"TYER": "2001", "TDAT": "0203", "TIME": "1405", "TORY": "1999", "TMOO": "mellow"} {
+		if tags.Frames[id] != s {
+			t.Errorf("%s: got %q, expected %q", id, tags.Frames[id], s)
+		}
+	}
+	if d := tags.Date(); !d.Equal(time.Date(2001, 3, 2, 14, 5, 0, 0, time.UTC)) {
+		t.Errorf("got date %v", d)
+	}
+	again, _, err := Convert(tags, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if people := again.allValues("TIPL"); !reflect.DeepEqual(people, v24.allValues("TIPL")) {
+		t.Errorf("got people %q", people)
+	}
+}
+
+func TestConvertV22(t *testing.T) {
+	// as decoded without NoFrameTranslation, which leaves TDA and TIM
+	v22 := &Tags{
+		Header: &Header{Major: 2},
+		Frames: map[string]string{"TT2": "title", "TYE": "1987", "TDA": "3112", "XYZ": "?"},
+		raw: []rawFrame{
+			{"PIC", []byte("\x00PNG\x03\x00\x89PNG")},
+			{"PIC", []byte("\x00???\x03\x00????")},
+		},
+	}
+	v23, dropped, err := Convert(v22, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"TIT2": "title", "TYER": "1987", "TDAT": "3112"}
+	if !reflect.DeepEqual(v23.Frames, want) {
+		t.Errorf("got %q, expected %q", v23.Frames, want)
+	}
+	if pics := v23.Pictures(); len(pics) != 1 {
+		t.Errorf("got %d pictures, expected 1", len(pics))
+	}
+	if !reflect.DeepEqual(dropped, []string{"PIC", "XYZ"}) {
+		t.Errorf("got dropped frames %q, expected PIC and XYZ", dropped)
+	}
+
+	if _, _, err := Convert(v22, 2); err != ErrUnsupportedVersion {
+		t.Errorf("got %v, expected ErrUnsupportedVersion", err)
+	}
+}
+
+type otherTags struct{}
+
+func (otherTags) Title() string       { return "title" }
+func (otherTags) AlbumArtist() string { return "" }
+func (otherTags) Artist() string      { return "artist" }
+func (otherTags) Album() string       { return "album" }
+func (otherTags) Genre() string       { return "" }
+func (otherTags) Disc() int           { return 0 }
+func (otherTags) Track() int          { return 7 }
+func (otherTags) Date() time.Time     { return time.Date(2010, 6, 1, 0, 0, 0, 0, time.UTC) }
+func (otherTags) Composer() string    { return "" }
+func (otherTags) Notes() string       { return "notes" }
+
+func (otherTags) Pictures() []sound.Picture {
+	return []sound.Picture{{MIMEType: "image/png", Type: 3, Description: "front", Data: []byte("\x89PNG")}}
+}
+
+func TestConvertOther(t *testing.T) {
+	tags, _, err := Convert(otherTags{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"TIT2": "title",
+		"TPE1": "artist",
+		"TALB": "album",
+		"TRCK": "7",
+		"COMM": "notes",
+		"TYER": "2010",
+		"TDAT": "0106",
+	}
+	if !reflect.DeepEqual(tags.Frames, want) {
+		t.Errorf("got %q, expected %q", tags.Frames, want)
+	}
+	if tags.Track() != 7 || !tags.Date().Equal(otherTags{}.Date()) {
+		t.Errorf("got track %d, date %v", tags.Track(), tags.Date())
+	}
+	pics := tags.Pictures()
+	if len(pics) != 1 || pics[0].Description != "front" || pics[0].MIMEType != "image/png" {
+		t.Errorf("got pictures %+v", pics)
+	}
+}
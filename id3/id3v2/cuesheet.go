@@ -0,0 +1,36 @@
+package id3v2
+
+import (
+	"strings"
+
+	"ktkr.us/pkg/sound"
+)
+
+// UserText returns the value of the TXXX frame with the given description,
+// matched case-insensitively, or "" if there is none.
+func (t *Tags) UserText(desc string) string {
+	if s, ok := t.txxx[desc]; ok {
+		return s
+	}
+	for k, s := range t.txxx {
+		if strings.EqualFold(k, desc) {
+			return s
+		}
+	}
+	return ""
+}
+
+// Cuesheet parses the cue sheet that some rippers embed in a tag on an album
+// ripped to a single file. It is taken from the TXXX frame described as
+// CUESHEET, or failing that, the comment if it reads as a cue sheet. If there
+// is neither, it returns sound.ErrNoCuesheet.
+func (t *Tags) Cuesheet() (*sound.Cuesheet, error) {
+	if s := t.UserText("CUESHEET"); s != "" {
+		return sound.ParseCuesheet(strings.NewReader(s))
+	}
+	c, err := sound.ParseCuesheet(strings.NewReader(t.Frames["COMM"]))
+	if err != nil {
+		return nil, sound.ErrNoCuesheet
+	}
+	return c, nil
+}
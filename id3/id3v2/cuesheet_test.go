@@ -0,0 +1,39 @@
+package id3v2
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+)
+
+func TestCuesheet(t *testing.T) {
+	cue := "PERFORMER \"Artist\"\r\nTITLE \"Album\"\r\n" +
+		"  TRACK 01 AUDIO\r\n    INDEX 01 00:00:00\r\n" +
+		"  TRACK 02 AUDIO\r\n    TITLE \"Two\"\r\n    INDEX 01 03:25:15\r\n"
+	body := "\x00CUESHEET\x00" + cue
+	frame := "TXXX" + string([]byte{0, 0, byte(len(body) >> 8), byte(len(body))}) + "\x00\x00" + body
+	n := len(frame)
+	tag := "ID3\x03\x00\x00" + string([]byte{0, 0, byte(n >> 7), byte(n & 0x7f)}) + frame
+
+	tags, err := Decode(bytes.NewReader([]byte(tag)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := tags.(sound.Cuesheeter).Cuesheet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Title != "Album" || len(c.Tracks) != 2 {
+		t.Fatalf("got %+v", c)
+	}
+	if tr := c.Tracks[1]; tr.Title != "Two" || tr.Start() != 3*time.Minute+25*time.Second+200*time.Millisecond {
+		t.Errorf("got track %+v", tr)
+	}
+
+	empty := &Tags{Frames: map[string]string{"COMM": "just a comment"}}
+	if _, err := empty.Cuesheet(); err != sound.ErrNoCuesheet {
+		t.Errorf("got %v, expected ErrNoCuesheet", err)
+	}
+}
@@ -0,0 +1,187 @@
+package id3v2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// WriteTo writes the tag to w as ID3v2.3 if it was decoded from an ID3v2.3
+// tag, or ID3v2.4 otherwise, with no padding. It returns the number of bytes
+// written, which is the size the tag takes up in a file.
+//
+// Text frames, comments and the TXXX values are encoded afresh, as
+// ISO-8859-1 where they fit and otherwise as UTF-8, or UTF-16 in ID3v2.3.
+// Text frames keep all of their values in ID3v2.4, and only the first in
+// ID3v2.3, which has no way to separate them. The comment keeps the language
+// and description it was read with, or is in English with no description.
+// Pictures are written from their original frames, with their descriptions
+// re-encoded if ID3v2.3 can't hold their encoding, and other frames in
+// Frames are written as they were read. Frames left over from ID3v2.2 that
+// have no later equivalent are dropped.
+func (t *Tags) WriteTo(w io.Writer) (int64, error) {
+	major := uint8(4)
+	if t.Header != nil && t.Major == 3 {
+		major = 3
+	}
+
+	var body bytes.Buffer
+	ids := make([]string, 0, len(t.Frames))
+	for id := range t.Frames {
+		if len(id) == 4 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s := t.Frames[id]
+		switch {
+		case id == "COMM":
+			lang := t.commLang
+			if len(lang) != 3 {
+				lang = "eng"
+			}
+			enc := textEncoding(t.commDesc+s, major)
+			b := append([]byte{enc}, lang...)
+			b = append(b, encodeString(t.commDesc, enc, true)...)
+			writeFrame(&body, major, id, append(b, encodeString(s, enc, false)...))
+		case id[0] == 'T', id == "GRP1", id == "MVNM", id == "MVIN":
+			if vals := t.values[id]; major == 4 && len(vals) > 1 && vals[0] == s {
+				s = strings.Join(vals, "\x00")
+			}
+			enc := textEncoding(s, major)
+			writeFrame(&body, major, id, append([]byte{enc}, encodeString(s, enc, false)...))
+		default:
+			writeFrame(&body, major, id, []byte(s))
+		}
+	}
+
+	descs := make([]string, 0, len(t.txxx))
+	for desc := range t.txxx {
+		descs = append(descs, desc)
+	}
+	sort.Strings(descs)
+	for _, desc := range descs {
+		// Descriptions that decoding translated into a frame are written as
+		// that frame alone, or the TXXX value would override any change to
+		// it when the tag is read back.
+		if id, ok := txxxEquiv[desc]; ok {
+			if _, ok := t.Frames[id]; ok {
+				continue
+			}
+		}
+		s := t.txxx[desc]
+		enc := textEncoding(desc+s, major)
+		b := append([]byte{enc}, encodeString(desc, enc, true)...)
+		writeFrame(&body, major, "TXXX", append(b, encodeString(s, enc, false)...))
+	}
+
+	for _, f := range t.raw {
+		switch f.id {
+		case "APIC":
+			data := f.data
+			if major == 3 && len(data) > 0 && data[0] > encUTF16_BOM {
+				// UTF-16BE and UTF-8 are new in ID3v2.4
+				if pic, err := decodePicture(data, false); err == nil {
+					data = encodePicture(*pic, major)
+				}
+			}
+			writeFrame(&body, major, f.id, data)
+		case "PIC":
+			if b, ok := picToAPIC(f.data); ok {
+				writeFrame(&body, major, "APIC", b)
+			}
+		}
+	}
+
+	h := Header{Major: major, Size: unsynchsafe32(uint32(body.Len()))}
+	copy(h.Magic[:], Magic)
+	err := binary.Write(w, binary.BigEndian, &h)
+	if err != nil {
+		return 0, err
+	}
+	n, err := body.WriteTo(w)
+	return tagHeaderSize + n, err
+}
+
+// writeFrame writes a frame header and body. Frame sizes are synchsafe in
+// ID3v2.4 and plain in ID3v2.3.
+func writeFrame(w *bytes.Buffer, major uint8, id string, data []byte) {
+	size := uint32(len(data))
+	if major == 4 {
+		size = unsynchsafe32(size)
+	}
+	w.WriteString(id)
+	binary.Write(w, binary.BigEndian, size)
+	w.Write([]byte{0, 0})
+	w.Write(data)
+}
+
+// unsynchsafe32 is the inverse of synchsafe32, spreading n over the low 7
+// bits of each byte.
+func unsynchsafe32(n uint32) uint32 {
+	return n&0x7f | (n&0x3f80)<<1 | (n&0x1fc000)<<2 | (n&0xfe00000)<<3
+}
+
+// textEncoding picks the encoding for s: ISO-8859-1 if it will do, and
+// otherwise UTF-8, which ID3v2.3 doesn't have, so UTF-16 there.
+func textEncoding(s string, major uint8) byte {
+	for _, r := range s {
+		if r > 0xff {
+			if major == 3 {
+				return encUTF16_BOM
+			}
+			return encUTF8
+		}
+	}
+	return encISO8859_1
+}
+
+// encodeString encodes s in the given encoding, followed by a terminator if
+// terminate is set.
+func encodeString(s string, enc byte, terminate bool) []byte {
+	var b []byte
+	switch enc {
+	case encISO8859_1:
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+	case encUTF16_BOM:
+		b = []byte{0xff, 0xfe}
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	default:
+		b = []byte(s)
+	}
+	if terminate {
+		b = append(b, 0)
+		if enc == encUTF16_BOM {
+			b = append(b, 0)
+		}
+	}
+	return b
+}
+
+// picToAPIC converts the content of an ID3v2.2 PIC frame to an APIC frame by
+// replacing its image format with a MIME type.
+func picToAPIC(b []byte) ([]byte, bool) {
+	if len(b) < 4 {
+		return nil, false
+	}
+	var mime string
+	for format, m := range v22ImageFormats {
+		if bytes.EqualFold(b[1:4], []byte(format)) {
+			mime = m
+		}
+	}
+	if mime == "" {
+		return nil, false
+	}
+	apic := append([]byte{b[0]}, mime...)
+	apic = append(apic, 0)
+	return append(apic, b[4:]...), true
+}
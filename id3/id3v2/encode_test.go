@@ -0,0 +1,210 @@
+package id3v2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	frames := map[string]string{
+		"TIT2": "títle",
+		"TPE1": "日本語",
+		"TALB": "album",
+		"TRCK": "3/12",
+		"COMM": "コメント",
+		"MVNM": "Allegro",
+	}
+	pic := "\x00image/png\x00\x03desc\x00\x89PNG"
+
+	for _, major := range []uint8{3, 4} {
+		in := &Tags{
+			Header: &Header{Major: major},
+			Frames: frames,
+			txxx:   map[string]string{"CUSTOM": "ünïcode ✓"},
+			raw:    []rawFrame{{"APIC", []byte(pic)}},
+		}
+		var buf bytes.Buffer
+		n, err := in.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("2.%d: wrote %d bytes, reported %d", major, buf.Len(), n)
+		}
+
+		tags, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("2.%d: %v", major, err)
+		}
+		out := tags.(*Tags)
+		if out.Major != major || out.TotalSize() != n {
+			t.Errorf("2.%d: got version %d, size %d", major, out.Major, out.TotalSize())
+		}
+		for id, s := range frames {
+			if out.Frames[id] != s {
+				t.Errorf("2.%d: %s: got %q, expected %q", major, id, out.Frames[id], s)
+			}
+		}
+		if out.Track() != 3 || out.TotalTracks != 12 {
+			t.Errorf("2.%d: got track %d/%d", major, out.Track(), out.TotalTracks)
+		}
+		if s := out.UserText("CUSTOM"); s != "ünïcode ✓" {
+			t.Errorf("2.%d: got TXXX %q", major, s)
+		}
+		if pics := out.Pictures(); len(pics) != 1 || string(pics[0].Data) != "\x89PNG" {
+			t.Errorf("2.%d: got pictures %+v", major, pics)
+		}
+	}
+}
+
+func TestWriteToKeeps(t *testing.T) {
+	// a German comment with a description, and a picture described in UTF-8
+	apic := "\x03image/png\x00\x03Vorderseite ✓\x00\x89PNG"
+
+	in := &Tags{
+		Header:   &Header{Major: 3},
+		Frames:   map[string]string{"COMM": "Kommentar"},
+		commLang: "deu",
+		commDesc: "Beschreibung ✓",
+		raw:      []rawFrame{{"APIC", []byte(apic)}},
+	}
+	var buf bytes.Buffer
+	if _, err := in.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if i := bytes.Index(b, []byte("APIC")); i < 0 || b[i+10] != encUTF16_BOM {
+		t.Errorf("APIC frame isn't in UTF-16 for ID3v2.3")
+	}
+
+	tags, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := tags.(*Tags)
+	if out.Notes() != "Kommentar" || out.commLang != "deu" || out.commDesc != "Beschreibung ✓" {
+		t.Errorf("got comment %q in %q, described %q", out.Notes(), out.commLang, out.commDesc)
+	}
+	if pics := out.Pictures(); len(pics) != 1 || pics[0].Description != "Vorderseite ✓" || string(pics[0].Data) != "\x89PNG" {
+		t.Errorf("got pictures %+v", pics)
+	}
+}
+
+func TestWriteToTranslatedTXXX(t *testing.T) {
+	// an album given only as a TXXX frame, which decoding makes TALB of
+	frame := "\x00ALBUM\x00old"
+	frames := "TXXX\x00\x00\x00" + string([]byte{byte(len(frame))}) + "\x00\x00" + frame
+	tag := "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+
+	tags, err := Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := tags.(*Tags)
+	if in.Album() != "old" {
+		t.Fatalf("got album %q", in.Album())
+	}
+	in.Frames["TALB"] = "new"
+
+	var buf bytes.Buffer
+	if _, err := in.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("ALBUM")) {
+		t.Error("TXXX frame for the album was written as well as TALB")
+	}
+	tags, err = Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := tags.Album(); a != "new" {
+		t.Errorf("got album %q, expected %q", a, "new")
+	}
+}
+
+func TestConcatenatedTags(t *testing.T) {
+	first := &Tags{
+		Header: &Header{Major: 3},
+		Frames: map[string]string{"TIT2": "short", "TPE1": "artist"},
+	}
+	tests := []struct {
+		major  uint8
+		update bool
+		artist string
+	}{
+		// ID3v2.3 has no update flag, so the frames are merged
+		{3, false, "artist"},
+		{4, true, "artist"},
+		// and an ID3v2.4 tag that isn't an update replaces the first
+		{4, false, ""},
+	}
+	for _, test := range tests {
+		second := &Tags{
+			Header: &Header{Major: test.major},
+			Frames: map[string]string{"TIT2": "full title", "TALB": "album", "TRCK": "7"},
+		}
+		var buf, b bytes.Buffer
+		n1, err := first.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n2, err := second.WriteTo(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.update {
+			n2 += 6
+			buf.Write(markUpdate(b.Bytes()))
+		} else {
+			buf.Write(b.Bytes())
+		}
+		buf.WriteString("audio")
+
+		r := bufio.NewReader(&buf)
+		tags, err := Decode(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := tags.(*Tags)
+		if out.Title() != "full title" || out.Artist() != test.artist || out.Album() != "album" || out.Track() != 7 {
+			t.Errorf("2.%d, update %t: got %q, %q, %q, %d", test.major, test.update, out.Title(), out.Artist(), out.Album(), out.Track())
+		}
+		if out.TotalSize() != n1+n2 {
+			t.Errorf("2.%d, update %t: got total size %d, expected %d", test.major, test.update, out.TotalSize(), n1+n2)
+		}
+		rest, _ := io.ReadAll(r)
+		if string(rest) != "audio" {
+			t.Errorf("2.%d, update %t: left %q after the tags", test.major, test.update, rest)
+		}
+	}
+}
+
+// markUpdate adds an extended header to an ID3v2.4 tag that marks it as an
+// update.
+func markUpdate(tag []byte) []byte {
+	b := append([]byte(nil), tag[:tagHeaderSize]...)
+	b[5] |= flagExtendedHeader
+	binary.BigEndian.PutUint32(b[6:], unsynchsafe32(synchsafe32(binary.BigEndian.Uint32(b[6:]))+6))
+	b = append(b, 0, 0, 0, 6, 1, extFlagTagIsUpdate)
+	return append(b, tag[tagHeaderSize:]...)
+}
+
+func TestManyTags(t *testing.T) {
+	// enough empty tags that decoding each in turn would run out of stack
+	empty := "ID3\x03\x00\x00\x00\x00\x00\x00"
+	tag := "ID3\x03\x00\x00\x00\x00\x00\x10" + "TIT2\x00\x00\x00\x06\x00\x00\x00title"
+	file := tag + strings.Repeat(empty, 1<<20)
+
+	tags, err := Decode(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := tags.(*Tags)
+	if out.Title() != "title" || out.TotalSize() != int64(len(file)) {
+		t.Errorf("got title %q, size %d of %d", out.Title(), out.TotalSize(), len(file))
+	}
+}
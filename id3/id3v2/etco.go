@@ -0,0 +1,81 @@
+package id3v2
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNoEvents       = errors.New("id3v2: no ETCO frame")
+	ErrBadEvents      = errors.New("id3v2: malformed ETCO frame")
+	ErrFrameTimestamp = errors.New("id3v2: ETCO frame counts MPEG frames but no frame duration given")
+)
+
+// timestamp formats, as used by ETCO and other timed frames
+const (
+	timestampMPEGFrames = 1
+	timestampMillis     = 2
+)
+
+// Some of the event types defined for ETCO frames.
+const (
+	EventPadding       = 0x00
+	EventSilenceEnd    = 0x01
+	EventIntroStart    = 0x02
+	EventMainPartStart = 0x03
+	EventOutroStart    = 0x04
+	EventOutroEnd      = 0x05
+	EventVerseStart    = 0x06
+	EventRefrainStart  = 0x07
+	EventKeyChange     = 0x0B
+	EventTimeChange    = 0x0C
+	EventAudioEnd      = 0xFD
+	EventFileEnd       = 0xFE
+)
+
+// Event is one of the timed events of an ETCO (event timing codes) frame.
+type Event struct {
+	Type byte
+	Time time.Duration
+}
+
+// Events decodes the tag's ETCO frame. If its timestamps count MPEG frames
+// rather than milliseconds, they are converted with frameDuration, the length
+// of one frame, and ErrFrameTimestamp is returned if that is 0.
+func (t *Tags) Events(frameDuration time.Duration) ([]Event, error) {
+	s, ok := t.Frames["ETCO"]
+	if !ok {
+		return nil, ErrNoEvents
+	}
+	return decodeETCO([]byte(s), frameDuration)
+}
+
+func decodeETCO(b []byte, frameDuration time.Duration) ([]Event, error) {
+	if len(b) < 1 || (len(b)-1)%5 != 0 {
+		return nil, ErrBadEvents
+	}
+
+	var unit time.Duration
+	switch b[0] {
+	case timestampMPEGFrames:
+		if frameDuration == 0 {
+			return nil, ErrFrameTimestamp
+		}
+		unit = frameDuration
+	case timestampMillis:
+		unit = time.Millisecond
+	default:
+		return nil, ErrBadEvents
+	}
+
+	events := make([]Event, 0, (len(b)-1)/5)
+	for b = b[1:]; len(b) >= 5; b = b[5:] {
+		events = append(events, Event{
+			Type: b[0],
+			Time: time.Duration(binary.BigEndian.Uint32(b[1:])) * unit,
+		})
+	}
+	return events, nil
+}
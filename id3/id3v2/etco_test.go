@@ -0,0 +1,42 @@
+package id3v2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	body := "\x00\x00\x00\x00\x10" + "\x03\x00\x00\x00\x20" + "\xfd\x00\x00\x01\x00"
+	expected := []Event{{EventPadding, 16}, {EventMainPartStart, 32}, {EventAudioEnd, 256}}
+
+	tests := []struct {
+		format        string
+		frameDuration time.Duration
+		unit          time.Duration
+	}{
+		{"\x02", 0, time.Millisecond},
+		// 1152 samples at 44.1 kHz
+		{"\x01", 26122449 * time.Nanosecond, 26122449 * time.Nanosecond},
+	}
+	for _, test := range tests {
+		tags := &Tags{Frames: map[string]string{"ETCO": test.format + body}}
+		events, err := tags.Events(test.frameDuration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != len(expected) {
+			t.Fatalf("format %q: got %v", test.format, events)
+		}
+		for i, e := range expected {
+			e.Time *= test.unit
+			if events[i] != e {
+				t.Errorf("format %q: event %d: got %v, expected %v", test.format, i, events[i], e)
+			}
+		}
+	}
+
+	tags := &Tags{Frames: map[string]string{"ETCO": "\x01" + body}}
+	if _, err := tags.Events(0); err != ErrFrameTimestamp {
+		t.Errorf("got %v, expected ErrFrameTimestamp", err)
+	}
+}
@@ -0,0 +1,77 @@
+package id3v2
+
+import (
+	"strconv"
+	"strings"
+
+	"ktkr.us/pkg/sound/id3/id3v1"
+)
+
+// Genre returns the genres of the TCON frame, as returned by Genres, joined
+// by commas.
+func (t *Tags) Genre() string { return strings.Join(t.Genres(), ", ") }
+
+// Genres returns all of the genres of the TCON frame, of which ID3v2.4 allows
+// several values separated by nulls, with references to the ID3v1 genres and
+// the special codes expanded.
+func (t *Tags) Genres() []string {
+	var genres []string
+	for _, s := range t.allValues("TCON") {
+		genres = append(genres, parseGenres(s)...)
+	}
+	return genres
+}
+
+// parseGenres parses a TCON value. In ID3v2.3 it starts with any number of
+// references in parentheses: the number of an ID3v1 genre, or RX for a remix
+// or CR for a cover. Text after them refines the genre, and "((" stands for a
+// literal "(". ID3v2.4 drops the parentheses, and the value may be just a
+// number, RX or CR. Refinements that repeat the name of the genre before
+// them, as in "(17)Rock", are left out.
+func parseGenres(s string) []string {
+	var genres []string
+	for strings.HasPrefix(s, "(") && !strings.HasPrefix(s, "((") {
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			break
+		}
+		name, ok := genreName(s[1:end])
+		if !ok {
+			break
+		}
+		genres = append(genres, name)
+		s = s[end+1:]
+	}
+
+	if strings.HasPrefix(s, "((") {
+		s = s[1:]
+	}
+	if s == "" {
+		return genres
+	}
+	if len(genres) == 0 {
+		if name, ok := genreName(s); ok {
+			return []string{name}
+		}
+	} else if genres[len(genres)-1] == s {
+		return genres
+	}
+	return append(genres, s)
+}
+
+// genreName returns the name of the genre that code stands for, if it is
+// the number of an ID3v1 genre, RX or CR.
+func genreName(code string) (string, bool) {
+	switch code {
+	case "RX":
+		return "Remix", true
+	case "CR":
+		return "Cover", true
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 {
+		return "", false
+	}
+	name := id3v1.GenreName(n)
+	return name, name != ""
+}
@@ -0,0 +1,47 @@
+package id3v2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGenres(t *testing.T) {
+	tests := []struct {
+		s      string
+		genres []string
+	}{
+		{"Rock", []string{"Rock"}},
+		{"(17)", []string{"Rock"}},
+		{"(17)Rock", []string{"Rock"}},
+		{"(RX)", []string{"Remix"}},
+		{"(CR)(17)", []string{"Cover", "Rock"}},
+		{"(0)(3)Merged", []string{"Blues", "Dance", "Merged"}},
+		{"(4)Eurodisco", []string{"Disco", "Eurodisco"}},
+		{"((Not a reference)", []string{"(Not a reference)"}},
+		// ID3v2.4
+		{"17", []string{"Rock"}},
+		{"RX", []string{"Remix"}},
+		// out of range, so kept as is
+		{"(999)", []string{"(999)"}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		if genres := parseGenres(test.s); !reflect.DeepEqual(genres, test.genres) {
+			t.Errorf("%q: got %q, expected %q", test.s, genres, test.genres)
+		}
+	}
+
+	tags := &Tags{Frames: map[string]string{"TCON": "(0)(3)Merged"}}
+	if g := tags.Genre(); g != "Blues, Dance, Merged" {
+		t.Errorf("got %q", g)
+	}
+
+	// every value of an ID3v2.4 frame counts
+	tags = &Tags{
+		Frames: map[string]string{"TCON": "0"},
+		values: map[string][]string{"TCON": {"0", "RX", "Merged"}},
+	}
+	if g := tags.Genre(); g != "Blues, Remix, Merged" {
+		t.Errorf("got %q", g)
+	}
+}
@@ -9,14 +9,16 @@ import (
 	"encoding/binary"
 	"io"
 	"io/ioutil"
-	"log"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/dateutil"
 )
 
 // Tags is an ID3v2 tag set.
@@ -30,19 +32,204 @@ type Tags struct {
 
 	TotalTracks int
 	TotalDiscs  int
+
+	update bool
+	// binary frames that don't fit in Frames, in the order they appeared
+	raw []rawFrame
+	// all of the values of text frames that have more than one
+	values map[string][]string
+	// TXXX values by description
+	txxx map[string]string
+	// the language and description of the COMM frame that Notes is from,
+	// so that WriteTo can keep them
+	commLang, commDesc string
+	// total is the size of the whole tag, including the header
+	total int64
+	// unsynch is whether the whole tag was unsynchronised, and
+	// frameUnsynch whether any of its frames were by their own flags
+	unsynch, frameUnsynch bool
+	// every frame in order, if DecodeOptions.KeepOrder was set
+	ordered []Frame
+}
+
+// Frame is a frame as it appeared in the tag.
+type Frame struct {
+	// ID is the frame ID the tag was written with, such as "TIT2", or "TT2"
+	// in an ID3v2.2 tag.
+	ID string
+	// Raw is the body of the frame as it was stored, after the data length
+	// indicator if there is one. It is still compressed or unsynchronised if
+	// the frame was.
+	Raw []byte
+	// Value is the decoded value of a text or comment frame, or the body as
+	// a string for most other frames. It is empty for TXXX, picture and PRIV
+	// frames.
+	Value string
 }
 
+// rawFrame is the undecoded content of a frame.
+type rawFrame struct {
+	id   string
+	data []byte
+}
+
+func (t *Tags) String() string      { return sound.Summary(t, nil) }
 func (t *Tags) Title() string       { return t.Frames["TIT2"] }
 func (t *Tags) AlbumArtist() string { return t.Frames["TPE2"] }
 func (t *Tags) Artist() string      { return t.Frames["TPE1"] }
 func (t *Tags) Album() string       { return t.Frames["TALB"] }
-func (t *Tags) Genre() string       { return t.Frames["TCON"] }
 func (t *Tags) Disc() int           { return t.disc }
 func (t *Tags) Track() int          { return t.track }
 func (t *Tags) Date() time.Time     { return t.date }
 func (t *Tags) Composer() string    { return t.Frames["TCOM"] }
 func (t *Tags) Notes() string       { return t.Frames["COMM"] }
 
+func (t *Tags) EncoderSettings() string { return t.Frames["TSSE"] }
+
+func (t *Tags) EncodingTime() time.Time {
+	tm, _ := dateutil.Parse(t.Frames["TDEN"])
+	return tm
+}
+
+// Length returns the length of the audio declared in the TLEN frame, or 0 if
+// there isn't one.
+func (t *Tags) Length() time.Duration { return parseMillis(t.Frames["TLEN"]) }
+
+// PlaylistDelay returns the silence to insert between this track and the
+// previous one in a playlist, from the TDLY frame, or 0 if there isn't one.
+func (t *Tags) PlaylistDelay() time.Duration { return parseMillis(t.Frames["TDLY"]) }
+
+// parseMillis parses the value of a frame that counts milliseconds, returning
+// 0 if it isn't a number that can.
+func parseMillis(s string) time.Duration {
+	ms, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || ms < 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Grouping returns the GRP1 frame that iTunes 12.5 and later write, or
+// failing that the TIT1 (content group) frame, where grouping was kept
+// before.
+func (t *Tags) Grouping() string {
+	if s, ok := t.Frames["GRP1"]; ok {
+		return s
+	}
+	return t.Frames["TIT1"]
+}
+
+// Work returns the TIT1 (content group) frame, which holds the work.
+func (t *Tags) Work() string { return t.Frames["TIT1"] }
+
+// SortTitle, SortArtist, SortAlbumArtist, SortAlbum and SortComposer return
+// the TSOT, TSOP, TSO2, TSOA and TSOC frames. ID3v2.4 has only the first two
+// and TSOA; the rest are iTunes extensions.
+func (t *Tags) SortTitle() string       { return t.Frames["TSOT"] }
+func (t *Tags) SortArtist() string      { return t.Frames["TSOP"] }
+func (t *Tags) SortAlbumArtist() string { return t.Frames["TSO2"] }
+func (t *Tags) SortAlbum() string       { return t.Frames["TSOA"] }
+func (t *Tags) SortComposer() string    { return t.Frames["TSOC"] }
+
+// Subtitle returns the TIT3 (subtitle) frame, which refines the title, such as
+// "Live at Wembley".
+func (t *Tags) Subtitle() string { return t.Frames["TIT3"] }
+
+// SetSubtitle returns the TSST (set subtitle) frame, which names the disc of
+// a set that the track is on, such as "Disc 2: B-Sides".
+func (t *Tags) SetSubtitle() string { return t.Frames["TSST"] }
+
+// MovementName returns the iTunes MVNM frame.
+func (t *Tags) MovementName() string { return t.Frames["MVNM"] }
+
+// Movement parses the iTunes MVIN frame, written as "2/4".
+func (t *Tags) Movement() (n, total int) {
+	s := t.Frames["MVIN"]
+	if s == "" {
+		return 0, 0
+	}
+	n, total, _ = parseMultiNumber(s)
+	return n, total
+}
+
+// RawFrame returns the body of the first frame with the given ID as it was in
+// the tag, before any text decoding. Bodies other than pictures, RVA2 and MCDI
+// frames are only kept if the tag was decoded with DecodeOptions.KeepRaw.
+// ID3v2.2 frames keep their original 3-character IDs.
+func (t *Tags) RawFrame(id string) ([]byte, bool) {
+	for _, f := range t.raw {
+		if f.id == id {
+			return f.data, true
+		}
+	}
+	return nil, false
+}
+
+// AllFrames returns every frame of the tag in the order they appeared,
+// including each one of any that repeat, such as COMM, APIC and TXXX. They
+// are only kept if the tag was decoded with DecodeOptions.KeepOrder.
+func (t *Tags) AllFrames() []Frame { return t.ordered }
+
+// TotalSize returns the number of bytes the tag takes up in the stream,
+// including the header, extended header and padding.
+func (t *Tags) TotalSize() int64 { return t.total }
+
+// TagFormat returns "ID3v2." followed by the major version of the tag.
+func (t *Tags) TagFormat() string {
+	if t.Header == nil {
+		return "ID3v2"
+	}
+	return "ID3v2." + strconv.Itoa(int(t.Major))
+}
+
+// Keys returns the IDs of the frames in the tag.
+func (t *Tags) Keys() []string {
+	keys := make([]string, 0, len(t.Frames))
+	for k := range t.Frames {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IsUpdate reports whether the tag's extended header marked it as an update
+// of an earlier tag in the file, meaning its frames should take precedence
+// over, rather than replace, the earlier tag's frames. Only ID3v2.4 tags can
+// carry this flag.
+func (t *Tags) IsUpdate() bool { return t.update }
+
+// Unsynchronized reports whether unsynchronisation was applied to the tag,
+// either to the whole tag by the header flag or, in ID3v2.4, to any of its
+// frames individually. TagUnsynchronized and FramesUnsynchronized tell the
+// two apart.
+func (t *Tags) Unsynchronized() bool { return t.unsynch || t.frameUnsynch }
+
+// TagUnsynchronized reports whether the header flag applied
+// unsynchronisation to the whole tag.
+func (t *Tags) TagUnsynchronized() bool { return t.unsynch }
+
+// FramesUnsynchronized reports whether any frame was unsynchronised by its
+// own flag, which only ID3v2.4 has.
+func (t *Tags) FramesUnsynchronized() bool { return t.frameUnsynch }
+
+// Artists and Composers return all of the values of the TPE1 and TCOM frames,
+// of which ID3v2.4 allows several, separated by nulls. The methods of
+// sound.Tags return only the first.
+func (t *Tags) Artists() []string   { return t.allValues("TPE1") }
+func (t *Tags) Composers() []string { return t.allValues("TCOM") }
+
+// allValues returns all of the values of a text frame, or nil if it isn't
+// set.
+func (t *Tags) allValues(id string) []string {
+	if vals, ok := t.values[id]; ok {
+		return vals
+	}
+	if s := t.Frames[id]; s != "" {
+		return []string{s}
+	}
+	return nil
+}
+
 type Header struct {
 	Magic [3]byte
 	Major uint8
@@ -101,7 +288,8 @@ const (
 	frameUnsynchronisation   = 1 << 1
 	frameDataLengthIndicator = 1 << 0
 
-	footerSize = 10
+	tagHeaderSize = 10
+	footerSize    = 10
 )
 
 var (
@@ -110,8 +298,16 @@ var (
 	ErrUnknownFlag = errors.New("id3v2: unknown header flag")
 	ErrEncryption  = errors.New("id3v2: frame encryption not supported")
 	ErrCompression = errors.New("id3v2: frame compression not supported")
+	// ErrTruncated is returned when the tag ends partway through a frame
+	// header or a string.
+	ErrTruncated = errors.New("id3v2: unexpected end of tag")
 )
 
+// Logger is called with diagnostics about problems that decoding recovers
+// from, such as a malformed TXXX frame. It does nothing by default; set it to
+// log.Printf or similar to see them.
+var Logger = func(format string, v ...interface{}) {}
+
 type countReader struct {
 	r io.Reader
 	n int64
@@ -142,20 +338,53 @@ func (lpr *limitedBufioReader) Read(p []byte) (n int, err error) {
 	return
 }
 
+// DecodeOptions changes how DecodeWithOptions interprets a tag.
+type DecodeOptions struct {
+	// CleanStrings trims surrounding whitespace from the values of text
+	// frames and removes any C0 control characters (U+0000 to U+001F) from
+	// them. Otherwise the values are kept exactly as they were written, up
+	// to the first null.
+	CleanStrings bool
+
+	// KeepRaw keeps the undecoded body of every frame, to be returned by
+	// RawFrame. Otherwise only the bodies of picture frames are kept.
+	KeepRaw bool
+
+	// NoFrameTranslation keeps the frame IDs the tag was written with.
+	// Otherwise ID3v2.2 frames are renamed to their ID3v2.3 equivalents (TT2
+	// to TIT2), and TXXX frames with well known descriptions are copied into
+	// the frames they stand for. With it, the accessors that look for
+	// ID3v2.3 frames find nothing in an ID3v2.2 tag, but Frames can be
+	// written back out as it was read.
+	NoFrameTranslation bool
+
+	// StopAfter lists frame IDs to look for, such as "TIT2" and "TPE1". Once
+	// all of them have been decoded, the rest of the frames are skipped,
+	// which speeds up a first pass over a large library that needs only a
+	// few fields. The IDs are those of ID3v2.3 and later, unless
+	// NoFrameTranslation is set. Frames made from TXXX frames don't count.
+	StopAfter []string
+
+	// KeepOrder keeps every frame, in the order they appeared, to be returned
+	// by AllFrames. The Frames map holds only one frame for each ID, so this
+	// is for tools that need to write the tag back out as it was.
+	KeepOrder bool
+}
+
 // Decode decodes an ID3v2 header out of an MP3 stream. It only reads as many
 // bytes as it needs to, no more and no less.
 //
 // The underlying type of the sound.Tags returned will be (*Tag).
 func Decode(r io.Reader) (sound.Tags, error) {
-	// log.Print("decode id3 header")
-	//r := &countReader{r: rr}
-	h, padding, err := readHeader(r)
-	if err != nil {
-		return nil, err
-	}
+	return DecodeWithOptions(r, DecodeOptions{})
+}
 
-	// log.Printf("%d bytes of padding", padding)
+// maxFollowingTags is how many tags straight after the first are decoded.
+// Any more are skipped.
+const maxFollowingTags = 4
 
+// DecodeWithOptions is like Decode, with the given options.
+func DecodeWithOptions(r io.Reader, opts DecodeOptions) (sound.Tags, error) {
 	// calls from mp3 package should always be bufio.Reader
 	var br *bufio.Reader
 
@@ -166,6 +395,65 @@ func Decode(r io.Reader) (sound.Tags, error) {
 		br = bufio.NewReader(r)
 	}
 
+	h, f, err := decodeTag(br, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// A few files have more tags straight after the first. An ID3v2.4 tag
+	// marked as an update has its frames merged in over the ones before it,
+	// and one that isn't replaces them, header and all. Earlier versions
+	// have no update flag, so their frames are merged in, since whichever
+	// tag came last is usually the full one.
+	for i := 0; ; i++ {
+		magic, err := br.Peek(len(Magic))
+		if err != nil || string(magic) != Magic {
+			break
+		}
+		if i == maxFollowingTags {
+			n, err := Skip(br)
+			if err != nil {
+				return nil, errors.Wrap(err, "skip following tags")
+			}
+			f.total += n
+			break
+		}
+
+		nh, nf, err := decodeTag(br, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode following tag")
+		}
+		if nh.Major == 4 && !nf.update {
+			nf.total += f.total
+			h, f = nh, nf
+			continue
+		}
+		f.merge(nf)
+	}
+
+	t, err := makeTags(h, f.frames)
+	if err != nil {
+		return nil, err
+	}
+	t.update = f.update
+	t.raw = f.raw
+	t.values = f.values
+	t.unsynch = f.unsynch
+	t.frameUnsynch = f.frameUnsynch
+	t.txxx = f.txxx
+	t.commLang, t.commDesc = f.commLang, f.commDesc
+	t.total = f.total
+	t.ordered = f.ordered
+	return t, nil
+}
+
+// decodeTag decodes one tag, leaving br after it.
+func decodeTag(br *bufio.Reader, opts DecodeOptions) (*Header, *tagFrames, error) {
+	h, padding, update, total, err := readHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Make sure we don't read more than we need to, so that subsequent readers
 	// can get the audio data from the file
 	// totalSize := int64(h.Size)
@@ -187,53 +475,129 @@ func Decode(r io.Reader) (sound.Tags, error) {
 	//log.Print("data left: ", lr.N)
 
 	// log.Print("reading frames")
-	frames, err := readFrames(lr, h)
+	f, err := readFramesWithOptions(lr, h, opts)
 	if err != nil {
-		return nil, errors.Wrap(err, "read frames")
+		return nil, nil, errors.Wrap(err, "read frames")
 	}
 
 	if padding > 0 {
 		_, err = io.CopyN(ioutil.Discard, br, int64(padding))
 		if err != nil {
-			return nil, errors.Wrap(err, "discard padding")
+			return nil, nil, errors.Wrap(err, "discard padding")
+		}
+	}
+
+	if opts.CleanStrings {
+		for id, s := range f.frames {
+			if id[0] == 'T' {
+				f.frames[id] = cleanString(s)
+			}
+		}
+		for _, vals := range f.values {
+			for i, s := range vals {
+				vals[i] = cleanString(s)
+			}
+		}
+		for i, fr := range f.ordered {
+			if fr.ID[0] == 'T' {
+				f.ordered[i].Value = cleanString(fr.Value)
+			}
 		}
 	}
 
-	return makeTags(h, frames)
+	f.update = update
+	f.total = total
+	return h, f, nil
 }
 
-func readHeader(r io.Reader) (*Header, uint32, error) {
+// merge merges the frames of a following tag in over those of f.
+func (f *tagFrames) merge(nf *tagFrames) {
+	for id, s := range nf.frames {
+		f.frames[id] = s
+		if vals, ok := nf.values[id]; ok {
+			f.values[id] = vals
+		} else {
+			delete(f.values, id)
+		}
+	}
+	for desc, s := range nf.txxx {
+		f.txxx[desc] = s
+	}
+	if _, ok := nf.frames["COMM"]; ok {
+		f.commLang, f.commDesc = nf.commLang, nf.commDesc
+	}
+	f.raw = append(f.raw, nf.raw...)
+	f.ordered = append(f.ordered, nf.ordered...)
+	f.unsynch = f.unsynch || nf.unsynch
+	f.frameUnsynch = f.frameUnsynch || nf.frameUnsynch
+	f.total += nf.total
+}
+
+// Skip discards the ID3v2 tags at the start of r, including any that follow
+// the first, without decoding their frames. It returns the number of bytes
+// discarded.
+func Skip(r *bufio.Reader) (int64, error) {
+	var total int64
+	for {
+		magic, err := r.Peek(len(Magic))
+		if err != nil || string(magic) != Magic {
+			return total, nil
+		}
+
+		var h Header
+		err = binary.Read(r, binary.BigEndian, &h)
+		if err != nil {
+			return total, err
+		}
+		size := int64(synchsafe32(h.Size))
+		if h.Flags&flagFooterPresent != 0 {
+			size += footerSize
+		}
+		_, err = io.CopyN(ioutil.Discard, r, size)
+		if err != nil {
+			return total, err
+		}
+		total += tagHeaderSize + size
+	}
+}
+
+// readHeader reads the header and extended header. As well as the header, it
+// returns the amount of padding, whether the tag is an update, and the total
+// size of the tag including its header.
+func readHeader(r io.Reader) (*Header, uint32, bool, int64, error) {
 	var (
 		esize   uint32
 		h       Header
 		padding uint32
+		update  bool
 	)
 
 	err := binary.Read(r, binary.BigEndian, &h)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, false, 0, err
 	}
 	if string(h.Magic[:]) != Magic {
-		return nil, 0, ErrBadHeader
+		return nil, 0, false, 0, ErrBadHeader
 	}
 	h.Size = synchsafe32(h.Size)
+	total := int64(tagHeaderSize) + int64(h.Size)
 
 	if (h.Flags & flagExtendedHeader) != 0 {
 		switch h.Major {
 		case 2:
-			return nil, 0, ErrUnknownFlag
+			return nil, 0, false, 0, ErrUnknownFlag
 
 		case 3:
 			var hh extHeader23
 			err = binary.Read(r, binary.BigEndian, &hh)
 			if err != nil {
-				return nil, 0, err
+				return nil, 0, false, 0, err
 			}
 			if hh.Size > 6 {
 				// discard CRC if present
 				_, err = io.CopyN(ioutil.Discard, r, int64(hh.Size-6))
 				if err != nil {
-					return nil, 0, err
+					return nil, 0, false, 0, err
 				}
 			}
 			// header size field in id3v2.3 doesn't include itself
@@ -245,18 +609,20 @@ func readHeader(r io.Reader) (*Header, uint32, error) {
 			var hh extHeader24
 			err = binary.Read(r, binary.BigEndian, &hh)
 			if err != nil {
-				return nil, 0, err
+				return nil, 0, false, 0, err
 			}
 			hh.Size = synchsafe32(hh.Size)
 
 			////log.Printf("%#v", hh)
 
-			// for now we're just gonna skip it
+			// The "tag is an update" flag has no data attached to it; the
+			// rest of the flag data we're just gonna skip for now
 			// (the fixed header size is 6)
+			update = hh.Flags&extFlagTagIsUpdate != 0
 			buf := make([]byte, hh.Size-6)
 			_, err = io.ReadFull(r, buf)
 			if err != nil {
-				return nil, 0, err
+				return nil, 0, false, 0, err
 			}
 
 			esize = hh.Size
@@ -265,7 +631,7 @@ func readHeader(r io.Reader) (*Header, uint32, error) {
 
 	h.Size -= esize
 
-	return &h, padding, nil
+	return &h, padding, update, total, nil
 }
 
 var validFramePat = regexp.MustCompile(`^[A-Z0-9]+\x00*$`)
@@ -281,9 +647,87 @@ func validFrameName(name []byte) bool {
 	// return true
 }
 
-func readFrames(rr *bytes.Reader, h *Header) (map[string]string, error) {
+// guessFrameSize decides how to interpret the size field of a 2.3 or 2.4
+// frame header that was just read from rr. Sizes are supposed to be
+// synchsafe in 2.4 and plain in 2.3, but plenty of taggers have written them
+// the other way around. If the size as the version says overruns the tag or
+// leads to something that isn't a frame or padding, and the other reading
+// doesn't, the other reading wins.
+func guessFrameSize(rr *bytes.Reader, h *Header, size uint32) uint32 {
+	expected, other := size, synchsafe32(size)
+	if h.Major >= 4 {
+		expected, other = other, expected
+	}
+	// sizes with the high bit of any byte set can't be synchsafe
+	if size&0x80808080 != 0 {
+		return size
+	}
+	if expected == other {
+		return expected
+	}
+
+	if !nextFrameFollows(rr, expected) && nextFrameFollows(rr, other) {
+		return other
+	}
+	return expected
+}
+
+// nextFrameFollows reports whether a frame of the given size starting at the
+// current position of rr would be followed by another frame header, padding,
+// or the end of the tag.
+func nextFrameFollows(rr *bytes.Reader, size uint32) bool {
+	end := rr.Size() - int64(rr.Len()) + int64(size)
+	if end > rr.Size() {
+		return false
+	}
+	if end == rr.Size() {
+		return true
+	}
+
+	next := make([]byte, 4)
+	n, _ := rr.ReadAt(next, end)
+	if next[0] == 0 {
+		return true
+	}
+	return n == len(next) && validFrameName(next)
+}
+
+func readFrames(rr *bytes.Reader, h *Header) (map[string]string, []rawFrame, error) {
+	f, err := readFramesWithOptions(rr, h, DecodeOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return f.frames, f.raw, nil
+}
+
+// tagFrames is what readFramesWithOptions finds in a tag.
+type tagFrames struct {
+	frames map[string]string
+	// values holds all of the values of text frames that have more than one
+	values map[string][]string
+	// txxx holds the TXXX values keyed by their descriptions
+	txxx map[string]string
+	raw  []rawFrame
+	// unsynch is whether the header flag unsynchronised the whole tag, and
+	// frameUnsynch whether any frame was unsynchronised by its own flag
+	unsynch, frameUnsynch bool
+	// ordered holds every frame if DecodeOptions.KeepOrder is set
+	ordered []Frame
+	// commLang and commDesc are those of the last COMM frame
+	commLang, commDesc string
+	// update is whether the tag was marked as an update
+	update bool
+	// total is the size of the tag, and of any merged into it
+	total int64
+}
+
+// readFramesWithOptions reads the frames of the tag.
+func readFramesWithOptions(rr *bytes.Reader, h *Header, opts DecodeOptions) (*tagFrames, error) {
 	var (
+		raw        []rawFrame
+		ordered    []Frame
 		frames     = make(map[string]string)
+		values     = make(map[string][]string)
 		txxx       = make(map[string]string)
 		fh         frameHeader
 		frameID    []byte
@@ -291,9 +735,15 @@ func readFrames(rr *bytes.Reader, h *Header) (map[string]string, error) {
 		pos        = uint32(0)
 
 		// needed to decode 3-byte size dscriptor in id3v2.2
-		sizeBuf    = make([]byte, 4)
-		frameSize  uint32
+		sizeBuf   = make([]byte, 4)
+		frameSize uint32
+		// dliSize is the size of the current frame's data length indicator,
+		// which comes between its header and its body
+		dliSize    uint32
 		allUnsynch = h.Flags&flagUnsynchronisation != 0
+		anyUnsynch bool
+
+		commLang, commDesc string
 	)
 
 	if h.Major == 2 {
@@ -305,7 +755,16 @@ func readFrames(rr *bytes.Reader, h *Header) (map[string]string, error) {
 	}
 
 frameloop:
-	for ; pos < h.Size; pos += frameSize + headerSize {
+	for ; pos < h.Size; pos += frameSize + headerSize + dliSize {
+		// too little left for a frame header, so it can only be padding
+		if h.Size-pos < headerSize {
+			break
+		}
+		dliSize = 0
+		if len(opts.StopAfter) > 0 && haveFrames(frames, opts.StopAfter) {
+			break
+		}
+
 		_, err := io.ReadFull(rr, frameID)
 		if err != nil {
 			if err == io.EOF {
@@ -349,6 +808,7 @@ frameloop:
 			s           string
 			frameIDStr            = string(frameID)
 			frameReader io.Reader = rr
+			multi       []string
 		)
 
 		if h.Major == 2 {
@@ -357,37 +817,46 @@ frameloop:
 				return nil, err
 			}
 
-			frameSize = uint32(binary.BigEndian.Uint32(sizeBuf))
+			frameSize = clampFrameSize(frameIDStr, uint32(binary.BigEndian.Uint32(sizeBuf)), h.Size-pos, headerSize)
+			if frameSize == 0 {
+				continue
+			}
 		} else {
 			err = binary.Read(rr, binary.BigEndian, &fh)
 			if err != nil {
 				return nil, err
 			}
-			if h.Major >= 4 {
-				frameSize = synchsafe32(fh.Size)
-			} else {
-				frameSize = fh.Size
-			}
+			size := guessFrameSize(rr, h, fh.Size)
 
 			if fh.Flags&frameEncrypted != 0 {
 				return nil, ErrEncryption
 			}
 
+			anyUnsynch = anyUnsynch || fh.Flags&frameUnsynchronisation != 0
 			frameUnsynch = allUnsynch || fh.Flags&frameUnsynchronisation != 0
 
 			if fh.Flags&frameDataLengthIndicator != 0 {
 				_, err = io.ReadFull(rr, sizeBuf)
 				if err != nil {
 					if err == io.EOF {
-						return nil, errors.New("unexpected eof in frame header")
+						return nil, errors.Wrap(ErrTruncated, "data length indicator")
 					}
 					return nil, err
 				}
 
-				frameSize -= 4
+				dliSize = 4
+				if size < dliSize {
+					size = dliSize
+				}
+				size -= dliSize
 				// dataLengthIndicator = synchsafe32(binary.BigEndian.Uint32(sizeBuf))
 			}
 
+			frameSize = clampFrameSize(frameIDStr, size, h.Size-pos, headerSize+dliSize)
+			if frameSize == 0 {
+				continue
+			}
+
 			if fh.Flags&frameCompressed != 0 {
 				zr, err := zlib.NewReader(rr)
 				if err != nil {
@@ -402,6 +871,18 @@ frameloop:
 		// 	log.Printf("frame %q is unsynchronised", frameIDStr)
 		// }
 
+		if opts.KeepRaw && !keepsRaw(frameIDStr) {
+			// look ahead without disturbing the decoding below
+			body := make([]byte, frameSize)
+			n, _ := rr.ReadAt(body, rr.Size()-int64(rr.Len()))
+			raw = append(raw, rawFrame{frameIDStr, body[:n]})
+		}
+		if opts.KeepOrder {
+			body := make([]byte, frameSize)
+			n, _ := rr.ReadAt(body, rr.Size()-int64(rr.Len()))
+			ordered = append(ordered, Frame{ID: frameIDStr, Raw: body[:n]})
+		}
+
 		if frameID[0] == 'T' {
 			buf := make([]byte, frameSize)
 			_, err = io.ReadFull(rr, buf)
@@ -412,7 +893,7 @@ frameloop:
 			if frameIDStr == "TXXX" {
 				err = decodeTXXX(txxx, buf, frameUnsynch)
 				if err != nil {
-					log.Print(errors.Wrap(err, "decode TXXX"))
+					Logger("id3v2: decode TXXX: %v", err)
 				} else {
 					// log.Printf("  %q", truncate(s, 40))
 				}
@@ -424,19 +905,48 @@ frameloop:
 				return nil, err
 			}
 
+			// ID3v2.4 separates multiple values with nulls
+			if vals := strings.Split(strings.TrimRight(s, "\x00"), "\x00"); len(vals) > 1 {
+				multi = vals
+			}
 			j := strings.IndexByte(s, '\x00')
 			if j > -1 {
 				s = s[:j]
 			}
 		} else {
 			switch frameIDStr {
-			case "APIC", "PIC", "PRIV":
-				// skip album arts for now
-				//log.Print("skipping album art")
+			case "APIC", "PIC":
+				buf := make([]byte, frameSize)
+				_, err = io.ReadFull(rr, buf)
+				if err != nil {
+					return nil, err
+				}
+				if frameUnsynch {
+					buf = deunsynch(buf)
+				}
+				raw = append(raw, rawFrame{frameIDStr, buf})
+				continue
 
+			case "PRIV":
 				io.CopyN(ioutil.Discard, rr, int64(frameSize))
 				continue
 
+			case "GRP1", "MVNM", "MVIN":
+				// iTunes frames that are laid out like text frames
+				buf := make([]byte, frameSize)
+				_, err = io.ReadFull(rr, buf)
+				if err != nil {
+					return nil, err
+				}
+				if len(buf) == 0 {
+					continue
+				}
+				s, err = decodeTextFrame(buf[0], buf[1:], frameUnsynch)
+				if err != nil {
+					return nil, err
+				}
+				s = strings.TrimRight(s, "\x00")
+
 			case "COMM":
 				buf := make([]byte, frameSize)
 				_, err = io.ReadFull(rr, buf)
@@ -450,13 +960,13 @@ frameloop:
 					return nil, err
 				}
 
-				b.Next(3) // discard lang code
-				// log.Printf("comment lang: %q", lang)
-				readTerminatedString(enc, b)
+				lang := string(b.Next(3))
+				desc, _ := readTerminatedString(enc, b)
 				s, err = decodeTextFrame(enc, b.Bytes(), frameUnsynch)
 				if err != nil {
 					return nil, err
 				}
+				commLang, commDesc = lang, desc
 
 			default:
 				buf := make([]byte, frameSize)
@@ -464,6 +974,18 @@ frameloop:
 				if err != nil {
 					return nil, err
 				}
+				if frameUnsynch {
+					buf = deunsynch(buf)
+				}
+				switch frameIDStr {
+				case "RVA2":
+					// there may be one for each identification, so keep
+					// them all for ReplayGain
+					raw = append(raw, rawFrame{frameIDStr, buf})
+				case "MCDI", "MCI":
+					// binary, for CDTOC
+					raw = append(raw, rawFrame{frameIDStr, buf})
+				}
 				// TODO: other special frames
 				s = string(buf)
 			}
@@ -471,7 +993,7 @@ frameloop:
 
 		// log.Printf("  %q", truncate(s, 40))
 
-		if len(frameID) == 3 {
+		if len(frameID) == 3 && !opts.NoFrameTranslation {
 			newID, ok := v22Equiv[frameIDStr]
 			if ok {
 				//log.Printf("%s => %s", frameIDStr, newID)
@@ -481,6 +1003,12 @@ frameloop:
 
 		//log.Printf("%s: %s", frameIDStr, s)
 		frames[frameIDStr] = s
+		if opts.KeepOrder {
+			ordered[len(ordered)-1].Value = s
+		}
+		if multi != nil {
+			values[frameIDStr] = multi
+		}
 
 		if zr, ok := frameReader.(io.ReadCloser); ok {
 			zr.Close()
@@ -490,9 +1018,46 @@ frameloop:
 	// for k, v := range frames {
 	// 	log.Printf("%q: %q", k, v)
 	// }
-	translateTXXXFrames(frames, txxx)
+	if !opts.NoFrameTranslation {
+		translateTXXXFrames(frames, txxx)
+	}
+
+	return &tagFrames{frames, values, txxx, raw, allUnsynch, anyUnsynch, ordered, commLang, commDesc, false, 0}, nil
+}
+
+// keepsRaw reports whether the body of a frame with the given ID is always
+// kept in Tags.raw, so that it needn't be added again for KeepRaw.
+func keepsRaw(id string) bool {
+	switch id {
+	case "APIC", "PIC", "RVA2", "MCDI", "MCI":
+		return true
+	}
+	return false
+}
+
+// haveFrames reports whether there is a frame for each of ids.
+func haveFrames(frames map[string]string, ids []string) bool {
+	for _, id := range ids {
+		if _, ok := frames[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
 
-	return frames, nil
+// clampFrameSize limits the size of a frame to the rest of the tag, which is
+// left bytes including the frame's header, so that a corrupt size can't run
+// the frame on into the padding or audio, or make for a huge allocation.
+func clampFrameSize(id string, size, left, headerSize uint32) uint32 {
+	var rest uint32
+	if left > headerSize {
+		rest = left - headerSize
+	}
+	if size > rest {
+		Logger("id3v2: frame %s claims %d bytes, but only %d are left in the tag", id, size, rest)
+		return rest
+	}
+	return size
 }
 
 func truncate(s string, limit int) string {
@@ -508,7 +1073,7 @@ func truncate(s string, limit int) string {
 	}
 }
 
-func makeTags(h *Header, frames map[string]string) (sound.Tags, error) {
+func makeTags(h *Header, frames map[string]string) (*Tags, error) {
 	t := Tags{
 		Header: h,
 		Frames: frames,
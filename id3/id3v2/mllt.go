@@ -0,0 +1,101 @@
+package id3v2
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNoSeekTable  = errors.New("id3v2: no MLLT frame")
+	ErrBadSeekTable = errors.New("id3v2: malformed MLLT frame")
+)
+
+// SeekTable is the contents of an MLLT (MPEG location lookup table) frame. It
+// divides the audio into references, each a fixed number of MPEG frames
+// apart. The byte and time distances between two references are the fixed
+// BytesBetween and MillisBetween plus that reference's deviations.
+type SeekTable struct {
+	FramesBetween uint16
+	BytesBetween  uint32
+	MillisBetween uint32
+
+	// BytesDeviationBits and MillisDeviationBits are the widths of the
+	// deviation fields in the frame.
+	BytesDeviationBits  uint8
+	MillisDeviationBits uint8
+
+	References []SeekReference
+}
+
+// SeekReference is one entry of a SeekTable.
+type SeekReference struct {
+	BytesDeviation  uint32
+	MillisDeviation uint32
+}
+
+// SeekTable decodes the tag's MLLT frame.
+func (t *Tags) SeekTable() (*SeekTable, error) {
+	s, ok := t.Frames["MLLT"]
+	if !ok {
+		return nil, ErrNoSeekTable
+	}
+	return decodeMLLT([]byte(s))
+}
+
+func decodeMLLT(b []byte) (*SeekTable, error) {
+	if len(b) < 10 {
+		return nil, ErrBadSeekTable
+	}
+
+	st := &SeekTable{
+		FramesBetween:       binary.BigEndian.Uint16(b),
+		BytesBetween:        uint32(b[2])<<16 | uint32(b[3])<<8 | uint32(b[4]),
+		MillisBetween:       uint32(b[5])<<16 | uint32(b[6])<<8 | uint32(b[7]),
+		BytesDeviationBits:  b[8],
+		MillisDeviationBits: b[9],
+	}
+	if st.BytesDeviationBits > 32 || st.MillisDeviationBits > 32 {
+		return nil, ErrBadSeekTable
+	}
+
+	// the deviations are packed back to back as a bit stream
+	var (
+		data   = b[10:]
+		bit    = 0
+		refLen = int(st.BytesDeviationBits) + int(st.MillisDeviationBits)
+		n      = len(data) * 8
+	)
+	readBits := func(width uint8) uint32 {
+		var v uint32
+		for i := uint8(0); i < width; i++ {
+			v = v<<1 | uint32(data[bit/8]>>(7-uint(bit%8))&1)
+			bit++
+		}
+		return v
+	}
+	for refLen > 0 && bit+refLen <= n {
+		st.References = append(st.References, SeekReference{
+			BytesDeviation:  readBits(st.BytesDeviationBits),
+			MillisDeviation: readBits(st.MillisDeviationBits),
+		})
+	}
+
+	return st, nil
+}
+
+// Lookup finds the last reference at or before d. It returns the byte offset
+// of that reference from the first MPEG frame after the tag, and the time of
+// the reference.
+func (st *SeekTable) Lookup(d time.Duration) (offset int64, at time.Duration) {
+	for _, ref := range st.References {
+		next := at + time.Duration(st.MillisBetween+ref.MillisDeviation)*time.Millisecond
+		if next > d {
+			break
+		}
+		at = next
+		offset += int64(st.BytesBetween + ref.BytesDeviation)
+	}
+	return offset, at
+}
@@ -0,0 +1,45 @@
+package id3v2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeekTable(t *testing.T) {
+	// 10 frames, 4000 bytes and 261 ms between references, with 4-bit
+	// deviations: (1, 2), (3, 0)
+	mllt := "\x00\x0a\x00\x0f\xa0\x00\x01\x05\x04\x04\x12\x30"
+	tags := &Tags{Frames: map[string]string{"MLLT": mllt}}
+
+	st, err := tags.SeekTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.FramesBetween != 10 || st.BytesBetween != 4000 || st.MillisBetween != 261 {
+		t.Errorf("got %+v", st)
+	}
+	if len(st.References) != 2 || st.References[0] != (SeekReference{1, 2}) || st.References[1] != (SeekReference{3, 0}) {
+		t.Fatalf("got references %v", st.References)
+	}
+
+	tests := []struct {
+		d      time.Duration
+		offset int64
+		at     time.Duration
+	}{
+		{0, 0, 0},
+		{262 * time.Millisecond, 0, 0},
+		{263 * time.Millisecond, 4001, 263 * time.Millisecond},
+		{time.Second, 8004, 524 * time.Millisecond},
+	}
+	for _, test := range tests {
+		offset, at := st.Lookup(test.d)
+		if offset != test.offset || at != test.at {
+			t.Errorf("Lookup(%v): got %d, %v; expected %d, %v", test.d, offset, at, test.offset, test.at)
+		}
+	}
+
+	if _, err := (&Tags{Frames: map[string]string{}}).SeekTable(); err != ErrNoSeekTable {
+		t.Errorf("expected ErrNoSeekTable, got %v", err)
+	}
+}
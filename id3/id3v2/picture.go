@@ -0,0 +1,83 @@
+package id3v2
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+)
+
+var ErrBadPicture = errors.New("id3v2: malformed picture frame")
+
+// v22ImageFormats maps the image formats of ID3v2.2 PIC frames to MIME types.
+var v22ImageFormats = map[string]string{
+	"JPG": "image/jpeg",
+	"PNG": "image/png",
+	"GIF": "image/gif",
+	"BMP": "image/bmp",
+}
+
+// Pictures decodes the tag's APIC frames (PIC in ID3v2.2). Frames that can't
+// be decoded are skipped.
+func (t *Tags) Pictures() []sound.Picture {
+	var pics []sound.Picture
+	for _, f := range t.raw {
+		if f.id != "APIC" && f.id != "PIC" {
+			continue
+		}
+		pic, err := decodePicture(f.data, t.Header != nil && t.Major == 2)
+		if err != nil {
+			continue
+		}
+		pics = append(pics, *pic)
+	}
+	return pics
+}
+
+// decodePicture decodes the content of an APIC frame, or a PIC frame if v22
+// is set. PIC has a fixed 3-character image format where APIC has a
+// null-terminated MIME type.
+func decodePicture(buf []byte, v22 bool) (*sound.Picture, error) {
+	if len(buf) < 2 {
+		return nil, ErrBadPicture
+	}
+
+	var (
+		pic sound.Picture
+		enc = buf[0]
+		b   = bytes.NewBuffer(buf[1:])
+		err error
+	)
+
+	if v22 {
+		format := b.Next(3)
+		if len(format) != 3 {
+			return nil, ErrBadPicture
+		}
+		pic.MIMEType = v22ImageFormats[strings.ToUpper(string(format))]
+		if pic.MIMEType == "" {
+			pic.MIMEType = "image/" + strings.ToLower(string(format))
+		}
+	} else {
+		pic.MIMEType, err = readTerminatedString(encISO8859_1, b)
+		if err != nil {
+			return nil, ErrBadPicture
+		}
+	}
+
+	picType, err := b.ReadByte()
+	if err != nil {
+		return nil, ErrBadPicture
+	}
+	pic.Type = int(picType)
+
+	pic.Description, err = readTerminatedString(enc, b)
+	if err != nil {
+		return nil, ErrBadPicture
+	}
+
+	pic.Data = b.Bytes()
+	return &pic, nil
+}
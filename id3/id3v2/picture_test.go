@@ -0,0 +1,47 @@
+package id3v2
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPictures(t *testing.T) {
+	tests := []struct {
+		major uint8
+		frame string
+		desc  string
+	}{
+		{2, "PIC\x00\x00\x0f\x00JPG\x03cover\x00\xff\xd8\xff\xe0", "cover"},
+		{3, "APIC\x00\x00\x00\x17\x00\x00\x00image/jpeg\x00\x03cover\x00\xff\xd8\xff\xe0", "cover"},
+		{4, "APIC\x00\x00\x00\x19\x00\x00\x01image/jpeg\x00\x03\xff\xfec\x00o\x00\x00\x00\xff\xd8\xff\xe0", "co"},
+		// unsynchronised, so that each 0xFF is followed by a 0x00
+		{4, "APIC\x00\x00\x00\x14\x00\x02\x00image/jpeg\x00\x03\x00\xff\x00\xd8\xff\x00\xe0", ""},
+	}
+
+	for _, test := range tests {
+		h := &Header{Major: test.major, Size: uint32(len(test.frame))}
+		frames, raw, err := readFrames(bytes.NewReader([]byte(test.frame)), h)
+		if err != nil {
+			t.Errorf("2.%d: %v", test.major, err)
+			continue
+		}
+		tags, err := makeTags(h, frames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags.raw = raw
+
+		pics := tags.Pictures()
+		if len(pics) != 1 {
+			t.Errorf("2.%d: got %d pictures", test.major, len(pics))
+			continue
+		}
+		pic := pics[0]
+		if pic.MIMEType != "image/jpeg" || pic.Type != 3 || string(pic.Data) != "\xff\xd8\xff\xe0" {
+			t.Errorf("2.%d: got %+v", test.major, pic)
+		}
+		if pic.Description != test.desc {
+			t.Errorf("2.%d: got description %q", test.major, pic.Description)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package id3v2
+
+import "strings"
+
+// PlayCount returns the number of times the file has been played, from the
+// PCNT (play counter) frame, or failing that, the counter in the POPM
+// (popularimeter) frame, which players that keep ratings use instead. It
+// returns 0 if there is neither.
+func (t *Tags) PlayCount() uint64 {
+	if s, ok := t.Frames["PCNT"]; ok {
+		return decodeCounter(s)
+	}
+	if s, ok := t.Frames["POPM"]; ok {
+		// the counter follows the email address and the rating
+		if i := strings.IndexByte(s, 0); i >= 0 && i+2 <= len(s) {
+			return decodeCounter(s[i+2:])
+		}
+	}
+	return 0
+}
+
+// decodeCounter decodes a big endian counter, which is at least 4 bytes but
+// grows a byte at a time as needed. Counters too big for a uint64 keep their
+// low 64 bits.
+func decodeCounter(s string) uint64 {
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		n = n<<8 | uint64(s[i])
+	}
+	return n
+}
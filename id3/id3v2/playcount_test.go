@@ -0,0 +1,25 @@
+package id3v2
+
+import "testing"
+
+func TestPlayCount(t *testing.T) {
+	tests := []struct {
+		frames map[string]string
+		count  uint64
+	}{
+		{map[string]string{"PCNT": "\x00\x00\x01\x02"}, 258},
+		{map[string]string{"PCNT": "\x01\x00\x00\x00\x00"}, 1 << 32},
+		// PCNT wins over POPM
+		{map[string]string{"PCNT": "\x00\x00\x00\x07", "POPM": "a@example.com\x00\xff\x00\x00\x00\x09"}, 7},
+		{map[string]string{"POPM": "a@example.com\x00\xff\x00\x00\x00\x09"}, 9},
+		// POPM without a counter
+		{map[string]string{"POPM": "a@example.com\x00\xff"}, 0},
+		{map[string]string{}, 0},
+	}
+	for _, test := range tests {
+		tags := &Tags{Frames: test.frames}
+		if n := tags.PlayCount(); n != test.count {
+			t.Errorf("%q: got %d, expected %d", test.frames, n, test.count)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package id3v2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"ktkr.us/pkg/sound"
+)
+
+// rva2Master is the channel type of the master volume in an RVA2 frame.
+const rva2Master = 1
+
+// ReplayGain returns the loudness normalization values of the track. They are
+// read from RVA2 (relative volume adjustment) frames identified as "track" or
+// "album", and from the TXXX frames described as REPLAYGAIN_TRACK_GAIN and
+// so on. Where both give a value, the TXXX frame wins, as that is what most
+// players read.
+func (t *Tags) ReplayGain() (sound.ReplayGain, bool) {
+	var rg sound.ReplayGain
+	for _, f := range t.raw {
+		if f.id != "RVA2" {
+			continue
+		}
+		ident, gain, peak, ok := decodeRVA2(f.data)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(ident, "album") {
+			rg.AlbumGain, rg.AlbumPeak, rg.HasAlbum = gain, peak, true
+		} else {
+			rg.TrackGain, rg.TrackPeak, rg.HasTrack = gain, peak, true
+		}
+	}
+
+	if gain, ok := parseGain(t.UserText("REPLAYGAIN_TRACK_GAIN")); ok {
+		rg.TrackGain, rg.HasTrack = gain, true
+		rg.TrackPeak, _ = parseGain(t.UserText("REPLAYGAIN_TRACK_PEAK"))
+	}
+	if gain, ok := parseGain(t.UserText("REPLAYGAIN_ALBUM_GAIN")); ok {
+		rg.AlbumGain, rg.HasAlbum = gain, true
+		rg.AlbumPeak, _ = parseGain(t.UserText("REPLAYGAIN_ALBUM_PEAK"))
+	}
+	return rg, rg.HasTrack || rg.HasAlbum
+}
+
+// parseGain parses a ReplayGain value such as "-6.48 dB" or "0.988312".
+func parseGain(s string) (float64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// decodeRVA2 decodes an RVA2 frame: an identification string, followed by
+// an adjustment for each channel. It returns the adjustment of the master
+// volume channel, or of the first channel if there is no master volume, with
+// the gain in dB and the peak as a fraction of full scale.
+func decodeRVA2(b []byte) (ident string, gain, peak float64, ok bool) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", 0, 0, false
+	}
+	ident, b = string(b[:i]), b[i+1:]
+
+	for len(b) >= 4 {
+		var (
+			channel  = b[0]
+			adjust   = int16(binary.BigEndian.Uint16(b[1:]))
+			peakBits = int(b[3])
+			n        = (peakBits + 7) / 8
+		)
+		if len(b) < 4+n {
+			break
+		}
+		if !ok || channel == rva2Master {
+			// the adjustment is in 1/512 dB
+			gain = float64(adjust) / 512
+			peak = 0
+			if peakBits > 0 {
+				// the peak is an integer in peakBits bits, full scale being
+				// the largest signed sample of that width
+				var v uint64
+				for _, c := range b[4 : 4+n] {
+					v = v<<8 | uint64(c)
+				}
+				peak = float64(v) / float64(uint64(1)<<uint(peakBits-1))
+			}
+			ok = true
+			if channel == rva2Master {
+				break
+			}
+		}
+		b = b[4+n:]
+	}
+	return ident, gain, peak, ok
+}
@@ -0,0 +1,51 @@
+package id3v2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplayGain(t *testing.T) {
+	frame := func(id, body string) string {
+		return id + "\x00\x00\x00" + string([]byte{byte(len(body))}) + "\x00\x00" + body
+	}
+	frames := frame("RVA2", "track\x00"+
+		// front right at -1 dB, then master volume at -6.5 dB with a
+		// 16-bit peak of half scale
+		"\x02\xfe\x00\x00"+"\x01\xf3\x00\x10\x40\x00") +
+		// front left only at -3 dB, overridden by the TXXX frame
+		frame("RVA2", "album\x00\x03\xfa\x00\x00") +
+		frame("TXXX", "\x00replaygain_album_gain\x00-4.00 dB")
+	tag := "ID3\x04\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+
+	tags, err := Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rg, ok := tags.(*Tags).ReplayGain()
+	if !ok || !rg.HasTrack || !rg.HasAlbum {
+		t.Fatalf("got %+v, %t", rg, ok)
+	}
+	if rg.TrackGain != -6.5 || rg.TrackPeak != 0.5 {
+		t.Errorf("got track gain %v, peak %v", rg.TrackGain, rg.TrackPeak)
+	}
+	if rg.AlbumGain != -4 || rg.AlbumPeak != 0 {
+		t.Errorf("got album gain %v, peak %v", rg.AlbumGain, rg.AlbumPeak)
+	}
+}
+
+func TestReplayGainUnsynchronized(t *testing.T) {
+	// master volume at -0.0625 dB, 0xffe0, which has to be unsynchronised
+	body := "track\x00\x01\xff\x00\xe0\x00"
+	frames := "RVA2\x00\x00\x00" + string([]byte{byte(len(body))}) + "\x00\x02" + body
+	tag := "ID3\x04\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+
+	tags, err := Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rg, ok := tags.(*Tags).ReplayGain()
+	if !ok || !rg.HasTrack || rg.TrackGain != -0.0625 {
+		t.Errorf("got %+v, %t", rg, ok)
+	}
+}
@@ -2,12 +2,14 @@ package id3v2
 
 import (
 	"bytes"
-	"errors"
-	"fmt"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound/internal/dateutil"
 )
 
 var txxxEquiv = map[string]string{
@@ -52,8 +54,10 @@ var txxxEquiv = map[string]string{
 	"ARTISTSORT":        "TSOP",
 	"TITLESORT":         "TSOT",
 	"ALBUMARTISTSORT":   "TSO2",
+	"COMPOSERSORT":      "TSOC",
 	"ISRC":              "TSRC",
 	"ENCODING":          "TSSE",
+	"DISCSUBTITLE":      "TSST",
 }
 
 var v22Equiv = map[string]string{
@@ -83,40 +87,40 @@ const (
 )
 
 var (
-	ErrEmptyText    = errors.New("id3v2: empty text field")
-	ErrMalformedBOM = errors.New("id3v2: malformed UTF-16 BOM")
+	ErrEmptyText       = errors.New("id3v2: empty text field")
+	ErrMalformedBOM    = errors.New("id3v2: malformed UTF-16 BOM")
+	ErrUnknownEncoding = errors.New("id3v2: unknown text encoding")
 )
 
+// readTerminatedString reads a null-terminated string in the given encoding
+// out of r and decodes it, leaving r positioned after the terminator.
 func readTerminatedString(enc byte, r *bytes.Buffer) (string, error) {
 	if enc == encISO8859_1 || enc == encUTF8 {
-		s, err := r.ReadString('\x00')
+		s, err := r.ReadBytes('\x00')
 		if err != nil {
 			return "", err
 		}
-		if len(s) <= 1 {
-			return "", nil
-		}
-		return s[:len(s)-1], nil
+		return decodeTextFrame(enc, s[:len(s)-1], false)
 	}
 
-	// string is null-terminated with two null bytes if unicode encoded
-
-	// disgusting allocation here but what can you do
-	buf := []byte{}
+	// If unicode encoded, the string is terminated by a zero code unit,
+	// which can only be found on a code unit boundary. A pair of null bytes
+	// straddling two code units (e.g. "\xe9\x00\x00\x00" is "é" and then
+	// the terminator) isn't one.
+	var buf []byte
 
 	for {
-		next := r.Next(2)
+		unit := r.Next(2)
 
-		if len(next) != 2 {
-			return "", errors.New("id3v2: unexpected eof inside terminated string")
+		if len(unit) != 2 {
+			return "", errors.Wrap(ErrTruncated, "inside terminated string")
 		}
 
-		if bytes.Equal(next, []byte("\x00\x00")) {
-			return string(buf), nil
+		if unit[0] == 0 && unit[1] == 0 {
+			return decodeTextFrame(enc, buf, false)
 		}
 
-		buf = append(buf, next[0])
-		r.UnreadByte()
+		buf = append(buf, unit...)
 	}
 }
 
@@ -133,35 +137,52 @@ func decodeTextFrame(enc byte, buf []byte, unsynch bool) (string, error) {
 	var s string
 
 	if unsynch {
-		buf = bytes.Replace(buf, []byte{0xFF, 0x00}, []byte{0xFF}, -1)
+		buf = deunsynch(buf)
 	}
 
 	switch enc {
 	case encISO8859_1:
 		s = decodeLatin1(buf)
 	case encUTF16_BOM:
+		if len(buf) < 2 {
+			return "", ErrMalformedBOM
+		}
 		bom := string(buf[:2])
 		buf = buf[2:]
 
 		switch bom {
 		case "\xff\xfe":
-			s = decodeUTF16BE(buf)
-		case "\xfe\xff":
 			s = decodeUTF16LE(buf)
+		case "\xfe\xff":
+			s = decodeUTF16BE(buf)
 		default:
 			return "", ErrMalformedBOM
 		}
 	case encUTF16BE:
-		s = decodeUTF16BE(buf)
+		// there shouldn't be a BOM, but some taggers write one anyway
+		switch {
+		case bytes.HasPrefix(buf, []byte("\xfe\xff")):
+			s = decodeUTF16BE(buf[2:])
+		case bytes.HasPrefix(buf, []byte("\xff\xfe")):
+			s = decodeUTF16LE(buf[2:])
+		default:
+			s = decodeUTF16BE(buf)
+		}
 	case encUTF8:
-		s = string(buf)
+		// likewise, UTF-8 has no need of a BOM
+		s = string(bytes.TrimPrefix(buf, []byte("\xef\xbb\xbf")))
 	default:
-		return "", fmt.Errorf("id3v2: unknown encoding 0x%02x", enc)
+		return "", errors.Wrapf(ErrUnknownEncoding, "0x%02x", enc)
 	}
 
 	return strings.TrimRight(s, "\x00"), nil
 }
 
+// deunsynch reverses unsynchronisation, which puts a 0x00 after every 0xFF.
+func deunsynch(buf []byte) []byte {
+	return bytes.Replace(buf, []byte{0xFF, 0x00}, []byte{0xFF}, -1)
+}
+
 func decodeLatin1(buf []byte) string {
 	r := make([]rune, len(buf))
 	for i := range buf {
@@ -172,16 +193,16 @@ func decodeLatin1(buf []byte) string {
 
 func decodeUTF16BE(buf []byte) string {
 	s := make([]rune, 0, len(buf)/2)
-	for i := 0; i < len(buf); i += 2 {
-		s = append(s, rune(buf[i])|rune(buf[i+1])<<8)
+	for i := 0; i+1 < len(buf); i += 2 {
+		s = append(s, rune(buf[i])<<8|rune(buf[i+1]))
 	}
 	return string(s)
 }
 
 func decodeUTF16LE(buf []byte) string {
 	s := make([]rune, 0, len(buf)/2)
-	for i := 0; i < len(buf); i += 2 {
-		s = append(s, rune(buf[i])<<8|rune(buf[i+1]))
+	for i := 0; i+1 < len(buf); i += 2 {
+		s = append(s, rune(buf[i])|rune(buf[i+1])<<8)
 	}
 	return string(s)
 }
@@ -206,6 +227,18 @@ func decodeTXXX(txxx map[string]string, buf []byte, unsynch bool) error {
 	return nil
 }
 
+// cleanString removes C0 control characters from s and trims the whitespace
+// around it.
+func cleanString(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
 func translateTXXXFrames(frames map[string]string, txxx map[string]string) {
 	for key, val := range txxx {
 		// log.Printf("TXXX %q: %q", key, val)
@@ -271,43 +304,12 @@ func parseDate(frames map[string]string) (tm time.Time, err error) {
 
 	for _, frame := range dateFrames {
 		if val, ok := frames[frame]; ok {
-			tm, err = tryAllDateFormats(val)
-			if err == nil {
+			if tm, ok := dateutil.Parse(val); ok {
 				// log.Println(val, tm)
-				return
+				return tm, nil
 			}
 		}
 	}
 
 	return time.Time{}, nil
 }
-
-var dateFormats = []string{
-	"2006-01-02T15:04:05Z0700",
-	"2006-01-02T15:04:05Z07:00",
-	"2006-01-02T15:04:05",
-	"2006-01-02T15:04Z0700",
-	"2006-01-02T15:04Z07:00",
-	"2006-01-02T15:04",
-	"2006-01-02T15",
-	"2006-01-02",
-	"2006-01",
-	"2006",
-	"2006/01/02",
-	"2006.01.02",
-}
-
-func tryAllDateFormats(s string) (tm time.Time, err error) {
-	for i, f := range dateFormats {
-		tm, err = time.Parse(f, s)
-		if err != nil {
-			if i == len(dateFormats)-1 {
-				return
-			}
-			err = nil
-			continue
-		}
-		break
-	}
-	return
-}
@@ -1,26 +1,500 @@
 package id3v2
 
 import (
-	"fmt"
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
 )
 
 func TestTextFrame(t *testing.T) {
-	f, err := os.Open("/home/moshee/.pls/pihupaxog.06 Mitch Murder - Montage.mp3")
+	tests := []struct {
+		file   string
+		frames map[string]string
+	}{
+		{"id3v22.mp3", map[string]string{"TIT2": "Title 2.2", "TPE1": "Artist", "TALB": "Album", "TRCK": "2/10"}},
+		{"id3v23.mp3", map[string]string{"TIT2": "Title 2.3", "TPE1": "Artist", "TALB": "Album", "TRCK": "3/10", "TYER": "2003"}},
+		// UTF-8, which only ID3v2.4 has
+		{"id3v24.mp3", map[string]string{"TIT2": "Titre 2.4 ☆", "TPE1": "Artiste", "TALB": "Album", "TRCK": "4", "TDRC": "2004-05-06"}},
+	}
+
+	for _, test := range tests {
+		f, err := os.Open(filepath.Join("..", "..", "testdata", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, err := Decode(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+
+		frames := tags.(*Tags).Frames
+		if len(frames) != len(test.frames) {
+			t.Errorf("%s: got frames %q", test.file, frames)
+		}
+		for id, s := range test.frames {
+			if frames[id] != s {
+				t.Errorf("%s: %s: got %q, expected %q", test.file, id, frames[id], s)
+			}
+		}
+	}
+}
+
+func TestRedundantBOM(t *testing.T) {
+	tests := []struct {
+		enc  byte
+		text string
+	}{
+		{encUTF8, "\xef\xbb\xbfTitle"},
+		{encUTF16BE, "\xfe\xff\x00T\x00i\x00t\x00l\x00e"},
+		// the BOM wins over the encoding
+		{encUTF16BE, "\xff\xfeT\x00i\x00t\x00l\x00e\x00"},
+		{encUTF16BE, "\x00T\x00i\x00t\x00l\x00e"},
+	}
+	for _, test := range tests {
+		s, err := decodeTextFrame(test.enc, []byte(test.text), false)
+		if err != nil || s != "Title" {
+			t.Errorf("%q: got %q, %v", test.text, s, err)
+		}
+	}
+}
+
+func TestReadTerminatedString(t *testing.T) {
+	tests := []struct {
+		enc     byte
+		data    string
+		s       string
+		content string
+	}{
+		{encISO8859_1, "desc\x00content", "desc", "content"},
+		{encISO8859_1, "caf\xe9\x00content", "café", "content"},
+		{encUTF8, "caf\xc3\xa9\x00content", "café", "content"},
+		{encUTF8, "\x00content", "", "content"},
+		// the last character ends in a null byte right before the terminator
+		{encUTF16_BOM, "\xff\xfec\x00a\x00f\x00\xe9\x00\x00\x00\xff\xfex\x00", "café", "\xff\xfex\x00"},
+		{encUTF16_BOM, "\xfe\xff\x00c\x00a\x00f\x00\xe9\x00\x00\x00x", "café", "\x00x"},
+		{encUTF16_BOM, "\x00\x00\xff\xfex\x00", "", "\xff\xfex\x00"},
+		// a null byte as the second half of one code unit and the first of the
+		// next isn't a terminator
+		{encUTF16BE, "\x01\x00\x00\x41\x00\x00content", "ĀA", "content"},
+	}
+
+	for _, test := range tests {
+		b := bytes.NewBufferString(test.data)
+		s, err := readTerminatedString(test.enc, b)
+		if err != nil {
+			t.Errorf("%q: %v", test.data, err)
+			continue
+		}
+		if s != test.s {
+			t.Errorf("%q: got %q, expected %q", test.data, s, test.s)
+		}
+		if b.String() != test.content {
+			t.Errorf("%q: %q left over, expected %q", test.data, b.String(), test.content)
+		}
+	}
+}
+
+func TestCOMMDescriptor(t *testing.T) {
+	// UTF-16 "é" as the descriptor, then "hi" as the comment
+	body := "\x01eng\xff\xfe\xe9\x00\x00\x00\xff\xfeh\x00i\x00"
+	frame := "COMM" + string([]byte{0, 0, 0, byte(len(body))}) + "\x00\x00" + body
+
+	frames, _, err := readFrames(bytes.NewReader([]byte(frame)), &Header{Major: 3, Size: uint32(len(frame))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames["COMM"] != "hi" {
+		t.Errorf("got %q", frames["COMM"])
+	}
+}
+
+func TestEncodingTags(t *testing.T) {
+	var tags sound.EncodingTags = &Tags{Frames: map[string]string{
+		"TSSE": "LAME 3.100 -V0",
+		"TDEN": "2019-03-04T05:06",
+	}}
+	if s := tags.EncoderSettings(); s != "LAME 3.100 -V0" {
+		t.Errorf("EncoderSettings: got %q", s)
+	}
+	expected := time.Date(2019, 3, 4, 5, 6, 0, 0, time.UTC)
+	if tm := tags.EncodingTime(); !tm.Equal(expected) {
+		t.Errorf("EncodingTime: got %v, expected %v", tm, expected)
+	}
+}
+
+func TestMistaggedFrameSize(t *testing.T) {
+	// 200 bytes of text, so the synchsafe size (0x0148) and the plain size
+	// (0xc8) differ
+	text := "\x00" + strings.Repeat("a", 199)
+
+	tests := []struct {
+		major uint8
+		size  string
+	}{
+		{3, "\x00\x00\x00\xc8"}, // correct
+		{3, "\x00\x00\x01\x48"}, // synchsafe in 2.3
+		{4, "\x00\x00\x01\x48"}, // correct
+		{4, "\x00\x00\x00\xc8"}, // plain in 2.4
+	}
+
+	for _, test := range tests {
+		tag := "TIT2" + test.size + "\x00\x00" + text + "TALB\x00\x00\x00\x02\x00\x00\x00b"
+		frames, _, err := readFrames(bytes.NewReader([]byte(tag)), &Header{Major: test.major, Size: uint32(len(tag))})
+		if err != nil {
+			t.Errorf("2.%d %q: %v", test.major, test.size, err)
+			continue
+		}
+		if frames["TIT2"] != text[1:] || frames["TALB"] != "b" {
+			t.Errorf("2.%d %q: got %q", test.major, test.size, frames)
+		}
+	}
+}
+
+func TestCleanStrings(t *testing.T) {
+	frames := "TIT2\x00\x00\x00\x0c\x00\x00\x00 Title\r\n\x00\x00\x00" +
+		"TPE1\x00\x00\x00\x08\x00\x00\x00Art\x01ist"
+	tag := "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+
+	for _, test := range []struct {
+		opts          DecodeOptions
+		title, artist string
+	}{
+		{DecodeOptions{}, " Title\r\n", "Art\x01ist"},
+		{DecodeOptions{CleanStrings: true}, "Title", "Artist"},
+	} {
+		tags, err := DecodeWithOptions(strings.NewReader(tag), test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags.Title() != test.title || tags.Artist() != test.artist {
+			t.Errorf("%+v: got %q, %q", test.opts, tags.Title(), tags.Artist())
+		}
+	}
+}
+
+func TestOversizedFrame(t *testing.T) {
+	// the title claims 100 bytes, but the tag ends after 6
+	frames := "TPE1\x00\x00\x00\x07\x00\x00\x00Artist" +
+		"TIT2\x00\x00\x00\x64\x00\x00\x00Title"
+	tag := "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames +
+		"\xff\xfb\x90\x00"
+
+	tags, err := Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Artist() != "Artist" || tags.Title() != "Title" {
+		t.Errorf("got artist %q, title %q", tags.Artist(), tags.Title())
+	}
+
+	// and with nothing at all left, the title is skipped
+	frames = "TPE1\x00\x00\x00\x07\x00\x00\x00Artist" +
+		"TIT2\x00\x00\x00\x64\x00\x00"
+	tag = "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+	tags, err = Decode(strings.NewReader(tag))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer f.Close()
+	if _, ok := tags.(*Tags).Frames["TIT2"]; tags.Artist() != "Artist" || ok {
+		t.Errorf("got artist %q, title %q", tags.Artist(), tags.Title())
+	}
+
+	// a data length indicator claimed by a frame too short to hold one
+	frames = "TIT2\x00\x00\x00\x02\x00\x01\x00\x00\x00\x00"
+	tag = "ID3\x04\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+	if _, err = Decode(strings.NewReader(tag)); err != nil {
+		t.Errorf("short frame with a data length indicator: %v", err)
+	}
+}
+
+func TestNoFrameTranslation(t *testing.T) {
+	v22 := "TT2\x00\x00\x06\x00Title"
+	v23 := "TXXX\x00\x00\x00\x0c\x00\x00\x00ALBUM\x00Album"
+
+	for _, test := range []struct {
+		tag      string
+		opts     DecodeOptions
+		id, want string
+	}{
+		{"ID3\x02\x00\x00\x00\x00\x00\x0c" + v22, DecodeOptions{}, "TIT2", "Title"},
+		{"ID3\x02\x00\x00\x00\x00\x00\x0c" + v22, DecodeOptions{NoFrameTranslation: true}, "TT2", "Title"},
+		{"ID3\x03\x00\x00\x00\x00\x00\x16" + v23, DecodeOptions{}, "TALB", "Album"},
+		{"ID3\x03\x00\x00\x00\x00\x00\x16" + v23, DecodeOptions{NoFrameTranslation: true}, "TALB", ""},
+	} {
+		tags, err := DecodeWithOptions(strings.NewReader(test.tag), test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tags.(*Tags).Frames[test.id]; got != test.want {
+			t.Errorf("%+v: got %s %q, want %q", test.opts, test.id, got, test.want)
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		tlen string
+		d    time.Duration
+	}{
+		{"225000", 225 * time.Second},
+		{" 1500 ", 1500 * time.Millisecond},
+		{"", 0},
+		{"3:45", 0},
+	}
+	for _, test := range tests {
+		tags := &Tags{Frames: map[string]string{"TLEN": test.tlen}}
+		if d := tags.Length(); d != test.d {
+			t.Errorf("%q: got %v, expected %v", test.tlen, d, test.d)
+		}
+	}
+}
+
+func TestStopAfter(t *testing.T) {
+	// the encrypted frame after the title and artist can't be decoded
+	frames := "TIT2\x00\x00\x00\x06\x00\x00\x00Title" +
+		"TPE1\x00\x00\x00\x07\x00\x00\x00Artist" +
+		"TALB\x00\x00\x00\x06\x00\x04\x00Album"
+	tag := "ID3\x04\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
 
-	tags, err := Decode(f)
+	if _, err := Decode(strings.NewReader(tag)); !errors.Is(err, ErrEncryption) {
+		t.Errorf("got %v, expected ErrEncryption", err)
+	}
+	tags, err := DecodeWithOptions(strings.NewReader(tag), DecodeOptions{StopAfter: []string{"TPE1", "TIT2"}})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if tags.Title() != "Title" || tags.Artist() != "Artist" || tags.Album() != "" {
+		t.Errorf("got %q, %q, %q", tags.Title(), tags.Artist(), tags.Album())
+	}
+}
 
-	tt := tags.(*Tags)
+func TestPlaylistDelay(t *testing.T) {
+	// given as a TXXX frame, which is translated to TDLY
+	frames := "TXXX\x00\x00\x00\x12\x00\x00\x00PLAYLISTDELAY\x00" + "250"
+	tag := "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
 
-	for k, v := range tt.Frames {
-		fmt.Printf("%s\t%s\n", k, v)
+	tags, err := Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := tags.(*Tags).PlaylistDelay(); d != 250*time.Millisecond {
+		t.Errorf("got %v", d)
+	}
+}
+
+func TestAllPaddingTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+	}{
+		// declared size 1000 as a synchsafe integer
+		{"2.3", "ID3\x03\x00\x00\x00\x00\x07\x68" + strings.Repeat("\x00", 1000)},
+		{"2.4", "ID3\x04\x00\x00\x00\x00\x07\x68" + strings.Repeat("\x00", 1000)},
+		{"2.2", "ID3\x02\x00\x00\x00\x00\x07\x68" + strings.Repeat("\x00", 1000)},
+		{"odd size", "ID3\x03\x00\x00\x00\x00\x07\x67" + strings.Repeat("\x00", 999)},
+		{"empty", "ID3\x03\x00\x00\x00\x00\x00\x00"},
+		{"shorter than a frame ID", "ID3\x03\x00\x00\x00\x00\x00\x03\x00\x00\x00"},
+	}
+
+	for _, test := range tests {
+		r := bufio.NewReader(strings.NewReader(test.tag + "\xff\xfb"))
+		tags, err := Decode(r)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		v2 := tags.(*Tags)
+		if len(v2.Frames) != 0 || tags.Title() != "" || tags.Track() != 0 || !tags.Date().IsZero() {
+			t.Errorf("%s: got %+v", test.name, v2)
+		}
+		if rest, _ := ioutil.ReadAll(r); string(rest) != "\xff\xfb" {
+			t.Errorf("%s: %q left after the tag", test.name, rest)
+		}
+	}
+}
+
+func TestClassicalTags(t *testing.T) {
+	frame := func(id, text string) string {
+		return id + string([]byte{0, 0, 0, byte(len(text) + 1)}) + "\x00\x00\x00" + text
+	}
+	tag := frame("TIT1", "Symphony No. 9") + frame("GRP1", "Favourites") +
+		frame("MVNM", "Presto") + frame("MVIN", "4/4")
+
+	h := &Header{Major: 3, Size: uint32(len(tag))}
+	frames, _, err := readFrames(bytes.NewReader([]byte(tag)), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags sound.ClassicalTags = &Tags{Frames: frames}
+	if tags.Grouping() != "Favourites" || tags.Work() != "Symphony No. 9" || tags.MovementName() != "Presto" {
+		t.Errorf("got %q", frames)
+	}
+	if n, total := tags.Movement(); n != 4 || total != 4 {
+		t.Errorf("got movement %d/%d", n, total)
+	}
+
+	// before GRP1, grouping was kept in TIT1
+	delete(frames, "GRP1")
+	if g := tags.Grouping(); g != "Symphony No. 9" {
+		t.Errorf("without GRP1: got grouping %q", g)
+	}
+}
+
+func TestSubtitles(t *testing.T) {
+	// the set subtitle is given as a TXXX frame, which is translated to TSST
+	frames := "TIT3\x00\x00\x00\x0a\x00\x00\x00Live take" +
+		"TXXX\x00\x00\x00\x17\x00\x00\x00DISCSUBTITLE\x00B-Sides"
+	tag := "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+
+	tags, err := Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := tags.(sound.SubtitleTags)
+	if st.Subtitle() != "Live take" || st.SetSubtitle() != "B-Sides" {
+		t.Errorf("got %q, %q", st.Subtitle(), st.SetSubtitle())
+	}
+}
+
+func TestRawFrame(t *testing.T) {
+	frames := "TIT2\x00\x00\x00\x05\x00\x00\x01\xff\xfea\x00" +
+		"PRIV\x00\x00\x00\x05\x00\x00own\x00\x01"
+	tag := "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+
+	for _, keep := range []bool{false, true} {
+		tags, err := DecodeWithOptions(strings.NewReader(tag), DecodeOptions{KeepRaw: keep})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2 := tags.(*Tags)
+		if v2.Title() != "a" {
+			t.Errorf("KeepRaw %v: got title %q", keep, v2.Title())
+		}
+
+		b, ok := v2.RawFrame("TIT2")
+		if ok != keep || keep && string(b) != "\x01\xff\xfea\x00" {
+			t.Errorf("KeepRaw %v: got TIT2 %q, %v", keep, b, ok)
+		}
+		b, ok = v2.RawFrame("PRIV")
+		if ok != keep || keep && string(b) != "own\x00\x01" {
+			t.Errorf("KeepRaw %v: got PRIV %q, %v", keep, b, ok)
+		}
+	}
+}
+
+func TestUnsynchronized(t *testing.T) {
+	tests := []struct {
+		name         string
+		tag          string
+		unsynch      bool
+		tagUnsynch   bool
+		frameUnsynch bool
+	}{
+		{"none", "ID3\x03\x00\x00\x00\x00\x00\x0dTIT2\x00\x00\x00\x03\x00\x00\x00ab", false, false, false},
+		{"header flag", "ID3\x03\x00\x80\x00\x00\x00\x0dTIT2\x00\x00\x00\x03\x00\x00\x00ab", true, true, false},
+		{"frame flag", "ID3\x04\x00\x00\x00\x00\x00\x0dTIT2\x00\x00\x00\x03\x00\x02\x00ab", true, false, true},
+	}
+
+	for _, test := range tests {
+		tags, err := Decode(strings.NewReader(test.tag))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		v2 := tags.(*Tags)
+		if v2.Title() != "ab" || v2.Unsynchronized() != test.unsynch {
+			t.Errorf("%s: got title %q, unsynchronized %v", test.name, v2.Title(), v2.Unsynchronized())
+		}
+		if v2.TagUnsynchronized() != test.tagUnsynch || v2.FramesUnsynchronized() != test.frameUnsynch {
+			t.Errorf("%s: got tag %v, frames %v", test.name, v2.TagUnsynchronized(), v2.FramesUnsynchronized())
+		}
+	}
+}
+
+func TestMultipleValues(t *testing.T) {
+	frames := "TPE1\x00\x00\x00\x0a\x00\x00\x03first\x00two" +
+		"TCOM\x00\x00\x00\x05\x00\x00\x03solo"
+	tag := "ID3\x04\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+
+	tags, err := Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(what string, tags *Tags) {
+		var m sound.MultiValueTags = tags
+		if a := m.Artists(); tags.Artist() != "first" || len(a) != 2 || a[0] != "first" || a[1] != "two" {
+			t.Errorf("%s: got artist %q, artists %q", what, tags.Artist(), a)
+		}
+		if c := m.Composers(); len(c) != 1 || c[0] != "solo" || m.Genres() != nil {
+			t.Errorf("%s: got composers %q, genres %q", what, c, m.Genres())
+		}
+	}
+	check("decoded", tags.(*Tags))
+
+	var buf bytes.Buffer
+	_, err = tags.(*Tags).WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err = Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("rewritten", tags.(*Tags))
+}
+
+func TestTextErrors(t *testing.T) {
+	if _, err := decodeTextFrame(0x05, []byte("text"), false); !errors.Is(err, ErrUnknownEncoding) {
+		t.Errorf("unknown encoding: got %v", err)
+	}
+	if _, err := readTerminatedString(encUTF16BE, bytes.NewBufferString("\x00t\x00")); !errors.Is(err, ErrTruncated) {
+		t.Errorf("unterminated string: got %v", err)
+	}
+}
+
+func TestAllFrames(t *testing.T) {
+	frames := "COMM\x00\x00\x00\x08\x00\x00\x00eng\x00one" +
+		"TIT2\x00\x00\x00\x06\x00\x00\x00Title" +
+		"TXXX\x00\x00\x00\x04\x00\x00\x00a\x00b" +
+		"COMM\x00\x00\x00\x08\x00\x00\x00eng\x00two"
+	tag := "ID3\x03\x00\x00\x00\x00\x00" + string([]byte{byte(len(frames))}) + frames
+
+	tags, err := DecodeWithOptions(strings.NewReader(tag), DecodeOptions{KeepOrder: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Frame{
+		{"COMM", []byte("\x00eng\x00one"), "one"},
+		{"TIT2", []byte("\x00Title"), "Title"},
+		{"TXXX", []byte("\x00a\x00b"), ""},
+		{"COMM", []byte("\x00eng\x00two"), "two"},
+	}
+	all := tags.(*Tags).AllFrames()
+	if len(all) != len(expected) {
+		t.Fatalf("got %d frames, expected %d", len(all), len(expected))
+	}
+	for i, f := range all {
+		e := expected[i]
+		if f.ID != e.ID || string(f.Raw) != string(e.Raw) || f.Value != e.Value {
+			t.Errorf("frame %d: got %q, expected %q", i, f, e)
+		}
+	}
+
+	tags, err = Decode(strings.NewReader(tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all := tags.(*Tags).AllFrames(); all != nil {
+		t.Errorf("got %d frames without KeepOrder", len(all))
 	}
 }
@@ -0,0 +1,173 @@
+// Package lyrics3 provides facilities for reading Lyrics3 v2.00 tags, which
+// some older MP3s carry between the end of the audio and the ID3v1 tag.
+//
+// A Lyrics3 v2.00 tag is a sequence of fields delimited by "LYRICSBEGIN" and
+// a trailer consisting of the 6-digit size of the tag and "LYRICS200". Each
+// field is a 3-character ID, a 5-digit size, and the content.
+package lyrics3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/id3/id3v1"
+)
+
+const (
+	Begin = "LYRICSBEGIN"
+	End   = "LYRICS200"
+
+	// size of the trailer: 6-digit tag size + "LYRICS200"
+	trailerSize = 6 + len(End)
+	// size of a field header: 3-character ID + 5-digit size
+	fieldHeaderSize = 3 + 5
+)
+
+var (
+	ErrBadHeader = errors.New("lyrics3: missing LYRICSBEGIN")
+	ErrBadSize   = errors.New("lyrics3: malformed tag size")
+	ErrBadField  = errors.New("lyrics3: malformed field")
+)
+
+// Tag is a Lyrics3 v2.00 tag. Fields maps field IDs, such as "LYR" or "INF",
+// to their contents.
+type Tag struct {
+	Fields map[string]string
+}
+
+func (t *Tag) String() string      { return sound.Summary(t, nil) }
+func (t *Tag) Title() string       { return t.Fields["ETT"] }
+func (t *Tag) AlbumArtist() string { return t.Fields["EAR"] }
+func (t *Tag) Artist() string      { return t.Fields["EAR"] }
+func (t *Tag) Album() string       { return t.Fields["EAL"] }
+func (t *Tag) Genre() string       { return "" }
+func (t *Tag) Disc() int           { return 0 }
+func (t *Tag) Track() int          { return 0 }
+func (t *Tag) Date() time.Time     { return time.Time{} }
+func (t *Tag) Composer() string    { return t.Fields["AUT"] }
+func (t *Tag) Notes() string       { return t.Fields["INF"] }
+
+// Keys returns the IDs of the fields in the tag.
+func (t *Tag) Keys() []string {
+	keys := make([]string, 0, len(t.Fields))
+	for k := range t.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *Tag) TagFormat() string { return "Lyrics3v2" }
+
+// Lyrics returns the contents of the LYR field.
+func (t *Tag) Lyrics() string { return t.Fields["LYR"] }
+
+// Decode decodes a Lyrics3 v2.00 tag, locating it from the end of the stream.
+// The tag is expected to be immediately before the ID3v1 tag, or at the very
+// end if there is no ID3v1 tag. If no Lyrics3 tag is found, it returns
+// sound.ErrNoTags.
+//
+// If r is not an io.Seeker, the whole stream will be read into memory.
+func Decode(r io.Reader) (sound.Tags, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		rs = bytes.NewReader(b)
+	}
+
+	end, err := rs.Seek(0, os.SEEK_END)
+	if err != nil {
+		return nil, err
+	}
+
+	// step over the ID3v1 tag if there is one
+	if end >= id3v1.Size {
+		magic, err := readAt(rs, end-id3v1.Size, 3)
+		if err != nil {
+			return nil, err
+		}
+		if string(magic) == "TAG" {
+			end -= id3v1.Size
+		}
+	}
+
+	if end < int64(trailerSize) {
+		return nil, sound.ErrNoTags
+	}
+	trailer, err := readAt(rs, end-int64(trailerSize), trailerSize)
+	if err != nil {
+		return nil, err
+	}
+	if string(trailer[6:]) != End {
+		return nil, sound.ErrNoTags
+	}
+
+	size, err := strconv.Atoi(string(trailer[:6]))
+	if err != nil || size < len(Begin) {
+		return nil, ErrBadSize
+	}
+	start := end - int64(trailerSize) - int64(size)
+	if start < 0 {
+		return nil, ErrBadSize
+	}
+
+	block, err := readAt(rs, start, size)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(block, []byte(Begin)) {
+		return nil, ErrBadHeader
+	}
+
+	fields, err := decodeFields(block[len(Begin):])
+	if err != nil {
+		return nil, err
+	}
+	return &Tag{fields}, nil
+}
+
+func readAt(rs io.ReadSeeker, pos int64, n int) ([]byte, error) {
+	_, err := rs.Seek(pos, os.SEEK_SET)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(rs, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func decodeFields(b []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+
+	for len(b) > 0 {
+		if len(b) < fieldHeaderSize {
+			return nil, ErrBadField
+		}
+		id := string(b[:3])
+		size, err := strconv.Atoi(string(b[3:fieldHeaderSize]))
+		if err != nil || size < 0 {
+			return nil, ErrBadField
+		}
+		b = b[fieldHeaderSize:]
+		if size > len(b) {
+			return nil, ErrBadField
+		}
+		fields[id] = string(b[:size])
+		b = b[size:]
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,28 @@
+package lyrics3
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	body := Begin + "IND00002" + "10" + "LYR00011" + "hello world" + "INF00004" + "info"
+	data := []byte("audio data" + body + fmt.Sprintf("%06d", len(body)) + End)
+	id3v1 := make([]byte, 128)
+	copy(id3v1, "TAG")
+
+	for _, b := range [][]byte{data, append(data, id3v1...)} {
+		tags, err := Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag := tags.(*Tag)
+		if tag.Lyrics() != "hello world" {
+			t.Errorf("lyrics: got %q", tag.Lyrics())
+		}
+		if tag.Notes() != "info" {
+			t.Errorf("info: got %q", tag.Notes())
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package dateutil parses the dates found in tags, which are written in many
+// more ways than the formats' specifications allow.
+package dateutil
+
+import (
+	"strings"
+	"time"
+)
+
+// formats are the layouts Parse tries, from ISO 8601 timestamps down to a
+// bare year, along with the slashes and dots that some taggers use.
+var formats = []string{
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02T15",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+	"2006/01/02",
+	"2006.01.02",
+}
+
+// Parse parses s as the first of the known formats that it matches,
+// reporting false if there are none. Dates without a time zone are in UTC,
+// and partial dates, such as just a year, are at the start of the period.
+func Parse(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, f := range formats {
+		t, err := time.Parse(f, s)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
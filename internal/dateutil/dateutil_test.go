@@ -0,0 +1,28 @@
+package dateutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		date time.Time
+		ok   bool
+	}{
+		{"2005-06-07T08:09:10+0900", time.Date(2005, 6, 7, 8, 9, 10, 0, time.FixedZone("", 9*3600)), true},
+		{"2005-06-07T08:09", time.Date(2005, 6, 7, 8, 9, 0, 0, time.UTC), true},
+		{"2005-06-07", time.Date(2005, 6, 7, 0, 0, 0, 0, time.UTC), true},
+		{"2005/06/07", time.Date(2005, 6, 7, 0, 0, 0, 0, time.UTC), true},
+		{"2005.06.07", time.Date(2005, 6, 7, 0, 0, 0, 0, time.UTC), true},
+		{" 2005 ", time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"someday", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, test := range tests {
+		if date, ok := Parse(test.s); !date.Equal(test.date) || ok != test.ok {
+			t.Errorf("%q: got %v, %t", test.s, date, ok)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Package fixture synthesizes minimal, well-formed audio files for tests.
+// The files have correct headers for the real parsers to read, and silent
+// or empty audio, so that the expected durations follow from the arguments.
+//
+// The functions panic if asked for something the format can't hold, since
+// they are only called with constants from tests.
+package fixture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mpegRates are the MPEG versions that each sample rate belongs to, as the
+// version ID and sample rate index of the frame header.
+var mpegRates = map[int]struct{ version, index uint32 }{
+	44100: {3, 0}, 48000: {3, 1}, 32000: {3, 2},
+	22050: {2, 0}, 24000: {2, 1}, 16000: {2, 2},
+	11025: {0, 0}, 12000: {0, 1}, 8000: {0, 2},
+}
+
+// mpegBitrates are the Layer III bitrates in kbps by bitrate index, for
+// MPEG-1 and then MPEG-2 and 2.5.
+var mpegBitrates = [2][]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// MP3SamplesPerFrame returns the number of samples in each frame that MakeMP3
+// makes at the given sample rate.
+func MP3SamplesPerFrame(sampleRate int) int {
+	if mpegRates[sampleRate].version == 3 {
+		return 1152
+	}
+	return 576
+}
+
+// MakeMP3 makes the given number of silent MPEG Layer III frames at a
+// constant bitrate in bps. The MPEG version follows from the sample rate. The
+// frames are stereo and unpadded, and there is no Xing header.
+func MakeMP3(frames, bitrate, sampleRate int) []byte {
+	rate, ok := mpegRates[sampleRate]
+	if !ok {
+		panic(fmt.Sprintf("fixture: no MPEG version has a sample rate of %d Hz", sampleRate))
+	}
+	table := mpegBitrates[1]
+	if rate.version == 3 {
+		table = mpegBitrates[0]
+	}
+	index := -1
+	for i, kbps := range table {
+		if kbps > 0 && kbps*1000 == bitrate {
+			index = i
+		}
+	}
+	if index < 0 {
+		panic(fmt.Sprintf("fixture: %d bps isn't an MPEG bitrate at %d Hz", bitrate, sampleRate))
+	}
+
+	header := 0xffe00000 | rate.version<<19 | 1<<17 | 1<<16 | uint32(index)<<12 | rate.index<<10
+	frame := make([]byte, MP3SamplesPerFrame(sampleRate)*bitrate/8/sampleRate)
+	binary.BigEndian.PutUint32(frame, header)
+	return bytes.Repeat(frame, frames)
+}
+
+// oggStream lays packets out in pages, one packet per page.
+type oggStream struct {
+	buf bytes.Buffer
+	seq uint32
+}
+
+func (s *oggStream) page(granule int64, packet []byte, last bool) {
+	var flags byte
+	if s.seq == 0 {
+		flags |= 2 // beginning of stream
+	}
+	if last {
+		flags |= 4 // end of stream
+	}
+	s.buf.Write(oggPage(flags, granule, s.seq, oggLacing(len(packet)), packet))
+	s.seq++
+}
+
+// OggPage makes a page holding one whole packet, with no header type flags
+// and a sequence number of 0.
+func OggPage(granule int64, packet string) string {
+	return string(oggPage(0, granule, 0, oggLacing(len(packet)), []byte(packet)))
+}
+
+// OggLacedPage makes a page with the given header type flags and segment
+// table, filling each segment with its own index, for packets that span
+// pages or share them.
+func OggLacedPage(headerType byte, lacing ...byte) string {
+	var data []byte
+	for i, n := range lacing {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, int(n))...)
+	}
+	return string(oggPage(headerType, 0, 0, lacing, data))
+}
+
+// oggLacing makes the segment table for a packet of n bytes.
+func oggLacing(n int) []byte {
+	var lacing []byte
+	for ; n >= 255; n -= 255 {
+		lacing = append(lacing, 255)
+	}
+	return append(lacing, byte(n))
+}
+
+// oggPage makes a page of the stream with serial number 1, with its
+// checksum.
+func oggPage(headerType byte, granule int64, seq uint32, lacing, data []byte) []byte {
+	var p bytes.Buffer
+	p.WriteString("OggS")
+	p.Write([]byte{0, headerType})
+	binary.Write(&p, binary.LittleEndian, granule)
+	binary.Write(&p, binary.LittleEndian, []uint32{1, seq, 0})
+	p.WriteByte(byte(len(lacing)))
+	p.Write(lacing)
+	p.Write(data)
+
+	b := p.Bytes()
+	binary.LittleEndian.PutUint32(b[22:], oggCRC(b))
+	return b
+}
+
+// oggCRC is the page checksum: CRC-32 with the polynomial 0x04c11db7,
+// unreflected, with no initial value or final XOR.
+func oggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, c := range b {
+		crc ^= uint32(c) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// VorbisComment makes a comment vector, as used by Vorbis, Opus and FLAC,
+// from "KEY=value" strings.
+func VorbisComment(comments ...string) []byte {
+	var b bytes.Buffer
+	vendor := "ktkr.us/pkg/sound fixture"
+	binary.Write(&b, binary.LittleEndian, uint32(len(vendor)))
+	b.WriteString(vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+// MakeOggVorbis makes an Ogg Vorbis stream of the given number of samples
+// per channel, with a nominal bitrate in bps, and the given comments. The
+// audio packets are empty, with one page per second.
+func MakeOggVorbis(samples int64, sampleRate, channels, bitrate int, comments ...string) []byte {
+	var id bytes.Buffer
+	id.WriteString("\x01vorbis")
+	binary.Write(&id, binary.LittleEndian, uint32(0))
+	id.WriteByte(byte(channels))
+	binary.Write(&id, binary.LittleEndian, []int32{int32(sampleRate), 0, int32(bitrate), 0})
+	// block sizes of 256 and 2048, and the framing bit
+	id.Write([]byte{0xb8, 1})
+
+	comment := append([]byte("\x03vorbis"), VorbisComment(comments...)...)
+
+	var s oggStream
+	s.page(0, id.Bytes(), false)
+	s.page(0, append(comment, 1), false)
+	s.page(0, []byte("\x05vorbis"), false)
+	for granule := int64(sampleRate); granule < samples; granule += int64(sampleRate) {
+		s.page(granule, make([]byte, 16), false)
+	}
+	s.page(samples, make([]byte, 16), true)
+	return s.buf.Bytes()
+}
+
+// MakeOggOpus makes an Ogg Opus stream of the given number of samples per
+// channel at 48 kHz, after the pre-skip, with the given comments. The input
+// sample rate in the header is 44.1 kHz, and there is one empty audio packet.
+func MakeOggOpus(samples int64, channels, preSkip int, comments ...string) []byte {
+	var head bytes.Buffer
+	head.WriteString("OpusHead")
+	head.Write([]byte{1, byte(channels)})
+	binary.Write(&head, binary.LittleEndian, uint16(preSkip))
+	binary.Write(&head, binary.LittleEndian, uint32(44100))
+	// no output gain, and channel mapping family 0
+	head.Write([]byte{0, 0, 0})
+
+	var s oggStream
+	s.page(0, head.Bytes(), false)
+	s.page(0, append([]byte("OpusTags"), VorbisComment(comments...)...), false)
+	s.page(samples+int64(preSkip), make([]byte, 16), true)
+	return s.buf.Bytes()
+}
+
+// MakeFLAC makes a FLAC stream with a STREAMINFO block for the given number
+// of samples per channel, and a VORBIS_COMMENT block if there are comments.
+// There are no audio frames.
+func MakeFLAC(samples int64, sampleRate, channels, bitsPerSample int, comments ...string) []byte {
+	var si bytes.Buffer
+	// block sizes of 4096, and unknown frame sizes
+	si.Write([]byte{0x10, 0, 0x10, 0, 0, 0, 0, 0, 0, 0})
+	// 20 bits of sample rate, 3 of channels-1, 5 of bits-1, 36 of samples
+	v := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(bitsPerSample-1)<<36 | uint64(samples)&(1<<36-1)
+	binary.Write(&si, binary.BigEndian, v)
+	si.Write(make([]byte, 16)) // MD5 of the audio, unknown
+
+	block := func(typ byte, data []byte, last bool) []byte {
+		if last {
+			typ |= 0x80
+		}
+		size := len(data)
+		return append([]byte{typ, byte(size >> 16), byte(size >> 8), byte(size)}, data...)
+	}
+
+	b := []byte("fLaC")
+	if len(comments) == 0 {
+		return append(b, block(0, si.Bytes(), true)...)
+	}
+	b = append(b, block(0, si.Bytes(), false)...)
+	return append(b, block(4, VorbisComment(comments...), true)...)
+}
+
+// AIFFChunk makes an AIFF chunk, with a 32-bit size and a pad byte if the
+// data is of odd length.
+func AIFFChunk(id, data string) string {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.BigEndian, uint32(len(data)))
+	b.WriteString(data)
+	if len(data)%2 != 0 {
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// AIFFForm makes a FORM of the given type, "AIFF" or "AIFC", holding the
+// chunks.
+func AIFFForm(typ string, chunks ...string) []byte {
+	var body string
+	for _, c := range chunks {
+		body += c
+	}
+	var b bytes.Buffer
+	b.WriteString("FORM")
+	binary.Write(&b, binary.BigEndian, uint32(4+len(body)))
+	b.WriteString(typ + body)
+	return b.Bytes()
+}
+
+// DSDIFFChunk makes a DSDIFF chunk, with a 64-bit size, from the data
+// strung together, and a pad byte if that is of odd length.
+func DSDIFFChunk(id string, data ...string) string {
+	var body string
+	for _, d := range data {
+		body += d
+	}
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.BigEndian, uint64(len(body)))
+	b.WriteString(body)
+	if len(body)%2 != 0 {
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// DSDIFFForm makes a FRM8 of type "DSD " holding the chunks.
+func DSDIFFForm(chunks ...string) []byte {
+	return []byte(DSDIFFChunk("FRM8", append([]string{"DSD "}, chunks...)...))
+}
+
+// CountingReader counts in N the bytes read through R. It only has a Read
+// method, so a decoder can't seek in R through it.
+type CountingReader struct {
+	R io.Reader
+	N int64
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.R.Read(p)
+	r.N += int64(n)
+	return n, err
+}
+
+// CountingReadSeeker is a CountingReader that can seek, for checking that a
+// decoder seeks past data it has no use for rather than reading it.
+type CountingReadSeeker struct {
+	CountingReader
+	io.Seeker
+}
+
+// NewCountingReadSeeker makes a CountingReadSeeker reading from b.
+func NewCountingReadSeeker(b []byte) *CountingReadSeeker {
+	br := bytes.NewReader(b)
+	return &CountingReadSeeker{CountingReader{R: br}, br}
+}
@@ -0,0 +1,82 @@
+package sound_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/mp3"
+)
+
+// the title is only in ID3v1, and the artist is in both
+var mergeFile = "ID3\x03\x00\x00\x00\x00\x00\x10" + "TPE1\x00\x00\x00\x06\x00\x00\x00id3v2" +
+	"\xff\xfb\x90\x00" + strings.Repeat("\x00", 1000) +
+	"TAG" + padded("title", 30) + padded("id3v1", 30) + padded("", 30) +
+	"2001" + padded("", 29) + "\x01\x00"
+
+func TestDecodeTagsMP3Merge(t *testing.T) {
+	tags, _, err := sound.DecodeTags(bytes.NewReader([]byte(mergeFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title() != "title" || tags.Artist() != "id3v2" {
+		t.Errorf("got title %q, artist %q", tags.Title(), tags.Artist())
+	}
+	if f := tags.(sound.FormatTags).TagFormat(); f != "ID3v2.3+ID3v1.1" {
+		t.Errorf("got tag format %q", f)
+	}
+}
+
+func TestMP3Decoder(t *testing.T) {
+	// hide the Seek method so that the tail has to be read through
+	r := struct{ io.Reader }{strings.NewReader(mergeFile)}
+	d, err := mp3.NewDecoder(r, int64(len(mergeFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := d.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title() != "title" || tags.Artist() != "id3v2" {
+		t.Errorf("got title %q, artist %q", tags.Title(), tags.Artist())
+	}
+	if m := d.Meta(); m.BitRate() != 128000 || m.SampleRate() != 44100 {
+		t.Errorf("got %d bps at %d Hz", m.BitRate(), m.SampleRate())
+	}
+}
+
+func TestMP3DecodeMetaAt(t *testing.T) {
+	m, _, err := sound.DecodeMeta(bytes.NewReader([]byte(mergeFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := m.(interface{ DataOffset() int64 }).DataOffset()
+	if offset != 26 {
+		t.Fatalf("got data offset %d, expected 26", offset)
+	}
+
+	fsize := int64(len(mergeFile))
+	m, err = mp3.DecodeMetaAt(bytes.NewReader([]byte(mergeFile)), fsize, offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.BitRate() != 128000 {
+		t.Errorf("got %d bps", m.BitRate())
+	}
+
+	// without seeking
+	r := struct{ io.Reader }{strings.NewReader(mergeFile)}
+	_, err = mp3.DecodeMetaAt(r, fsize, offset)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = mp3.DecodeMetaAt(bytes.NewReader([]byte(mergeFile)), fsize, offset+1)
+	if err != mp3.ErrUnsynced {
+		t.Errorf("off by one: got %v, expected ErrUnsynced", err)
+	}
+}
@@ -3,7 +3,9 @@ package mp3
 import (
 	"bufio"
 	"io"
+	"io/ioutil"
 	"math"
+	"os"
 	"time"
 
 	"ktkr.us/pkg/sound"
@@ -13,6 +15,17 @@ import (
 // DecodeMeta decodes metadata out of an MP3 stream, attempting to calculate
 // the duration and decode the ID3v1 header if there is one.
 func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
+	return decodeMeta(rr, fsize, false)
+}
+
+// DecodeMetaQuick is like DecodeMeta, but never counts the frames. If the VBR
+// header's frame count is missing or can't be right, the duration is
+// estimated from the file size and the first frame's bitrate instead.
+func DecodeMetaQuick(rr io.Reader, fsize int64) (sound.Metadata, error) {
+	return decodeMeta(rr, fsize, true)
+}
+
+func decodeMeta(rr io.Reader, fsize int64, quick bool) (sound.Metadata, error) {
 	r := newReader(rr)
 	f, err := r.nextFrame()
 	if err != nil {
@@ -20,7 +33,15 @@ func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
 		return nil, err
 	}
 
-	var numFrames int
+	var (
+		numFrames int
+		vbrHeader bool
+		// cbrHeader is whether the header is an Info header, which LAME
+		// writes in place of a Xing header for a CBR stream
+		cbrHeader bool
+		// audioBytes is the size of the stream as given by the VBR header
+		audioBytes int64
+	)
 	buf := make([]byte, 4)
 	_, err = io.ReadFull(f, buf)
 	if err != nil {
@@ -35,6 +56,9 @@ func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
 			return nil, err
 		}
 		numFrames = int(xing.NumFrames)
+		audioBytes = int64(xing.NumFileBytes)
+		vbrHeader = true
+		cbrHeader = string(buf) == "Info"
 
 	case "VBRI":
 		vbri, err := decodeVBRI(f)
@@ -43,28 +67,62 @@ func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
 			return nil, err
 		}
 		numFrames = int(vbri.NumFrames)
+		audioBytes = int64(vbri.NumBytes)
+		vbrHeader = true
 	}
 
 	f.Close()
+	dataOffset := r.skipped
+
+	// Some broken encoders write a VBR header without filling in the frame
+	// count. The first frame's bitrate says nothing about the rest of a VBR
+	// stream, so count the frames instead of estimating. In a CBR stream it
+	// holds for every frame, so the estimate from the size is good enough.
+	if vbrHeader && !plausibleFrameCount(numFrames, fsize, f.frameHeader) {
+		if cbrHeader || quick {
+			numFrames = 0
+		} else {
+			numFrames, err = r.countFrames(f.frameHeader)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	var duration time.Duration
+	var (
+		duration   time.Duration
+		numSamples int64
+		bitrate    = f.bitrate
+	)
 
 	if numFrames == 0 {
-		//log.Print(fsize, f.bitrate)
-		secs := math.Floor(float64(fsize)/float64(f.bitrate/8) + 0.5)
-		duration = time.Second * time.Duration(secs)
+		// estimate from the size and bitrate if both are known, going by
+		// the size in the Info header if there is one
+		size := fsize
+		if cbrHeader && audioBytes > 0 {
+			size = audioBytes
+		}
+		if size > 0 && f.bitrate > 0 {
+			secs := math.Floor(float64(size)/float64(f.bitrate/8) + 0.5)
+			duration = time.Second * time.Duration(secs)
+		}
 	} else {
-		var (
-			spf        = samplesPerFrame[f.mpegVersion][f.layer]
-			numSamples = numFrames * spf
-			secs       = math.Floor(float64(numSamples)/float64(f.samplerate) + 0.5)
-		)
+		spf := samplesPerFrame[f.mpegVersion][f.layer]
+		numSamples = int64(numFrames) * int64(spf)
+		secs := math.Floor(float64(numSamples)/float64(f.samplerate) + 0.5)
 		duration = time.Duration(secs) * time.Second
+
+		// the first frame's bitrate says nothing about the rest of a VBR
+		// stream, so average over the whole stream if its size is known
+		if audioBytes > 0 {
+			exact := float64(numSamples) / float64(f.samplerate)
+			bitrate = int(float64(audioBytes*8)/exact + 0.5)
+		}
 	}
 
 	/*
 		tags, err := id3v1.Decode(rr)
-		if err != nil {
+		if err != nil && err != sound.ErrNoTags {
 			//print(9)
 			return nil, err
 		}
@@ -80,9 +138,16 @@ func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
 	*/
 
 	m := &meta{
-		duration:   duration,
-		bitrate:    f.bitrate,
-		samplerate: f.samplerate,
+		duration:     duration,
+		exact:        numFrames != 0,
+		numSamples:   numSamples,
+		bitrate:      bitrate,
+		frameBitrate: f.bitrate,
+		samplerate:   f.samplerate,
+
+		mpegVersion: f.mpegVersion,
+		layer:       f.layer,
+		dataOffset:  dataOffset,
 		//Tags:       tags,
 	}
 
@@ -95,6 +160,21 @@ func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
 	return m, nil
 }
 
+// plausibleFrameCount reports whether n could be the number of frames in a
+// stream of fsize bytes made of frames like h: it must not be 0, and the
+// average bitrate that it implies must be one that MPEG audio can have.
+func plausibleFrameCount(n int, fsize int64, h frameHeader) bool {
+	if n == 0 {
+		return false
+	}
+	if fsize <= 0 {
+		return true
+	}
+	secs := float64(n) * float64(samplesPerFrame[h.mpegVersion][h.layer]) / float64(h.samplerate)
+	bps := float64(fsize*8) / secs
+	return bps >= 8000 && bps <= 640000
+}
+
 /*
 type countReader struct {
 	*bufio.Reader
@@ -109,8 +189,20 @@ func (r *countReader) Read(p []byte) (n int, err error) {
 */
 
 // DecodeMetaID3v2 decodes the metadata of an MP3 stream assuming it begins
-// with an ID3v2 tag.
+// with an ID3v2 tag. If there's no VBR header and the file size is unknown,
+// so that the duration can't be worked out from the audio, the length in the
+// tag's TLEN frame is used instead.
 func DecodeMetaID3v2(r io.Reader, fsize int64) (sound.Metadata, error) {
+	return decodeMetaID3v2(r, fsize, false)
+}
+
+// DecodeMetaID3v2Quick is like DecodeMetaID3v2, but never counts the frames,
+// as with DecodeMetaQuick.
+func DecodeMetaID3v2Quick(r io.Reader, fsize int64) (sound.Metadata, error) {
+	return decodeMetaID3v2(r, fsize, true)
+}
+
+func decodeMetaID3v2(r io.Reader, fsize int64, quick bool) (sound.Metadata, error) {
 	// discount the bytes read from the id3v2 tag before calculating CBR duration
 	rr := ensureBufioReader(r)
 
@@ -124,7 +216,7 @@ func DecodeMetaID3v2(r io.Reader, fsize int64) (sound.Metadata, error) {
 	//x, _ := br.Peek(16)
 	//log.Printf("%x", x)
 	v2tags := tags.(*id3v2.Tags)
-	m, err := DecodeMeta(rr, fsize-int64(v2tags.Size))
+	m, err := decodeMeta(rr, fsize-int64(v2tags.Size), quick)
 	if err != nil {
 		//print(4)
 		return nil, err
@@ -132,10 +224,124 @@ func DecodeMetaID3v2(r io.Reader, fsize int64) (sound.Metadata, error) {
 	// Prefer id3v2 over id3v1
 	mm := m.(*meta)
 	mm.Tags = tags
+	mm.dataOffset += v2tags.TotalSize()
+	mm.useTagLength(v2tags)
 	//print(5)
 	return mm, nil
 }
 
+// DurationID3v2 finds the duration of an MP3 stream that begins with an ID3v2
+// tag, as DecodeMetaID3v2 does, but skips over the tag without decoding it.
+// So unlike DecodeMetaID3v2, it never falls back to the tag's TLEN frame.
+func DurationID3v2(r io.Reader, fsize int64) (time.Duration, error) {
+	rr := ensureBufioReader(r)
+	n, err := id3v2.Skip(rr)
+	if err != nil {
+		return 0, err
+	}
+	m, err := DecodeMeta(rr, fsize-n)
+	if err != nil {
+		return 0, err
+	}
+	return m.Duration(), nil
+}
+
+// DecodeMetaAt decodes the metadata of an MP3 stream whose first frame is
+// known to be at audioOffset, as found by DataOffset from an earlier decode,
+// without reading any tag before it. If r is an io.Seeker, it seeks to the
+// offset; otherwise the bytes before it are discarded. It returns ErrUnsynced
+// if there isn't a frame sync at the offset.
+func DecodeMetaAt(r io.Reader, fsize, audioOffset int64) (sound.Metadata, error) {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(audioOffset, os.SEEK_SET)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		_, err := io.CopyN(ioutil.Discard, r, audioOffset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rr := ensureBufioReader(r)
+	x, err := rr.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if x[0] != 0xFF || x[1]&0xE0 != 0xE0 {
+		return nil, ErrUnsynced
+	}
+
+	m, err := DecodeMeta(rr, fsize-audioOffset)
+	if err != nil {
+		return nil, err
+	}
+	m.(*meta).dataOffset = audioOffset
+	return m, nil
+}
+
+// useTagLength takes the duration from the TLEN frame if it couldn't be
+// worked out from the audio.
+func (m *meta) useTagLength(t *id3v2.Tags) {
+	if m.duration == 0 {
+		m.duration = t.Length()
+	}
+}
+
+// Decoder decodes the tags and metadata of an MP3 stream in a single pass,
+// where calling DecodeTags and DecodeMeta would each decode the ID3v2 tag.
+type Decoder struct {
+	tags  *Tags
+	found bool
+	meta  *meta
+}
+
+// NewDecoder reads the ID3v2 tag if there is one, the first frame, and the
+// APEv2 and ID3v1 tags at the end of the stream. fsize is the size of the
+// whole stream, as for DecodeMeta.
+func NewDecoder(r io.Reader, fsize int64) (*Decoder, error) {
+	rr := ensureBufioReader(r)
+	t, err := decodeID3v2(rr)
+	if err != nil {
+		return nil, err
+	}
+	if t.Header != nil {
+		fsize -= int64(t.Size)
+	}
+
+	m, err := DecodeMeta(rr, fsize)
+	if err != nil {
+		return nil, err
+	}
+	mm := m.(*meta)
+	mm.dataOffset += t.TotalSize()
+	mm.useTagLength(t.Tags)
+
+	found, err := t.decodeTail(r, rr)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		mm.Tags = t
+	}
+	return &Decoder{t, found, mm}, nil
+}
+
+// Tags returns the merged tags, the same as DecodeTags. The underlying type
+// of the sound.Tags returned will be (*Tags).
+func (d *Decoder) Tags() (sound.Tags, error) {
+	if !d.found {
+		return nil, sound.ErrNoTags
+	}
+	return d.tags, nil
+}
+
+// Meta returns the metadata, the same as DecodeMeta or DecodeMetaID3v2.
+func (d *Decoder) Meta() sound.Metadata {
+	return d.meta
+}
+
 func ensureBufioReader(r io.Reader) *bufio.Reader {
 	if br, ok := r.(*bufio.Reader); ok {
 		return br
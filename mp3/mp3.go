@@ -1,13 +1,14 @@
 package mp3
 
 import (
+	"bufio"
 	"errors"
 	"io"
 	"io/ioutil"
+	"strings"
 	"time"
 
 	"ktkr.us/pkg/sound"
-	"ktkr.us/pkg/sound/id3/id3v1"
 	"ktkr.us/pkg/sound/id3/id3v2"
 )
 
@@ -18,22 +19,61 @@ var (
 	ErrBadSampleRate = errors.New("mp3: disallowed sample rate code")
 )
 
+// MaxSyncScan is the most bytes that will be skipped looking for a frame sync
+// before giving up with ErrUnsynced, so that a file that isn't MP3 at all
+// fails fast instead of being read to the end a byte at a time. Set it to 0
+// for no limit.
+var MaxSyncScan int64 = 8 << 10
+
 func init() {
-	sound.RegisterFormat("MP3 ID3v2.2", "ID3\x02", Decode, id3v2.Decode, DecodeMetaID3v2)
-	sound.RegisterFormat("MP3 ID3v2.3", "ID3\x03", Decode, id3v2.Decode, DecodeMetaID3v2)
-	sound.RegisterFormat("MP3 ID3v2.4", "ID3\x04", Decode, id3v2.Decode, DecodeMetaID3v2)
-	sound.RegisterFormat("MPEG-2 Layer III", "\xFF\xF2", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-2 Layer III", "\xFF\xF3", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-2 Layer II", "\xFF\xF4", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-2 Layer II", "\xFF\xF5", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-2 Layer I", "\xFF\xF6", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-2 Layer I", "\xFF\xF7", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-1 Layer III", "\xFF\xFA", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-1 Layer III", "\xFF\xFB", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-1 Layer II", "\xFF\xFC", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-1 Layer II", "\xFF\xFD", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-1 Layer I", "\xFF\xFE", Decode, id3v1.Decode, DecodeMeta)
-	sound.RegisterFormat("MPEG-1 Layer I", "\xFF\xFF", Decode, id3v1.Decode, DecodeMeta)
+	sound.RegisterFormat("MP3 ID3v2.2", "ID3\x02", Decode, DecodeTags, DecodeMetaID3v2)
+	sound.RegisterFormat("MP3 ID3v2.3", "ID3\x03", Decode, DecodeTags, DecodeMetaID3v2)
+	sound.RegisterFormat("MP3 ID3v2.4", "ID3\x04", Decode, DecodeTags, DecodeMetaID3v2)
+	sound.RegisterFormat("MPEG-2 Layer III", "\xFF\xF2", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-2 Layer III", "\xFF\xF3", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-2 Layer II", "\xFF\xF4", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-2 Layer II", "\xFF\xF5", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-2 Layer I", "\xFF\xF6", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-2 Layer I", "\xFF\xF7", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-1 Layer III", "\xFF\xFA", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-1 Layer III", "\xFF\xFB", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-1 Layer II", "\xFF\xFC", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-1 Layer II", "\xFF\xFD", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-1 Layer I", "\xFF\xFE", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterFormat("MPEG-1 Layer I", "\xFF\xFF", Decode, DecodeTags, DecodeMeta)
+
+	for _, name := range []string{"MP3 ID3v2.2", "MP3 ID3v2.3", "MP3 ID3v2.4"} {
+		sound.RegisterDuration(name, DurationID3v2)
+		sound.RegisterQuickMeta(name, DecodeMetaID3v2Quick)
+	}
+	for _, name := range []string{
+		"MP3 ID3v2.2", "MP3 ID3v2.3", "MP3 ID3v2.4",
+		"MPEG-2 Layer III", "MPEG-2 Layer II", "MPEG-2 Layer I",
+		"MPEG-1 Layer III", "MPEG-1 Layer II", "MPEG-1 Layer I",
+	} {
+		if !strings.HasPrefix(name, "MP3 ID3v2") {
+			sound.RegisterQuickMeta(name, DecodeMetaQuick)
+		}
+		sound.RegisterAudioStream(name, skipTags)
+		// every MP3 gets the ID3v2 tag's features, even if it's empty
+		sound.RegisterCapabilities(name, sound.Capabilities{
+			SupportsPictures:   true,
+			SupportsReplayGain: true,
+			SupportsCuesheet:   true,
+			SupportsMultiValue: true,
+			SupportsWriting:    strings.HasPrefix(name, "MP3 ID3v2"),
+		})
+	}
+}
+
+// skipTags discards the ID3v2 tags at the start of r, and any junk between
+// them and the first frame, for sound.AudioStream.
+func skipTags(r *bufio.Reader) error {
+	_, err := id3v2.Skip(r)
+	if err != nil {
+		return err
+	}
+	return newReader(r).sync()
 }
 
 // AAAAAAAA AAABBCCD EEEEFFGH IIJJKLMM
@@ -106,17 +146,78 @@ var (
 
 type meta struct {
 	duration   time.Duration
+	exact      bool
+	numSamples int64
 	channels   int
 	bitrate    int
 	samplerate int
+	// frameBitrate is the bitrate of the first frame
+	frameBitrate int
+
+	// raw version and layer IDs from the first frame header
+	mpegVersion int
+	layer       int
+
+	dataOffset int64
+
 	sound.Tags
 }
 
 func (m *meta) Duration() time.Duration { return m.duration }
 func (m *meta) NumChannels() int        { return m.channels }
-func (m *meta) BitRate() int            { return m.bitrate }
 func (m *meta) SampleRate() int         { return m.samplerate }
 
+// BitRate returns the average bitrate of the stream when a VBR header gives
+// its size in bytes along with the number of frames. Otherwise it is the
+// bitrate of the first frame, as returned by FrameBitRate.
+func (m *meta) BitRate() int { return m.bitrate }
+
+// FrameBitRate returns the bitrate of the first frame. In a VBR stream it
+// may be far from the average, as when the first frame is silence.
+func (m *meta) FrameBitRate() int { return m.frameBitrate }
+
+func (m *meta) String() string { return sound.Summary(m.Tags, m) }
+
+// DataOffset returns the position of the first frame in the stream, after any
+// ID3v2 tag and junk before it. It can be passed to DecodeMetaAt.
+func (m *meta) DataOffset() int64 { return m.dataOffset }
+
+// DurationExact reports whether the duration was calculated from the frame
+// count in a VBR header, rather than estimated from the file size and bitrate
+// of the first frame.
+func (m *meta) DurationExact() bool { return m.exact }
+
+// MPEGVersion returns the MPEG audio version of the stream: "1", "2" or
+// "2.5".
+func (m *meta) MPEGVersion() string {
+	switch m.mpegVersion {
+	case version1:
+		return "1"
+	case version2:
+		return "2"
+	case version2_5:
+		return "2.5"
+	}
+	return ""
+}
+
+// Layer returns the MPEG audio layer of the stream: 1, 2 or 3.
+func (m *meta) Layer() int {
+	switch m.layer {
+	case layerI:
+		return 1
+	case layerII:
+		return 2
+	case layerIII:
+		return 3
+	}
+	return 0
+}
+
+// TotalSamples returns the number of samples counted by the VBR header. CBR
+// streams without one only have an estimated duration, so it returns 0.
+func (m *meta) TotalSamples() int64 { return m.numSamples }
+
 type frameHeader struct {
 	mpegVersion int
 	layer       int
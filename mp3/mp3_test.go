@@ -1,41 +1,168 @@
 package mp3
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/binary"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/fixture"
 )
 
 func TestDuration(t *testing.T) {
-	badTracks := []string{
-		"kubivunuv",
-		"nolutimed",
-		"vamobovup",
-		"vusavetuy",
-		"wagonobil",
+	tests := []struct {
+		file     string
+		decode   func(io.Reader, int64) (sound.Metadata, error)
+		duration time.Duration
+	}{
+		{"id3v23.mp3", DecodeMetaID3v2, time.Second},
+		{"id3v24.mp3", DecodeMetaID3v2, time.Second},
+		// no ID3v2 tag, just the frames and an ID3v1 tag
+		{"id3v1.mp3", DecodeMeta, time.Second},
 	}
 
-	for _, file := range badTracks {
-		g, err := filepath.Glob("/home/moshee/.pls/" + file + "*")
+	for _, test := range tests {
+		f, err := os.Open(filepath.Join("..", "testdata", test.file))
 		if err != nil {
 			t.Fatal(err)
 		}
-		f, err := os.Open(g[0])
+		fi, err := f.Stat()
 		if err != nil {
 			t.Fatal(err)
 		}
-		fi, err := f.Stat()
+		m, err := test.decode(f, fi.Size())
+		f.Close()
 		if err != nil {
-			t.Fatal(err)
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		// with no Xing or VBRI header, the duration is estimated
+		exact := m.(sound.ExactDurationMetadata).DurationExact()
+		if m.Duration() != test.duration || exact {
+			t.Errorf("%s: got %v, exact %t", test.file, m.Duration(), exact)
 		}
-		m, err := DecodeMetaID3v2(f, fi.Size())
+	}
+}
+
+func TestMPEGVersions(t *testing.T) {
+	tests := []struct {
+		frames, bitrate, sampleRate int
+	}{
+		{383, 128000, 44100}, // MPEG-1
+		{383, 64000, 22050},  // MPEG-2
+		{139, 32000, 8000},   // MPEG-2.5
+	}
+
+	for _, test := range tests {
+		b := fixture.MakeMP3(test.frames, test.bitrate, test.sampleRate)
+		m, err := DecodeMeta(bytes.NewReader(b), int64(len(b)))
 		if err != nil {
-			t.Fatal(err)
+			t.Errorf("%d Hz: %v", test.sampleRate, err)
+			continue
+		}
+		// each is just over 10 seconds long
+		if m.SampleRate() != test.sampleRate || m.BitRate() != test.bitrate || m.Duration() != 10*time.Second {
+			t.Errorf("%d Hz: got %d Hz, %d bps, %v", test.sampleRate, m.SampleRate(), m.BitRate(), m.Duration())
 		}
+	}
+}
+
+func TestZeroFrameXing(t *testing.T) {
+	// a 320 kbps Xing frame that counts no frames, followed by 10 seconds at
+	// 64 kbps that an estimate from the first frame would make 2 seconds
+	xing := fixture.MakeMP3(1, 320000, 44100)
+	copy(xing[36:], "Xing\x00\x00\x00\x01\x00\x00\x00\x00")
+	b := append(xing, fixture.MakeMP3(383, 64000, 44100)...)
 
-		fmt.Printf("%v\t%s\n", m.Duration(), m.Title())
+	m, err := DecodeMeta(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact := m.(sound.ExactDurationMetadata).DurationExact()
+	if m.Duration() != 10*time.Second || !exact {
+		t.Errorf("got %v, exact %t", m.Duration(), exact)
+	}
+
+	// whereas the quick decode estimates from the first frame
+	m, _, err = sound.DecodeMetaQuick(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact = m.(sound.ExactDurationMetadata).DurationExact()
+	if m.Duration() != 2*time.Second || exact {
+		t.Errorf("quick: got %v, exact %t", m.Duration(), exact)
+	}
+}
 
+func TestDurationOnly(t *testing.T) {
+	for _, name := range []string{"id3v22.mp3", "id3v23.mp3", "id3v24.mp3", "id3v1.mp3"} {
+		f, err := os.Open(filepath.Join("..", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := sound.Duration(f)
 		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if d != time.Second {
+			t.Errorf("%s: got %v", name, d)
+		}
+	}
+}
+
+func TestMaxSyncScan(t *testing.T) {
+	frames := fixture.MakeMP3(10, 128000, 44100)
+	near := append(make([]byte, 1000), frames...)
+	far := append(make([]byte, MaxSyncScan+1), frames...)
+
+	if _, err := DecodeMeta(bytes.NewReader(near), int64(len(near))); err != nil {
+		t.Errorf("1000 bytes of junk: %v", err)
+	}
+	if _, err := DecodeMeta(bytes.NewReader(far), int64(len(far))); err != ErrUnsynced {
+		t.Errorf("%d bytes of junk: got %v, want ErrUnsynced", len(far)-len(frames), err)
+	}
+}
+
+func TestAverageBitRate(t *testing.T) {
+	// a 320 kbps Xing frame that counts itself and 383 frames at 64 kbps,
+	// along with their size
+	xing := fixture.MakeMP3(1, 320000, 44100)
+	size := len(xing) + 383*len(fixture.MakeMP3(1, 64000, 44100))
+	copy(xing[36:], "Xing\x00\x00\x00\x03\x00\x00\x01\x80")
+	binary.BigEndian.PutUint32(xing[48:], uint32(size))
+	b := append(xing, fixture.MakeMP3(383, 64000, 44100)...)
+
+	m, err := DecodeMeta(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := int(float64(size*8)/(384*1152/44100.0) + 0.5)
+	if br := m.BitRate(); br != want {
+		t.Errorf("BitRate: got %d, want %d", br, want)
+	}
+	if br := m.(interface{ FrameBitRate() int }).FrameBitRate(); br != 320000 {
+		t.Errorf("FrameBitRate: got %d", br)
+	}
+}
+
+func TestInfoWithoutFrames(t *testing.T) {
+	// a CBR stream of 10 seconds at 128 kbps, starting with an Info frame
+	// whose flags say it has no frame count
+	b := fixture.MakeMP3(384, 128000, 44100)
+	copy(b[36:], "Info\x00\x00\x00\x00")
+
+	m, err := DecodeMeta(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact := m.(sound.ExactDurationMetadata).DurationExact()
+	if m.Duration() != 10*time.Second || exact || m.BitRate() != 128000 {
+		t.Errorf("got %v, exact %t, %d bps", m.Duration(), exact, m.BitRate())
 	}
 }
@@ -9,28 +9,39 @@ import (
 type reader struct {
 	r   *bufio.Reader
 	buf []byte
+	// skipped is the number of bytes skipped looking for frame syncs
+	skipped int64
 }
 
 func newReader(r io.Reader) *reader {
 	return &reader{r: ensureBufioReader(r)}
 }
 
-func (r *reader) nextFrame() (*frame, error) {
-	var err error
-	// log.Printf("decoding mp3 at %x", z)
-	// log.Printf("%d buffered", r.r.Buffered())
-	//discard := make([]byte, 32)
-	for i := 0; ; i++ {
+// sync skips ahead to the next frame sync, giving up after MaxSyncScan bytes.
+func (r *reader) sync() error {
+	for i := int64(0); ; i++ {
+		if MaxSyncScan > 0 && i >= MaxSyncScan {
+			return ErrUnsynced
+		}
 		x, err := r.r.Peek(2)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if x[0] == 0xFF && x[1]&0xE0 == 0xE0 {
 			// log.Print("skipped ", i, " bytes")
-			break
+			return nil
 		}
 		r.r.ReadByte()
-		//r.r.Read(discard[:1])
+		r.skipped++
+	}
+}
+
+func (r *reader) nextFrame() (*frame, error) {
+	// log.Printf("decoding mp3 at %x", z)
+	// log.Printf("%d buffered", r.r.Buffered())
+	err := r.sync()
+	if err != nil {
+		return nil, err
 	}
 	var header uint32
 
@@ -138,6 +149,33 @@ func (r *reader) nextFrame() (*frame, error) {
 	//log.Printf("%#v", h)
 	//log.Print(r.r.Peek(4))
 	return &frame{h, &frameData{
-		io.LimitedReader{r.r, int64(h.frameSize)},
+		io.LimitedReader{R: r.r, N: int64(h.frameSize)},
 	}}, nil
 }
+
+// countFrames counts the frames left in the stream with the same version,
+// layer and sample rate as h. It stops at the end of the stream or at
+// anything that isn't a frame straight after the last one, such as an ID3v1
+// tag.
+func (r *reader) countFrames(h frameHeader) (int, error) {
+	n := 0
+	for {
+		skipped := r.skipped
+		f, err := r.nextFrame()
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF, ErrUnsynced, ErrReserved, ErrBadBitrate, ErrBadSampleRate:
+			return n, nil
+		default:
+			return 0, err
+		}
+		if r.skipped != skipped || f.bitrate == 0 || f.mpegVersion != h.mpegVersion || f.layer != h.layer || f.samplerate != h.samplerate {
+			return n, nil
+		}
+		err = f.Close()
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,193 @@
+package mp3
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/id3/ape"
+	"ktkr.us/pkg/sound/id3/id3v1"
+	"ktkr.us/pkg/sound/id3/id3v2"
+)
+
+// maxTail is how much of the end of a stream that can't seek is kept while
+// looking for APEv2 and ID3v1 tags. APEv2 tags bigger than this, which is
+// only likely if they hold cover art, are missed.
+const maxTail = 256 << 10
+
+// Tags is the combination of all of the tags in an MP3 file. Each field of
+// sound.Tags is taken from the ID3v2 tag, or if it isn't set there, the APEv2
+// tag, and then the ID3v1 tag. Everything else, such as the frames and
+// pictures, comes from the embedded ID3v2 tag, which is empty if the file
+// doesn't have one.
+type Tags struct {
+	*id3v2.Tags
+	// APE and ID3v1 are nil if the file doesn't have those tags.
+	APE   *ape.Tag
+	ID3v1 *id3v1.Tag
+}
+
+// DecodeTags decodes the ID3v2 tag at the start of an MP3 stream and the
+// APEv2 and ID3v1 tags at the end, and merges them. If there are none, it
+// returns sound.ErrNoTags. The underlying type of the sound.Tags returned
+// will be (*Tags).
+func DecodeTags(r io.Reader) (sound.Tags, error) {
+	rr := ensureBufioReader(r)
+	t, err := decodeID3v2(rr)
+	if err != nil {
+		return nil, err
+	}
+	found, err := t.decodeTail(r, rr)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, sound.ErrNoTags
+	}
+	return t, nil
+}
+
+// decodeID3v2 decodes the ID3v2 tag at the start of rr if there is one. If
+// there isn't, the tag in the Tags returned is empty and its Header is nil.
+func decodeID3v2(rr *bufio.Reader) (*Tags, error) {
+	t := &Tags{Tags: &id3v2.Tags{Frames: map[string]string{}}}
+
+	magic, err := rr.Peek(3)
+	if err == nil && string(magic) == "ID3" {
+		v2, err := id3v2.Decode(rr)
+		if err != nil {
+			return nil, err
+		}
+		t.Tags = v2.(*id3v2.Tags)
+	}
+	return t, nil
+}
+
+// decodeTail decodes the APEv2 and ID3v1 tags at the end of the stream, and
+// reports whether any tags, including the ID3v2 tag, were found. rr is the
+// buffered reader wrapping r.
+func (t *Tags) decodeTail(r io.Reader, rr *bufio.Reader) (bool, error) {
+	found := t.Header != nil
+
+	// The other tags are found from the end. If r can seek, the buffered
+	// reader is left behind and r is used directly.
+	var tail io.ReadSeeker
+	if rs, ok := r.(io.ReadSeeker); ok {
+		tail = rs
+	} else {
+		b, err := id3v1.SeekEnd(rr, maxTail)
+		if err != nil {
+			return false, err
+		}
+		tail = b
+	}
+
+	apeTag, err := ape.Decode(tail)
+	if err == nil {
+		t.APE = apeTag.(*ape.Tag)
+		found = true
+	} else if err != sound.ErrNoTags {
+		return false, err
+	}
+
+	_, err = tail.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return false, err
+	}
+	v1, err := id3v1.Decode(tail)
+	if err == nil {
+		t.ID3v1 = v1.(*id3v1.Tag)
+		found = true
+	} else if err != sound.ErrNoTags {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// tags returns the tags in order of precedence, leaving out the ones that
+// aren't there.
+func (t *Tags) tags() []sound.Tags {
+	tags := []sound.Tags{t.Tags}
+	if t.APE != nil {
+		tags = append(tags, t.APE)
+	}
+	if t.ID3v1 != nil {
+		tags = append(tags, t.ID3v1)
+	}
+	return tags
+}
+
+func (t *Tags) first(field func(sound.Tags) string) string {
+	for _, tt := range t.tags() {
+		if s := field(tt); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func (t *Tags) firstNumber(field func(sound.Tags) int) int {
+	for _, tt := range t.tags() {
+		if n := field(tt); n != 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func (t *Tags) Title() string       { return t.first(sound.Tags.Title) }
+func (t *Tags) AlbumArtist() string { return t.first(sound.Tags.AlbumArtist) }
+func (t *Tags) Artist() string      { return t.first(sound.Tags.Artist) }
+func (t *Tags) Album() string       { return t.first(sound.Tags.Album) }
+func (t *Tags) Genre() string       { return t.first(sound.Tags.Genre) }
+func (t *Tags) Composer() string    { return t.first(sound.Tags.Composer) }
+func (t *Tags) Notes() string       { return t.first(sound.Tags.Notes) }
+func (t *Tags) Disc() int           { return t.firstNumber(sound.Tags.Disc) }
+func (t *Tags) Track() int          { return t.firstNumber(sound.Tags.Track) }
+
+func (t *Tags) Artists() []string   { return t.all(t.Tags.Artists, t.Artist) }
+func (t *Tags) Genres() []string    { return t.all(t.Tags.Genres, t.Genre) }
+func (t *Tags) Composers() []string { return t.all(t.Tags.Composers, t.Composer) }
+
+// all returns all of the values of a field from the ID3v2 tag, or the one
+// value from the other tags if it isn't set there.
+func (t *Tags) all(values func() []string, field func() string) []string {
+	if vals := values(); vals != nil {
+		return vals
+	}
+	if s := field(); s != "" {
+		return []string{s}
+	}
+	return nil
+}
+
+func (t *Tags) String() string { return sound.Summary(t, nil) }
+
+// TagFormat lists the formats of the tags that were found, in order of
+// precedence, such as "ID3v2.3+ID3v1.1".
+func (t *Tags) TagFormat() string {
+	var formats []string
+	if t.Tags.Header != nil {
+		formats = append(formats, t.Tags.TagFormat())
+	}
+	if t.APE != nil {
+		formats = append(formats, t.APE.TagFormat())
+	}
+	if t.ID3v1 != nil {
+		formats = append(formats, t.ID3v1.TagFormat())
+	}
+	return strings.Join(formats, "+")
+}
+
+func (t *Tags) Date() time.Time {
+	for _, tt := range t.tags() {
+		if d := tt.Date(); !d.IsZero() {
+			return d
+		}
+	}
+	return time.Time{}
+}
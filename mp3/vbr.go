@@ -3,6 +3,8 @@ package mp3
 import (
 	"encoding/binary"
 	"io"
+
+	"github.com/pkg/errors"
 )
 
 type Xing struct {
@@ -24,7 +26,7 @@ func decodeXing(r io.Reader) (*Xing, error) {
 	var flags uint32
 	err := binary.Read(r, binary.BigEndian, &flags)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "read Xing header")
 	}
 	var xing Xing
 	if flags&xingFrames != 0 {
@@ -73,5 +75,5 @@ func decodeVBRI(r io.Reader) (*VBRI, error) {
 	err := binary.Read(r, binary.BigEndian, &vbri)
 	// there is still some TOC data left but whatever, I don't even know what
 	// that is and it won't help
-	return &vbri, err
+	return &vbri, errors.Wrap(err, "read VBRI header")
 }
@@ -12,6 +12,7 @@ const (
 	requiredOnePerFile = iota
 	requiredOnePerContainer
 	requiredVariable
+	requiredFamilialOne
 	dependsOnParent
 	optionalOnePerFile
 	optionalOnePerContainer
@@ -35,230 +36,228 @@ type atomDef struct {
 }
 
 var atomDefs = map[string]atomDef{
-	"ftyp": {{"FILE_LEVEL"}, childAtom, requiredOnePerFile, simpleAtom},
+	"ftyp": {[]string{"FILE_LEVEL"}, childAtom, requiredOnePerFile, simpleAtom},
 
-	"moov": {{"FILE_LEVEL"}, parentAtom, requiredOnePerFile, simpleAtom},
+	"moov": {[]string{"FILE_LEVEL"}, parentAtom, requiredOnePerFile, simpleAtom},
 
-	"mdat": {{"FILE_LEVEL"}, childAtom, optionalMany, simpleAtom},
+	"mdat": {[]string{"FILE_LEVEL"}, childAtom, optionalMany, simpleAtom},
 
-	"pdin": {{"FILE_LEVEL"}, childAtom, optionalOnePerFile, versionedAtom},
+	"pdin": {[]string{"FILE_LEVEL"}, childAtom, optionalOnePerFile, versionedAtom},
 
-	"moof": {{"FILE_LEVEL"}, parentAtom, optionalMany, simpleAtom},
-	"mfhd": {{"moof"}, childAtom, requiredOnePerContainer, versionedAtom},
-	"traf": {{"moof"}, parentAtom, optionalOnePerContainer, simpleAtom},
-	"tfhd": {{"traf"}, childAtom, requiredOnePerContainer, versionedAtom},
-	"trun": {{"traf"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"moof": {[]string{"FILE_LEVEL"}, parentAtom, optionalMany, simpleAtom},
+	"mfhd": {[]string{"moof"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"traf": {[]string{"moof"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	"tfhd": {[]string{"traf"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"trun": {[]string{"traf"}, childAtom, requiredOnePerContainer, versionedAtom},
 
-	"mfra": {{"FILE_LEVEL"}, parentAtom, optionalOnePerFile, simpleAtom},
-	"tfra": {{"mfra"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"mfro": {{"mfra"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"mfra": {[]string{"FILE_LEVEL"}, parentAtom, optionalOnePerFile, simpleAtom},
+	"tfra": {[]string{"mfra"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"mfro": {[]string{"mfra"}, childAtom, requiredOnePerContainer, versionedAtom},
 
-	"free": {{"_ANY_LEVEL"}, childAtom, optionalMany, simpleAtom},
-	"skip": {{"_ANY_LEVEL"}, childAtom, optionalMany, simpleAtom},
+	"free": {[]string{"_ANY_LEVEL"}, childAtom, optionalMany, simpleAtom},
+	"skip": {[]string{"_ANY_LEVEL"}, childAtom, optionalMany, simpleAtom},
 
-	"uuid": {{"_ANY_LEVEL"}, childAtom, requiredOnePerFile, EXTENDED_ATOM},
+	"uuid": {[]string{"_ANY_LEVEL"}, childAtom, requiredOnePerFile, extendedAtom},
 
-	"mvhd": {{"moov"}, childAtom, requiredOnePerFile, versionedAtom},
-	"iods": {{"moov"}, childAtom, optionalOnePerFile, versionedAtom},
+	"mvhd": {[]string{"moov"}, childAtom, requiredOnePerFile, versionedAtom},
+	"iods": {[]string{"moov"}, childAtom, optionalOnePerFile, versionedAtom},
 	// 3gp/MobileMP4
-	"drm ": {{"moov"}, childAtom, optionalOnePerFile, versionedAtom},
-	"trak": {{"moov"}, parentAtom, optionalMany, simpleAtom},
+	"drm ": {[]string{"moov"}, childAtom, optionalOnePerFile, versionedAtom},
+	"trak": {[]string{"moov"}, parentAtom, optionalMany, simpleAtom},
 
-	"tkhd": {{"trak"}, childAtom, optionalMany, versionedAtom},
-	"tref": {{"trak"}, parentAtom, optionalMany, simpleAtom},
-	"mdia": {{"trak"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	"tkhd": {[]string{"trak"}, childAtom, optionalMany, versionedAtom},
+	"tref": {[]string{"trak"}, parentAtom, optionalMany, simpleAtom},
+	"mdia": {[]string{"trak"}, parentAtom, optionalOnePerContainer, simpleAtom},
 
-	"tapt": {{"trak"}, parentAtom, optionalOnePerContainer, simpleAtom},
-	"clef": {{"tapt"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"prof": {{"tapt"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"enof": {{"tapt"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"tapt": {[]string{"trak"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	"clef": {[]string{"tapt"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"prof": {[]string{"tapt"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"enof": {[]string{"tapt"}, childAtom, optionalOnePerContainer, versionedAtom},
 
-	"mdhd": {{"mdia"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"minf": {{"mdia"}, parentAtom, requiredOnePerContainer, simpleAtom},
+	"mdhd": {[]string{"mdia"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"minf": {[]string{"mdia"}, parentAtom, requiredOnePerContainer, simpleAtom},
 
 	//minf parent present in chapterized
-	"hdlr": {{"mdia", "meta", "minf"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"hdlr": {[]string{"mdia", "meta", "minf"}, childAtom, requiredOnePerContainer, versionedAtom},
 
-	"vmhd": {{"minf"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
-	"smhd": {{"minf"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
-	"hmhd": {{"minf"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
-	"nmhd": {{"minf"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
+	"vmhd": {[]string{"minf"}, childAtom, requiredFamilialOne, versionedAtom},
+	"smhd": {[]string{"minf"}, childAtom, requiredFamilialOne, versionedAtom},
+	"hmhd": {[]string{"minf"}, childAtom, requiredFamilialOne, versionedAtom},
+	"nmhd": {[]string{"minf"}, childAtom, requiredFamilialOne, versionedAtom},
 	//present in chapterized
-	"gmhd": {{"minf"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
+	"gmhd": {[]string{"minf"}, childAtom, requiredFamilialOne, versionedAtom},
 
 	//required in minf
-	"dinf": {{"minf", "meta"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	"dinf": {[]string{"minf", "meta"}, parentAtom, optionalOnePerContainer, simpleAtom},
 
-	"url ": {{"dinf"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
-	"urn ": {{"dinf"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
-	"dref": {{"dinf"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
+	"url ": {[]string{"dinf"}, childAtom, requiredFamilialOne, versionedAtom},
+	"urn ": {[]string{"dinf"}, childAtom, requiredFamilialOne, versionedAtom},
+	"dref": {[]string{"dinf"}, childAtom, requiredFamilialOne, versionedAtom},
 
-	"stbl": {{"minf"}, parentAtom, requiredOnePerContainer, simpleAtom},
-	"stts": {{"stbl"}, childAtom, requiredOnePerContainer, versionedAtom},
-	"ctts": {{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"stsd": {{"stbl"}, DUAL_STATE_ATOM, requiredOnePerContainer, versionedAtom},
+	"stbl": {[]string{"minf"}, parentAtom, requiredOnePerContainer, simpleAtom},
+	"stts": {[]string{"stbl"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"ctts": {[]string{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"stsd": {[]string{"stbl"}, dualAtom, requiredOnePerContainer, versionedAtom},
 
-	"stsz": {{"stbl"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
-	"stz2": {{"stbl"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
+	"stsz": {[]string{"stbl"}, childAtom, requiredFamilialOne, versionedAtom},
+	"stz2": {[]string{"stbl"}, childAtom, requiredFamilialOne, versionedAtom},
 
-	"stsc": {{"stbl"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"stsc": {[]string{"stbl"}, childAtom, requiredOnePerContainer, versionedAtom},
 
-	"stco": {{"stbl"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
-	"co64": {{"stbl"}, childAtom, REQ_FAMILIAL_ONE, versionedAtom},
+	"stco": {[]string{"stbl"}, childAtom, requiredFamilialOne, versionedAtom},
+	"co64": {[]string{"stbl"}, childAtom, requiredFamilialOne, versionedAtom},
 
-	"stss": {{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"stsh": {{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"stdp": {{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"padb": {{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"sdtp": {{"stbl", "traf"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"sbgp": {{"stbl", "traf"}, childAtom, optionalMany, versionedAtom},
-	"sbgp": {{"stbl"}, childAtom, optionalMany, versionedAtom},
-	"stps": {{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"stss": {[]string{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"stsh": {[]string{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"stdp": {[]string{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"padb": {[]string{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"sdtp": {[]string{"stbl", "traf"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"sbgp": {[]string{"stbl", "traf"}, childAtom, optionalMany, versionedAtom},
+	"stps": {[]string{"stbl"}, childAtom, optionalOnePerContainer, versionedAtom},
 
-	"edts": {{"trak"}, parentAtom, optionalOnePerContainer, simpleAtom},
-	"elst": {{"edts"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"edts": {[]string{"trak"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	"elst": {[]string{"edts"}, childAtom, optionalOnePerContainer, versionedAtom},
 
-	"udta": {{"moov", "trak"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	"udta": {[]string{"moov", "trak"}, parentAtom, optionalOnePerContainer, simpleAtom},
 
 	//optionally contains info
-	"meta": {{"FILE_LEVEL", "moov", "trak", "udta"}, DUAL_STATE_ATOM, optionalOnePerContainer, versionedAtom},
+	"meta": {[]string{"FILE_LEVEL", "moov", "trak", "udta"}, dualAtom, optionalOnePerContainer, versionedAtom},
 
-	"mvex": {{"moov"}, parentAtom, optionalOnePerFile, simpleAtom},
-	"mehd": {{"mvex"}, childAtom, optionalOnePerFile, versionedAtom},
-	"trex": {{"mvex"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"mvex": {[]string{"moov"}, parentAtom, optionalOnePerFile, simpleAtom},
+	"mehd": {[]string{"mvex"}, childAtom, optionalOnePerFile, versionedAtom},
+	"trex": {[]string{"mvex"}, childAtom, requiredOnePerContainer, versionedAtom},
 
 	//"stsl": {	{"????"},						childAtom,				optionalOnePerContainer,					versionedAtom },				//contained by a sample entry box
 
-	"subs": {{"stbl", "traf"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"subs": {[]string{"stbl", "traf"}, childAtom, optionalOnePerContainer, versionedAtom},
 
-	"xml ": {{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"bxml": {{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"iloc": {{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"pitm": {{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"ipro": {{"meta"}, parentAtom, optionalOnePerContainer, versionedAtom},
-	"infe": {{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"iinf": {{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"xml ": {[]string{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"bxml": {[]string{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"iloc": {[]string{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"pitm": {[]string{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"ipro": {[]string{"meta"}, parentAtom, optionalOnePerContainer, versionedAtom},
+	"infe": {[]string{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"iinf": {[]string{"meta"}, childAtom, optionalOnePerContainer, versionedAtom},
 
 	//parent atom is also "Protected Sample Entry"
-	"sinf": {{"ipro", "drms", "drmi"}, parentAtom, requiredOnePerContainer, simpleAtom},
-	"frma": {{"sinf"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"imif": {{"sinf"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"schm": {{"sinf", "srpp"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"schi": {{"sinf", "srpp"}, DUAL_STATE_ATOM, optionalOnePerContainer, simpleAtom},
-	"skcr": {{"sinf"}, childAtom, optionalOnePerContainer, versionedAtom},
-
-	"user": {{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"sinf": {[]string{"ipro", "drms", "drmi"}, parentAtom, requiredOnePerContainer, simpleAtom},
+	"frma": {[]string{"sinf"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"imif": {[]string{"sinf"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"schm": {[]string{"sinf", "srpp"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"schi": {[]string{"sinf", "srpp"}, dualAtom, optionalOnePerContainer, simpleAtom},
+	"skcr": {[]string{"sinf"}, childAtom, optionalOnePerContainer, versionedAtom},
+
+	"user": {[]string{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
 	//could be required in 'drms'/'drmi'
-	"key ": {{"schi"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"iviv": {{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"righ": {{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"name": {{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"priv": {{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"key ": {[]string{"schi"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"iviv": {[]string{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"righ": {[]string{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
+	//'name' also occurs in udta and, versioned, in '----'
+	"name": {[]string{"schi", "udta", "----"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"priv": {[]string{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
 
 	// 'iAEC', '264b', 'iOMA', 'ICSD'
-	"iKMS": {{"schi"}, childAtom, optionalOnePerContainer, versionedAtom},
-	"iSFM": {{"schi"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"iKMS": {[]string{"schi"}, childAtom, optionalOnePerContainer, versionedAtom},
+	"iSFM": {[]string{"schi"}, childAtom, optionalOnePerContainer, versionedAtom},
 	//boxes with 'k***' are also here; reserved
-	"iSLT": {{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"IKEY": {{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"hint": {{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"dpnd": {{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"ipir": {{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"mpod": {{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"sync": {{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"iSLT": {[]string{"schi"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"IKEY": {[]string{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"hint": {[]string{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"dpnd": {[]string{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"ipir": {[]string{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"mpod": {[]string{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"sync": {[]string{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
 	//?possible versioned?
-	"chap": {{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
-
-	"ipmc": {{"moov", "meta"}, childAtom, optionalOnePerContainer, versionedAtom},
-
-	"tims": {{"rtp "}, childAtom, requiredOnePerContainer, simpleAtom},
-	"tsro": {{"rtp "}, childAtom, optionalOnePerContainer, simpleAtom},
-	"snro": {{"rtp "}, childAtom, optionalOnePerContainer, simpleAtom},
-
-	"srpp": {{"srtp"}, childAtom, requiredOnePerContainer, versionedAtom},
-
-	"hnti": {{"udta"}, parentAtom, optionalOnePerContainer, simpleAtom},
-	//'rtp ' is defined twice in different containers
-	"rtp ": {{"hnti"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"sdp ": {{"hnti"}, childAtom, optionalOnePerContainer, simpleAtom},
-
-	"hinf": {{"udta"}, parentAtom, optionalOnePerContainer, simpleAtom},
-	"name": {{"udta"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"trpy": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"nump": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"tpyl": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"totl": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"npck": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"maxr": {{"hinf"}, childAtom, optionalMany, simpleAtom},
-	"dmed": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"dimm": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"drep": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"tmin": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"tmax": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"pmax": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"dmax": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"payt": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"tpay": {{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
-
-	"drms": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"drmi": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"alac": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"mp4a": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"mp4s": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"mp4v": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"avc1": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"avcp": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"text": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"jpeg": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"tx3g": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	//"rtp " occurs twice; disparate meanings
-	"rtp ": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"srtp": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, simpleAtom},
-	"enca": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"encv": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"enct": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"encs": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"samr": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"sawb": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"sawp": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"s263": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"sevc": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"sqcp": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"ssmv": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-	"tmcd": {{"stsd"}, DUAL_STATE_ATOM, REQ_FAMILIAL_ONE, versionedAtom},
-
-	"alac": {{"alac"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"avcC": {{"avc1", "drmi"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"damr": {{"samr", "sawb"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"d263": {{"s263"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"dawp": {{"sawp"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"devc": {{"sevc"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"dqcp": {{"sqcp"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"dsmv": {{"ssmv"}, childAtom, requiredOnePerContainer, simpleAtom},
-	"bitr": {{"d263"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"chap": {[]string{"tref"}, childAtom, optionalOnePerContainer, simpleAtom},
+
+	"ipmc": {[]string{"moov", "meta"}, childAtom, optionalOnePerContainer, versionedAtom},
+
+	"tims": {[]string{"rtp "}, childAtom, requiredOnePerContainer, simpleAtom},
+	"tsro": {[]string{"rtp "}, childAtom, optionalOnePerContainer, simpleAtom},
+	"snro": {[]string{"rtp "}, childAtom, optionalOnePerContainer, simpleAtom},
+
+	"srpp": {[]string{"srtp"}, childAtom, requiredOnePerContainer, versionedAtom},
+
+	"hnti": {[]string{"udta"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	//'rtp ' is defined twice in different containers; see stsd below
+	"sdp ": {[]string{"hnti"}, childAtom, optionalOnePerContainer, simpleAtom},
+
+	"hinf": {[]string{"udta"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	"trpy": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"nump": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"tpyl": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"totl": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"npck": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"maxr": {[]string{"hinf"}, childAtom, optionalMany, simpleAtom},
+	"dmed": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"dimm": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"drep": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"tmin": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"tmax": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"pmax": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"dmax": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"payt": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"tpay": {[]string{"hinf"}, childAtom, optionalOnePerContainer, simpleAtom},
+
+	"drms": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"drmi": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	//the alac sample entry contains an 'alac' config atom of its own
+	"alac": {[]string{"stsd", "alac"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"mp4a": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"mp4s": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"mp4v": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"avc1": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"avcp": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"text": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"jpeg": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"tx3g": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	//"rtp " occurs twice; disparate meanings (also a child of hnti)
+	"rtp ": {[]string{"stsd", "hnti"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"srtp": {[]string{"stsd"}, dualAtom, requiredFamilialOne, simpleAtom},
+	"enca": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"encv": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"enct": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"encs": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"samr": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"sawb": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"sawp": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"s263": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"sevc": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"sqcp": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"ssmv": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+	"tmcd": {[]string{"stsd"}, dualAtom, requiredFamilialOne, versionedAtom},
+
+	"avcC": {[]string{"avc1", "drmi"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"damr": {[]string{"samr", "sawb"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"d263": {[]string{"s263"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"dawp": {[]string{"sawp"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"devc": {[]string{"sevc"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"dqcp": {[]string{"sqcp"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"dsmv": {[]string{"ssmv"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"bitr": {[]string{"d263"}, childAtom, requiredOnePerContainer, simpleAtom},
 	//found in NeroAVC
-	"btrt": {{"avc1"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"btrt": {[]string{"avc1"}, childAtom, optionalOnePerContainer, simpleAtom},
 	//?possible versioned?
-	"m4ds": {{"avc1"}, childAtom, optionalOnePerContainer, simpleAtom},
-	"ftab": {{"tx3g"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"m4ds": {[]string{"avc1"}, childAtom, optionalOnePerContainer, simpleAtom},
+	"ftab": {[]string{"tx3g"}, childAtom, optionalOnePerContainer, simpleAtom},
 
 	//the only ISO defined metadata tag; also a 3gp asset
-	"cprt": {{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"cprt": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
 	//3gp assets
-	"titl": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"auth": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"perf": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"gnre": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"dscp": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"albm": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"yrrc": {{"udta"}, childAtom, optionalMany, versionedAtom},
-	"rtng": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"clsf": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"kywd": {{"udta"}, childAtom, optionalMany, packedLangAtom},
-	"loci": {{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"titl": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"auth": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"perf": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"gnre": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"dscp": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"albm": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"yrrc": {[]string{"udta"}, childAtom, optionalMany, versionedAtom},
+	"rtng": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"clsf": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"kywd": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
+	"loci": {[]string{"udta"}, childAtom, optionalMany, packedLangAtom},
 
 	//id3v2 tag
-	"ID32": {{"meta"}, childAtom, optionalMany, packedLangAtom},
+	"ID32": {[]string{"meta"}, childAtom, optionalMany, packedLangAtom},
 
 	//"chpl": {	{"udta"},						childAtom,				optionalOnePerFile,				versionedAtom },		//Nero - seems to be versioned
 
@@ -275,17 +274,16 @@ var atomDefs = map[string]atomDef{
 	//Pish! Seems that Nero is simply unable to register any atoms.
 
 	//iTunes metadata container
-	"ilst": {{"meta"}, parentAtom, optionalOnePerFile, simpleAtom},
+	"ilst": {[]string{"meta"}, parentAtom, optionalOnePerFile, simpleAtom},
 	//reverse dns metadata
-	"----": {{"ilst"}, parentAtom, optionalMany, simpleAtom},
-	"mean": {{"----"}, childAtom, requiredOnePerContainer, versionedAtom},
-	"name": {{"----"}, childAtom, requiredOnePerContainer, versionedAtom},
+	"----": {[]string{"ilst"}, parentAtom, optionalMany, simpleAtom},
+	"mean": {[]string{"----"}, childAtom, requiredOnePerContainer, versionedAtom},
 
 	//multiple parents; keep 3rd from end; manual return
-	"esds": {{"SAMPLE_DESC"}, childAtom, requiredOnePerContainer, simpleAtom},
+	"esds": {[]string{"SAMPLE_DESC"}, childAtom, requiredOnePerContainer, simpleAtom},
 
 	//multiple parents; keep 2nd from end; manual return
-	"(..)": {{"ilst"}, parentAtom, optionalOnePerContainer, simpleAtom},
+	"(..)": {[]string{"ilst"}, parentAtom, optionalOnePerContainer, simpleAtom},
 	//multiple parents
-	"data": {{"ITUNES_METADATA"}, childAtom, parentSpecific, versionedAtom},
+	"data": {[]string{"ITUNES_METADATA"}, childAtom, dependsOnParent, versionedAtom},
 }
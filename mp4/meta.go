@@ -0,0 +1,199 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"ktkr.us/pkg/sound"
+)
+
+func init() {
+	sound.RegisterFormat("MPEG-4", "????ftyp", nil, ReadTags, DecodeMeta)
+	// the chapters are on the Tags, which are a *Reader
+	sound.RegisterCapabilities("MPEG-4", sound.Capabilities{
+		SupportsPictures: true,
+		SupportsChapters: true,
+	})
+}
+
+// audioSampleEntry is the fixed part of a sound sample description, which
+// follows the atom header of each entry in the stsd atom.
+type audioSampleEntry struct {
+	Reserved           [6]byte
+	DataReferenceIndex uint16
+	Version            uint16
+	Revision           uint16
+	Vendor             uint32
+	NumChannels        uint16
+	SampleSize         uint16
+	CompressionID      uint16
+	PacketSize         uint16
+	SampleRate         uint32 // 16.16 fixed point
+}
+
+const audioSampleEntrySize = 28
+
+// alacConfig is the ALACSpecificConfig held in the alac atom inside the alac
+// sample description.
+type alacConfig struct {
+	FrameLength       uint32
+	CompatibleVersion uint8
+	BitDepth          uint8
+	Pb                uint8
+	Mb                uint8
+	Kb                uint8
+	NumChannels       uint8
+	MaxRun            uint16
+	MaxFrameBytes     uint32
+	AvgBitRate        uint32
+	SampleRate        uint32
+}
+
+// Metadata is the information about the first sound track of the file.
+type Metadata struct {
+	// Codec is the format of the track's sample description, such as "mp4a"
+	// or "alac".
+	Codec         string
+	BitsPerSample int
+
+	duration    time.Duration
+	numChannels int
+	bitRate     int
+	sampleRate  int
+}
+
+func (m *Metadata) Duration() time.Duration { return m.duration }
+func (m *Metadata) NumChannels() int        { return m.numChannels }
+func (m *Metadata) BitRate() int            { return m.bitRate }
+func (m *Metadata) SampleRate() int         { return m.sampleRate }
+func (m *Metadata) String() string          { return sound.Summary(nil, m) }
+
+func (m *Metadata) DurationExact() bool { return true }
+
+// Lossless reports whether the audio is Apple Lossless.
+func (m *Metadata) Lossless() bool { return m.Codec == "alac" }
+
+// DecodeMeta decodes the metadata of the first sound track. The underlying
+// type of the sound.Metadata returned will be (*Metadata).
+func DecodeMeta(r io.Reader, fsize int64) (sound.Metadata, error) {
+	rr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return rr.Metadata()
+}
+
+// Metadata decodes the metadata of the first sound track.
+func (r *Reader) Metadata() (*Metadata, error) {
+	moov := r.Root.Get("moov")
+	if moov == nil {
+		return nil, ErrInvalidFormat
+	}
+
+	trak := r.soundTrack()
+	if trak == nil {
+		return nil, ErrInvalidFormat
+	}
+
+	var m Metadata
+
+	mh, err := readMediaHeader(trak)
+	if err != nil {
+		return nil, err
+	}
+	if mh.timescale != 0 {
+		m.duration = time.Duration(float64(mh.duration) / float64(mh.timescale) * float64(time.Second))
+	} else {
+		m.duration, err = movieDuration(moov)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, b, err := fullAtom(trak.Get("mdia", "minf", "stbl", "stsd"))
+	if err != nil {
+		return nil, err
+	}
+	// skip the entry count and read the first sample description
+	if len(b) < 4+atomHeaderSize+audioSampleEntrySize {
+		return nil, ErrInvalidFormat
+	}
+	b = b[4:]
+	size := binary.BigEndian.Uint32(b)
+	if size < atomHeaderSize+audioSampleEntrySize || int64(size) > int64(len(b)) {
+		return nil, ErrInvalidFormat
+	}
+	m.Codec = string(b[4:8])
+	b = b[atomHeaderSize:size]
+
+	var entry audioSampleEntry
+	binary.Read(bytes.NewReader(b), binary.BigEndian, &entry)
+	m.numChannels = int(entry.NumChannels)
+	m.BitsPerSample = int(entry.SampleSize)
+	m.sampleRate = int(entry.SampleRate >> 16)
+
+	if m.Codec == "alac" {
+		// the sample description's fields aren't reliable for ALAC; the
+		// codec's own config box is what the decoder actually uses
+		config := findAtom(b[audioSampleEntrySize:], "alac")
+		if len(config) >= 4+24 {
+			var c alacConfig
+			binary.Read(bytes.NewReader(config[4:]), binary.BigEndian, &c)
+			m.numChannels = int(c.NumChannels)
+			m.BitsPerSample = int(c.BitDepth)
+			m.sampleRate = int(c.SampleRate)
+			m.bitRate = int(c.AvgBitRate)
+		}
+	}
+
+	return &m, nil
+}
+
+// movieDuration reads the duration of the whole presentation from the mvhd
+// atom.
+func movieDuration(moov *Atom) (time.Duration, error) {
+	version, b, err := fullAtom(moov.Get("mvhd"))
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		timescale uint32
+		duration  uint64
+	)
+	if version == 1 {
+		if len(b) < 28 {
+			return 0, ErrInvalidFormat
+		}
+		timescale = binary.BigEndian.Uint32(b[16:])
+		duration = binary.BigEndian.Uint64(b[20:])
+	} else {
+		if len(b) < 16 {
+			return 0, ErrInvalidFormat
+		}
+		timescale = binary.BigEndian.Uint32(b[8:])
+		duration = uint64(binary.BigEndian.Uint32(b[12:]))
+	}
+	if timescale == 0 {
+		return 0, nil
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
+
+// findAtom looks for an atom by name in a sequence of atoms and returns its
+// content.
+func findAtom(b []byte, name string) []byte {
+	for len(b) >= atomHeaderSize {
+		size := binary.BigEndian.Uint32(b)
+		if size < atomHeaderSize || int64(size) > int64(len(b)) {
+			return nil
+		}
+		if string(b[4:8]) == name {
+			return b[atomHeaderSize:size]
+		}
+		b = b[size:]
+	}
+	return nil
+}
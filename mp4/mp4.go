@@ -2,9 +2,14 @@ package mp4
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"unicode/utf16"
 
 	"ktkr.us/pkg/sound"
 )
@@ -15,6 +20,10 @@ var (
 
 const (
 	atomHeaderSize = 8
+	// size of the 64-bit size following the header when the size field is 1
+	largeSizeSize = 8
+	// size of the extended type following the header of uuid atoms
+	uuidSize = 16
 )
 
 type AtomHeader struct {
@@ -23,10 +32,18 @@ type AtomHeader struct {
 }
 
 type Atom struct {
-	Name     string
+	Name string
+	// UUID is the extended type of "uuid" atoms.
+	UUID [16]byte
+	// Offset is the position of the start of the atom's header in the file,
+	// and Size is the size of the whole atom including the header.
+	Offset   int64
+	Size     int64
 	Content  []byte
 	Parent   *Atom
 	Children map[string][]*Atom
+
+	headerSize int64
 }
 
 func (a *Atom) Get(path ...string) *Atom {
@@ -48,14 +65,69 @@ func (a *Atom) Get(path ...string) *Atom {
 	return current
 }
 
+// childrenOffset reports whether the content of an atom is made up of child
+// atoms according to atomDefs, and if so, how many bytes of version and flags
+// come before them. Atoms that aren't in atomDefs are treated as leaves.
+func childrenOffset(name string, content []byte) (int, bool) {
+	def, ok := atomDefs[name]
+	if !ok {
+		return 0, false
+	}
+
+	switch def.container {
+	case parentAtom, simpleParentAtom:
+	case dualAtom:
+		// stsd is read by hand, since sample descriptions have fields
+		// before their children
+		if name != "meta" {
+			return 0, false
+		}
+		// QuickTime's meta atom doesn't have the version and flags of the
+		// ISO one, and goes straight into its hdlr atom
+		if len(content) >= 8 && string(content[4:8]) == "hdlr" {
+			return 0, true
+		}
+	default:
+		return 0, false
+	}
+
+	if def.boxType == versionedAtom {
+		return 4, true
+	}
+	return 0, true
+}
+
+// Reader reads the atom tree of an MP4 file. The contents of the media data
+// (mdat) atoms are skipped over rather than held in memory.
 type Reader struct {
 	Type string
-	r    *bufio.Reader
+	// Root holds the top level atoms of the file as its children.
+	Root *Atom
+
+	r   *bufio.Reader
+	rs  io.ReadSeeker
+	pos int64
+
+	chapters []sound.Chapter
 }
 
+// NewReader reads the entire atom tree from r. If r is an io.ReadSeeker, the
+// media data is seeked past instead of read, and chapter titles, which are
+// stored as media samples, can be resolved.
 func NewReader(r io.Reader) (*Reader, error) {
-	br := bufio.NewReader(r)
-	peek, err := br.Peek(8)
+	rr := &Reader{
+		Root: &Atom{Children: make(map[string][]*Atom)},
+	}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		pos, err := rs.Seek(0, os.SEEK_CUR)
+		if err == nil {
+			rr.rs = rs
+			rr.pos = pos
+		}
+	}
+	rr.r = bufio.NewReader(r)
+
+	peek, err := rr.r.Peek(8)
 	if err != nil {
 		return nil, err
 	}
@@ -65,28 +137,50 @@ func NewReader(r io.Reader) (*Reader, error) {
 		return nil, ErrInvalidFormat
 	}
 
-	rr := &Reader{r}
+	for {
+		a, err := rr.ReadAtom()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		a.Parent = rr.Root
+		rr.Root.Children[a.Name] = append(rr.Root.Children[a.Name], a)
+	}
 
-	a, err := rr.ReadAtom()
-	if err != nil {
-		return nil, err
+	ftyp := rr.Root.Get("ftyp")
+	if len(ftyp.Content) >= 4 {
+		rr.Type = string(ftyp.Content[:4])
+	}
+
+	if rr.rs != nil {
+		// A broken chapter track shouldn't keep the tags and metadata from
+		// being read, so it is taken as there being no chapters.
+		rr.chapters, err = rr.readChapters()
+		if err != nil {
+			rr.chapters = nil
+		}
 	}
+
+	return rr, nil
 }
 
 /*
 root:
-	read atom
-	if parent atom
-	  goto root
-	else
-	  read data
-	  if dual atom
-	    goto root
-      else
-	    if exhausted child atoms
-		  go up a level
+
+		read atom
+		if parent atom
+		  goto root
 		else
-	      read next child
+		  read data
+		  if dual atom
+		    goto root
+	      else
+		    if exhausted child atoms
+			  go up a level
+			else
+		      read next child
 */
 func (r *Reader) ReadAtom() (*Atom, error) {
 	var h AtomHeader
@@ -95,10 +189,323 @@ func (r *Reader) ReadAtom() (*Atom, error) {
 		return nil, err
 	}
 
-	buf := make([]byte, h.Size-atomHeaderSize)
+	var (
+		a          = &Atom{Name: string(h.Name[:]), Offset: r.pos}
+		headerSize = int64(atomHeaderSize)
+		size       = int64(h.Size)
+		toEnd      = h.Size == 0
+	)
+
+	if h.Size == 1 {
+		var large uint64
+		err = binary.Read(r.r, binary.BigEndian, &large)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		headerSize += largeSizeSize
+		size = int64(large)
+	}
+	if a.Name == "uuid" {
+		_, err = io.ReadFull(r.r, a.UUID[:])
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		headerSize += uuidSize
+	}
+	if !toEnd && size < headerSize {
+		return nil, ErrInvalidFormat
+	}
+	a.headerSize = headerSize
+	r.pos += headerSize
+
+	if toEnd {
+		// the atom extends to the end of the file
+		start := r.pos
+		switch a.Name {
+		case "mdat", "free", "skip":
+			err = r.skipToEnd()
+		default:
+			a.Content, err = ioutil.ReadAll(r.r)
+			r.pos += int64(len(a.Content))
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.Size = r.pos - start + headerSize
+	} else {
+		a.Size = size
+		size -= headerSize
+
+		switch a.Name {
+		case "mdat", "free", "skip":
+			// the size is only as much as the file really has
+			start := r.pos
+			err = r.skip(size)
+			a.Size = r.pos - start + headerSize
+			return a, err
+		}
+
+		// The size, especially a 64-bit one, may be far more than is left
+		// of the file, so the content is only allocated as it is read.
+		var buf bytes.Buffer
+		n, err := io.CopyN(&buf, r.r, size)
+		r.pos += n
+		if err == io.EOF {
+			return nil, ErrInvalidFormat
+		} else if err != nil {
+			return nil, err
+		}
+		a.Content = buf.Bytes()
+	}
+
+	err = readChildren(a)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// skip moves n bytes forward in the file, or to the end of the file if there
+// aren't that many left.
+func (r *Reader) skip(n int64) error {
+	if r.rs == nil {
+		m, err := io.CopyN(ioutil.Discard, r.r, n)
+		r.pos += m
+		return err
+	}
+
+	// seeking past the end isn't an error, so it has to be checked for
+	end, err := r.rs.Seek(0, os.SEEK_END)
+	if err != nil {
+		return err
+	}
+	r.pos += n
+	if r.pos > end {
+		r.pos = end
+	}
+	_, err = r.rs.Seek(r.pos, os.SEEK_SET)
+	if err != nil {
+		return err
+	}
+	r.r.Reset(r.rs)
+	return nil
+}
+
+// skipToEnd moves to the end of the file.
+func (r *Reader) skipToEnd() error {
+	if r.rs == nil {
+		n, err := io.Copy(ioutil.Discard, r.r)
+		r.pos += n
+		return err
+	}
+
+	end, err := r.rs.Seek(0, os.SEEK_END)
+	if err != nil {
+		return err
+	}
+	r.pos = end
+	r.r.Reset(r.rs)
+	return nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readChildren parses the content of a container atom into its children.
+func readChildren(a *Atom) error {
+	skip, ok := childrenOffset(a.Name, a.Content)
+	if !ok || len(a.Content) < skip {
+		return nil
+	}
+
+	a.Children = make(map[string][]*Atom)
+	b := a.Content[skip:]
+	offset := a.Offset + atomHeaderSize + int64(skip)
+
+	for len(b) >= atomHeaderSize {
+		var (
+			headerSize = uint64(atomHeaderSize)
+			size       = uint64(binary.BigEndian.Uint32(b))
+			child      = &Atom{Name: string(b[4:8]), Offset: offset, Parent: a}
+		)
+
+		switch size {
+		case 0:
+			// extends to the end of the parent
+			size = uint64(len(b))
+		case 1:
+			if len(b) < atomHeaderSize+largeSizeSize {
+				return ErrInvalidFormat
+			}
+			size = binary.BigEndian.Uint64(b[atomHeaderSize:])
+			headerSize += largeSizeSize
+		}
+		if child.Name == "uuid" {
+			if uint64(len(b)) < headerSize+uuidSize {
+				return ErrInvalidFormat
+			}
+			copy(child.UUID[:], b[headerSize:])
+			headerSize += uuidSize
+		}
+		if size < headerSize || size > uint64(len(b)) {
+			return ErrInvalidFormat
+		}
+
+		child.Size = int64(size)
+		child.headerSize = int64(headerSize)
+		child.Content = b[headerSize:size]
+		err := readChildren(child)
+		if err != nil {
+			return err
+		}
+		a.Children[child.Name] = append(a.Children[child.Name], child)
+
+		b = b[size:]
+		offset += int64(size)
+	}
+
+	return nil
+}
+
+// Chapters returns the chapters from the QuickTime chapter track, if the file
+// has one. The chapter titles are only available if the Reader was created
+// from an io.ReadSeeker.
+func (r *Reader) Chapters() []sound.Chapter {
+	return r.chapters
+}
+
+// readChapters resolves the chapter track referenced by the first track with
+// a tref/chap atom. Each sample of the chapter track is a text sample holding
+// the title of a chapter, and lasts as long as the chapter does.
+func (r *Reader) readChapters() ([]sound.Chapter, error) {
+	moov := r.Root.Get("moov")
+	if moov == nil {
+		return nil, nil
+	}
+
+	var chapterID uint32
+	for _, trak := range moov.Children["trak"] {
+		chap := trak.Get("tref", "chap")
+		if chap != nil && len(chap.Content) >= 4 {
+			chapterID = binary.BigEndian.Uint32(chap.Content)
+			break
+		}
+	}
+	if chapterID == 0 {
+		return nil, nil
+	}
+
+	var chapterTrak *Atom
+	for _, trak := range moov.Children["trak"] {
+		id, err := trackID(trak)
+		if err != nil {
+			return nil, err
+		}
+		if id == chapterID {
+			chapterTrak = trak
+			break
+		}
+	}
+	if chapterTrak == nil {
+		return nil, nil
+	}
+
+	st, err := readSampleTable(chapterTrak, r.mediaDataSize())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		offsets  = st.sampleOffsets()
+		times    = st.sampleTimes()
+		chapters = make([]sound.Chapter, 0, len(offsets))
+	)
+
+	for i, offset := range offsets {
+		// the rest of a sample after the longest possible text is of no use
+		size := st.size(i)
+		if size > maxTextSample {
+			size = maxTextSample
+		}
+		buf := make([]byte, size)
+		_, err = r.rs.Seek(offset, os.SEEK_SET)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.ReadFull(r.rs, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		chapters = append(chapters, sound.Chapter{
+			Start: st.duration(times[i]),
+			Title: decodeTextSample(buf),
+		})
+	}
 
+	return chapters, nil
 }
 
-func ReadTags(r io.Reader) (sound.Tags, error) {
-	return nil, nil
+// maxTextSample is the size of a text sample with the longest text that its
+// 16-bit length allows. Anything after that, such as style atoms, is ignored.
+const maxTextSample = 2 + 0xffff
+
+// decodeTextSample decodes a QuickTime text sample: a 16-bit length followed
+// by text that is UTF-8 unless it starts with a UTF-16 byte order mark, in
+// either byte order.
+func decodeTextSample(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if n < len(b) {
+		b = b[:n]
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(b, []byte("\xfe\xff")):
+		order = binary.BigEndian
+	case bytes.HasPrefix(b, []byte("\xff\xfe")):
+		order = binary.LittleEndian
+	default:
+		return string(b)
+	}
+	b = b[2:]
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// Keys returns the sorted names of the metadata item atoms in the iTunes-style
+// moov/udta/meta/ilst list, such as "\xa9nam" for the title.
+func (r *Reader) Keys() []string {
+	ilst := r.itemList()
+	var keys []string
+	for len(ilst) >= atomHeaderSize {
+		size := binary.BigEndian.Uint32(ilst)
+		if size < atomHeaderSize || int64(size) > int64(len(ilst)) {
+			break
+		}
+		keys = append(keys, string(ilst[4:8]))
+		ilst = ilst[size:]
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// itemList returns the content of the ilst atom.
+func (r *Reader) itemList() []byte {
+	ilst := r.Root.Get("moov", "udta", "meta", "ilst")
+	if ilst == nil {
+		return nil
+	}
+	return ilst.Content
 }
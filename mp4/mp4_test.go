@@ -0,0 +1,533 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+)
+
+func atom(name string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	b := make([]byte, atomHeaderSize, atomHeaderSize+len(body))
+	binary.BigEndian.PutUint32(b, uint32(atomHeaderSize+len(body)))
+	copy(b[4:], name)
+	return append(b, body...)
+}
+
+// fullAtomContent prepends a version and flags to content.
+func fullAtomContent(version byte, content ...[]byte) []byte {
+	return append([]byte{version, 0, 0, 0}, bytes.Join(content, nil)...)
+}
+
+func u32(ns ...uint32) []byte {
+	b := make([]byte, 4*len(ns))
+	for i, n := range ns {
+		binary.BigEndian.PutUint32(b[i*4:], n)
+	}
+	return b
+}
+
+func textSample(s string) []byte {
+	b := make([]byte, 2, 2+len(s))
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// makeChapterFile builds an M4B with an empty audio track that refers to a
+// chapter text track containing the given titles, each lasting the given
+// number of milliseconds.
+func makeChapterFile(titles []string, lengths []uint32) []byte {
+	var (
+		samples []byte
+		sizes   []uint32
+		stts    = []uint32{uint32(len(titles))}
+	)
+	for i, title := range titles {
+		s := textSample(title)
+		samples = append(samples, s...)
+		sizes = append(sizes, uint32(len(s)))
+		stts = append(stts, 1, lengths[i])
+	}
+
+	ftyp := atom("ftyp", []byte("M4B "), u32(0), []byte("M4B mp42"))
+
+	moov := func(mdatOffset uint32) []byte {
+		tkhd := func(id uint32) []byte {
+			return atom("tkhd", fullAtomContent(0, u32(0, 0, id, 0, 0)))
+		}
+		hdlr := func(handler string) []byte {
+			return atom("hdlr", fullAtomContent(0, u32(0), []byte(handler), make([]byte, 13)))
+		}
+		stsd := func(codec string) []byte {
+			return atom("stsd", fullAtomContent(0, u32(1), atom(codec, make([]byte, 8))))
+		}
+		// "eng"
+		mdhd := atom("mdhd", fullAtomContent(0, u32(0, 0, 1000, 91500), []byte{0x15, 0xc7, 0, 0}))
+
+		audio := atom("trak",
+			tkhd(1),
+			atom("tref", atom("chap", u32(2))),
+			atom("mdia", mdhd, hdlr("soun"), atom("minf", atom("stbl", stsd("mp4a")))),
+		)
+		text := atom("trak",
+			tkhd(2),
+			atom("mdia",
+				mdhd,
+				hdlr("text"),
+				atom("minf", atom("stbl",
+					stsd("text"),
+					atom("stts", fullAtomContent(0, u32(stts...))),
+					atom("stsc", fullAtomContent(0, u32(1, 1, uint32(len(titles)), 1))),
+					atom("stsz", fullAtomContent(0, u32(0, uint32(len(sizes))), u32(sizes...))),
+					atom("stco", fullAtomContent(0, u32(1, mdatOffset))),
+				)),
+			),
+		)
+		return atom("moov", audio, text)
+	}
+
+	offset := len(ftyp) + len(moov(0)) + atomHeaderSize
+	return bytes.Join([][]byte{ftyp, moov(uint32(offset)), atom("mdat", samples)}, nil)
+}
+
+func TestChapters(t *testing.T) {
+	data := makeChapterFile([]string{"Intro", "Chapter 1", "Chapter 2"}, []uint32{1500, 60000, 30000})
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Type != "M4B " {
+		t.Errorf("type: got %q", r.Type)
+	}
+
+	expected := []sound.Chapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 1500 * time.Millisecond, Title: "Chapter 1"},
+		{Start: 61500 * time.Millisecond, Title: "Chapter 2"},
+	}
+	chapters := r.Chapters()
+	if len(chapters) != len(expected) {
+		t.Fatalf("got %d chapters, expected %d", len(chapters), len(expected))
+	}
+	for i := range expected {
+		if chapters[i] != expected[i] {
+			t.Errorf("chapter %d: got %+v, expected %+v", i, chapters[i], expected[i])
+		}
+	}
+}
+
+func TestTracks(t *testing.T) {
+	data := makeChapterFile([]string{"Intro", "Chapter 1", "Chapter 2"}, []uint32{1500, 60000, 30000})
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Track{
+		{ID: 1, Handler: "soun", Codec: "mp4a", Duration: 91500 * time.Millisecond, Language: "eng"},
+		{ID: 2, Handler: "text", Codec: "text", Duration: 91500 * time.Millisecond, Language: "eng"},
+	}
+	tracks := r.Tracks()
+	if len(tracks) != len(expected) {
+		t.Fatalf("got %d tracks, expected %d", len(tracks), len(expected))
+	}
+	for i := range expected {
+		if tracks[i] != expected[i] {
+			t.Errorf("track %d: got %+v, expected %+v", i, tracks[i], expected[i])
+		}
+	}
+}
+
+func TestMetadataALAC(t *testing.T) {
+	var entry bytes.Buffer
+	binary.Write(&entry, binary.BigEndian, audioSampleEntry{
+		DataReferenceIndex: 1,
+		NumChannels:        2,
+		SampleSize:         16,
+		SampleRate:         44100 << 16,
+	})
+	binary.Write(&entry, binary.BigEndian, uint32(atomHeaderSize+4+24))
+	entry.WriteString("alac")
+	entry.Write(fullAtomContent(0))
+	binary.Write(&entry, binary.BigEndian, alacConfig{
+		FrameLength: 4096,
+		BitDepth:    24,
+		NumChannels: 2,
+		AvgBitRate:  2000000,
+		SampleRate:  96000,
+	})
+
+	data := bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A "), u32(0)),
+		atom("moov",
+			atom("mvhd", fullAtomContent(0, u32(0, 0, 1000, 5000))),
+			atom("trak",
+				atom("tkhd", fullAtomContent(0, u32(0, 0, 1, 0, 0))),
+				atom("mdia",
+					atom("mdhd", fullAtomContent(0, u32(0, 0, 96000, 96000*5), []byte{0, 0, 0, 0})),
+					atom("hdlr", fullAtomContent(0, u32(0), []byte("soun"), make([]byte, 13))),
+					atom("minf", atom("stbl",
+						atom("stsd", fullAtomContent(0, u32(1), atom("alac", entry.Bytes()))),
+					)),
+				),
+			),
+		),
+	}, nil)
+
+	mm, err := DecodeMeta(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mm.(*Metadata)
+	if !m.Lossless() {
+		t.Error("ALAC not reported as lossless")
+	}
+	if m.SampleRate() != 96000 || m.BitsPerSample != 24 || m.NumChannels() != 2 {
+		t.Errorf("got %d Hz, %d bits, %d channels", m.SampleRate(), m.BitsPerSample, m.NumChannels())
+	}
+	if m.Duration() != 5*time.Second {
+		t.Errorf("duration: got %v", m.Duration())
+	}
+}
+
+func TestUnknownAtoms(t *testing.T) {
+	file := bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A "), u32(0)),
+		atom("free", make([]byte, 100)),
+		atom("moov",
+			atom("vndr", []byte("vendor specific")),
+			atom("skip", make([]byte, 10)),
+			atom("udta",
+				atom("meta", fullAtomContent(0,
+					atom("hdlr", make([]byte, 25)),
+					atom("ilst",
+						atom("\xa9nam", atom("data", u32(1, 0), []byte("title"))),
+						atom("\xa9ART", atom("data", u32(1, 0), []byte("artist"))),
+					),
+				)),
+			),
+		),
+		atom("mdat", make([]byte, 1000)),
+	}, nil)
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Root.Get("moov", "vndr") == nil || r.Root.Get("free") == nil {
+		t.Error("unknown and free atoms should be kept as leaves")
+	}
+	keys := r.Keys()
+	if len(keys) != 2 || keys[0] != "\xa9ART" || keys[1] != "\xa9nam" {
+		t.Errorf("got keys %q", keys)
+	}
+}
+
+func TestExtendedAtoms(t *testing.T) {
+	uuid := []byte("0123456789abcdef")
+	large := append(u32(1), []byte("mdat")...)
+	large = append(large, 0, 0, 0, 0, 0, 0, 0, 16+20)
+	large = append(large, make([]byte, 20)...)
+
+	file := bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A "), u32(0)),
+		atom("moov",
+			atom("uuid", uuid, []byte("payload")),
+		),
+		large,
+		append(u32(0), []byte("free\x00\x00\x00")...),
+	}, nil)
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := r.Root.Get("moov", "uuid")
+	if u == nil || string(u.UUID[:]) != string(uuid) || string(u.Content) != "payload" {
+		t.Errorf("got uuid atom %+v", u)
+	}
+	m := r.Root.Get("mdat")
+	if m == nil || m.Size != 16+20 {
+		t.Errorf("got mdat %+v", m)
+	}
+	f := r.Root.Get("free")
+	if f == nil || f.Offset+f.Size != int64(len(file)) {
+		t.Errorf("free atom should extend to the end of the file, got %+v", f)
+	}
+}
+
+func TestHugeAtom(t *testing.T) {
+	// a 64-bit size of nearly 2^63 bytes, with nothing after it
+	large := append(u32(1), []byte("moov")...)
+	large = append(large, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	file := append(atom("ftyp", []byte("M4A "), u32(0)), large...)
+
+	_, _, err := sound.DecodeMetaBytes(file)
+	if err != ErrInvalidFormat {
+		t.Errorf("got %v, expected ErrInvalidFormat", err)
+	}
+}
+
+func TestSampleOffsets(t *testing.T) {
+	ftyp := atom("ftyp", []byte("M4A "), u32(0))
+	moov := func(chunkOffset uint32) []byte {
+		return atom("moov", atom("trak",
+			atom("tkhd", fullAtomContent(0, u32(0, 0, 1, 0, 0))),
+			atom("mdia",
+				atom("mdhd", fullAtomContent(0, u32(0, 0, 1000, 3000), []byte{0, 0, 0, 0})),
+				atom("hdlr", fullAtomContent(0, u32(0), []byte("soun"), make([]byte, 13))),
+				atom("minf", atom("stbl",
+					atom("stts", fullAtomContent(0, u32(1, 3, 1000))),
+					// two samples in the first chunk, one in the second
+					atom("stsc", fullAtomContent(0, u32(2, 1, 2, 1, 2, 1, 1))),
+					atom("stsz", fullAtomContent(0, u32(0, 3, 10, 20, 30))),
+					atom("stco", fullAtomContent(0, u32(2, chunkOffset, chunkOffset+40))),
+				)),
+			),
+		))
+	}
+	mdatOffset := len(ftyp) + len(moov(0))
+	dataOffset := uint32(mdatOffset + atomHeaderSize)
+	file := bytes.Join([][]byte{ftyp, moov(dataOffset), atom("mdat", make([]byte, 70))}, nil)
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset, length := r.MediaDataRange()
+	if offset != int64(dataOffset) || length != 70 {
+		t.Errorf("media data range: got %d+%d, expected %d+70", offset, length, dataOffset)
+	}
+
+	expected := []int64{int64(dataOffset), int64(dataOffset) + 10, int64(dataOffset) + 40}
+	offsets := r.SampleOffsets()
+	if len(offsets) != len(expected) {
+		t.Fatalf("got sample offsets %v, expected %v", offsets, expected)
+	}
+	for i := range expected {
+		if offsets[i] != expected[i] {
+			t.Errorf("got sample offsets %v, expected %v", offsets, expected)
+			break
+		}
+	}
+}
+
+func TestHugeSampleCount(t *testing.T) {
+	// every sample is a byte, and there are claimed to be 2^32-1 of them in
+	// a single chunk
+	ftyp := atom("ftyp", []byte("M4A "), u32(0))
+	moov := atom("moov", atom("trak",
+		atom("tkhd", fullAtomContent(0, u32(0, 0, 1, 0, 0))),
+		atom("mdia",
+			atom("mdhd", fullAtomContent(0, u32(0, 0, 1000, 3000), []byte{0, 0, 0, 0})),
+			atom("hdlr", fullAtomContent(0, u32(0), []byte("soun"), make([]byte, 13))),
+			atom("minf", atom("stbl",
+				atom("stts", fullAtomContent(0, u32(1, 0xffffffff, 1))),
+				atom("stsc", fullAtomContent(0, u32(1, 1, 0xffffffff, 1))),
+				atom("stsz", fullAtomContent(0, u32(1, 0xffffffff))),
+				atom("stco", fullAtomContent(0, u32(1, 0))),
+			)),
+		),
+	))
+	// and the media data is claimed to be 2^40 bytes in a 64-bit size
+	large := append(u32(1), []byte("mdat")...)
+	large = append(large, 0, 0, 1, 0, 0, 0, 0, 0)
+	large = append(large, make([]byte, 16)...)
+
+	for _, mdat := range [][]byte{atom("mdat", make([]byte, 16)), large} {
+		file := bytes.Join([][]byte{ftyp, moov, mdat}, nil)
+
+		r, err := NewReader(bytes.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, length := r.MediaDataRange(); length != 16 {
+			t.Errorf("got media data length %d, expected 16", length)
+		}
+		if offsets := r.SampleOffsets(); len(offsets) != 16 {
+			t.Errorf("got %d sample offsets, expected 16", len(offsets))
+		}
+	}
+}
+
+func TestChunkedSampleCount(t *testing.T) {
+	// the sizes allow for 1000 samples, but only one chunk of 3 is placed
+	st := &sampleTable{
+		sampleToChunk: []stscEntry{{1, 3}},
+		chunkOffsets:  []int64{0},
+		sampleSize:    1,
+		numSamples:    1000,
+	}
+	if n := st.chunkedSamples(); n != 3 {
+		t.Errorf("got %d samples, expected 3", n)
+	}
+}
+
+func TestBrokenChapterTrack(t *testing.T) {
+	data := makeChapterFile([]string{"Intro"}, []uint32{1500})
+	// the chapter track's ID can't be read without its tkhd
+	copy(data[bytes.LastIndex(data, []byte("tkhd")):], "xxxx")
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := r.Chapters(); c != nil {
+		t.Errorf("got chapters %+v", c)
+	}
+}
+
+func TestLongDuration(t *testing.T) {
+	st := &sampleTable{timescale: 44100}
+	if d := st.duration(44100 * 3600 * 1000); d != 1000*time.Hour {
+		t.Errorf("got %v", d)
+	}
+}
+
+func TestTextSampleUTF16(t *testing.T) {
+	tests := []struct {
+		sample []byte
+		title  string
+	}{
+		{[]byte("\x00\x08\xfe\xff\xd8\x34\xdd\x1e\x00!"), "\U0001d11e!"},
+		{[]byte("\x00\x08\xff\xfe\x34\xd8\x1e\xdd!\x00"), "\U0001d11e!"},
+		{[]byte("\x00\x03abc"), "abc"},
+	}
+	for _, test := range tests {
+		if s := decodeTextSample(test.sample); s != test.title {
+			t.Errorf("%x: got %q, expected %q", test.sample, s, test.title)
+		}
+	}
+}
+
+func TestGenre(t *testing.T) {
+	item := func(name string, value []byte) []byte {
+		return atom(name, atom("data", u32(0, 0), value))
+	}
+	file := func(items ...[]byte) []byte {
+		return bytes.Join([][]byte{
+			atom("ftyp", []byte("M4A "), u32(0)),
+			atom("moov", atom("udta", atom("meta", fullAtomContent(0,
+				atom("hdlr", make([]byte, 25)),
+				atom("ilst", items...),
+			)))),
+		}, nil)
+	}
+
+	tests := []struct {
+		data  []byte
+		genre string
+	}{
+		// 1-based, so 18 is "Rock" rather than "Techno"
+		{file(item("gnre", []byte{0, 18})), "Rock"},
+		{file(item("gnre", []byte{0, 18}), item("\xa9gen", []byte("Synthwave"))), "Synthwave"},
+		{file(item("gnre", []byte{0, 0})), ""},
+	}
+	for _, test := range tests {
+		tags, err := ReadTags(bytes.NewReader(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := tags.Genre(); g != test.genre {
+			t.Errorf("got %q, expected %q", g, test.genre)
+		}
+	}
+
+	_, err := ReadTags(bytes.NewReader(atom("ftyp", []byte("M4A "), u32(0))))
+	if err != sound.ErrNoTags {
+		t.Errorf("no ilst: got %v, expected ErrNoTags", err)
+	}
+}
+
+func TestClassicalTags(t *testing.T) {
+	item := func(name string, value []byte) []byte {
+		return atom(name, atom("data", u32(0, 0), value))
+	}
+	file := bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A "), u32(0)),
+		atom("moov", atom("udta", atom("meta", fullAtomContent(0,
+			atom("hdlr", make([]byte, 25)),
+			atom("ilst",
+				item("\xa9grp", []byte("Favourites")),
+				item("\xa9wrk", []byte("Symphony No. 9")),
+				item("\xa9mvn", []byte("Presto")),
+				item("\xa9mvi", []byte{0, 4}),
+				item("\xa9mvc", []byte{0, 4}),
+			),
+		)))),
+	}, nil)
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags sound.ClassicalTags = r
+	if tags.Grouping() != "Favourites" || tags.Work() != "Symphony No. 9" || tags.MovementName() != "Presto" {
+		t.Errorf("got %q, %q, %q", tags.Grouping(), tags.Work(), tags.MovementName())
+	}
+	if n, total := tags.Movement(); n != 4 || total != 4 {
+		t.Errorf("got movement %d/%d", n, total)
+	}
+}
+
+func TestSortTags(t *testing.T) {
+	item := func(name string, value string) []byte {
+		return atom(name, atom("data", u32(1, 0), []byte(value)))
+	}
+	file := bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A "), u32(0)),
+		atom("moov", atom("udta", atom("meta", fullAtomContent(0,
+			atom("hdlr", make([]byte, 25)),
+			atom("ilst",
+				item("sonm", "Long and Winding Road, The"),
+				item("soar", "Beatles, The"),
+				item("soaa", "Beatles, The"),
+				item("soal", "Let It Be"),
+				item("soco", "Lennon, John"),
+				item("sosn", "Office, The"),
+			),
+		)))),
+	}, nil)
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags sound.SortTags = r
+	got := []string{tags.SortTitle(), tags.SortArtist(), tags.SortAlbumArtist(), tags.SortAlbum(), tags.SortComposer(), r.SortShow()}
+	expected := []string{"Long and Winding Road, The", "Beatles, The", "Beatles, The", "Let It Be", "Lennon, John", "Office, The"}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("got %q, expected %q", got, expected)
+			break
+		}
+	}
+}
+
+func TestPictures(t *testing.T) {
+	file := bytes.Join([][]byte{
+		atom("ftyp", []byte("M4A "), u32(0)),
+		atom("moov", atom("udta", atom("meta", fullAtomContent(0,
+			atom("hdlr", make([]byte, 25)),
+			atom("ilst", atom("covr",
+				atom("data", u32(14, 0), []byte("\x89PNG")),
+				atom("data", u32(13, 0), []byte("\xff\xd8")),
+			)),
+		)))),
+	}, nil)
+
+	tags, err := ReadTags(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pics := tags.(sound.Picturer).Pictures()
+	if len(pics) != 2 || pics[0].MIMEType != "image/png" || string(pics[0].Data) != "\x89PNG" || pics[1].MIMEType != "image/jpeg" {
+		t.Errorf("got %+v", pics)
+	}
+}
@@ -0,0 +1,162 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/id3/id3v1"
+)
+
+// ReadTags reads the iTunes-style metadata items of an MP4 file. If there are
+// none, it returns sound.ErrNoTags. The underlying type of the sound.Tags
+// returned will be (*Reader).
+func ReadTags(r io.Reader) (sound.Tags, error) {
+	rr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if rr.Root.Get("moov", "udta", "meta", "ilst") == nil {
+		return nil, sound.ErrNoTags
+	}
+	return rr, nil
+}
+
+// itemData returns the value of the first data atom of the named metadata
+// item, or nil if there is no such item.
+func (r *Reader) itemData(name string) []byte {
+	ilst := r.Root.Get("moov", "udta", "meta", "ilst")
+	if ilst == nil || len(ilst.Children[name]) == 0 {
+		return nil
+	}
+
+	// the item holds a data atom: the type in place of the version and
+	// flags, then a 32-bit locale, then the value
+	b := ilst.Children[name][0].Content
+	if len(b) < atomHeaderSize+8 || string(b[4:8]) != "data" {
+		return nil
+	}
+	size := binary.BigEndian.Uint32(b)
+	if size < atomHeaderSize+8 || int64(size) > int64(len(b)) {
+		return nil
+	}
+	return b[atomHeaderSize+8 : size]
+}
+
+// coverTypes are the MIME types of the data types of the covr item.
+var coverTypes = map[uint32]string{13: "image/jpeg", 14: "image/png", 27: "image/bmp"}
+
+// Pictures returns the cover art in the covr item, which may hold several
+// images. MP4 doesn't say what they depict, so each is given as a front
+// cover.
+func (r *Reader) Pictures() []sound.Picture {
+	ilst := r.Root.Get("moov", "udta", "meta", "ilst")
+	if ilst == nil {
+		return nil
+	}
+
+	var pics []sound.Picture
+	for _, item := range ilst.Children["covr"] {
+		for b := item.Content; len(b) >= atomHeaderSize+8; {
+			size := binary.BigEndian.Uint32(b)
+			if size < atomHeaderSize+8 || int64(size) > int64(len(b)) {
+				break
+			}
+			if string(b[4:8]) == "data" {
+				pics = append(pics, sound.Picture{
+					MIMEType: coverTypes[binary.BigEndian.Uint32(b[8:])&0xFFFFFF],
+					Type:     3,
+					Data:     b[atomHeaderSize+8 : size],
+				})
+			}
+			b = b[size:]
+		}
+	}
+	return pics
+}
+
+func (r *Reader) itemText(name string) string {
+	return string(r.itemData(name))
+}
+
+// itemNumber reads the first number of a number/total pair, as found in the
+// trkn and disk items.
+func (r *Reader) itemNumber(name string) int {
+	b := r.itemData(name)
+	if len(b) < 4 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b[2:]))
+}
+
+func (r *Reader) String() string      { return sound.Summary(r, nil) }
+func (r *Reader) TagFormat() string   { return "MP4" }
+func (r *Reader) Title() string       { return r.itemText("\xa9nam") }
+func (r *Reader) AlbumArtist() string { return r.itemText("aART") }
+func (r *Reader) Artist() string      { return r.itemText("\xa9ART") }
+func (r *Reader) Album() string       { return r.itemText("\xa9alb") }
+func (r *Reader) Composer() string    { return r.itemText("\xa9wrt") }
+func (r *Reader) Notes() string       { return r.itemText("\xa9cmt") }
+func (r *Reader) Disc() int           { return r.itemNumber("disk") }
+func (r *Reader) Track() int          { return r.itemNumber("trkn") }
+
+func (r *Reader) Grouping() string     { return r.itemText("\xa9grp") }
+func (r *Reader) Work() string         { return r.itemText("\xa9wrk") }
+func (r *Reader) MovementName() string { return r.itemText("\xa9mvn") }
+
+// The sort items are the ones iTunes writes.
+func (r *Reader) SortTitle() string       { return r.itemText("sonm") }
+func (r *Reader) SortArtist() string      { return r.itemText("soar") }
+func (r *Reader) SortAlbumArtist() string { return r.itemText("soaa") }
+func (r *Reader) SortAlbum() string       { return r.itemText("soal") }
+func (r *Reader) SortComposer() string    { return r.itemText("soco") }
+
+// SortShow returns the sosn item, the name of the TV show to sort by.
+func (r *Reader) SortShow() string { return r.itemText("sosn") }
+
+// Movement returns the \xa9mvi and \xa9mvc items, which hold 16-bit
+// integers.
+func (r *Reader) Movement() (n, total int) {
+	return r.itemInt("\xa9mvi"), r.itemInt("\xa9mvc")
+}
+
+// itemInt reads an item holding a big endian integer of up to 64 bits.
+func (r *Reader) itemInt(name string) int {
+	b := r.itemData(name)
+	if len(b) > 8 {
+		return 0
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return int(n)
+}
+
+// Genre returns the text of the \xa9gen item if there is one. Otherwise it
+// resolves the gnre item, which holds a 16-bit ID3v1 genre index plus one.
+func (r *Reader) Genre() string {
+	if s := r.itemText("\xa9gen"); s != "" {
+		return s
+	}
+	b := r.itemData("gnre")
+	if len(b) < 2 {
+		return ""
+	}
+	return id3v1.GenreName(int(binary.BigEndian.Uint16(b)) - 1)
+}
+
+// Date parses the \xa9day item, which is either a year or an ISO 8601 date
+// and time.
+func (r *Reader) Date() time.Time {
+	s := strings.TrimSpace(r.itemText("\xa9day"))
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02", "2006"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,400 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// fullAtom splits the content of a versioned atom into its version and the
+// rest of the content, skipping the flags.
+func fullAtom(a *Atom) (version byte, body []byte, err error) {
+	if a == nil || len(a.Content) < 4 {
+		return 0, nil, ErrInvalidFormat
+	}
+	return a.Content[0], a.Content[4:], nil
+}
+
+// trackID reads the track ID from a trak's tkhd atom.
+func trackID(trak *Atom) (uint32, error) {
+	version, b, err := fullAtom(trak.Get("tkhd"))
+	if err != nil {
+		return 0, err
+	}
+
+	// creation and modification times are 64 bits in version 1
+	pos := 8
+	if version == 1 {
+		pos = 16
+	}
+	if len(b) < pos+4 {
+		return 0, ErrInvalidFormat
+	}
+	return binary.BigEndian.Uint32(b[pos:]), nil
+}
+
+// Track describes one of the tracks (trak atoms) of the file.
+type Track struct {
+	ID uint32
+	// Handler is the type of media in the track, such as "soun" for audio,
+	// "text" for chapter text, or "vide" for video.
+	Handler string
+	// Codec is the format of the track's first sample description, such as
+	// "mp4a" or "alac".
+	Codec    string
+	Duration time.Duration
+	// Language is an ISO 639-2/T language code.
+	Language string
+}
+
+// Tracks returns information about each of the tracks in the file. Any
+// information that couldn't be decoded is left blank.
+func (r *Reader) Tracks() []Track {
+	moov := r.Root.Get("moov")
+	if moov == nil {
+		return nil
+	}
+
+	var tracks []Track
+	for _, trak := range moov.Children["trak"] {
+		var t Track
+		t.ID, _ = trackID(trak)
+
+		mh, err := readMediaHeader(trak)
+		if err == nil {
+			t.Language = mh.language
+			if mh.timescale != 0 {
+				t.Duration = time.Duration(float64(mh.duration) / float64(mh.timescale) * float64(time.Second))
+			}
+		}
+
+		_, b, err := fullAtom(trak.Get("mdia", "hdlr"))
+		if err == nil && len(b) >= 8 {
+			t.Handler = string(b[4:8])
+		}
+
+		_, b, err = fullAtom(trak.Get("mdia", "minf", "stbl", "stsd"))
+		if err == nil && len(b) >= 12 {
+			t.Codec = string(b[8:12])
+		}
+
+		tracks = append(tracks, t)
+	}
+	return tracks
+}
+
+// soundTrack returns the trak atom of the first sound track, or nil if there
+// isn't one.
+func (r *Reader) soundTrack() *Atom {
+	moov := r.Root.Get("moov")
+	if moov == nil {
+		return nil
+	}
+	for i, t := range r.Tracks() {
+		if t.Handler == "soun" {
+			return moov.Children["trak"][i]
+		}
+	}
+	return nil
+}
+
+// MediaDataRange returns the position in the file and the length of the
+// contents of the first mdat atom, which holds the samples of the tracks. Both
+// are 0 if there is no mdat atom.
+func (r *Reader) MediaDataRange() (offset, length int64) {
+	mdat := r.Root.Get("mdat")
+	if mdat == nil {
+		return 0, 0
+	}
+	return mdat.Offset + mdat.headerSize, mdat.Size - mdat.headerSize
+}
+
+// SampleOffsets returns the position in the file of each sample of the first
+// sound track, as found from its chunk offset (stco or co64), sample-to-chunk
+// (stsc) and sample size (stsz) tables. It returns nil if the tables couldn't
+// be decoded.
+func (r *Reader) SampleOffsets() []int64 {
+	trak := r.soundTrack()
+	if trak == nil {
+		return nil
+	}
+	st, err := readSampleTable(trak, r.mediaDataSize())
+	if err != nil {
+		return nil
+	}
+	return st.sampleOffsets()
+}
+
+// mediaDataSize returns the total size of the contents of the mdat atoms,
+// which the samples of every track lie within.
+func (r *Reader) mediaDataSize() int64 {
+	var n int64
+	for _, mdat := range r.Root.Children["mdat"] {
+		n += mdat.Size - mdat.headerSize
+	}
+	return n
+}
+
+type mediaHeader struct {
+	timescale uint32
+	duration  uint64
+	language  string
+}
+
+// readMediaHeader decodes a trak's mdhd atom.
+func readMediaHeader(trak *Atom) (*mediaHeader, error) {
+	version, b, err := fullAtom(trak.Get("mdia", "mdhd"))
+	if err != nil {
+		return nil, err
+	}
+
+	var mh mediaHeader
+
+	// creation and modification times and duration are 64 bits in version 1
+	if version == 1 {
+		if len(b) < 30 {
+			return nil, ErrInvalidFormat
+		}
+		mh.timescale = binary.BigEndian.Uint32(b[16:])
+		mh.duration = binary.BigEndian.Uint64(b[20:])
+		b = b[28:]
+	} else {
+		if len(b) < 18 {
+			return nil, ErrInvalidFormat
+		}
+		mh.timescale = binary.BigEndian.Uint32(b[8:])
+		mh.duration = uint64(binary.BigEndian.Uint32(b[12:]))
+		b = b[16:]
+	}
+
+	// packed as three 5-bit characters offset from 0x60
+	lang := binary.BigEndian.Uint16(b)
+	if lang != 0 {
+		mh.language = string([]byte{
+			byte(lang>>10&0x1f) + 0x60,
+			byte(lang>>5&0x1f) + 0x60,
+			byte(lang&0x1f) + 0x60,
+		})
+	}
+
+	return &mh, nil
+}
+
+type sttsEntry struct {
+	count uint32
+	delta uint32
+}
+
+type stscEntry struct {
+	firstChunk      uint32
+	samplesPerChunk uint32
+}
+
+// sampleTable is the information from a track's stbl atom needed to locate
+// its samples in the file and in time.
+type sampleTable struct {
+	timescale     uint32
+	timeToSample  []sttsEntry
+	sampleToChunk []stscEntry
+	chunkOffsets  []int64
+
+	// If all samples are the same size, sampleSize is nonzero and sizes is
+	// empty.
+	sampleSize uint32
+	numSamples uint32
+	sizes      []uint32
+}
+
+// readSampleTable decodes a trak's sample tables. dataSize is the size of the
+// media data, which bounds the number of samples when they are all the same
+// size and so have no table of sizes to bound them.
+func readSampleTable(trak *Atom, dataSize int64) (*sampleTable, error) {
+	var st sampleTable
+
+	mh, err := readMediaHeader(trak)
+	if err != nil {
+		return nil, err
+	}
+	st.timescale = mh.timescale
+
+	stbl := trak.Get("mdia", "minf", "stbl")
+	if stbl == nil {
+		return nil, ErrInvalidFormat
+	}
+
+	b, err := tableEntries(stbl.Get("stts"), 8)
+	if err != nil {
+		return nil, err
+	}
+	for ; len(b) > 0; b = b[8:] {
+		st.timeToSample = append(st.timeToSample, sttsEntry{
+			count: binary.BigEndian.Uint32(b),
+			delta: binary.BigEndian.Uint32(b[4:]),
+		})
+	}
+
+	b, err = tableEntries(stbl.Get("stsc"), 12)
+	if err != nil {
+		return nil, err
+	}
+	for ; len(b) > 0; b = b[12:] {
+		st.sampleToChunk = append(st.sampleToChunk, stscEntry{
+			firstChunk:      binary.BigEndian.Uint32(b),
+			samplesPerChunk: binary.BigEndian.Uint32(b[4:]),
+		})
+	}
+
+	if stco := stbl.Get("stco"); stco != nil {
+		b, err = tableEntries(stco, 4)
+		if err != nil {
+			return nil, err
+		}
+		for ; len(b) > 0; b = b[4:] {
+			st.chunkOffsets = append(st.chunkOffsets, int64(binary.BigEndian.Uint32(b)))
+		}
+	} else {
+		b, err = tableEntries(stbl.Get("co64"), 8)
+		if err != nil {
+			return nil, err
+		}
+		for ; len(b) > 0; b = b[8:] {
+			st.chunkOffsets = append(st.chunkOffsets, int64(binary.BigEndian.Uint64(b)))
+		}
+	}
+
+	_, b, err = fullAtom(stbl.Get("stsz"))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 {
+		return nil, ErrInvalidFormat
+	}
+	st.sampleSize = binary.BigEndian.Uint32(b)
+	st.numSamples = binary.BigEndian.Uint32(b[4:])
+	b = b[8:]
+	if st.sampleSize != 0 && int64(st.numSamples) > dataSize/int64(st.sampleSize) {
+		st.numSamples = uint32(dataSize / int64(st.sampleSize))
+	}
+	if n := st.chunkedSamples(); uint64(st.numSamples) > n {
+		st.numSamples = uint32(n)
+	}
+	if st.sampleSize == 0 {
+		if uint64(len(b)) < uint64(st.numSamples)*4 {
+			return nil, ErrInvalidFormat
+		}
+		st.sizes = make([]uint32, st.numSamples)
+		for i := range st.sizes {
+			st.sizes[i] = binary.BigEndian.Uint32(b[i*4:])
+		}
+	}
+
+	return &st, nil
+}
+
+// chunkedSamples returns how many samples the sample-to-chunk and chunk
+// offset tables can place, which bounds the number of samples whatever the
+// sample size table says. It stops counting past the largest sample count.
+func (st *sampleTable) chunkedSamples() uint64 {
+	var n uint64
+	for i, e := range st.sampleToChunk {
+		// as in sampleOffsets
+		lastChunk := uint32(len(st.chunkOffsets))
+		if i+1 < len(st.sampleToChunk) && st.sampleToChunk[i+1].firstChunk-1 < lastChunk {
+			lastChunk = st.sampleToChunk[i+1].firstChunk - 1
+		}
+		if e.firstChunk >= 1 && e.firstChunk <= lastChunk {
+			n += uint64(lastChunk-e.firstChunk+1) * uint64(e.samplesPerChunk)
+		}
+		if n > math.MaxUint32 {
+			break
+		}
+	}
+	return n
+}
+
+// tableEntries returns the entries of a versioned table atom that begins with
+// a 32-bit entry count.
+func tableEntries(a *Atom, entrySize int) ([]byte, error) {
+	_, b, err := fullAtom(a)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, ErrInvalidFormat
+	}
+	n := uint64(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if uint64(len(b)) < n*uint64(entrySize) {
+		return nil, ErrInvalidFormat
+	}
+	return b[:n*uint64(entrySize)], nil
+}
+
+func (st *sampleTable) size(i int) uint32 {
+	if st.sampleSize != 0 {
+		return st.sampleSize
+	}
+	return st.sizes[i]
+}
+
+// sampleOffsets returns the position of each sample in the file.
+func (st *sampleTable) sampleOffsets() []int64 {
+	var (
+		offsets []int64
+		sample  = 0
+		n       = int(st.numSamples)
+	)
+
+	for i, e := range st.sampleToChunk {
+		// each entry applies up until the next entry's first chunk
+		lastChunk := uint32(len(st.chunkOffsets))
+		if i+1 < len(st.sampleToChunk) {
+			lastChunk = st.sampleToChunk[i+1].firstChunk - 1
+		}
+
+		for chunk := e.firstChunk; chunk <= lastChunk && chunk >= 1; chunk++ {
+			if int(chunk) > len(st.chunkOffsets) {
+				return offsets
+			}
+			offset := st.chunkOffsets[chunk-1]
+			for j := uint32(0); j < e.samplesPerChunk; j++ {
+				if sample >= n {
+					return offsets
+				}
+				offsets = append(offsets, offset)
+				offset += int64(st.size(sample))
+				sample++
+			}
+		}
+	}
+
+	return offsets
+}
+
+// sampleTimes returns the start time of each sample in timescale units.
+func (st *sampleTable) sampleTimes() []int64 {
+	var (
+		times []int64
+		t     int64
+		n     = int(st.numSamples)
+	)
+	for _, e := range st.timeToSample {
+		for i := uint32(0); i < e.count && len(times) < n; i++ {
+			times = append(times, t)
+			t += int64(e.delta)
+		}
+	}
+	for len(times) < n {
+		times = append(times, t)
+	}
+	return times
+}
+
+func (st *sampleTable) duration(t int64) time.Duration {
+	if st.timescale == 0 {
+		return 0
+	}
+	// in floating point, since t * time.Second overflows int64 after a few
+	// days at common timescales
+	return time.Duration(float64(t) / float64(st.timescale) * float64(time.Second))
+}
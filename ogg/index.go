@@ -0,0 +1,108 @@
+package ogg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// PageEntry locates a page in a stream.
+type PageEntry struct {
+	// GranulePos is the granule position of the page, which for audio is
+	// usually the number of samples up to the end of the last packet that
+	// finishes on the page.
+	GranulePos int64
+	// Offset is the position of the start of the page in the stream.
+	Offset int64
+}
+
+// ScanPages reads the page headers of r from the current position to the end
+// and returns where each page is, without reading the page data. Pages that
+// no packet finishes on (granule position -1) are left out, and so is a
+// truncated page at the end.
+func ScanPages(r io.ReadSeeker) ([]PageEntry, error) {
+	offset, err := r.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		pages      []PageEntry
+		magic      = make([]byte, len(CapturePattern))
+		h          Header
+		segmentTab = make([]byte, 255)
+	)
+	for {
+		_, err = io.ReadFull(r, magic)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return pages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if string(magic) != CapturePattern {
+			return nil, ErrBadHeader
+		}
+
+		err = binary.Read(r, binary.LittleEndian, &h)
+		if err == nil {
+			_, err = io.ReadFull(r, segmentTab[:h.SegmentCount])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return pages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		pageSize := int64(0)
+		for _, l := range segmentTab[:h.SegmentCount] {
+			pageSize += int64(l)
+		}
+		next, err := r.Seek(pageSize, os.SEEK_CUR)
+		if err != nil {
+			return nil, err
+		}
+
+		if h.GranulePos != -1 {
+			pages = append(pages, PageEntry{h.GranulePos, offset})
+		}
+		offset = next
+	}
+}
+
+// SkipHeaders discards whole pages from r until the first n packets of the
+// stream have been read, such as the header packets of a codec that starts
+// its audio on a new page, as Vorbis and Opus do. It peeks at each page
+// before discarding it, so r is left at the start of the next page.
+func SkipHeaders(r *bufio.Reader, n int) error {
+	for n > 0 {
+		b, err := r.Peek(len(CapturePattern) + headerSize)
+		if err != nil {
+			return err
+		}
+		if string(b[:len(CapturePattern)]) != CapturePattern {
+			return ErrBadHeader
+		}
+		segments := int(b[len(b)-1])
+		segmentTab, err := r.Peek(len(b) + segments)
+		if err != nil {
+			return err
+		}
+
+		pageSize := len(segmentTab)
+		for _, l := range segmentTab[len(b):] {
+			pageSize += int(l)
+			// a lacing value under 255 ends a packet
+			if l < 255 {
+				n--
+			}
+		}
+		_, err = r.Discard(pageSize)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -15,9 +15,9 @@ package ogg
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
-	"hash/crc32"
 	"io"
 )
 
@@ -28,7 +28,13 @@ const (
 
 var (
 	ErrBadHeader = errors.New("ogg: malformed header")
-	crcTable     = crc32.MakeTable(CRC32Polynomial)
+	// ErrTruncatedPage is returned by NextPage when the stream ends partway
+	// through a page.
+	ErrTruncatedPage = errors.New("ogg: truncated page at end of stream")
+	// ErrBadCRC is returned by NextPage when checking checksums and a page
+	// doesn't match its own.
+	ErrBadCRC = errors.New("ogg: page checksum mismatch")
+	crcTable  = makeCRCTable()
 )
 
 type Header struct {
@@ -41,10 +47,13 @@ type Header struct {
 	SegmentCount       uint8
 }
 
+// headerSize is the size of Header as stored, after the capture pattern.
+const headerSize = 23
+
 const (
-	headerTypeContinued = 1 << 1
-	headerTypeBOS       = 1 << 2
-	headerTypeEOS       = 1 << 3
+	headerTypeContinued = 1 << 0
+	headerTypeBOS       = 1 << 1
+	headerTypeEOS       = 1 << 2
 )
 
 type Page struct {
@@ -62,6 +71,11 @@ func Decode(r io.Reader) io.Reader {
 }
 
 type Reader struct {
+	// CheckCRC makes NextPage, and so Read, check the checksum of each page
+	// and return ErrBadCRC for a page that doesn't match. The page is
+	// consumed, so the next call goes on to the page after it.
+	CheckCRC bool
+
 	r *bufio.Reader
 	// page is the current page
 	validPage  bool
@@ -70,6 +84,21 @@ type Reader struct {
 	buf        []byte
 	segmentTab []byte
 	h          Header
+
+	// spare is read into and then swapped with buf, so that the current page
+	// survives a truncated one
+	spare []byte
+	// pos is the number of bytes consumed from the stream
+	pos int64
+
+	// lacing is the segment table of the current page, and seg the next
+	// segment of it for ReadPacketInto
+	lacing []byte
+	seg    int
+	// packet holds a packet that didn't fit the buffer given to
+	// ReadPacketInto until it is asked for again, if pending is set
+	packet  []byte
+	pending bool
 }
 
 func NewReader(r io.Reader) *Reader {
@@ -89,14 +118,11 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 	for n < len(p) {
 		// Decode a new page from the stream if this is the first read or we've
 		// exhausted the current page.
-		if !r.validPage || r.ptr >= len(r.page.Data)-1 {
+		if !r.validPage || r.ptr >= len(r.page.Data) {
 			var page *Page
 			page, err = r.NextPage()
-			if err != nil {
-				if page == nil {
-					return n, io.EOF
-				}
-				return
+			if err != nil || page == nil {
+				return n, io.EOF
 			}
 		}
 
@@ -115,9 +141,10 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 }
 
 // NextPage decodes and returns a page from the Ogg stream, and any decoding
-// error occurred. It only returns an EOF error if an unexpected EOF occurred
-// in the middle of a page. If the last page has already been read out, both
-// return values will be nil.
+// error occurred. If the last page has already been read out, both return
+// values will be nil. If the stream ends partway through a page, as happens
+// with files that were cut off, it returns ErrTruncatedPage, and Page still
+// returns the last complete page.
 //
 // Page data is only valid until the next call to NextPage.
 func (r *Reader) NextPage() (*Page, error) {
@@ -127,27 +154,27 @@ func (r *Reader) NextPage() (*Page, error) {
 		if err == io.EOF {
 			return nil, nil
 		}
-		r.validPage = false
-		return nil, err
+		return nil, r.pageError(err)
 	}
 
-	err = binary.Read(r.r, binary.LittleEndian, &r.page.Header)
+	var h Header
+	err = binary.Read(r.r, binary.LittleEndian, &h)
 	if err != nil {
-		r.validPage = false
-		return nil, err
+		return nil, r.pageError(err)
 	}
+	r.pos += int64(binary.Size(h))
 
 	var segmentTab []byte
-	if r.segmentTab == nil || len(r.segmentTab) < int(r.page.Header.SegmentCount) {
-		r.segmentTab = make([]byte, r.page.Header.SegmentCount)
+	if r.segmentTab == nil || len(r.segmentTab) < int(h.SegmentCount) {
+		r.segmentTab = make([]byte, h.SegmentCount)
 		segmentTab = r.segmentTab
 	} else {
-		segmentTab = r.segmentTab[:r.page.Header.SegmentCount]
+		segmentTab = r.segmentTab[:h.SegmentCount]
 	}
-	_, err = io.ReadFull(r.r, segmentTab)
+	n, err := io.ReadFull(r.r, segmentTab)
+	r.pos += int64(n)
 	if err != nil {
-		r.validPage = false
-		return nil, err
+		return nil, r.pageError(err)
 	}
 
 	pageSize := 0
@@ -157,16 +184,22 @@ func (r *Reader) NextPage() (*Page, error) {
 
 	// Only allocate a new buffer if we need more space
 	var buf []byte
-	if r.buf == nil || len(r.buf) < pageSize {
-		r.buf = make([]byte, uint(pageSize))
-		buf = r.buf
+	if r.spare == nil || len(r.spare) < pageSize {
+		r.spare = make([]byte, uint(pageSize))
+		buf = r.spare
 	} else {
-		buf = r.buf[:pageSize]
+		buf = r.spare[:pageSize]
 	}
-	_, err = io.ReadFull(r.r, buf)
+	n, err = io.ReadFull(r.r, buf)
+	r.pos += int64(n)
 	if err != nil {
+		return nil, r.pageError(err)
+	}
+	r.buf, r.spare = r.spare, r.buf
+
+	if r.CheckCRC && pageChecksum(h, segmentTab, buf) != h.PageChecksum {
 		r.validPage = false
-		return nil, err
+		return nil, ErrBadCRC
 	}
 
 	/*
@@ -180,20 +213,155 @@ func (r *Reader) NextPage() (*Page, error) {
 	*/
 
 	//page := &Page{h, segments, r.buf[:pageSize]}
+	r.page.Header = h
 	r.page.Data = buf
 	r.validPage = true
 	//page := &Page{h, buf}
 	//r.page = page
 	r.ptr = 0
+	r.lacing = append(r.lacing[:0], segmentTab...)
+	r.seg = 0
 	return &r.page, nil
 }
 
+// ReadPacketInto reads the next packet of the stream into buf, reassembling
+// it from the pages it spans, and returns its size. If it doesn't fit, it
+// returns the size needed along with io.ErrShortBuffer, and the packet is kept
+// for the next call, which can be given a buffer big enough. Once a buffer has
+// grown to fit the largest packet, reading packets into it allocates nothing.
+// At the end of the stream it returns io.EOF, or io.ErrUnexpectedEOF if the
+// stream ends partway through a packet.
+//
+// Only the first len(buf) bytes of buf are written to, and the caller may
+// reuse it as soon as ReadPacketInto returns. If the first page read has
+// the end of a packet that started before it, as when the Reader is made
+// partway through a stream, that part of a packet is skipped.
+//
+// ReadPacketInto and NextPacket share their position in the stream with
+// NextPage, which moves on to the start of the next page, and Read, which
+// ignores packet boundaries, so reading packets shouldn't be mixed with
+// either.
+func (r *Reader) ReadPacketInto(buf []byte) (int, error) {
+	if r.pending {
+		if len(buf) < len(r.packet) {
+			return len(r.packet), io.ErrShortBuffer
+		}
+		r.pending = false
+		return copy(buf, r.packet), nil
+	}
+
+	var (
+		p       = buf[:0]
+		started bool
+		// spilled is whether the packet has outgrown buf and is being
+		// put together in r.packet instead
+		spilled bool
+	)
+	for {
+		if !r.validPage || r.seg >= len(r.lacing) {
+			page, err := r.NextPage()
+			if err != nil {
+				return 0, err
+			}
+			if page == nil {
+				if started {
+					return 0, io.ErrUnexpectedEOF
+				}
+				return 0, io.EOF
+			}
+			if !started && page.HeaderType&headerTypeContinued != 0 {
+				r.skipContinuation()
+				continue
+			}
+		}
+
+		l := int(r.lacing[r.seg])
+		r.seg++
+		data := r.page.Data[r.ptr : r.ptr+l]
+		r.ptr += l
+		started = true
+
+		if !spilled && len(p)+l > len(buf) {
+			r.packet = append(r.packet[:0], p...)
+			p = r.packet
+			spilled = true
+		}
+		p = append(p, data...)
+
+		// a segment of less than 255 bytes ends the packet
+		if l < 255 {
+			break
+		}
+	}
+
+	if spilled {
+		r.packet = p
+		r.pending = true
+		return len(p), io.ErrShortBuffer
+	}
+	return len(p), nil
+}
+
+// NextPacket is like ReadPacketInto, but returns the packet in a newly
+// allocated slice, which the caller may keep.
+func (r *Reader) NextPacket() ([]byte, error) {
+	n, err := r.ReadPacketInto(nil)
+	if err == io.ErrShortBuffer {
+		p := make([]byte, n)
+		_, err = r.ReadPacketInto(p)
+		return p, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte{}, nil
+}
+
+// skipContinuation skips the segments at the start of the current page that
+// finish a packet from before it.
+func (r *Reader) skipContinuation() {
+	for r.seg < len(r.lacing) {
+		l := int(r.lacing[r.seg])
+		r.seg++
+		r.ptr += l
+		if l < 255 {
+			return
+		}
+	}
+}
+
+// pageError turns an unexpected EOF partway through a page into
+// ErrTruncatedPage, keeping the last page. Any other error invalidates it.
+func (r *Reader) pageError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncatedPage
+	}
+	r.validPage = false
+	return err
+}
+
+// Position returns the number of bytes of the underlying stream that have been
+// decoded, counting from where it was when the Reader was made. Between calls
+// to NextPage, it is the offset of the next page.
+func (r *Reader) Position() int64 { return r.pos }
+
+// Page returns the page most recently decoded, either by NextPage or by Read,
+// or nil if there hasn't been one. Once NextPage has returned nil at the end
+// of the stream, Page returns the last page of the stream.
+func (r *Reader) Page() *Page {
+	if !r.validPage {
+		return nil
+	}
+	return &r.page
+}
+
 // capture should ensure that there is an 'OggS' in the stream. If seek is true
 // then it should read forward and look for one.
 func (r *Reader) capture(seek bool) error {
 	// TODO: make it actually seek
 	buf := make([]byte, 4)
-	_, err := io.ReadFull(r.r, buf)
+	n, err := io.ReadFull(r.r, buf)
+	r.pos += int64(n)
 	if err != nil {
 		return err
 	}
@@ -204,3 +372,41 @@ func (r *Reader) capture(seek bool) error {
 
 	return nil
 }
+
+// makeCRCTable makes the table for the page checksum, which is CRC-32 with
+// the polynomial CRC32Polynomial, unlike the usual one unreflected, and with
+// no initial value or final XOR.
+func makeCRCTable() *[256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ CRC32Polynomial
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return &t
+}
+
+func updateCRC(crc uint32, b []byte) uint32 {
+	for _, c := range b {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^c]
+	}
+	return crc
+}
+
+// pageChecksum computes the checksum of a page, which covers all of it with
+// the checksum field itself set to 0.
+func pageChecksum(h Header, segmentTab, data []byte) uint32 {
+	h.PageChecksum = 0
+	var b bytes.Buffer
+	b.WriteString(CapturePattern)
+	binary.Write(&b, binary.LittleEndian, h)
+	crc := updateCRC(0, b.Bytes())
+	crc = updateCRC(crc, segmentTab)
+	return updateCRC(crc, data)
+}
@@ -0,0 +1,127 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"ktkr.us/pkg/sound/internal/fixture"
+)
+
+func TestPosition(t *testing.T) {
+	pages := []string{fixture.OggPage(0, "first"), fixture.OggPage(1, "second page"), fixture.OggPage(2, "")}
+	var file string
+	for _, p := range pages {
+		file += p
+	}
+
+	r := NewReader(bytes.NewReader([]byte(file)))
+	var offset int64
+	for i, p := range pages {
+		if pos := r.Position(); pos != offset {
+			t.Errorf("before page %d: got %d, expected %d", i, pos, offset)
+		}
+		page, err := r.NextPage()
+		if err != nil || page == nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		offset += int64(len(p))
+	}
+	if pos := r.Position(); pos != int64(len(file)) {
+		t.Errorf("at the end: got %d, expected %d", pos, len(file))
+	}
+}
+
+func TestCheckCRC(t *testing.T) {
+	file := fixture.MakeOggOpus(48000, 2, 312)
+	// corrupt the OpusTags packet on the second page
+	bad := append([]byte(nil), file...)
+	i := bytes.Index(bad, []byte("OpusTags"))
+	bad[i+len("OpusTags")]++
+
+	for _, test := range []struct {
+		name string
+		file []byte
+		errs []error
+	}{
+		{"good", file, []error{nil, nil, nil}},
+		{"bad", bad, []error{nil, ErrBadCRC, nil}},
+	} {
+		r := NewReader(bytes.NewReader(test.file))
+		r.CheckCRC = true
+		for j, expected := range test.errs {
+			if _, err := r.NextPage(); err != expected {
+				t.Errorf("%s page %d: got %v, expected %v", test.name, j, err, expected)
+			}
+		}
+	}
+}
+
+func TestLastGranulePos(t *testing.T) {
+	// longer than the part that is searched
+	file := fixture.MakeOggVorbis(44100*5000, 44100, 2, 128000)
+	// a truncated page at the end is skipped
+	truncated := append(file[:len(file):len(file)], fixture.OggPage(-1, "")...)
+	truncated = append(truncated, fixture.OggPage(1, "cut off")[:30]...)
+	// but the search stops after the largest possible page
+	junk := append(file[:len(file):len(file)], make([]byte, maxPageSize)...)
+
+	for _, test := range []struct {
+		name string
+		file []byte
+		pos  int64
+		err  error
+	}{
+		{"whole", file, 44100 * 5000, nil},
+		{"truncated", truncated, 44100 * 5000, nil},
+		{"empty", nil, 0, ErrNoGranulePos},
+		{"junk", junk, 0, ErrNoGranulePos},
+	} {
+		pos, err := LastGranulePos(bytes.NewReader(test.file), int64(len(test.file)))
+		if pos != test.pos || err != test.err {
+			t.Errorf("%s: got %d, %v, expected %d, %v", test.name, pos, err, test.pos, test.err)
+		}
+	}
+}
+
+func TestReadPacketInto(t *testing.T) {
+	// a packet of 300 bytes split over two pages, then packets of 10 and 0
+	// bytes, and one cut off by the end of the stream
+	file := fixture.OggLacedPage(0, 255) + fixture.OggLacedPage(headerTypeContinued, 45, 10, 0, 255)
+
+	r := NewReader(bytes.NewReader([]byte(file)))
+	buf := make([]byte, 100)
+	n, err := r.ReadPacketInto(buf)
+	if n != 300 || err != io.ErrShortBuffer {
+		t.Fatalf("got %d, %v, expected 300, io.ErrShortBuffer", n, err)
+	}
+	buf = make([]byte, n)
+	for _, expected := range []int{300, 10, 0} {
+		n, err = r.ReadPacketInto(buf)
+		if n != expected || err != nil {
+			t.Fatalf("got %d, %v, expected %d", n, err, expected)
+		}
+	}
+	if _, err = r.ReadPacketInto(buf); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, expected io.ErrUnexpectedEOF", err)
+	}
+
+	// starting on the second page skips the end of the first packet
+	r = NewReader(bytes.NewReader([]byte(file[len(fixture.OggLacedPage(0, 255)):])))
+	p, err := r.NextPacket()
+	if err != nil || len(p) != 10 || p[0] != 1 {
+		t.Errorf("got %v, %v", p, err)
+	}
+
+	file = string(fixture.MakeOggOpus(48000, 2, 312))
+	r = NewReader(bytes.NewReader([]byte(file)))
+	for _, prefix := range []string{"OpusHead", "OpusTags", "\x00"} {
+		p, err := r.NextPacket()
+		if err != nil || !bytes.HasPrefix(p, []byte(prefix)) {
+			t.Errorf("got %q, %v, expected %q", p, err, prefix)
+		}
+	}
+	if _, err := r.NextPacket(); err != io.EOF {
+		t.Errorf("got %v, expected io.EOF", err)
+	}
+}
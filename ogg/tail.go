@@ -0,0 +1,106 @@
+package ogg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrNoGranulePos is returned by LastGranulePos when no complete page in the
+// stream has a granule position.
+var ErrNoGranulePos = errors.New("ogg: no page with a granule position")
+
+// maxPageSize is the size of the largest possible page: a full header and
+// segment table, and 255 segments of 255 bytes.
+const maxPageSize = len(CapturePattern) + headerSize + 255 + 255*255
+
+// LastGranulePos finds the granule position of the last complete page of the
+// stream that has one, which for audio is usually the total number of
+// samples. It reads backwards from the end of r, which is size bytes long,
+// and so reads only the tail of the stream, unlike walking it with NextPage.
+// Pages are only taken if their checksums match, so that the capture pattern
+// turning up in the middle of a page isn't mistaken for the start of one.
+//
+// Only the last maxPageSize bytes are searched, which always hold the start
+// of the last page. If no page there has a granule position, as when the
+// stream ends in junk or in pages that finish no packet, ErrNoGranulePos is
+// returned rather than reading back through the whole stream.
+func LastGranulePos(r io.ReaderAt, size int64) (int64, error) {
+	start := size - int64(maxPageSize)
+	if start < 0 {
+		start = 0
+	}
+	b := make([]byte, size-start)
+	_, err := r.ReadAt(b, start)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	for i := bytes.LastIndex(b, []byte(CapturePattern)); i >= 0; i = bytes.LastIndex(b[:i], []byte(CapturePattern)) {
+		h, ok, err := readPageAt(r, start+int64(i), size)
+		if err != nil {
+			return 0, err
+		}
+		if ok && h.GranulePos != -1 {
+			return h.GranulePos, nil
+		}
+	}
+	return 0, ErrNoGranulePos
+}
+
+// ReadHeadersAt reads the header packets at the start of r, which is size
+// bytes long, by calling readHeaders, and then returns the result of
+// LastGranulePos. It is the common part of the codec packages'
+// DecodeMetaReaderAt functions, which decide for themselves what to do about
+// ErrNoGranulePos.
+func ReadHeadersAt(r io.ReaderAt, size int64, readHeaders func(*Reader) error) (int64, error) {
+	err := readHeaders(NewReader(io.NewSectionReader(r, 0, size)))
+	if err != nil {
+		return 0, err
+	}
+	return LastGranulePos(r, size)
+}
+
+// readPageAt reads the page at offset in r, reporting whether it is whole
+// and its checksum matches.
+func readPageAt(r io.ReaderAt, offset, size int64) (Header, bool, error) {
+	var h Header
+	head := make([]byte, len(CapturePattern)+headerSize)
+	if offset+int64(len(head)) > size {
+		return h, false, nil
+	}
+	_, err := r.ReadAt(head, offset)
+	if err != nil {
+		return h, false, err
+	}
+	binary.Read(bytes.NewReader(head[len(CapturePattern):]), binary.LittleEndian, &h)
+	if h.Version != 0 {
+		return h, false, nil
+	}
+	offset += int64(len(head))
+
+	segmentTab := make([]byte, h.SegmentCount)
+	if offset+int64(len(segmentTab)) > size {
+		return h, false, nil
+	}
+	_, err = r.ReadAt(segmentTab, offset)
+	if err != nil {
+		return h, false, err
+	}
+	offset += int64(len(segmentTab))
+
+	var pageSize int64
+	for _, l := range segmentTab {
+		pageSize += int64(l)
+	}
+	if offset+pageSize > size {
+		return h, false, nil
+	}
+	data := make([]byte, pageSize)
+	_, err = r.ReadAt(data, offset)
+	if err != nil && !(err == io.EOF && pageSize == 0) {
+		return h, false, err
+	}
+	return h, pageChecksum(h, segmentTab, data) == h.PageChecksum, nil
+}
@@ -0,0 +1,259 @@
+// Package opus provides facilities for reading the headers of Opus streams in
+// an Ogg container.
+//
+// An Ogg Opus stream starts with two header packets, each on its own page: the
+// identification header "OpusHead", and the comment header "OpusTags", which
+// is laid out like a Vorbis comment header without the framing bit. Granule
+// positions always count samples at 48 kHz, whatever the sample rate of the
+// original input.
+package opus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/ogg"
+	"ktkr.us/pkg/sound/vorbis"
+)
+
+func init() {
+	sound.RegisterFormat("Ogg Opus", "OggS????????????????????????OpusHead", nil, DecodeTags, DecodeMeta)
+	sound.RegisterMetaReaderAt("Ogg Opus", DecodeMetaReaderAt)
+	// the audio starts on the page after the identification and comment
+	// headers
+	sound.RegisterAudioStream("Ogg Opus", func(r *bufio.Reader) error {
+		return ogg.SkipHeaders(r, 2)
+	})
+	sound.RegisterCapabilities("Ogg Opus", sound.Capabilities{
+		SupportsPictures:   true,
+		SupportsReplayGain: true,
+		SupportsMultiValue: true,
+	})
+}
+
+const (
+	headMagic = "OpusHead"
+	tagsMagic = "OpusTags"
+
+	// SampleRate is the rate that Opus always decodes at, and that granule
+	// positions count in.
+	SampleRate = 48000
+
+	// r128Offset is the difference in dB between the ReplayGain reference
+	// level of -18 LUFS and the EBU R128 level of -23 LUFS that Opus gains
+	// normalize to.
+	r128Offset = 5
+)
+
+var (
+	ErrBadHeader = errors.New("opus: malformed OpusHead header")
+	ErrBadTags   = errors.New("opus: malformed OpusTags header")
+)
+
+// header is the fixed part of the identification header. A channel mapping
+// table follows it unless MappingFamily is 0.
+type header struct {
+	Magic           [8]byte
+	Version         uint8
+	Channels        uint8
+	PreSkip         uint16
+	InputSampleRate uint32
+	// OutputGain is in dB as Q7.8 fixed point.
+	OutputGain    int16
+	MappingFamily uint8
+}
+
+// OutputGainDB returns the gain in dB that the header says to apply to the
+// decoded audio. Decoders apply it as a matter of course.
+func (h header) OutputGainDB() float64 { return float64(h.OutputGain) / 256 }
+
+// Tags is the comment header of an Opus stream, along with the
+// identification header that comes before it.
+type Tags struct {
+	vorbis.Comment
+	header
+	vendor string
+}
+
+func (t *Tags) SampleRate() int   { return SampleRate }
+func (t *Tags) NumChannels() int  { return int(t.Channels) }
+func (t *Tags) TagFormat() string { return "OpusTags" }
+
+// Vendor returns the vendor string of the comment header, which names the
+// library that wrote it, such as "libopus 1.3.1".
+func (t *Tags) Vendor() string { return t.vendor }
+
+// ReplayGain converts the R128_TRACK_GAIN and R128_ALBUM_GAIN tags to
+// ReplayGain values.
+//
+// The R128 gains are relative to the audio as decoded, with the output gain
+// of the identification header already applied, and bring it to -23 LUFS.
+// ReplayGain's reference level is 5 dB louder, so 5 dB is added to each.
+// The output gain itself isn't counted again, as decoders always apply it;
+// a player that skips it must add OutputGainDB as well. Opus has no peak
+// values, so the peaks are always 0.
+func (t *Tags) ReplayGain() (sound.ReplayGain, bool) {
+	var rg sound.ReplayGain
+	rg.TrackGain, rg.HasTrack = r128Gain(t.Get("R128_TRACK_GAIN"))
+	rg.AlbumGain, rg.HasAlbum = r128Gain(t.Get("R128_ALBUM_GAIN"))
+	return rg, rg.HasTrack || rg.HasAlbum
+}
+
+// r128Gain parses a gain tag, which is a decimal Q7.8 fixed point number of
+// dB, and converts it to the ReplayGain reference level.
+func r128Gain(s string) (float64, bool) {
+	q, err := strconv.ParseInt(strings.TrimSpace(s), 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return float64(q)/256 + r128Offset, true
+}
+
+// DecodeTags decodes the comment header. The underlying type of the
+// sound.Tags returned will be (*Tags).
+func DecodeTags(rr io.Reader) (sound.Tags, error) {
+	h, vendor, comment, err := readHeaders(ogg.NewReader(rr))
+	if err != nil {
+		return nil, err
+	}
+	return &Tags{comment, h, vendor}, nil
+}
+
+type meta struct {
+	header
+	vorbis.Comment
+	numSamples int64
+	fsize      int64
+}
+
+func (m *meta) Duration() time.Duration {
+	// Avoid overflowing int64, which numSamples * time.Second does after
+	// about 53 hours
+	return time.Duration(float64(m.numSamples) / SampleRate * float64(time.Second))
+}
+
+func (m *meta) String() string { return sound.Summary(m.Comment, m) }
+
+func (m *meta) NumChannels() int    { return int(m.Channels) }
+func (m *meta) SampleRate() int     { return SampleRate }
+func (m *meta) TotalSamples() int64 { return m.numSamples }
+
+// InputSampleRate returns the sample rate of the audio before it was encoded,
+// which is only informational, or 0 if it wasn't given.
+func (m *meta) InputSampleRate() int { return int(m.header.InputSampleRate) }
+
+// PreSkip returns the number of samples at 48 kHz to be discarded from the
+// start of the decoded audio.
+func (m *meta) PreSkip() int { return int(m.header.PreSkip) }
+
+// BitRate returns the average bitrate over the whole file, as Opus streams
+// don't give one.
+func (m *meta) BitRate() int {
+	if m.fsize <= 0 || m.numSamples <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(m.fsize) * 8 * SampleRate / float64(m.numSamples)))
+}
+
+// DecodeMeta decodes the identification header, and reads to the last page
+// for the length of the stream. The underlying type of the sound.Metadata
+// returned implements sound.SampleCounter, along with InputSampleRate,
+// PreSkip and OutputGainDB methods.
+func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
+	r := ogg.NewReader(rr)
+	h, _, comment, err := readHeaders(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		page, err := r.NextPage()
+		if err == ogg.ErrTruncatedPage {
+			// go by the last complete page
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if page == nil {
+			break
+		}
+	}
+
+	m := &meta{header: h, Comment: comment, fsize: fsize}
+	if page := r.Page(); page != nil && page.GranulePos > int64(h.PreSkip) {
+		m.numSamples = page.GranulePos - int64(h.PreSkip)
+	}
+	return m, nil
+}
+
+// DecodeMetaReaderAt is like DecodeMeta, but reads the last page by going
+// back from the end of ra, which is size bytes long, instead of reading
+// through the whole stream.
+func DecodeMetaReaderAt(ra io.ReaderAt, size int64) (sound.Metadata, error) {
+	var (
+		h       header
+		comment vorbis.Comment
+	)
+	pos, err := ogg.ReadHeadersAt(ra, size, func(r *ogg.Reader) (err error) {
+		h, _, comment, err = readHeaders(r)
+		return err
+	})
+	if err != nil && err != ogg.ErrNoGranulePos {
+		return nil, err
+	}
+
+	m := &meta{header: h, Comment: comment, fsize: size}
+	if err == nil && pos > int64(h.PreSkip) {
+		m.numSamples = pos - int64(h.PreSkip)
+	}
+	return m, nil
+}
+
+// readHeaders reads the identification and comment headers.
+func readHeaders(r *ogg.Reader) (header, string, vorbis.Comment, error) {
+	var h header
+	err := binary.Read(r, binary.LittleEndian, &h)
+	if err != nil {
+		return h, "", nil, errors.Wrap(err, "read OpusHead header")
+	}
+	if string(h.Magic[:]) != headMagic || h.Version>>4 != 0 || h.Channels == 0 {
+		return h, "", nil, ErrBadHeader
+	}
+
+	// The comment header starts on a new page, so the channel mapping table
+	// is skipped along with the rest of the first page.
+	_, err = r.NextPage()
+	if err != nil {
+		return h, "", nil, err
+	}
+
+	// read the packet whole so that ReadComment knows how much it holds
+	packet, err := r.NextPacket()
+	if err != nil {
+		return h, "", nil, errors.Wrap(err, "read OpusTags packet")
+	}
+	pr := bytes.NewReader(packet)
+	magic := make([]byte, len(tagsMagic))
+	_, err = io.ReadFull(pr, magic)
+	if err != nil {
+		return h, "", nil, errors.Wrap(err, "read OpusTags header")
+	}
+	if string(magic) != tagsMagic {
+		return h, "", nil, ErrBadTags
+	}
+	vendor, comment, err := vorbis.ReadComment(pr)
+	if err != nil {
+		return h, "", nil, err
+	}
+	return h, vendor, comment, nil
+}
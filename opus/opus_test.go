@@ -0,0 +1,66 @@
+package opus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/fixture"
+)
+
+func comment(s string) string {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(len(s)))
+	b.WriteString(s)
+	return b.String()
+}
+
+func TestReplayGain(t *testing.T) {
+	var head bytes.Buffer
+	binary.Write(&head, binary.LittleEndian, header{
+		Version:         1,
+		Channels:        2,
+		PreSkip:         312,
+		InputSampleRate: 44100,
+		OutputGain:      -256,
+	})
+	copy(head.Bytes(), headMagic)
+	// two bytes of channel mapping table that should be skipped
+	head.WriteString("\x00\x01")
+
+	tags := tagsMagic + comment("vendor") + "\x02\x00\x00\x00" +
+		comment("R128_TRACK_GAIN=-2560") + comment("TITLE=title")
+	file := []byte(fixture.OggPage(0, head.String()) + fixture.OggPage(0, tags) + fixture.OggPage(SampleRate*2+312, "audio"))
+
+	st, _, err := sound.DecodeTags(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Title() != "title" {
+		t.Errorf("got title %q", st.Title())
+	}
+	rg, ok := st.(sound.ReplayGainer).ReplayGain()
+	if !ok || !rg.HasTrack || rg.HasAlbum || rg.TrackGain != -5 {
+		t.Errorf("got %+v, %t", rg, ok)
+	}
+	if g := st.(*Tags).OutputGainDB(); g != -1 {
+		t.Errorf("got output gain %v dB", g)
+	}
+
+	m, _, err := sound.DecodeMeta(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Duration() != 2*time.Second || m.NumChannels() != 2 || m.SampleRate() != SampleRate {
+		t.Errorf("got %v, %d channels at %d Hz", m.Duration(), m.NumChannels(), m.SampleRate())
+	}
+}
+
+func TestLongDuration(t *testing.T) {
+	m := &meta{numSamples: SampleRate * 3600 * 1000}
+	if d := m.Duration(); d != 1000*time.Hour {
+		t.Errorf("got %v", d)
+	}
+}
@@ -0,0 +1,79 @@
+package sound
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// ReadSize fills in the Width, Height and ColorDepth of a picture from the
+// header of its image data, for pictures from formats that don't record them,
+// such as ID3v2 and MP4. Only the header is read, so it is much cheaper than
+// decoding the image. It understands PNG, JPEG and GIF, and reports whether
+// it found the size. A size that was already set is left alone.
+func (p *Picture) ReadSize() bool {
+	if p.Width != 0 && p.Height != 0 {
+		return true
+	}
+	var ok bool
+	switch b := p.Data; {
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		p.Width, p.Height, p.ColorDepth, ok = pngSize(b)
+	case bytes.HasPrefix(b, []byte("\xff\xd8")):
+		p.Width, p.Height, p.ColorDepth, ok = jpegSize(b)
+	case bytes.HasPrefix(b, []byte("GIF8")):
+		p.Width, p.Height, p.ColorDepth, ok = gifSize(b)
+	}
+	return ok
+}
+
+// pngSize reads the IHDR chunk, which must come first.
+func pngSize(b []byte) (w, h, depth int, ok bool) {
+	if len(b) < 26 || string(b[12:16]) != "IHDR" {
+		return 0, 0, 0, false
+	}
+	// the number of samples per pixel, by color type
+	samples := map[byte]int{0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[b[25]]
+	return int(binary.BigEndian.Uint32(b[16:])), int(binary.BigEndian.Uint32(b[20:])), int(b[24]) * samples, true
+}
+
+// jpegSize looks through the markers for a start of frame.
+func jpegSize(b []byte) (w, h, depth int, ok bool) {
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return 0, 0, 0, false
+		}
+		marker := b[i+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			i++
+			continue
+		case marker == 0x01, marker >= 0xD0 && marker <= 0xD9:
+			// markers without a length
+			i += 2
+			continue
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			if i+10 > len(b) {
+				return 0, 0, 0, false
+			}
+			// precision, height, width, number of components
+			h := int(binary.BigEndian.Uint16(b[i+5:]))
+			w := int(binary.BigEndian.Uint16(b[i+7:]))
+			return w, h, int(b[i+4]) * int(b[i+9]), true
+		}
+		i += 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+	}
+	return 0, 0, 0, false
+}
+
+// gifSize reads the logical screen descriptor. The color depth is that of the
+// global color table, or 0 if there isn't one.
+func gifSize(b []byte) (w, h, depth int, ok bool) {
+	if len(b) < 11 {
+		return 0, 0, 0, false
+	}
+	if b[10]&0x80 != 0 {
+		depth = int(b[10]&7) + 1
+	}
+	return int(binary.LittleEndian.Uint16(b[6:])), int(binary.LittleEndian.Uint16(b[8:])), depth, true
+}
@@ -6,20 +6,32 @@ package sound
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"io"
 	"os"
+	"sync"
 	"time"
 )
 
 var (
 	ErrFormat = errors.New("sound: unknown format")
+	// ErrNoTags is returned by tag decoders when the file is well-formed but
+	// has no tag block at all, as opposed to an empty one.
+	ErrNoTags = errors.New("sound: no tags present")
 )
 
-// TODO: album art?
-
 type Sound interface{}
 
+// AudioReader is implemented by Sounds whose audio can be read as PCM.
+type AudioReader interface {
+	SampleRate() int
+	Channels() int
+	// Read reads up to len(p) samples, interleaved by channel and scaled to
+	// the range [-1, 1]. It returns io.EOF at the end of the audio.
+	Read(p []float32) (n int, err error)
+}
+
 type Metadata interface {
 	Duration() time.Duration
 	NumChannels() int // Number of audio channels.
@@ -29,6 +41,161 @@ type Metadata interface {
 	SampleRate() int // Number of samples per second.
 }
 
+// SampleCounter is implemented by Metadata that can report the exact length
+// of the stream, free of the rounding in Duration.
+type SampleCounter interface {
+	// TotalSamples returns the number of samples per channel, or 0 if it
+	// isn't known.
+	TotalSamples() int64
+}
+
+// ExactDurationMetadata is implemented by Metadata that can tell whether
+// their duration was calculated exactly or estimated, for example from the
+// file size and bitrate.
+type ExactDurationMetadata interface {
+	DurationExact() bool
+}
+
+// LosslessMetadata is implemented by Metadata that can tell whether the
+// audio is stored losslessly, for formats that can hold either kind.
+type LosslessMetadata interface {
+	Lossless() bool
+}
+
+// Chapter is a titled section of a recording, such as a chapter of an
+// audiobook.
+type Chapter struct {
+	Start time.Duration
+	Title string
+}
+
+// Chapterer is implemented by values that can list the chapters of a
+// recording, in order of their start times.
+type Chapterer interface {
+	Chapters() []Chapter
+}
+
+// Picture is an image embedded in a file's tags, such as cover art.
+type Picture struct {
+	// MIMEType is the type of the image data, such as "image/jpeg".
+	MIMEType string
+	// Type is what the picture depicts, numbered as in ID3v2's APIC frame
+	// (and FLAC's PICTURE block), where 3 is the front cover.
+	Type        int
+	Description string
+	Data        []byte
+	// Width, Height and ColorDepth, in bits per pixel, are as recorded
+	// alongside the picture in formats that do so, such as FLAC's PICTURE
+	// block, or 0 otherwise. ReadSize finds them from the image data.
+	Width      int
+	Height     int
+	ColorDepth int
+}
+
+// Picturer is implemented by Tags that can hold embedded pictures.
+type Picturer interface {
+	Pictures() []Picture
+}
+
+// EncodingTags is implemented by Tags that record how the file was encoded.
+type EncodingTags interface {
+	// EncoderSettings returns the software and settings used to encode the
+	// file, such as "LAME 3.100 -V0".
+	EncoderSettings() string
+	// EncodingTime returns the time the file was encoded, or the zero time
+	// if it isn't known.
+	EncodingTime() time.Time
+}
+
+// StreamInfoTags is implemented by Tags that also carry basic information
+// about the audio, for formats where it is stored right next to the tags and
+// can be read at no extra cost.
+type StreamInfoTags interface {
+	SampleRate() int
+	NumChannels() int
+}
+
+// MusicBrainzTags is implemented by Tags that can carry MusicBrainz
+// identifiers. The map is keyed by the Vorbis comment names, such as
+// "MUSICBRAINZ_TRACKID" and "MUSICBRAINZ_ALBUMID", whatever the format.
+type MusicBrainzTags interface {
+	MusicBrainz() map[string]string
+}
+
+// ClassicalTags is implemented by Tags that can group tracks by work and
+// movement, as classical recordings are organized.
+type ClassicalTags interface {
+	Grouping() string
+	Work() string
+	MovementName() string
+	// Movement returns the movement number and the number of movements in
+	// the work, either of which may be 0 if unknown.
+	Movement() (n, total int)
+}
+
+// SortTags is implemented by Tags that can hold the forms of names to sort by,
+// such as "Beatles, The" for "The Beatles". Each method returns "" if the
+// field isn't set, in which case the name itself should be used.
+type SortTags interface {
+	SortTitle() string
+	SortArtist() string
+	SortAlbumArtist() string
+	SortAlbum() string
+	SortComposer() string
+}
+
+// SubtitleTags is implemented by Tags that can hold the subtitle of a track,
+// and that of the disc it is on, as box sets and deluxe editions use.
+type SubtitleTags interface {
+	Subtitle() string
+	SetSubtitle() string
+}
+
+// MultiValueTags is implemented by Tags that can hold more than one artist,
+// genre or composer, which the methods of Tags reduce to one. Each method
+// returns nil if the field isn't set.
+type MultiValueTags interface {
+	Artists() []string
+	Genres() []string
+	Composers() []string
+}
+
+// ReplayGain holds the loudness normalization values of a track. Gains are in
+// dB, to be applied to the decoded audio to bring it to the ReplayGain
+// reference level of 89 dB SPL (-18 LUFS). Peaks are the highest sample
+// amplitude, where 1 is full scale, or 0 if unknown.
+type ReplayGain struct {
+	TrackGain float64
+	TrackPeak float64
+	AlbumGain float64
+	AlbumPeak float64
+	// HasTrack and HasAlbum report whether the track and album values are
+	// set.
+	HasTrack bool
+	HasAlbum bool
+}
+
+// ReplayGainer is implemented by Tags that can carry loudness normalization
+// values. ReplayGain returns false if the tags have neither track nor album
+// values.
+type ReplayGainer interface {
+	ReplayGain() (ReplayGain, bool)
+}
+
+// FormatTags is implemented by Tags that can report the format and version
+// of the tag they were decoded from, such as "ID3v2.3", "ID3v1.1",
+// "VorbisComment", "MP4" or "APEv2".
+type FormatTags interface {
+	TagFormat() string
+}
+
+// KeyedTags is implemented by Tags that can list every key they hold, beyond
+// the fixed set covered by Tags. The keys are the format's own names, such as
+// ID3v2 frame IDs or Vorbis comment field names, and are sorted.
+type KeyedTags interface {
+	Keys() []string
+}
+
 type Tags interface {
 	Title() string
 	AlbumArtist() string
@@ -42,7 +209,10 @@ type Tags interface {
 	Notes() string
 }
 
-var formats []format
+var (
+	formatsMu sync.RWMutex
+	formats   []format
+)
 
 type format struct {
 	name       string
@@ -50,6 +220,13 @@ type format struct {
 	decode     func(io.Reader) (Sound, error)
 	decodeTags func(io.Reader) (Tags, error)
 	decodeMeta func(io.Reader, int64) (Metadata, error)
+
+	decodeMetaQuick    func(io.Reader, int64) (Metadata, error)
+	duration           func(io.Reader, int64) (time.Duration, error)
+	skipMetadata       func(*bufio.Reader) error
+	decodeAll          func(io.Reader, int64) (Metadata, Tags, error)
+	decodeMetaReaderAt func(io.ReaderAt, int64) (Metadata, error)
+	capabilities       Capabilities
 }
 
 // RegisterFormat lets the package know how to decode a sound file format
@@ -57,11 +234,134 @@ type format struct {
 // the the input as an io.Reader. In addition, the decodeMeta function
 // will get the filesize as an additional parameter to aid in calculating
 // duration, if the filesize can be calculated.
+//
+// RegisterFormat is safe to call concurrently, though it is usually called
+// from an init function.
 func RegisterFormat(name, magic string,
 	decode func(io.Reader) (Sound, error),
 	decodeTags func(io.Reader) (Tags, error),
 	decodeMeta func(io.Reader, int64) (Metadata, error)) {
-	formats = append(formats, format{name, magic, decode, decodeTags, decodeMeta})
+	formatsMu.Lock()
+	formats = append(formats, format{
+		name:       name,
+		magic:      magic,
+		decode:     decode,
+		decodeTags: decodeTags,
+		decodeMeta: decodeMeta,
+	})
+	formatsMu.Unlock()
+}
+
+// RegisterQuickMeta registers a faster alternative to the decodeMeta function
+// of the named format for DecodeMetaQuick to use. It should be called after
+// RegisterFormat.
+func RegisterQuickMeta(name string, decodeMetaQuick func(io.Reader, int64) (Metadata, error)) {
+	formatsMu.Lock()
+	for i := range formats {
+		if formats[i].name == name {
+			formats[i].decodeMetaQuick = decodeMetaQuick
+		}
+	}
+	formatsMu.Unlock()
+}
+
+// RegisterDuration registers a function for Duration to use for the named
+// format, which finds the duration without decoding anything else, such as
+// tags, that the decodeMeta function would. It should be called after
+// RegisterFormat.
+func RegisterDuration(name string, duration func(io.Reader, int64) (time.Duration, error)) {
+	formatsMu.Lock()
+	for i := range formats {
+		if formats[i].name == name {
+			formats[i].duration = duration
+		}
+	}
+	formatsMu.Unlock()
+}
+
+// RegisterAudioStream registers a function for AudioStream to use for the
+// named format, which discards the tags and other metadata at the start of
+// the stream, leaving it at the first byte of audio. It should be called
+// after RegisterFormat.
+func RegisterAudioStream(name string, skipMetadata func(*bufio.Reader) error) {
+	formatsMu.Lock()
+	for i := range formats {
+		if formats[i].name == name {
+			formats[i].skipMetadata = skipMetadata
+		}
+	}
+	formatsMu.Unlock()
+}
+
+// RegisterMetaAndTags registers a function for OpenFile to use for the named
+// format, which decodes the metadata and the tags in one pass, for formats
+// that keep them together. It returns nil Tags if there are none. It should
+// be called after RegisterFormat.
+func RegisterMetaAndTags(name string, decodeAll func(io.Reader, int64) (Metadata, Tags, error)) {
+	formatsMu.Lock()
+	for i := range formats {
+		if formats[i].name == name {
+			formats[i].decodeAll = decodeAll
+		}
+	}
+	formatsMu.Unlock()
+}
+
+// RegisterMetaReaderAt registers a function for DecodeMetaReaderAt to use for
+// the named format, which reads what it needs from near the end of the stream
+// directly, rather than reading through to it. It should be called after
+// RegisterFormat.
+func RegisterMetaReaderAt(name string, decodeMetaReaderAt func(io.ReaderAt, int64) (Metadata, error)) {
+	formatsMu.Lock()
+	for i := range formats {
+		if formats[i].name == name {
+			formats[i].decodeMetaReaderAt = decodeMetaReaderAt
+		}
+	}
+	formatsMu.Unlock()
+}
+
+// Capabilities says which of the optional features a format supports, so
+// that a program can decide what to offer for a file from its format name
+// alone, before decoding anything.
+type Capabilities struct {
+	// SupportsTags is whether the format has a tag decoder. It is set by
+	// FormatCapabilities from the registration, not by the format.
+	SupportsTags bool
+	// The rest are declared by the format with RegisterCapabilities, and
+	// say whether its Tags or Metadata implement the named interface.
+	SupportsPictures   bool // Picturer
+	SupportsChapters   bool // Chapterer
+	SupportsReplayGain bool // ReplayGainer
+	SupportsCuesheet   bool // Cuesheeter
+	SupportsMultiValue bool // MultiValueTags
+	// SupportsWriting is whether the format's Tags can be encoded back
+	// into a tag, as with the WriteTo method of ID3v2 tags.
+	SupportsWriting bool
+}
+
+// RegisterCapabilities declares the capabilities of the named format, to be
+// returned by FormatCapabilities. It should be called after RegisterFormat.
+func RegisterCapabilities(name string, c Capabilities) {
+	formatsMu.Lock()
+	for i := range formats {
+		if formats[i].name == name {
+			formats[i].capabilities = c
+		}
+	}
+	formatsMu.Unlock()
+}
+
+// FormatCapabilities returns the capabilities of the named format. A format
+// that isn't registered has none.
+func FormatCapabilities(name string) Capabilities {
+	f, ok := lookup(name)
+	if !ok {
+		return Capabilities{}
+	}
+	c := f.capabilities
+	c.SupportsTags = f.decodeTags != nil
+	return c
 }
 
 func Decode(r io.Reader) (Sound, string, error) {
@@ -69,41 +369,236 @@ func Decode(r io.Reader) (Sound, string, error) {
 }
 
 func DecodeMeta(r io.Reader) (Metadata, string, error) {
-	rr := bufio.NewReader(r)
+	rr := ensureBufioReader(r)
 
 	f := sniff(rr)
-	if f.decodeMeta == nil {
-		return nil, "", ErrFormat
+	return decodeMeta(r, rr, f, f.decodeMeta)
+}
+
+// DecodeMetaReaderAt is like DecodeMeta, for a source of the given size that
+// can be read at any offset, such as a remote file fetched with HTTP range requests.
+// It reads the start of the stream for the tags and metadata, and only reads
+// the end, as for an ID3v1 tag or the last page of an Ogg stream, where the
+// format needs it, rather than reading everything in between. Formats that
+// have to scan the whole stream, such as an MP3 file with no VBR header,
+// still do.
+func DecodeMetaReaderAt(ra io.ReaderAt, size int64) (Metadata, string, error) {
+	sr := io.NewSectionReader(ra, 0, size)
+	rr := ensureBufioReader(sr)
+
+	f := sniff(rr)
+	if f.decodeMetaReaderAt != nil {
+		m, err := f.decodeMetaReaderAt(ra, size)
+		return m, f.name, err
+	}
+	return decodeMeta(sr, rr, f, f.decodeMeta)
+}
+
+// DecodeMetaQuick is like DecodeMeta, but never reads through the whole file
+// to find the duration. Formats that would need to do so estimate it instead,
+// for example from the file size and nominal bitrate, and the resulting
+// Metadata's DurationExact method (see ExactDurationMetadata) will report
+// false. Formats that don't need a full scan decode the same as DecodeMeta.
+//
+// This is meant for a first pass over a large library, to be followed up with
+// DecodeMeta when precise durations are needed.
+func DecodeMetaQuick(r io.Reader) (Metadata, string, error) {
+	rr := ensureBufioReader(r)
+
+	f := sniff(rr)
+	decode := f.decodeMetaQuick
+	if decode == nil {
+		decode = f.decodeMeta
 	}
-	var (
-		n   int64
-		err error
-	)
-	if seeker, ok := r.(io.Seeker); ok {
-		n, err = seeker.Seek(0, os.SEEK_END)
+	return decodeMeta(r, rr, f, decode)
+}
+
+// Duration sniffs the format of r and finds its duration as cheaply as the
+// format allows, for callers that need nothing else. Formats with a function
+// registered by RegisterDuration use it, which for MP3 means skipping over
+// the tags rather than decoding them. The rest decode their metadata as
+// DecodeMetaQuick does, so the duration may likewise be an estimate.
+func Duration(r io.Reader) (time.Duration, error) {
+	rr := ensureBufioReader(r)
+
+	f := sniff(rr)
+	if f.duration != nil {
+		n, err := fileSize(r, rr)
 		if err != nil {
-			return nil, f.name, err
+			return 0, err
 		}
-		seeker.Seek(0, os.SEEK_SET)
-		rr.Reset(r)
-	} else {
-		// how else can we determine the file size easily?
+		return f.duration(rr, n)
 	}
 
-	m, err := f.decodeMeta(rr, n)
+	decode := f.decodeMetaQuick
+	if decode == nil {
+		decode = f.decodeMeta
+	}
+	m, _, err := decodeMeta(r, rr, f, decode)
+	if err != nil {
+		return 0, err
+	}
+	return m.Duration(), nil
+}
+
+// AudioStream sniffs the format of r and skips the tags and other metadata at
+// the start of it, for callers such as transcoders that want only the audio.
+// It returns a reader positioned at the first byte of audio, along with the
+// name of the format. For MP3 that is the first frame after any ID3v2 tag,
+// for FLAC the first frame after the metadata blocks, and for Ogg formats the
+// first page after the header packets. Anything at the end of the stream,
+// such as an ID3v1 tag, is left in. If the format is unknown or has no
+// function registered by RegisterAudioStream, the error will be ErrFormat.
+func AudioStream(r io.Reader) (io.Reader, string, error) {
+	rr := ensureBufioReader(r)
+
+	f := sniff(rr)
+	if f.skipMetadata == nil {
+		return nil, f.name, ErrFormat
+	}
+	err := f.skipMetadata(rr)
+	if err != nil {
+		return nil, f.name, err
+	}
+	return rr, f.name, nil
+}
+
+func decodeMeta(r io.Reader, rr *bufio.Reader, f format, decode func(io.Reader, int64) (Metadata, error)) (Metadata, string, error) {
+	if decode == nil {
+		return nil, "", ErrFormat
+	}
+	n, err := fileSize(r, rr)
+	if err != nil {
+		return nil, f.name, err
+	}
+
+	// The decoder is given r itself if it can seek, so that it can skip
+	// over the audio rather than read through it.
+	if _, ok := r.(io.Seeker); ok && r != io.Reader(rr) {
+		m, err := decode(r, n)
+		return m, f.name, err
+	}
+	m, err := decode(rr, n)
 	return m, f.name, err
 }
 
+// fileSize finds the size of r if it is an io.Seeker, leaving it and rr, its
+// buffered reader, back at the start. Otherwise it returns 0.
+func fileSize(r io.Reader, rr *bufio.Reader) (int64, error) {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		// how else can we determine the file size easily?
+		return 0, nil
+	}
+	n, err := seeker.Seek(0, os.SEEK_END)
+	if err != nil {
+		return 0, err
+	}
+	seeker.Seek(0, os.SEEK_SET)
+	rr.Reset(r)
+	return n, nil
+}
+
+// DecodeTags sniffs the format of r and decodes its tags. If the file has no
+// tags, the error will be ErrNoTags.
+//
+// r doesn't need to be an io.Seeker, so tags can be read from forward-only
+// streams such as entries in a zip archive. Tags stored at the end of the
+// file, such as ID3v1, are found by reading through the whole stream, unless
+// r is an io.Seeker, in which case they are seeked to.
 func DecodeTags(r io.Reader) (Tags, string, error) {
-	rr := bufio.NewReader(r)
+	rr := ensureBufioReader(r)
 	f := sniff(rr)
 	if f.decodeTags == nil {
 		return nil, "", ErrFormat
 	}
+	// The format's decoder is given r itself if it can seek, rewound from
+	// sniffing, so that it can tell.
+	if seeker, ok := r.(io.Seeker); ok && r != io.Reader(rr) {
+		if _, err := seeker.Seek(0, os.SEEK_SET); err != nil {
+			return nil, f.name, err
+		}
+		m, err := f.decodeTags(r)
+		return m, f.name, err
+	}
 	m, err := f.decodeTags(rr)
 	return m, f.name, err
 }
 
+// DecodeMetaAs decodes the metadata of r as the registered format with the
+// given name, such as one returned by an earlier call to DecodeMeta, without
+// sniffing. If there is no such format, the error will be ErrFormat.
+func DecodeMetaAs(name string, r io.Reader) (Metadata, error) {
+	f, ok := lookup(name)
+	if !ok {
+		return nil, ErrFormat
+	}
+	m, _, err := decodeMeta(r, ensureBufioReader(r), f, f.decodeMeta)
+	return m, err
+}
+
+// DecodeTagsAs decodes the tags of r as the registered format with the given
+// name, without sniffing. If there is no such format, the error will be
+// ErrFormat.
+func DecodeTagsAs(name string, r io.Reader) (Tags, error) {
+	f, ok := lookup(name)
+	if !ok || f.decodeTags == nil {
+		return nil, ErrFormat
+	}
+	return f.decodeTags(r)
+}
+
+// lookup finds a registered format by name.
+func lookup(name string) (format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for _, f := range formats {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return format{}, false
+}
+
+// DecodeMetaBytes is like DecodeMeta, but decodes a file that is already in
+// memory. The size of the file is always known, so formats that estimate
+// duration from the file size, such as CBR MP3, can always do so.
+func DecodeMetaBytes(b []byte) (Metadata, string, error) {
+	return DecodeMeta(bytes.NewReader(b))
+}
+
+// DecodeTagsBytes is like DecodeTags, but decodes a file that is already in
+// memory.
+func DecodeTagsBytes(b []byte) (Tags, string, error) {
+	return DecodeTags(bytes.NewReader(b))
+}
+
+// ensureBufioReader reuses r if it is already buffered, so that callers
+// scanning many files can pass in one *bufio.Reader and Reset it each time
+// instead of paying for a new buffer per file.
+func ensureBufioReader(r io.Reader) *bufio.Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+// Sniff determines the format of r without consuming any of it. It returns
+// the name of the format, such as "FLAC", and a buffered reader positioned at
+// the start of r, which can be passed on to DecodeMetaAs, DecodeTagsAs or the
+// format's own decoder without sniffing again. If r is already a
+// *bufio.Reader, it is returned as is. If no registered format matches, the
+// error will be ErrFormat.
+func Sniff(r io.Reader) (string, *bufio.Reader, error) {
+	rr := ensureBufioReader(r)
+	f := sniff(rr)
+	if f.name == "" {
+		return "", rr, ErrFormat
+	}
+	return f.name, rr, nil
+}
+
 // Match reports whether magic matches b. Magic may contain "?" wildcards.
 func match(magic string, b []byte) bool {
 	if len(magic) != len(b) {
@@ -117,13 +612,23 @@ func match(magic string, b []byte) bool {
 	return true
 }
 
-// Sniff determines the format of r's data.
+// Sniff determines the format of r's data. Every registered format is tried,
+// and if more than one magic matches, the longest (most specific) one wins.
+// Between equally long matches, the first registered wins. A format whose
+// magic is longer than the available data never matches.
 func sniff(r *bufio.Reader) format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	var best format
 	for _, f := range formats {
+		if best.name != "" && len(f.magic) <= len(best.magic) {
+			continue
+		}
 		b, err := r.Peek(len(f.magic))
 		if err == nil && match(f.magic, b) {
-			return f
+			best = f
 		}
 	}
-	return format{}
+	return best
 }
@@ -0,0 +1,176 @@
+package sound
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTags struct{}
+
+func (testTags) Title() string       { return "" }
+func (testTags) AlbumArtist() string { return "" }
+func (testTags) Artist() string      { return "" }
+func (testTags) Album() string       { return "" }
+func (testTags) Genre() string       { return "" }
+func (testTags) Disc() int           { return 0 }
+func (testTags) Track() int          { return 0 }
+func (testTags) Date() time.Time     { return time.Time{} }
+func (testTags) Composer() string    { return "" }
+func (testTags) Notes() string       { return "" }
+
+func decodeTestTags(r io.Reader) (Tags, error) {
+	return testTags{}, nil
+}
+
+func init() {
+	RegisterFormat("test generic", "TEST", nil, decodeTestTags, nil)
+	RegisterFormat("test specific", "TEST????specific", nil, decodeTestTags, nil)
+}
+
+func TestSniffLongestMagic(t *testing.T) {
+	tests := []struct {
+		data string
+		name string
+	}{
+		{"TEST1234specific and then some", "test specific"},
+		{"TEST1234generic and then some", "test generic"},
+		{"TEST", "test generic"},
+		{"TES", ""},
+	}
+
+	for _, test := range tests {
+		f := sniff(bufio.NewReader(bytes.NewReader([]byte(test.data))))
+		if f.name != test.name {
+			t.Errorf("sniff(%q): got %q, expected %q", test.data, f.name, test.name)
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	name, rr, err := Sniff(strings.NewReader("TEST1234specific data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "test specific" {
+		t.Errorf("got %q", name)
+	}
+	if b, _ := io.ReadAll(rr); string(b) != "TEST1234specific data" {
+		t.Errorf("read %q after sniffing", b)
+	}
+
+	if _, _, err := Sniff(strings.NewReader("nothing")); err != ErrFormat {
+		t.Errorf("got %v, expected ErrFormat", err)
+	}
+}
+
+func TestDecodeTagsAs(t *testing.T) {
+	// doesn't match any magic, but the format is given
+	_, err := DecodeTagsAs("test generic", bytes.NewReader([]byte("nothing")))
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = DecodeTagsAs("no such format", bytes.NewReader(benchData))
+	if err != ErrFormat {
+		t.Errorf("expected ErrFormat, got %v", err)
+	}
+}
+
+var benchData = []byte("TEST1234specific and then some")
+
+func BenchmarkDecodeTags(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, err := DecodeTags(bytes.NewReader(benchData))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeTagsReuseBufio(b *testing.B) {
+	var (
+		r  = bytes.NewReader(benchData)
+		br = bufio.NewReader(r)
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(benchData)
+		br.Reset(r)
+		_, _, err := DecodeTags(br)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseCuesheet(t *testing.T) {
+	cue := `REM GENRE Rock
+CATALOG 0123456789012
+FILE "Album Name.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "First Song"
+    PERFORMER "Someone Else"
+    ISRC USABC0000001
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    INDEX 00 04:01:70
+    INDEX 01 04:03:00
+`
+	c, err := ParseCuesheet(strings.NewReader(cue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Catalog != "0123456789012" || len(c.Tracks) != 2 {
+		t.Fatalf("got %+v", c)
+	}
+	first := c.Tracks[0]
+	if first.Title != "First Song" || first.Performer != "Someone Else" || first.ISRC != "USABC0000001" {
+		t.Errorf("got track %+v", first)
+	}
+	if start := c.Tracks[1].Start(); start != 4*time.Minute+3*time.Second {
+		t.Errorf("got start %v", start)
+	}
+
+	_, err = ParseCuesheet(strings.NewReader("TRACK 01 AUDIO\nINDEX 01 1:2\n"))
+	if err != ErrBadCuesheet {
+		t.Errorf("got %v, expected ErrBadCuesheet", err)
+	}
+}
+
+func TestReadSize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	var pngData, jpegData, gifData bytes.Buffer
+	png.Encode(&pngData, img)
+	jpeg.Encode(&jpegData, img, nil)
+	gif.Encode(&gifData, img, nil)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		depth int
+	}{
+		{"PNG", pngData.Bytes(), 32},
+		{"JPEG", jpegData.Bytes(), 24},
+		{"GIF", gifData.Bytes(), 8},
+	}
+	for _, test := range tests {
+		p := Picture{Data: test.data}
+		if !p.ReadSize() || p.Width != 30 || p.Height != 20 || p.ColorDepth != test.depth {
+			t.Errorf("%s: got %dx%d, %d bits", test.name, p.Width, p.Height, p.ColorDepth)
+		}
+	}
+
+	p := Picture{Data: []byte("not an image")}
+	if p.ReadSize() {
+		t.Error("read the size of garbage")
+	}
+}
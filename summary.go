@@ -0,0 +1,76 @@
+package sound
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Summary describes a track in one line, in the form
+//
+//	Artist - Title [Album] (3:45, 320kbps, stereo)
+//
+// Either t or m may be nil, and any part that is missing is left out along
+// with its punctuation. The String methods of the Tags and Metadata types in
+// the format packages use it, so their output is the same everywhere.
+func Summary(t Tags, m Metadata) string {
+	var tags, meta string
+	if t != nil {
+		tags = summarizeTags(t)
+	}
+	if m != nil {
+		meta = summarizeMetadata(m)
+	}
+
+	switch {
+	case tags == "":
+		return meta
+	case meta == "":
+		return tags
+	}
+	return tags + " (" + meta + ")"
+}
+
+func summarizeTags(t Tags) string {
+	var parts []string
+	if s := t.Artist(); s != "" {
+		parts = append(parts, s)
+	}
+	if s := t.Title(); s != "" {
+		parts = append(parts, s)
+	}
+	s := strings.Join(parts, " - ")
+	if album := t.Album(); album != "" {
+		if s != "" {
+			s += " "
+		}
+		s += "[" + album + "]"
+	}
+	return s
+}
+
+func summarizeMetadata(m Metadata) string {
+	parts := []string{formatDuration(m.Duration())}
+	if br := m.BitRate(); br > 0 {
+		parts = append(parts, fmt.Sprintf("%dkbps", (br+500)/1000))
+	}
+	switch n := m.NumChannels(); n {
+	case 0:
+	case 1:
+		parts = append(parts, "mono")
+	case 2:
+		parts = append(parts, "stereo")
+	default:
+		parts = append(parts, fmt.Sprintf("%d channels", n))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatDuration formats d as m:ss, or h:mm:ss if it's an hour or longer.
+func formatDuration(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
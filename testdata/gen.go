@@ -0,0 +1,218 @@
+//go:build ignore
+
+// This program generates the test fixtures in this directory. They are tiny
+// but well-formed files of each format, with silent or empty audio. Run it
+// from this directory with
+//
+//	go run gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+
+	"ktkr.us/pkg/sound/internal/fixture"
+)
+
+func main() {
+	files := map[string][]byte{
+		"id3v22.mp3": join(id3v2(2, "TT2", "Title 2.2", "TP1", "Artist", "TAL", "Album", "TRK", "2/10"), fixture.MakeMP3(40, 128000, 44100)),
+		"id3v23.mp3": join(id3v2(3, "TIT2", "Title 2.3", "TPE1", "Artist", "TALB", "Album", "TRCK", "3/10", "TYER", "2003"), fixture.MakeMP3(40, 128000, 44100), id3v1("v1 title", "v1 artist", "v1 album", "1999", 9)),
+		"id3v24.mp3": join(id3v2(4, "TIT2", "Titre 2.4 ☆", "TPE1", "Artiste", "TALB", "Album", "TRCK", "4", "TDRC", "2004-05-06"), fixture.MakeMP3(40, 128000, 44100)),
+		"id3v1.mp3":  join(fixture.MakeMP3(40, 128000, 44100), id3v1("Title 1.1", "Artist", "Album", "2001", 5)),
+		"vorbis.ogg": fixture.MakeOggVorbis(44100*3, 44100, 2, 128000, "TITLE=Vorbis Title", "ARTIST=Artist", "ALBUM=Album", "TRACKNUMBER=5", "DATE=2005"),
+		"opus.opus":  fixture.MakeOggOpus(48000*2, 2, 312, "TITLE=Opus Title", "ARTIST=Artist", "ALBUM=Album", "TRACKNUMBER=6", "R128_TRACK_GAIN=-512"),
+		"flac.flac":  fixture.MakeFLAC(44100*2, 44100, 2, 16, "TITLE=FLAC Title", "ARTIST=Artist", "ALBUM=Album", "TRACKNUMBER=7", "DATE=2007-01-02"),
+		"wave.wav":   waveFile(),
+		"aiff.aiff":  aiffFile(),
+		"m4a.m4a":    m4aFile(),
+	}
+	for name, b := range files {
+		err := os.WriteFile(name, b, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func join(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func be32(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
+
+func le32(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, n)
+	return b
+}
+
+// id3v2 makes a tag of the given major version from pairs of frame IDs and
+// values. Text is written as ISO-8859-1 if it fits, or else UTF-8 in 2.4 and
+// UTF-16 before that.
+func id3v2(major byte, frames ...string) []byte {
+	var body bytes.Buffer
+	for i := 0; i < len(frames); i += 2 {
+		data := encodeText(major, frames[i+1])
+		size := uint32(len(data))
+		body.WriteString(frames[i])
+		switch major {
+		case 2:
+			body.Write(be32(size)[1:])
+		case 3:
+			body.Write(be32(size))
+			body.Write([]byte{0, 0})
+		case 4:
+			body.Write(be32(synchsafe(size)))
+			body.Write([]byte{0, 0})
+		}
+		body.Write(data)
+	}
+	// some padding, as taggers leave
+	body.Write(make([]byte, 32))
+
+	h := append([]byte{'I', 'D', '3', major, 0, 0}, be32(synchsafe(uint32(body.Len())))...)
+	return join(h, body.Bytes())
+}
+
+func encodeText(major byte, s string) []byte {
+	latin1 := true
+	for _, r := range s {
+		if r > 0xff {
+			latin1 = false
+		}
+	}
+	switch {
+	case latin1:
+		b := []byte{0}
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		return b
+	case major == 4:
+		return append([]byte{3}, s...)
+	default:
+		b := []byte{1, 0xff, 0xfe}
+		for _, r := range s {
+			b = append(b, byte(r), byte(r>>8))
+		}
+		return b
+	}
+}
+
+func synchsafe(n uint32) uint32 {
+	return n&0x7f | (n&0x3f80)<<1 | (n&0x1fc000)<<2 | (n&0xfe00000)<<3
+}
+
+// id3v1 makes an ID3v1.1 tag.
+func id3v1(title, artist, album, year string, track byte) []byte {
+	field := func(s string, n int) []byte {
+		b := make([]byte, n)
+		copy(b, s)
+		return b
+	}
+	return join([]byte("TAG"), field(title, 30), field(artist, 30), field(album, 30),
+		field(year, 4), field("comment", 28), []byte{0, track, 17})
+}
+
+// riffChunk makes a chunk, adding the pad byte after odd sizes.
+func riffChunk(id string, data []byte) []byte {
+	b := join([]byte(id), le32(uint32(len(data))), data)
+	if len(data)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// waveFile is 1 second of 8-bit mono at 8 kHz.
+func waveFile() []byte {
+	var format bytes.Buffer
+	binary.Write(&format, binary.LittleEndian, []uint16{1, 1})
+	format.Write(le32(8000))
+	format.Write(le32(8000))
+	binary.Write(&format, binary.LittleEndian, []uint16{1, 8})
+
+	info := join([]byte("INFO"),
+		riffChunk("INAM", []byte("WAVE Title\x00")),
+		riffChunk("IART", []byte("Artist\x00")),
+		riffChunk("IPRD", []byte("Album\x00")),
+		riffChunk("ITRK", []byte("8\x00")))
+
+	body := join([]byte("WAVE"),
+		riffChunk("fmt ", format.Bytes()),
+		riffChunk("LIST", info),
+		riffChunk("data", bytes.Repeat([]byte{0x80}, 8000)))
+	return join([]byte("RIFF"), le32(uint32(len(body))), body)
+}
+
+// aiffFile is half a second of 16-bit mono at 8 kHz.
+func aiffFile() []byte {
+	chunk := func(id string, data []byte) []byte {
+		b := join([]byte(id), be32(uint32(len(data))), data)
+		if len(data)%2 != 0 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	// 8000 as an 80-bit extended float
+	comm := join([]byte{0, 1}, be32(4000), []byte{0, 16}, []byte{0x40, 0x0b, 0xfa, 0, 0, 0, 0, 0, 0, 0})
+	ssnd := join(be32(0), be32(0), make([]byte, 8000))
+	body := join([]byte("AIFF"), chunk("COMM", comm), chunk("SSND", ssnd))
+	return join([]byte("FORM"), be32(uint32(len(body))), body)
+}
+
+func atom(name string, content ...[]byte) []byte {
+	body := join(content...)
+	return join(be32(uint32(8+len(body))), []byte(name), body)
+}
+
+func fullAtom(name string, content ...[]byte) []byte {
+	return atom(name, append([]byte{0, 0, 0, 0}, join(content...)...))
+}
+
+// m4aFile has an empty AAC track that says it is 2 seconds at 44.1 kHz,
+// stereo.
+func m4aFile() []byte {
+	var entry bytes.Buffer
+	entry.Write(make([]byte, 6))
+	binary.Write(&entry, binary.BigEndian, []uint16{1, 0, 0})
+	entry.Write(be32(0))
+	binary.Write(&entry, binary.BigEndian, []uint16{2, 16, 0, 0})
+	entry.Write(be32(44100 << 16))
+
+	item := func(name string, data []byte) []byte {
+		return atom(name, atom("data", be32(1), be32(0), data))
+	}
+	trkn := []byte{0, 0, 0, 9, 0, 12, 0, 0}
+
+	return join(
+		atom("ftyp", []byte("M4A "), be32(0), []byte("M4A mp42isom")),
+		atom("moov",
+			fullAtom("mvhd", be32(0), be32(0), be32(1000), be32(2000)),
+			atom("trak",
+				fullAtom("tkhd", be32(0), be32(0), be32(1), be32(0), be32(0)),
+				atom("mdia",
+					fullAtom("mdhd", be32(0), be32(0), be32(44100), be32(44100*2), []byte{0x55, 0xc4, 0, 0}),
+					fullAtom("hdlr", be32(0), []byte("soun"), make([]byte, 13)),
+					atom("minf", atom("stbl",
+						fullAtom("stsd", be32(1), atom("mp4a", entry.Bytes())),
+					)),
+				),
+			),
+			atom("udta", fullAtom("meta",
+				fullAtom("hdlr", be32(0), []byte("mdir"), make([]byte, 13)),
+				atom("ilst",
+					item("\xa9nam", []byte("M4A Title")),
+					item("\xa9ART", []byte("Artist")),
+					item("\xa9alb", []byte("Album")),
+					item("trkn", trkn),
+					item("\xa9day", []byte("2009")),
+				),
+			)),
+		),
+	)
+}
@@ -0,0 +1,85 @@
+package vorbis
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"ktkr.us/pkg/sound"
+)
+
+var ErrBadPicture = errors.New("vorbis: malformed picture")
+
+// Pictures decodes the METADATA_BLOCK_PICTURE comments. Those that can't be
+// decoded are skipped.
+func (c Comment) Pictures() []sound.Picture {
+	var pics []sound.Picture
+	for _, s := range c["METADATA_BLOCK_PICTURE"] {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			continue
+		}
+		pic, err := DecodePicture(b)
+		if err != nil {
+			continue
+		}
+		pics = append(pics, *pic)
+	}
+	return pics
+}
+
+// DecodePicture decodes the body of a FLAC PICTURE metadata block, which is
+// also the content of a METADATA_BLOCK_PICTURE comment once its base64 is
+// decoded. Unlike ID3v2, it records the size and color depth of the image.
+func DecodePicture(b []byte) (*sound.Picture, error) {
+	var (
+		r   = bytes.NewReader(b)
+		pic sound.Picture
+		n   uint32
+	)
+	readNumber := func() int {
+		if binary.Read(r, binary.BigEndian, &n) != nil {
+			n = 0
+		}
+		return int(n)
+	}
+	readString := func() ([]byte, error) {
+		size := readNumber()
+		if size > r.Len() {
+			return nil, ErrBadPicture
+		}
+		s := make([]byte, size)
+		_, err := io.ReadFull(r, s)
+		return s, err
+	}
+
+	if r.Len() < 32 {
+		return nil, ErrBadPicture
+	}
+	pic.Type = readNumber()
+	mime, err := readString()
+	if err != nil {
+		return nil, ErrBadPicture
+	}
+	pic.MIMEType = string(mime)
+	desc, err := readString()
+	if err != nil {
+		return nil, ErrBadPicture
+	}
+	pic.Description = string(desc)
+
+	if r.Len() < 20 {
+		return nil, ErrBadPicture
+	}
+	pic.Width = readNumber()
+	pic.Height = readNumber()
+	pic.ColorDepth = readNumber()
+	readNumber() // number of colors in an indexed image
+	pic.Data, err = readString()
+	if err != nil {
+		return nil, ErrBadPicture
+	}
+	return &pic, nil
+}
@@ -1,20 +1,36 @@
 package vorbis
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
-	"log"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/dateutil"
 	"ktkr.us/pkg/sound/ogg"
 )
 
 func init() {
 	sound.RegisterFormat("Ogg Vorbis", "OggS????????????????????????\x01vorbis", Decode, DecodeTags, DecodeMeta)
+	sound.RegisterQuickMeta("Ogg Vorbis", DecodeMetaQuick)
+	sound.RegisterMetaAndTags("Ogg Vorbis", DecodeAll)
+	sound.RegisterMetaReaderAt("Ogg Vorbis", DecodeMetaReaderAt)
+	// the audio starts on the page after the identification, comment and
+	// setup headers
+	sound.RegisterAudioStream("Ogg Vorbis", func(r *bufio.Reader) error {
+		return ogg.SkipHeaders(r, 3)
+	})
+	sound.RegisterCapabilities("Ogg Vorbis", sound.Capabilities{
+		SupportsPictures:   true,
+		SupportsMultiValue: true,
+	})
 }
 
 const (
@@ -26,9 +42,16 @@ const (
 var (
 	ErrMissingFramingBit = errors.New("vorbis: missing framing bit")
 	ErrBadPreamble       = errors.New("vorbis: malformed packet preamble")
-	ErrBadComment        = errors.New("vorbis: malformed comment vector")
+	// ErrBadComment is returned by ReadComment when the number of comments
+	// or the length of one is more than what is left of the stream.
+	ErrBadComment = errors.New("vorbis: malformed comment vector")
 )
 
+// Logger is called with diagnostics about malformed streams before the
+// corresponding error is returned. It does nothing by default; set it to
+// log.Printf or similar to see them.
+var Logger = func(format string, v ...interface{}) {}
+
 /*
 Vorbis I Spec §4.2.2
 1) [vorbis_version]    = read 32 bits as unsigned integer
@@ -55,79 +78,145 @@ type header struct {
 type meta struct {
 	header
 	numSamples int64
+	fsize      int64
 	Comment
+
+	// estimate is the duration estimated from the file size, used instead of
+	// numSamples if estimated is set.
+	estimate  time.Duration
+	estimated bool
 }
 
 func (m *meta) Duration() time.Duration {
+	if m.estimated {
+		return m.estimate
+	}
 	// Avoid overflowing int64 to get milliseconds if we have a really really
 	// long track
 	return time.Millisecond * time.Duration(1e3*float64(m.numSamples)/float64(m.AudioSampleRate))
 }
 
+func (m *meta) String() string {
+	return sound.Summary(m.Comment, m)
+}
+
+func (m *meta) DurationExact() bool {
+	return !m.estimated
+}
+
 func (m *meta) NumChannels() int {
 	return int(m.AudioChannels)
 }
 
+// BitRate returns the nominal bitrate from the identification header. If that
+// isn't set, it falls back to the middle of the minimum and maximum bitrates,
+// and then to the average over the whole file if its size and exact duration
+// are known.
 func (m *meta) BitRate() int {
-	if m.BitrateNominal == 0 {
-		// approximate using file size and duration
-		return 0
+	if br := m.headerBitRate(); br > 0 {
+		return br
+	}
+	if !m.estimated && m.fsize > 0 && m.numSamples > 0 && m.AudioSampleRate > 0 {
+		return int(m.fsize * 8 * int64(m.AudioSampleRate) / m.numSamples)
 	}
-	return int(m.BitrateNominal)
+	return 0
 }
 
+// headerBitRate returns the bitrate hinted at by the identification header,
+// or 0 if it doesn't say. Values of 0 or less mean unset.
+func (m *meta) headerBitRate() int {
+	h := m.header
+	if h.BitrateNominal > 0 {
+		return int(h.BitrateNominal)
+	}
+	if h.BitrateMinimum > 0 && h.BitrateMaximum > 0 {
+		return int(h.BitrateMaximum/2 + h.BitrateMinimum/2)
+	}
+	return 0
+}
+
+// BitrateMin, BitrateMax and BitrateNominal return the bitrate fields of the
+// identification header as written, which may be 0 or negative if unset.
+func (m *meta) BitrateMin() int     { return int(m.header.BitrateMinimum) }
+func (m *meta) BitrateMax() int     { return int(m.header.BitrateMaximum) }
+func (m *meta) BitrateNominal() int { return int(m.header.BitrateNominal) }
+
 func (m *meta) SampleRate() int {
 	return int(m.AudioSampleRate)
 }
 
+func (m *meta) TotalSamples() int64 {
+	return m.numSamples
+}
+
 func Decode(rr io.Reader) (sound.Sound, error) {
 	return nil, nil
 }
 
+// Tags is the comment header of a Vorbis stream, along with the
+// identification header that comes before it.
+type Tags struct {
+	Comment
+	header
+	vendor string
+}
+
+func (t *Tags) SampleRate() int  { return int(t.AudioSampleRate) }
+func (t *Tags) NumChannels() int { return int(t.AudioChannels) }
+
+// Vendor returns the vendor string of the comment header, which names the
+// library that wrote it, such as "Xiph.Org libVorbis I 20200704 (Reducing
+// Environment)". It is set by the encoder, unlike the ENCODER comment, which
+// tools may add or change.
+func (t *Tags) Vendor() string { return t.vendor }
+
+// DecodeTags decodes the comment header. The underlying type of the
+// sound.Tags returned will be (*Tags).
 func DecodeTags(rr io.Reader) (sound.Tags, error) {
 	r := ogg.NewReader(rr)
-	r.NextPage()
-	r.NextPage()
-
-	err := readPacketPreamble(r, commentPreamble)
+	h, vendor, comment, err := readHeaders(r)
 	if err != nil {
-		return nil, errors.New("malformed Vorbis Comment preamble")
+		return nil, err
 	}
-	_, comment, err := ReadComment(r)
-	return comment, err
+	return &Tags{comment, h, vendor}, nil
 }
 
 func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
-	r := ogg.NewReader(rr)
-	err := readPacketPreamble(r, idPreamble)
+	m, _, err := decodeAll(rr, fsize)
 	if err != nil {
 		return nil, err
 	}
+	return m, nil
+}
 
-	var h header
-	err = binary.Read(r, binary.LittleEndian, &h)
+// DecodeAll decodes the metadata and the tags together, reading the header
+// pages only once, where DecodeMeta and DecodeTags would each read them. The
+// underlying types of the sound.Metadata and sound.Tags returned are the same
+// as for DecodeMeta and DecodeTags.
+func DecodeAll(rr io.Reader, fsize int64) (sound.Metadata, sound.Tags, error) {
+	m, t, err := decodeAll(rr, fsize)
 	if err != nil {
-		return nil, err
-	}
-
-	if h.FramingBit != 1 {
-		return nil, ErrMissingFramingBit
+		return nil, nil, err
 	}
+	return m, t, nil
+}
 
-	err = readPacketPreamble(r, commentPreamble)
+func decodeAll(rr io.Reader, fsize int64) (*meta, *Tags, error) {
+	r := ogg.NewReader(rr)
+	h, vendor, comment, err := readHeaders(r)
 	if err != nil {
-		return nil, errors.New("malformed Vorbis Comment preamble")
-	}
-	_, comment, err := ReadComment(r)
-	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var page, lastPage *ogg.Page
 	for {
 		page, err = r.NextPage()
+		if err == ogg.ErrTruncatedPage {
+			// go by the last complete page
+			break
+		}
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if page == nil {
@@ -137,7 +226,162 @@ func DecodeMeta(rr io.Reader, fsize int64) (sound.Metadata, error) {
 		lastPage = page
 	}
 
-	return &meta{h, lastPage.GranulePos, comment}, nil
+	m := &meta{header: h, fsize: fsize, Comment: comment}
+	if lastPage == nil || lastPage.GranulePos < 0 {
+		// no page had a usable granule position (-1 means no packet
+		// finished on the page)
+		m.estimateDuration(fsize)
+	} else {
+		m.numSamples = lastPage.GranulePos
+	}
+	return m, &Tags{comment, h, vendor}, nil
+}
+
+// DecodeMetaReaderAt is like DecodeMeta, but reads the last page by going
+// back from the end of ra, which is size bytes long, instead of reading
+// through the whole stream.
+func DecodeMetaReaderAt(ra io.ReaderAt, size int64) (sound.Metadata, error) {
+	var (
+		h       header
+		comment Comment
+	)
+	pos, err := ogg.ReadHeadersAt(ra, size, func(r *ogg.Reader) (err error) {
+		h, _, comment, err = readHeaders(r)
+		return err
+	})
+	if err != nil && err != ogg.ErrNoGranulePos {
+		return nil, err
+	}
+
+	m := &meta{header: h, fsize: size, Comment: comment}
+	if err == ogg.ErrNoGranulePos || pos < 0 {
+		m.estimateDuration(size)
+		return m, nil
+	}
+	m.numSamples = pos
+	return m, nil
+}
+
+// DecodeMetaQuick is like DecodeMeta, but instead of reading to the last page
+// for the exact number of samples, it estimates the duration from the file
+// size and the bitrate given in the header. If either is unknown, the duration is 0.
+func DecodeMetaQuick(rr io.Reader, fsize int64) (sound.Metadata, error) {
+	r := ogg.NewReader(rr)
+	h, _, comment, err := readHeaders(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &meta{header: h, fsize: fsize, Comment: comment}
+	m.estimateDuration(fsize)
+	return m, nil
+}
+
+// estimateDuration estimates the duration from the file size and the bitrate
+// given in the header.
+func (m *meta) estimateDuration(fsize int64) {
+	m.estimated = true
+	if br := m.headerBitRate(); br > 0 && fsize > 0 {
+		secs := float64(fsize) * 8 / float64(br)
+		m.estimate = time.Duration(secs * float64(time.Second))
+	}
+}
+
+// PageIndex maps the granule positions of the pages of a Vorbis stream, which
+// count samples, to where the pages are.
+type PageIndex struct {
+	SampleRate int
+	Pages      []ogg.PageEntry
+}
+
+// BuildPageIndex reads the identification header for the sample rate, and
+// then scans the page headers of the whole stream without decoding any audio.
+func BuildPageIndex(r io.ReadSeeker) (*PageIndex, error) {
+	start, err := r.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return nil, err
+	}
+
+	or := ogg.NewReader(r)
+	err = readPacketPreamble(or, idPreamble)
+	if err != nil {
+		return nil, err
+	}
+	var h header
+	err = binary.Read(or, binary.LittleEndian, &h)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ogg reader buffers ahead, so start over from the first page
+	_, err = r.Seek(start, os.SEEK_SET)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := ogg.ScanPages(r)
+	if err != nil {
+		return nil, err
+	}
+	return &PageIndex{int(h.AudioSampleRate), pages}, nil
+}
+
+// Seek returns the offset of the last page that ends before the sample at d,
+// from which decoding can start to reach d. If d is before the end of the
+// first page, it returns the offset of the first page.
+func (x *PageIndex) Seek(d time.Duration) int64 {
+	if len(x.Pages) == 0 {
+		return 0
+	}
+	target := int64(d.Seconds() * float64(x.SampleRate))
+	i := sort.Search(len(x.Pages), func(i int) bool {
+		return x.Pages[i].GranulePos >= target
+	})
+	if i == 0 {
+		return x.Pages[0].Offset
+	}
+	return x.Pages[i-1].Offset
+}
+
+// readHeaders reads the identification and comment headers.
+func readHeaders(r *ogg.Reader) (header, string, Comment, error) {
+	var h header
+
+	err := readPacketPreamble(r, idPreamble)
+	if err != nil {
+		return h, "", nil, err
+	}
+
+	err = binary.Read(r, binary.LittleEndian, &h)
+	if err != nil {
+		return h, "", nil, err
+	}
+
+	if h.FramingBit != 1 {
+		return h, "", nil, ErrMissingFramingBit
+	}
+
+	// The identification header is alone on the first page, so the comment
+	// header is the first packet of the next. It is read whole so that
+	// ReadComment knows how much it holds.
+	_, err = r.NextPage()
+	if err != nil {
+		return h, "", nil, err
+	}
+	packet, err := r.NextPacket()
+	if err != nil {
+		return h, "", nil, err
+	}
+	pr := bytes.NewReader(packet)
+	err = readPacketPreamble(pr, commentPreamble)
+	if err != nil {
+		return h, "", nil, err
+	}
+	vendor, comment, err := ReadComment(pr)
+	if err != nil {
+		return h, "", nil, err
+	}
+
+	return h, vendor, comment, nil
 }
 
 func decode(r io.Reader) (sound.Sound, error) {
@@ -148,6 +392,18 @@ func decodeMeta(r io.Reader) (sound.Metadata, error) {
 	panic("aaa")
 }
 
+// maxCommentHint caps the number of comments that ReadComment makes room for
+// up front, since the count in the stream can't be trusted.
+const maxCommentHint = 64
+
+// ReadComment reads a comment vector, returning the vendor string and the
+// comments. Comments without an "=" are skipped, after being passed to
+// Logger, so that one bad entry from a buggy tagger doesn't lose the rest.
+//
+// Since the counts and lengths in the vector come from the stream, memory is
+// only set aside for as much as there is to read. If r reports how much is
+// left, as *bytes.Reader and *io.LimitedReader do, counts and lengths that
+// it couldn't hold are an error up front.
 func ReadComment(r io.Reader) (string, Comment, error) {
 	vendor, err := readString(r)
 	if err != nil {
@@ -160,7 +416,17 @@ func ReadComment(r io.Reader) (string, Comment, error) {
 		return "", nil, err
 	}
 
-	c := make(Comment, numComments)
+	// each comment takes at least 4 bytes for its length
+	if n, ok := remaining(r); ok && int64(numComments) > n/4 {
+		Logger("vorbis: %d comments can't fit in the %d bytes left", numComments, n)
+		return "", nil, ErrBadComment
+	}
+
+	hint := numComments
+	if hint > maxCommentHint {
+		hint = maxCommentHint
+	}
+	c := make(Comment, hint)
 
 	for i := uint32(0); i < numComments; i++ {
 		comment, err := readString(r)
@@ -170,14 +436,10 @@ func ReadComment(r io.Reader) (string, Comment, error) {
 
 		parts := strings.SplitN(comment, "=", 2)
 		if len(parts) < 2 {
-			return "", nil, ErrBadComment
-		}
-		key := strings.ToUpper(parts[0])
-
-		// again, we're gonna skip album art for now
-		if key == "METADATA_BLOCK_PICTURE" {
+			Logger("vorbis: skipping comment %d with no '=': %q", i, comment)
 			continue
 		}
+		key := strings.ToUpper(parts[0])
 		val := parts[1]
 
 		if _, ok := c[key]; ok {
@@ -197,30 +459,70 @@ func readPacketPreamble(r io.Reader, preamble string) error {
 		return err
 	}
 	if string(buf) != preamble {
-		log.Printf("%q", string(buf))
+		Logger("vorbis: expected packet preamble %q, got %q", preamble, buf)
 		return ErrBadPreamble
 	}
 	return nil
 }
 
+// maxStringAlloc is the longest string readString allocates for all at once.
+// Longer ones, such as pictures in comments, grow as they are read, so that a
+// bogus length can't make it allocate more than the stream holds.
+const maxStringAlloc = 1 << 20
+
 func readString(r io.Reader) (string, error) {
 	var length uint32
 	err := binary.Read(r, binary.LittleEndian, &length)
 	if err != nil {
 		return "", err
 	}
+	if n, ok := remaining(r); ok && int64(length) > n {
+		Logger("vorbis: string of %d bytes can't fit in the %d bytes left", length, n)
+		return "", ErrBadComment
+	}
 
-	s := make([]byte, length)
-	_, err = io.ReadFull(r, s)
+	if length <= maxStringAlloc {
+		s := make([]byte, length)
+		_, err = io.ReadFull(r, s)
+		if err != nil {
+			return "", err
+		}
+		return string(s), nil
+	}
+
+	var b strings.Builder
+	n, err := io.CopyN(&b, r, int64(length))
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
 	if err != nil {
 		return "", err
 	}
+	return b.String(), nil
+}
 
-	return string(s), nil
+// remaining returns the number of bytes left in r, if it is a kind of reader
+// that knows.
+func remaining(r io.Reader) (int64, bool) {
+	switch r := r.(type) {
+	case *io.LimitedReader:
+		return r.N, true
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	}
+	return 0, false
 }
 
+// Comment maps the upper case field names of a comment header to their
+// values. A field may be given more than once, as with a track that has
+// several artists, so each maps to all of its values in order.
+//
+// The methods of sound.Tags return only the first value of a field, so that
+// a field reads the same whichever method it's asked for through. Use GetAll
+// for all of the values joined together, or index the map for each of them.
 type Comment map[string][]string
 
+// Get returns the first value of a field, or "" if it isn't set.
 func (c Comment) Get(key string) string {
 	val := c[key]
 	if val != nil && len(val) > 0 {
@@ -229,6 +531,8 @@ func (c Comment) Get(key string) string {
 	return ""
 }
 
+// GetAll returns all of the values of a field joined by ", ", or "" if it
+// isn't set.
 func (c Comment) GetAll(key string) string {
 	val, ok := c[key]
 	if ok {
@@ -237,20 +541,74 @@ func (c Comment) GetAll(key string) string {
 	return ""
 }
 
-var dateFormats = []string{
-	"2006-01-02",
-	"2006-01",
-	"2006",
+// Keys returns the field names of the comments.
+func (c Comment) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MusicBrainz returns the MUSICBRAINZ_* comments, such as
+// MUSICBRAINZ_TRACKID and MUSICBRAINZ_ALBUMID.
+func (c Comment) MusicBrainz() map[string]string { return c.prefixed("MUSICBRAINZ_") }
+
+// Discogs returns the DISCOGS_* comments, such as DISCOGS_RELEASE_ID.
+func (c Comment) Discogs() map[string]string { return c.prefixed("DISCOGS_") }
+
+func (c Comment) SortTitle() string       { return c.Get("TITLESORT") }
+func (c Comment) SortArtist() string      { return c.Get("ARTISTSORT") }
+func (c Comment) SortAlbumArtist() string { return c.Get("ALBUMARTISTSORT") }
+func (c Comment) SortAlbum() string       { return c.Get("ALBUMSORT") }
+func (c Comment) SortComposer() string    { return c.Get("COMPOSERSORT") }
+
+// Subtitle returns the SUBTITLE comment.
+func (c Comment) Subtitle() string { return c.Get("SUBTITLE") }
+
+// SetSubtitle returns the DISCSUBTITLE comment, which names the disc of a set
+// that the track is on.
+func (c Comment) SetSubtitle() string { return c.Get("DISCSUBTITLE") }
+
+// prefixed returns the first value of each comment whose key starts with
+// prefix, or nil if there are none.
+func (c Comment) prefixed(prefix string) map[string]string {
+	var m map[string]string
+	for key := range c {
+		if strings.HasPrefix(key, prefix) {
+			if m == nil {
+				m = make(map[string]string)
+			}
+			m[key] = c.Get(key)
+		}
+	}
+	return m
 }
 
-func (c Comment) Title() string       { return c.GetAll("TITLE") }
-func (c Comment) AlbumArtist() string { return c.GetAll("ALBUMARTIST") }
-func (c Comment) Artist() string      { return c.GetAll("ARTIST") }
-func (c Comment) Album() string       { return c.GetAll("ALBUM") }
-func (c Comment) Genre() string       { return c.GetAll("GENRE") }
-func (c Comment) Composer() string    { return c.GetAll("COMPOSER") }
+func (c Comment) String() string      { return sound.Summary(c, nil) }
+func (c Comment) TagFormat() string   { return "VorbisComment" }
+func (c Comment) Title() string       { return c.Get("TITLE") }
+func (c Comment) AlbumArtist() string { return c.Get("ALBUMARTIST") }
+func (c Comment) Artist() string      { return c.Get("ARTIST") }
+func (c Comment) Album() string       { return c.Get("ALBUM") }
+func (c Comment) Genre() string       { return c.Get("GENRE") }
+func (c Comment) Composer() string    { return c.Get("COMPOSER") }
 func (c Comment) Notes() string       { return c.Get("DESCRIPTION") }
 
+// EncoderSettings returns the ENCODER comment, which tools such as FFmpeg
+// set to the software that encoded the file. The vendor string of the
+// comment header is kept separately, by the Tags of each format.
+func (c Comment) EncoderSettings() string { return c.Get("ENCODER") }
+
+// EncodingTime always returns the zero time, as there is no conventional
+// comment for it.
+func (c Comment) EncodingTime() time.Time { return time.Time{} }
+
+func (c Comment) Artists() []string   { return c["ARTIST"] }
+func (c Comment) Genres() []string    { return c["GENRE"] }
+func (c Comment) Composers() []string { return c["COMPOSER"] }
+
 func (c Comment) Disc() int {
 	n, _ := strconv.Atoi(c.Get("DISCNUMBER"))
 	return n
@@ -261,14 +619,13 @@ func (c Comment) Track() int {
 	return n
 }
 
+// Date returns the DATE comment, or failing that ORIGINALDATE or YEAR, which
+// some taggers write instead. Partial dates, such as just a year, are allowed.
 func (c Comment) Date() time.Time {
-	s := c.Get("DATE")
-	for _, dateFormat := range dateFormats {
-		t, err := time.Parse(dateFormat, s)
-		if err != nil {
-			continue
+	for _, key := range []string{"DATE", "ORIGINALDATE", "YEAR"} {
+		if t, ok := dateutil.Parse(c.Get(key)); ok {
+			return t
 		}
-		return t
 	}
 	return time.Time{}
 }
@@ -0,0 +1,188 @@
+package vorbis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+	"ktkr.us/pkg/sound/internal/fixture"
+)
+
+func TestPageIndex(t *testing.T) {
+	var id bytes.Buffer
+	id.WriteString(idPreamble)
+	binary.Write(&id, binary.LittleEndian, header{AudioChannels: 2, AudioSampleRate: 1000, FramingBit: 1})
+
+	pages := []string{
+		fixture.OggPage(0, id.String()),
+		fixture.OggPage(0, "comments and setup"),
+		fixture.OggPage(1000, "audio"),
+		fixture.OggPage(-1, "audio continued"),
+		fixture.OggPage(3000, "audio"),
+		fixture.OggPage(4000, "audio"),
+	}
+	var offsets []int64
+	var file string
+	for _, p := range pages {
+		offsets = append(offsets, int64(len(file)))
+		file += p
+	}
+	// a truncated page at the end is ignored
+	file += pages[5][:10]
+
+	x, err := BuildPageIndex(bytes.NewReader([]byte(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.SampleRate != 1000 || len(x.Pages) != 5 {
+		t.Fatalf("got %+v", x)
+	}
+
+	tests := []struct {
+		d      time.Duration
+		offset int64
+	}{
+		{0, offsets[0]},
+		{500 * time.Millisecond, offsets[1]},
+		{1500 * time.Millisecond, offsets[2]},
+		{3 * time.Second, offsets[2]},
+		{3500 * time.Millisecond, offsets[4]},
+		{time.Hour, offsets[5]},
+	}
+	for _, test := range tests {
+		if offset := x.Seek(test.d); offset != test.offset {
+			t.Errorf("%v: got %d, expected %d", test.d, offset, test.offset)
+		}
+	}
+}
+
+func TestTruncatedLastPage(t *testing.T) {
+	var id bytes.Buffer
+	id.WriteString(idPreamble)
+	binary.Write(&id, binary.LittleEndian, header{AudioChannels: 2, AudioSampleRate: 1000, FramingBit: 1})
+
+	last := fixture.OggPage(5000, "audio")
+	file := fixture.OggPage(0, id.String()) +
+		fixture.OggPage(0, commentPreamble+"\x00\x00\x00\x00\x00\x00\x00\x00\x01") +
+		fixture.OggPage(3000, "audio") +
+		last[:len(last)-2]
+
+	m, err := DecodeMeta(bytes.NewReader([]byte(file)), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := m.Duration(); d != 3*time.Second {
+		t.Errorf("got %v, expected 3s", d)
+	}
+}
+
+func TestMultipleValues(t *testing.T) {
+	c := Comment{
+		"TITLE":       {"title"},
+		"ARTIST":      {"first", "second"},
+		"DESCRIPTION": {"one", "two"},
+	}
+	if c.Artist() != "first" || c.Notes() != "one" || c.Title() != "title" {
+		t.Errorf("got artist %q, notes %q, title %q", c.Artist(), c.Notes(), c.Title())
+	}
+	if s := c.GetAll("ARTIST"); s != "first, second" {
+		t.Errorf("got all artists %q", s)
+	}
+	if c.Get("ALBUM") != "" || c.GetAll("ALBUM") != "" {
+		t.Error("got a value for a missing field")
+	}
+	if a := c.Artists(); len(a) != 2 || a[1] != "second" || c.Genres() != nil {
+		t.Errorf("got artists %q, genres %q", a, c.Genres())
+	}
+}
+
+func TestSubtitles(t *testing.T) {
+	var st sound.SubtitleTags = Comment{"SUBTITLE": {"Live take"}, "DISCSUBTITLE": {"B-Sides"}}
+	if st.Subtitle() != "Live take" || st.SetSubtitle() != "B-Sides" {
+		t.Errorf("got %q, %q", st.Subtitle(), st.SetSubtitle())
+	}
+}
+
+func TestDate(t *testing.T) {
+	tests := []struct {
+		c    Comment
+		date time.Time
+	}{
+		{Comment{"DATE": {"2005-06-07"}}, time.Date(2005, 6, 7, 0, 0, 0, 0, time.UTC)},
+		{Comment{"DATE": {"2005/06/07"}}, time.Date(2005, 6, 7, 0, 0, 0, 0, time.UTC)},
+		{Comment{"DATE": {"2005.06.07"}}, time.Date(2005, 6, 7, 0, 0, 0, 0, time.UTC)},
+		{Comment{"DATE": {"2005-06-07T08:09:10"}}, time.Date(2005, 6, 7, 8, 9, 10, 0, time.UTC)},
+		{Comment{"DATE": {"2005"}}, time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Comment{"ORIGINALDATE": {"1999-12"}}, time.Date(1999, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{Comment{"YEAR": {"1999"}}, time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// DATE wins
+		{Comment{"DATE": {"2005"}, "YEAR": {"1999"}}, time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Comment{"DATE": {"someday"}}, time.Time{}},
+	}
+	for _, test := range tests {
+		if d := test.c.Date(); !d.Equal(test.date) {
+			t.Errorf("%q: got %v, expected %v", test.c, d, test.date)
+		}
+	}
+}
+
+func TestBadComment(t *testing.T) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	binary.Write(&b, binary.LittleEndian, uint32(3))
+	for _, c := range []string{"TITLE=Title", "no equals sign", "ARTIST=Artist"} {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+
+	_, c, err := ReadComment(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Title() != "Title" || c.Artist() != "Artist" || len(c) != 2 {
+		t.Errorf("got %q", c)
+	}
+}
+
+func TestCommentBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		vector string
+	}{
+		{"count", "\x00\x00\x00\x00\xff\xff\xff\xff\x03\x00\x00\x00A=b"},
+		{"vendor", "\xff\xff\xff\xffvendor"},
+		{"comment", "\x00\x00\x00\x00\x01\x00\x00\x00\xff\xff\xff\x7fA=b"},
+	}
+	for _, test := range tests {
+		_, _, err := ReadComment(strings.NewReader(test.vector))
+		if err != ErrBadComment {
+			t.Errorf("%s: got %v, expected ErrBadComment", test.name, err)
+		}
+		// without knowing how much is left, it gets as far as the end
+		_, _, err = ReadComment(struct{ io.Reader }{strings.NewReader(test.vector)})
+		if err != io.ErrUnexpectedEOF && err != io.EOF {
+			t.Errorf("%s: got %v, expected an EOF", test.name, err)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	defer func(l func(string, ...interface{})) { Logger = l }(Logger)
+	var logged []string
+	Logger = func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}
+
+	err := readPacketPreamble(strings.NewReader("\x01flac!!"), idPreamble)
+	if err != ErrBadPreamble {
+		t.Errorf("got error %v, expected %v", err, ErrBadPreamble)
+	}
+	if len(logged) != 1 {
+		t.Errorf("logged %q", logged)
+	}
+}
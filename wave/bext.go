@@ -0,0 +1,117 @@
+package wave
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// bext is the fixed-size part of the Broadcast Wave Extension chunk, as
+// specified in EBU Tech 3285. The coding history follows it and takes up the
+// rest of the chunk.
+type bext struct {
+	Description          [256]byte
+	Originator           [32]byte
+	OriginatorReference  [32]byte
+	OriginationDate      [10]byte
+	OriginationTime      [8]byte
+	TimeReferenceLow     uint32
+	TimeReferenceHigh    uint32
+	Version              uint16
+	UMID                 [64]byte
+	LoudnessValue        int16
+	LoudnessRange        int16
+	MaxTruePeakLevel     int16
+	MaxMomentaryLoudness int16
+	MaxShortTermLoudness int16
+	Reserved             [180]byte
+}
+
+// BroadcastInfo is the contents of a Broadcast Wave "bext" chunk.
+type BroadcastInfo struct {
+	Description         string
+	Originator          string
+	OriginatorReference string
+	// OriginationDate and OriginationTime are kept as written, in the forms
+	// "yyyy-mm-dd" and "hh:mm:ss".
+	OriginationDate string
+	OriginationTime string
+	// TimeReference is the position of the first sample in the file, counted
+	// in samples since midnight.
+	TimeReference uint64
+	Version       int
+	UMID          [64]byte
+	CodingHistory string
+}
+
+// Origination parses the origination date and time. The EBU spec allows any
+// separator between the fields, so only the digit positions are relied on.
+func (b *BroadcastInfo) Origination() (time.Time, bool) {
+	d, t := []byte(b.OriginationDate), []byte(b.OriginationTime)
+	if len(d) != 10 || len(t) != 8 {
+		return time.Time{}, false
+	}
+	d[4], d[7] = '-', '-'
+	t[2], t[5] = ':', ':'
+	tm, err := time.Parse("2006-01-02 15:04:05", string(d)+" "+string(t))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return tm, true
+}
+
+// Timecode converts the time reference to a time of day given the sample
+// rate of the file.
+func (b *BroadcastInfo) Timecode(sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	secs := b.TimeReference / uint64(sampleRate)
+	rem := b.TimeReference % uint64(sampleRate)
+	return time.Duration(secs)*time.Second + time.Duration(rem)*time.Second/time.Duration(sampleRate)
+}
+
+// BroadcastMetadata is implemented by metadata that may carry a Broadcast
+// Wave bext chunk.
+type BroadcastMetadata interface {
+	BroadcastInfo() (*BroadcastInfo, bool)
+}
+
+// BroadcastInfo returns the contents of the bext chunk, if there was one.
+func (m *Metadata) BroadcastInfo() (*BroadcastInfo, bool) {
+	return m.bext, m.bext != nil
+}
+
+// Timecode returns the time of day of the first sample according to the bext
+// chunk, or 0 if there isn't one.
+func (m *Metadata) Timecode() time.Duration {
+	if m.bext == nil {
+		return 0
+	}
+	return m.bext.Timecode(int(m.Format.SampleRate))
+}
+
+func readBroadcastInfo(r io.Reader) (*BroadcastInfo, error) {
+	var b bext
+	err := binary.Read(r, binary.LittleEndian, &b)
+	if err != nil {
+		return nil, err
+	}
+	history, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BroadcastInfo{
+		Description:         trimString(b.Description[:]),
+		Originator:          trimString(b.Originator[:]),
+		OriginatorReference: trimString(b.OriginatorReference[:]),
+		OriginationDate:     trimString(b.OriginationDate[:]),
+		OriginationTime:     trimString(b.OriginationTime[:]),
+		TimeReference:       uint64(b.TimeReferenceHigh)<<32 | uint64(b.TimeReferenceLow),
+		Version:             int(b.Version),
+		UMID:                b.UMID,
+		CodingHistory:       trimString(history),
+	}, nil
+}
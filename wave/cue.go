@@ -0,0 +1,137 @@
+package wave
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+type cuePoint struct {
+	ID           uint32
+	Position     uint32
+	DataChunkID  [4]byte
+	ChunkStart   uint32
+	BlockStart   uint32
+	SampleOffset uint32
+}
+
+type ltxt struct {
+	CuePointID   uint32
+	SampleLength uint32
+	Purpose      [4]byte
+	Country      uint16
+	Language     uint16
+	Dialect      uint16
+	CodePage     uint16
+}
+
+// Marker is a cue point from the "cue " chunk, along with any labels attached
+// to it in the associated data list.
+type Marker struct {
+	ID           uint32
+	SampleOffset uint32
+	Label        string
+	Note         string
+	// Length is the length of the region in samples beginning at the cue
+	// point, or 0 if the marker is a single point.
+	Length uint32
+}
+
+// Markers returns the cue points in the file ordered by sample offset.
+func (m *Metadata) Markers() []Marker {
+	return m.markers
+}
+
+func readCue(r io.Reader) ([]cuePoint, error) {
+	var n uint32
+	err := binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return nil, err
+	}
+
+	var cues []cuePoint
+	for i := uint32(0); i < n; i++ {
+		var c cuePoint
+		err = binary.Read(r, binary.LittleEndian, &c)
+		if err != nil {
+			return nil, err
+		}
+		cues = append(cues, c)
+	}
+	return cues, nil
+}
+
+// readAssociatedData reads the subchunks of a LIST adtl chunk into markers,
+// keyed by cue point ID. r is the body of the LIST chunk.
+func readAssociatedData(r *io.LimitedReader, markers map[uint32]*Marker) error {
+	get := func(id uint32) *Marker {
+		mk, ok := markers[id]
+		if !ok {
+			mk = &Marker{ID: id}
+			markers[id] = mk
+		}
+		return mk
+	}
+
+	for {
+		var ch chunkHeader
+		err := binary.Read(r, binary.LittleEndian, &ch)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		size := int64(ch.Size) + int64(ch.Size%2)
+		if size > r.N {
+			return ErrBadChunk
+		}
+		buf := make([]byte, size)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return err
+		}
+		if len(buf) < 4 {
+			continue
+		}
+		id := binary.LittleEndian.Uint32(buf)
+
+		switch string(ch.ID[:]) {
+		case "labl":
+			get(id).Label = trimString(buf[4:])
+
+		case "note":
+			get(id).Note = trimString(buf[4:])
+
+		case "ltxt":
+			const size = 20
+			if len(buf) < size {
+				continue
+			}
+			mk := get(id)
+			mk.Length = binary.LittleEndian.Uint32(buf[4:])
+			if mk.Label == "" {
+				mk.Label = trimString(buf[size:])
+			}
+		}
+	}
+}
+
+func makeMarkers(cues []cuePoint, labels map[uint32]*Marker) []Marker {
+	if len(cues) == 0 {
+		return nil
+	}
+	markers := make([]Marker, len(cues))
+	for i, c := range cues {
+		if mk, ok := labels[c.ID]; ok {
+			markers[i] = *mk
+		}
+		markers[i].ID = c.ID
+		markers[i].SampleOffset = c.SampleOffset
+	}
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].SampleOffset < markers[j].SampleOffset
+	})
+	return markers
+}
@@ -0,0 +1,89 @@
+package wave
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+var ErrNoIXML = errors.New("wave: no iXML chunk")
+
+// BWFMetadata is the commonly used part of an iXML chunk, as written by field
+// recorders and used in film and TV post-production. Vendors add their own
+// elements, so the raw XML is also available from Metadata.IXML.
+type BWFMetadata struct {
+	Version string `xml:"IXML_VERSION"`
+	Project string `xml:"PROJECT"`
+	Scene   string `xml:"SCENE"`
+	Take    string `xml:"TAKE"`
+	Tape    string `xml:"TAPE"`
+	Note    string `xml:"NOTE"`
+	FileUID string `xml:"FILE_UID"`
+	// Circled is "TRUE" if the take was marked as a good one.
+	Circled string `xml:"CIRCLED"`
+
+	Speed struct {
+		// TimecodeRate is a fraction such as "25/1" or "30000/1001".
+		TimecodeRate string `xml:"TIMECODE_RATE"`
+		// TimecodeFlag is "DF" for drop frame or "NDF" for non drop frame.
+		TimecodeFlag   string `xml:"TIMECODE_FLAG"`
+		FileSampleRate int    `xml:"FILE_SAMPLE_RATE"`
+		// The time of the first sample in samples since midnight, split
+		// into two 32-bit halves.
+		TimestampHigh uint32 `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI"`
+		TimestampLow  uint32 `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO"`
+	} `xml:"SPEED"`
+
+	Tracks []IXMLTrack `xml:"TRACK_LIST>TRACK"`
+}
+
+// IXMLTrack describes one channel of the file.
+type IXMLTrack struct {
+	ChannelIndex    int    `xml:"CHANNEL_INDEX"`
+	InterleaveIndex int    `xml:"INTERLEAVE_INDEX"`
+	Name            string `xml:"NAME"`
+	Function        string `xml:"FUNCTION"`
+}
+
+// IsCircled reports whether the take was circled.
+func (b *BWFMetadata) IsCircled() bool {
+	return strings.EqualFold(strings.TrimSpace(b.Circled), "TRUE")
+}
+
+// TimeReference returns the time of the first sample in samples since
+// midnight.
+func (b *BWFMetadata) TimeReference() uint64 {
+	return uint64(b.Speed.TimestampHigh)<<32 | uint64(b.Speed.TimestampLow)
+}
+
+// IXML returns the XML of the iXML chunk as written, or "" if there isn't one.
+func (m *Metadata) IXML() string { return m.ixml }
+
+// AXML returns the XML of the Broadcast Wave axml chunk, usually EBU Core
+// metadata, or "" if there isn't one.
+func (m *Metadata) AXML() string { return m.axml }
+
+// BWFMetadata parses the iXML chunk. If there isn't one, it returns
+// ErrNoIXML.
+func (m *Metadata) BWFMetadata() (*BWFMetadata, error) {
+	if m.ixml == "" {
+		return nil, ErrNoIXML
+	}
+	var b BWFMetadata
+	err := xml.Unmarshal([]byte(m.ixml), &b)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// readXML reads an XML chunk, which may be padded with nulls.
+func readXML(r io.Reader) (string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(trimString(b)), nil
+}
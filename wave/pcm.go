@@ -0,0 +1,167 @@
+package wave
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+var ErrUnsupported = errors.New("wave: unsupported audio format")
+
+// Reader reads the samples from the data chunk of a WAVE file. Integer PCM of
+// 8 to 32 bits and 32- or 64-bit floating point are supported.
+type Reader struct {
+	Format
+
+	r             *io.LimitedReader
+	format        uint16
+	bytesPerValue int
+	buf           []byte
+}
+
+func newReader(rr io.Reader) (*Reader, error) {
+	r := ensureBufioReader(rr)
+
+	_, err := readRIFFHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wr         Reader
+		haveFormat bool
+		sizes      map[string]int64
+	)
+	for {
+		var ch chunkHeader
+		err = binary.Read(r, binary.LittleEndian, &ch)
+		if err != nil {
+			return nil, err
+		}
+
+		size, known := chunkSize(ch, sizes)
+		body := &io.LimitedReader{R: r, N: size}
+
+		switch string(ch.ID[:]) {
+		case "ds64":
+			sizes, err = readDS64(body)
+			if err != nil {
+				return nil, err
+			}
+
+		case "fmt ":
+			err = wr.readFormat(body)
+			if err != nil {
+				return nil, err
+			}
+			haveFormat = true
+
+		case "data":
+			if !haveFormat {
+				return nil, ErrNoFormat
+			}
+			if !known {
+				// read to the end of the stream
+				body.N = math.MaxInt64
+			}
+			wr.r = body
+			return &wr, nil
+		}
+
+		// skip whatever wasn't read, plus the pad byte for odd sizes
+		if size%2 != 0 {
+			body.N++
+		}
+		_, err = io.Copy(ioutil.Discard, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *Reader) readFormat(body io.Reader) error {
+	err := binary.Read(body, binary.LittleEndian, &r.Format)
+	if err != nil {
+		return err
+	}
+
+	r.format = r.AudioFormat
+	if r.format == formatExtensible {
+		// the real format is the first two bytes of the subformat GUID,
+		// after the extension size, valid bits and channel mask
+		var ext struct {
+			Size         uint16
+			ValidBits    uint16
+			ChannelMask  uint32
+			SubFormat    uint16
+			SubFormatEnd [14]byte
+		}
+		err = binary.Read(body, binary.LittleEndian, &ext)
+		if err != nil {
+			return err
+		}
+		r.format = ext.SubFormat
+	}
+
+	r.bytesPerValue = (int(r.BitsPerSample) + 7) / 8
+	switch {
+	case r.format == formatPCM && r.bytesPerValue >= 1 && r.bytesPerValue <= 4:
+	case r.format == formatFloat && (r.bytesPerValue == 4 || r.bytesPerValue == 8):
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func (r *Reader) SampleRate() int { return int(r.Format.SampleRate) }
+func (r *Reader) Channels() int   { return int(r.NumChannels) }
+
+// Read reads up to len(p) samples from the data chunk, converting them to
+// floating point.
+func (r *Reader) Read(p []float32) (int, error) {
+	size := len(p) * r.bytesPerValue
+	if cap(r.buf) < size {
+		r.buf = make([]byte, size)
+	}
+	buf := r.buf[:size]
+
+	m, err := io.ReadFull(r.r, buf)
+	n := m / r.bytesPerValue
+	if err == io.ErrUnexpectedEOF && n > 0 {
+		// a partial sample at the end is dropped
+		err = nil
+	}
+
+	for i := 0; i < n; i++ {
+		p[i] = r.value(buf[i*r.bytesPerValue:])
+	}
+	if n == 0 && err == nil && len(p) > 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// value converts one little endian sample.
+func (r *Reader) value(b []byte) float32 {
+	if r.format == formatFloat {
+		if r.bytesPerValue == 4 {
+			return math.Float32frombits(binary.LittleEndian.Uint32(b))
+		}
+		return float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	}
+
+	switch r.bytesPerValue {
+	case 1:
+		// 8-bit samples are unsigned
+		return float32(int(b[0])-128) / (1 << 7)
+	case 2:
+		return float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 3:
+		v := int32(b[0])<<8 | int32(b[1])<<16 | int32(b[2])<<24
+		return float32(v>>8) / (1 << 23)
+	default:
+		return float32(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
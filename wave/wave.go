@@ -0,0 +1,420 @@
+// Package wave implements reading of metadata from RIFF WAVE files.
+//
+// A WAVE file is a RIFF container: a "RIFF" header followed by a sequence of
+// chunks, each with a 4-byte ID, a 32-bit little endian size, and the data,
+// padded to an even number of bytes. The "fmt " chunk describes the audio and
+// the "data" chunk holds it. Other chunks carry tags and production metadata.
+//
+// RF64 and BW64 files, which may be bigger than 4 GiB, have "RF64" or "BW64"
+// in place of "RIFF", and a "ds64" chunk first with the 64-bit sizes of the
+// chunks whose 32-bit sizes are set to 0xFFFFFFFF.
+package wave
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"ktkr.us/pkg/sound"
+)
+
+const (
+	Magic     = "RIFF????WAVE"
+	MagicRF64 = "RF64????WAVE"
+	MagicBW64 = "BW64????WAVE"
+)
+
+func init() {
+	for _, magic := range []string{Magic, MagicRF64, MagicBW64} {
+		sound.RegisterFormat("WAVE", magic, Decode, DecodeTags, DecodeMeta)
+	}
+}
+
+var (
+	ErrBadHeader = errors.New("wave: malformed RIFF header")
+	ErrNoFormat  = errors.New("wave: missing fmt chunk")
+	// ErrBadChunk is returned when a subchunk of a LIST chunk is bigger
+	// than what is left of the LIST.
+	ErrBadChunk = errors.New("wave: subchunk extends past the end of its LIST")
+)
+
+type chunkHeader struct {
+	ID   [4]byte
+	Size uint32
+}
+
+type riffHeader struct {
+	Magic [4]byte
+	Size  uint32
+	Form  [4]byte
+}
+
+// readRIFFHeader reads the header of a RIFF, RF64 or BW64 file.
+func readRIFFHeader(r io.Reader) (riffHeader, error) {
+	var h riffHeader
+	err := binary.Read(r, binary.LittleEndian, &h)
+	if err != nil {
+		return h, errors.Wrap(err, "read RIFF header")
+	}
+	switch string(h.Magic[:]) {
+	case "RIFF", "RF64", "BW64":
+	default:
+		return h, ErrBadHeader
+	}
+	if string(h.Form[:]) != "WAVE" {
+		return h, ErrBadHeader
+	}
+	return h, nil
+}
+
+// sizeUnknown is the size of a chunk whose real size is in the ds64 chunk, or
+// of a data chunk being streamed whose size wasn't known when it was written.
+const sizeUnknown = 0xFFFFFFFF
+
+// ds64 is the fixed part of the "ds64" chunk. It is followed by a table of
+// the sizes of any other chunks that need 64 bits.
+type ds64 struct {
+	RIFFSize    uint64
+	DataSize    uint64
+	SampleCount uint64
+	TableLength uint32
+}
+
+// readDS64 reads the ds64 chunk into a map of the 64-bit chunk sizes by ID.
+func readDS64(r io.Reader) (map[string]int64, error) {
+	var d ds64
+	err := binary.Read(r, binary.LittleEndian, &d)
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{"data": int64(d.DataSize)}
+	for i := uint32(0); i < d.TableLength; i++ {
+		var entry struct {
+			ID   [4]byte
+			Size uint64
+		}
+		err = binary.Read(r, binary.LittleEndian, &entry)
+		if err != nil {
+			return nil, err
+		}
+		sizes[string(entry.ID[:])] = int64(entry.Size)
+	}
+	return sizes, nil
+}
+
+// chunkSize returns the size of a chunk, taken from sizes, which was read from
+// the ds64 chunk, if its header says to look there. It reports false if the
+// size is unknown.
+func chunkSize(ch chunkHeader, sizes map[string]int64) (int64, bool) {
+	if ch.Size != sizeUnknown {
+		return int64(ch.Size), true
+	}
+	n, ok := sizes[string(ch.ID[:])]
+	return n, ok
+}
+
+// audio formats in the fmt chunk
+const (
+	formatPCM        = 0x0001
+	formatFloat      = 0x0003
+	formatExtensible = 0xfffe
+)
+
+// Format is the contents of the "fmt " chunk.
+type Format struct {
+	AudioFormat   uint16
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// Metadata is the information gathered from all of the chunks in a WAVE file.
+type Metadata struct {
+	Format
+	DataSize int64
+	// DataSizeFromFile is whether DataSize was worked out from the size of
+	// the file, because the data chunk's own size was unknown or too big to
+	// fit in it. It may then take in anything after the audio.
+	DataSizeFromFile bool
+
+	bext    *BroadcastInfo
+	markers []Marker
+	ixml    string
+	axml    string
+
+	Info
+}
+
+func (m *Metadata) Duration() time.Duration {
+	if m.ByteRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(m.DataSize) / float64(m.ByteRate) * float64(time.Second))
+}
+
+func (m *Metadata) NumChannels() int { return int(m.Format.NumChannels) }
+func (m *Metadata) BitRate() int     { return int(m.ByteRate) * 8 }
+func (m *Metadata) SampleRate() int  { return int(m.Format.SampleRate) }
+
+func (m *Metadata) String() string { return sound.Summary(m.Info, m) }
+
+func (m *Metadata) DurationExact() bool { return !m.DataSizeFromFile }
+
+// Lossless reports whether the audio is uncompressed PCM.
+func (m *Metadata) Lossless() bool {
+	switch m.AudioFormat {
+	case formatPCM, formatFloat, formatExtensible:
+		return true
+	}
+	return false
+}
+
+func (m *Metadata) TotalSamples() int64 {
+	if m.BlockAlign == 0 {
+		return 0
+	}
+	return m.DataSize / int64(m.BlockAlign)
+}
+
+// Decode reads up to the start of the audio data. The underlying type of the
+// sound.Sound returned will be (*Reader), which is a sound.AudioReader.
+func Decode(r io.Reader) (sound.Sound, error) {
+	return newReader(r)
+}
+
+// DecodeTags decodes the LIST INFO chunk. If there isn't one, it returns
+// sound.ErrNoTags.
+func DecodeTags(r io.Reader) (sound.Tags, error) {
+	m, err := decode(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if m.Info == nil {
+		return nil, sound.ErrNoTags
+	}
+	return m.Info, nil
+}
+
+// DecodeMeta decodes the format information and any other known chunks. The
+// underlying type of the sound.Metadata returned will be (*Metadata).
+//
+// If the data chunk's size is 0xFFFFFFFF, as when it was streamed, and there
+// is no ds64 chunk to give the real one, or if the size has overflowed 32
+// bits in a file bigger than 4 GiB, the size of the audio is taken to be the
+// rest of the file, if fsize is known.
+func DecodeMeta(r io.Reader, fsize int64) (sound.Metadata, error) {
+	m, err := decode(r, fsize)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func decode(rr io.Reader, fsize int64) (*Metadata, error) {
+	r := ensureBufioReader(rr)
+
+	_, err := readRIFFHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		m          Metadata
+		haveFormat bool
+		cues       []cuePoint
+		labels     = make(map[uint32]*Marker)
+		sizes      map[string]int64
+		// offset is the position of the current chunk's body
+		offset int64 = 12
+	)
+
+chunks:
+	for {
+		var ch chunkHeader
+		err = binary.Read(r, binary.LittleEndian, &ch)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "read chunk header")
+		}
+		offset += 8
+
+		size, known := chunkSize(ch, sizes)
+		body := &io.LimitedReader{R: r, N: size}
+
+		switch string(ch.ID[:]) {
+		case "ds64":
+			sizes, err = readDS64(body)
+
+		case "fmt ":
+			err = binary.Read(body, binary.LittleEndian, &m.Format)
+			haveFormat = true
+
+		case "data":
+			m.DataSize = size
+			rest := fsize - offset
+			if !known {
+				// the audio runs to the end of the file
+				if fsize > 0 {
+					m.DataSize = rest
+				}
+				m.DataSizeFromFile = true
+				break chunks
+			}
+			if fsize > 0 && rest > size && (rest-size)%(1<<32) == 0 {
+				// the size wrapped around
+				m.DataSize = rest
+				m.DataSizeFromFile = true
+				size = rest
+				body.N = rest
+			}
+
+		case "bext":
+			m.bext, err = readBroadcastInfo(body)
+
+		case "cue ":
+			cues, err = readCue(body)
+
+		case "iXML":
+			m.ixml, err = readXML(body)
+
+		case "axml":
+			m.axml, err = readXML(body)
+
+		case "LIST":
+			err = readList(body, &m, labels)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// skip whatever wasn't read, plus the pad byte for odd sizes
+		if size%2 != 0 {
+			body.N++
+		}
+		_, err = io.Copy(ioutil.Discard, body)
+		if err != nil {
+			return nil, err
+		}
+		// body.N is left over only if the file ended early
+		offset += size + size%2 - body.N
+	}
+
+	if !haveFormat {
+		return nil, ErrNoFormat
+	}
+	m.markers = makeMarkers(cues, labels)
+
+	return &m, nil
+}
+
+func readList(r *io.LimitedReader, m *Metadata, labels map[uint32]*Marker) error {
+	var listType [4]byte
+	_, err := io.ReadFull(r, listType[:])
+	if err != nil {
+		return err
+	}
+
+	switch string(listType[:]) {
+	case "INFO":
+		m.Info, err = readInfo(r)
+	case "adtl":
+		err = readAssociatedData(r, labels)
+	}
+	return err
+}
+
+func ensureBufioReader(r io.Reader) *bufio.Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+// trimString cuts a fixed-size or null-terminated string field at the first
+// null byte.
+func trimString(b []byte) string {
+	s := string(b)
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// Info holds the tags from a LIST INFO chunk, keyed by subchunk ID such as
+// "INAM" or "IART".
+type Info map[string]string
+
+// readInfo reads the subchunks of a LIST INFO chunk, whose body is r.
+func readInfo(r *io.LimitedReader) (Info, error) {
+	info := make(Info)
+	for {
+		var ch chunkHeader
+		err := binary.Read(r, binary.LittleEndian, &ch)
+		if err != nil {
+			if err == io.EOF {
+				return info, nil
+			}
+			return nil, err
+		}
+
+		// strings are padded like any other chunk
+		size := int64(ch.Size) + int64(ch.Size%2)
+		if size > r.N {
+			return nil, ErrBadChunk
+		}
+		buf := make([]byte, size)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return nil, err
+		}
+		info[string(ch.ID[:])] = trimString(buf)
+	}
+}
+
+// Keys returns the IDs of the INFO subchunks.
+func (i Info) Keys() []string {
+	keys := make([]string, 0, len(i))
+	for k := range i {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (i Info) String() string      { return sound.Summary(i, nil) }
+func (i Info) TagFormat() string   { return "RIFF INFO" }
+func (i Info) Title() string       { return i["INAM"] }
+func (i Info) AlbumArtist() string { return i["IART"] }
+func (i Info) Artist() string      { return i["IART"] }
+func (i Info) Album() string       { return i["IPRD"] }
+func (i Info) Genre() string       { return i["IGNR"] }
+func (i Info) Disc() int           { return 0 }
+func (i Info) Composer() string    { return i["IMUS"] }
+func (i Info) Notes() string       { return i["ICMT"] }
+
+func (i Info) Track() int {
+	n, _ := strconv.Atoi(i["ITRK"])
+	return n
+}
+
+func (i Info) Date() time.Time {
+	s := i["ICRD"]
+	for _, layout := range []string{"2006-01-02", "2006"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
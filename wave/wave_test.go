@@ -0,0 +1,349 @@
+package wave
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"ktkr.us/pkg/sound"
+)
+
+type testChunk struct {
+	id   string
+	data []byte
+}
+
+func makeWave(chunks ...testChunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	for _, c := range chunks {
+		body.WriteString(c.id)
+		binary.Write(&body, binary.LittleEndian, uint32(len(c.data)))
+		body.Write(c.data)
+		if len(c.data)%2 != 0 {
+			body.WriteByte(0)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(body.Len()))
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+func fmtChunk(channels, rate, bits int) testChunk {
+	var b bytes.Buffer
+	align := channels * bits / 8
+	binary.Write(&b, binary.LittleEndian, Format{
+		AudioFormat:   1,
+		NumChannels:   uint16(channels),
+		SampleRate:    uint32(rate),
+		ByteRate:      uint32(rate * align),
+		BlockAlign:    uint16(align),
+		BitsPerSample: uint16(bits),
+	})
+	return testChunk{"fmt ", b.Bytes()}
+}
+
+func TestDecodeMeta(t *testing.T) {
+	var b bext
+	copy(b.Description[:], "a description")
+	copy(b.Originator[:], "originator")
+	copy(b.OriginationDate[:], "2016-03-04")
+	copy(b.OriginationTime[:], "05-06-07")
+	b.TimeReferenceLow = 48000 * 3600
+	var bb bytes.Buffer
+	binary.Write(&bb, binary.LittleEndian, &b)
+	bb.WriteString("A=PCM,F=48000,W=16,M=stereo\r\n")
+
+	info := []byte("INFOINAM\x06\x00\x00\x00title\x00")
+
+	data := makeWave(
+		fmtChunk(2, 48000, 16),
+		testChunk{"bext", bb.Bytes()},
+		testChunk{"data", make([]byte, 48000*4*2)},
+		testChunk{"LIST", info},
+	)
+
+	mm, err := DecodeMeta(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mm.(*Metadata)
+
+	if d := m.Duration(); d != 2*time.Second {
+		t.Errorf("duration: got %v", d)
+	}
+	if m.Title() != "title" {
+		t.Errorf("title: got %q", m.Title())
+	}
+
+	bi, ok := m.BroadcastInfo()
+	if !ok {
+		t.Fatal("no bext chunk")
+	}
+	if bi.Description != "a description" || bi.Originator != "originator" {
+		t.Errorf("got %+v", bi)
+	}
+	if bi.CodingHistory != "A=PCM,F=48000,W=16,M=stereo\r\n" {
+		t.Errorf("coding history: got %q", bi.CodingHistory)
+	}
+	if tc := m.Timecode(); tc != time.Hour {
+		t.Errorf("timecode: got %v", tc)
+	}
+	tm, ok := bi.Origination()
+	if !ok || !tm.Equal(time.Date(2016, 3, 4, 5, 6, 7, 0, time.UTC)) {
+		t.Errorf("origination: got %v", tm)
+	}
+}
+
+func TestBadInfo(t *testing.T) {
+	// a string claiming nearly 4 GiB in a LIST of a few bytes
+	info := []byte("INFOINAM\xfe\xff\xff\xfftitle\x00")
+	data := makeWave(fmtChunk(1, 8000, 8), testChunk{"LIST", info})
+
+	_, err := DecodeMeta(bytes.NewReader(data), int64(len(data)))
+	if err != ErrBadChunk {
+		t.Errorf("got %v, expected ErrBadChunk", err)
+	}
+}
+
+func TestMarkers(t *testing.T) {
+	var cue bytes.Buffer
+	binary.Write(&cue, binary.LittleEndian, uint32(2))
+	binary.Write(&cue, binary.LittleEndian, cuePoint{ID: 1, DataChunkID: [4]byte{'d', 'a', 't', 'a'}, SampleOffset: 4000})
+	binary.Write(&cue, binary.LittleEndian, cuePoint{ID: 2, DataChunkID: [4]byte{'d', 'a', 't', 'a'}, SampleOffset: 1000})
+
+	adtl := []byte("adtl" +
+		"labl\x08\x00\x00\x00\x01\x00\x00\x00end\x00" +
+		"labl\x0a\x00\x00\x00\x02\x00\x00\x00start\x00" +
+		"ltxt\x14\x00\x00\x00\x02\x00\x00\x00\xe8\x03\x00\x00rgn \x00\x00\x00\x00\x00\x00\x00\x00")
+
+	data := makeWave(
+		fmtChunk(1, 8000, 8),
+		testChunk{"data", make([]byte, 8000)},
+		testChunk{"cue ", cue.Bytes()},
+		testChunk{"LIST", adtl},
+	)
+
+	mm, err := DecodeMeta(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Marker{
+		{ID: 2, SampleOffset: 1000, Label: "start", Length: 1000},
+		{ID: 1, SampleOffset: 4000, Label: "end"},
+	}
+	markers := mm.(*Metadata).Markers()
+	if len(markers) != len(expected) {
+		t.Fatalf("got %d markers, expected %d", len(markers), len(expected))
+	}
+	for i := range expected {
+		if markers[i] != expected[i] {
+			t.Errorf("marker %d: got %+v, expected %+v", i, markers[i], expected[i])
+		}
+	}
+}
+
+func TestBadAssociatedData(t *testing.T) {
+	// a label claiming nearly 4 GiB in a LIST of a few bytes
+	adtl := []byte("adtllabl\xfe\xff\xff\xff\x01\x00\x00\x00end\x00")
+	data := makeWave(fmtChunk(1, 8000, 8), testChunk{"LIST", adtl})
+
+	_, err := DecodeMeta(bytes.NewReader(data), int64(len(data)))
+	if err != ErrBadChunk {
+		t.Errorf("got %v, expected ErrBadChunk", err)
+	}
+}
+
+func TestDecodePCM(t *testing.T) {
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, []int16{0, -32768, 16384, 32767, -16384})
+
+	file := makeWave(
+		fmtChunk(1, 8000, 16),
+		testChunk{"junk", []byte{1, 2, 3}},
+		testChunk{"data", data.Bytes()},
+	)
+	s, err := Decode(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := s.(sound.AudioReader)
+	if !ok {
+		t.Fatalf("%T is not a sound.AudioReader", s)
+	}
+	if r.SampleRate() != 8000 || r.Channels() != 1 {
+		t.Errorf("got %d Hz, %d channels", r.SampleRate(), r.Channels())
+	}
+
+	var (
+		expected = []float32{0, -1, 0.5, 32767.0 / 32768, -0.5}
+		samples  []float32
+		p        = make([]float32, 2)
+	)
+	for {
+		n, err := r.Read(p)
+		samples = append(samples, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(samples) != len(expected) {
+		t.Fatalf("got %v, expected %v", samples, expected)
+	}
+	for i := range expected {
+		if samples[i] != expected[i] {
+			t.Errorf("got %v, expected %v", samples, expected)
+			break
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	m := &Metadata{
+		Format:   Format{NumChannels: 2, ByteRate: 40000},
+		DataSize: 40000 * 225,
+		Info:     Info{"IART": "Artist", "INAM": "Title", "IPRD": "Album"},
+	}
+	expected := "Artist - Title [Album] (3:45, 320kbps, stereo)"
+	if s := m.String(); s != expected {
+		t.Errorf("got %q, expected %q", s, expected)
+	}
+
+	m.Info = nil
+	m.Format.NumChannels = 1
+	m.DataSize *= 20
+	if s := m.String(); s != "1:15:00, 320kbps, mono" {
+		t.Errorf("without tags: got %q", s)
+	}
+}
+
+func TestIXML(t *testing.T) {
+	ixml := `<?xml version="1.0" encoding="UTF-8"?>
+<BWFXML>
+	<IXML_VERSION>1.61</IXML_VERSION>
+	<PROJECT>Feature</PROJECT>
+	<SCENE>12A</SCENE>
+	<TAKE>3</TAKE>
+	<CIRCLED>TRUE</CIRCLED>
+	<SPEED>
+		<TIMECODE_RATE>24000/1001</TIMECODE_RATE>
+		<TIMECODE_FLAG>NDF</TIMECODE_FLAG>
+		<TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>1</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>
+		<TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>2</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>
+	</SPEED>
+	<TRACK_LIST>
+		<TRACK_COUNT>2</TRACK_COUNT>
+		<TRACK><CHANNEL_INDEX>1</CHANNEL_INDEX><NAME>Boom</NAME></TRACK>
+		<TRACK><CHANNEL_INDEX>2</CHANNEL_INDEX><NAME>Lav</NAME></TRACK>
+	</TRACK_LIST>
+	<VENDOR_THING>kept in the raw XML</VENDOR_THING>
+</BWFXML>`
+
+	file := makeWave(
+		fmtChunk(2, 48000, 24),
+		testChunk{"iXML", []byte(ixml + "\x00\x00")},
+		testChunk{"axml", []byte("<ebuCoreMain/>")},
+		testChunk{"data", nil},
+	)
+	meta, err := DecodeMeta(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := meta.(*Metadata)
+	if m.IXML() != ixml || m.AXML() != "<ebuCoreMain/>" {
+		t.Errorf("got iXML %q, axml %q", m.IXML(), m.AXML())
+	}
+
+	b, err := m.BWFMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Project != "Feature" || b.Scene != "12A" || b.Take != "3" || !b.IsCircled() {
+		t.Errorf("got %+v", b)
+	}
+	if b.Speed.TimecodeRate != "24000/1001" || b.TimeReference() != 1<<32|2 {
+		t.Errorf("got speed %+v", b.Speed)
+	}
+	if len(b.Tracks) != 2 || b.Tracks[1].ChannelIndex != 2 || b.Tracks[1].Name != "Lav" {
+		t.Errorf("got tracks %+v", b.Tracks)
+	}
+}
+
+func TestUnknownDataSize(t *testing.T) {
+	for _, chunks := range [][]testChunk{
+		{fmtChunk(1, 8000, 16)},
+		// the offset of the data has to take the other chunks into account
+		{fmtChunk(1, 8000, 16), {"JUNK", make([]byte, 28)}, {"odd ", []byte{1}}},
+	} {
+		data := makeWave(append(chunks, testChunk{"data", make([]byte, 16000)})...)
+		// set the data chunk's size as a streaming writer would
+		binary.LittleEndian.PutUint32(data[len(data)-16000-4:], 0xFFFFFFFF)
+
+		mm, err := DecodeMeta(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := mm.(*Metadata)
+		if m.DataSize != 16000 || m.DurationExact() {
+			t.Errorf("%d chunks before data: got size %d, exact %t", len(chunks), m.DataSize, m.DurationExact())
+		}
+		if d := m.Duration(); d != time.Second {
+			t.Errorf("%d chunks before data: duration: got %v", len(chunks), d)
+		}
+	}
+}
+
+func TestRF64(t *testing.T) {
+	var ds bytes.Buffer
+	binary.Write(&ds, binary.LittleEndian, ds64{DataSize: 16000, SampleCount: 8000})
+	data := makeWave(
+		testChunk{"ds64", ds.Bytes()},
+		fmtChunk(1, 8000, 16),
+		testChunk{"data", make([]byte, 16000)},
+		testChunk{"junk", []byte{1, 2, 3, 4}},
+	)
+	copy(data, "RF64")
+	binary.LittleEndian.PutUint32(data[4:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(data[len(data)-12-16000-4:], 0xFFFFFFFF)
+
+	mm, err := DecodeMeta(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mm.(*Metadata)
+	if m.DataSize != 16000 || !m.DurationExact() {
+		t.Errorf("got size %d, exact %t", m.DataSize, m.DurationExact())
+	}
+
+	s, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		r = s.(sound.AudioReader)
+		p = make([]float32, 1000)
+		n int
+	)
+	for {
+		k, err := r.Read(p)
+		n += k
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n != 8000 {
+		t.Errorf("read %d samples", n)
+	}
+}
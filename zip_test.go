@@ -0,0 +1,88 @@
+package sound_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"ktkr.us/pkg/sound"
+	_ "ktkr.us/pkg/sound/flac"
+	_ "ktkr.us/pkg/sound/mp3"
+	_ "ktkr.us/pkg/sound/wave"
+)
+
+func padded(s string, n int) string {
+	return s + strings.Repeat("\x00", n-len(s))
+}
+
+var zipFiles = map[string]string{
+	// frame sync, more than one read buffer of audio, then an ID3v1 tag
+	"id3v1.mp3": "\xff\xfb\x90\x00" + strings.Repeat("\x55", 100001) +
+		"TAG" + padded("mp3 title", 30) + padded("artist", 30) + padded("album", 30) +
+		"2001" + padded("", 29) + "\x01\x00",
+
+	"id3v2.mp3": "ID3\x03\x00\x00\x00\x00\x00\x10" + "TIT2\x00\x00\x00\x06\x00\x00\x00id3v2" +
+		"\xff\xfb\x90\x00" + strings.Repeat("\x00", 1000),
+
+	"test.flac": "fLaC" +
+		"\x00\x00\x00\x22" + strings.Repeat("\x00", 34) +
+		"\x84\x00\x00\x18\x00\x00\x00\x00\x01\x00\x00\x00\x0c\x00\x00\x00TITLE=flac!!",
+
+	"test.wav": "RIFF\x00\x00\x00\x00WAVE" +
+		"fmt \x10\x00\x00\x00\x01\x00\x02\x00\x44\xac\x00\x00\x10\xb1\x02\x00\x04\x00\x10\x00" +
+		"LIST\x12\x00\x00\x00INFOINAM\x06\x00\x00\x00wave!\x00" +
+		"data\x04\x00\x00\x00\x00\x00\x00\x00",
+}
+
+func TestDecodeTagsZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range zipFiles {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"id3v1.mp3": "mp3 title",
+		"id3v2.mp3": "id3v2",
+		"test.flac": "flac!!",
+		"test.wav":  "wave!",
+	}
+
+	for _, f := range zr.File {
+		// once as is, and once with reads coming up short
+		for _, wrap := range []func(io.Reader) io.Reader{nil, iotest.OneByteReader} {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var r io.Reader = rc
+			if wrap != nil {
+				r = wrap(r)
+			}
+			tags, _, err := sound.DecodeTags(r)
+			rc.Close()
+			if err != nil {
+				t.Errorf("%s: %v", f.Name, err)
+				continue
+			}
+			if tags.Title() != expected[f.Name] {
+				t.Errorf("%s: got title %q, expected %q", f.Name, tags.Title(), expected[f.Name])
+			}
+		}
+	}
+}